@@ -134,14 +134,15 @@ const (
 )
 
 const (
-	RoleGuestUser  = 0
-	RoleCommonUser = 1
-	RoleAdminUser  = 10
-	RoleRootUser   = 100
+	RoleGuestUser    = 0
+	RoleCommonUser   = 1
+	RoleResellerUser = 5 // 分销商，可创建并管理自己的子用户
+	RoleAdminUser    = 10
+	RoleRootUser     = 100
 )
 
 func IsValidateRole(role int) bool {
-	return role == RoleGuestUser || role == RoleCommonUser || role == RoleAdminUser || role == RoleRootUser
+	return role == RoleGuestUser || role == RoleCommonUser || role == RoleResellerUser || role == RoleAdminUser || role == RoleRootUser
 }
 
 var (
@@ -201,7 +202,43 @@ const (
 )
 
 const (
-	TopUpStatusPending = "pending"
-	TopUpStatusSuccess = "success"
-	TopUpStatusExpired = "expired"
+	TopUpStatusPending  = "pending"
+	TopUpStatusSuccess  = "success"
+	TopUpStatusExpired  = "expired"
+	TopUpStatusRefunded = "refunded"
+)
+
+const (
+	AffiliateCommissionStatusPending  = "pending"  // 结算期内，暂不可划转
+	AffiliateCommissionStatusSettled  = "settled"  // 已结算，计入邀请额度
+	AffiliateCommissionStatusReversed = "reversed" // 充值退款，佣金已冲正
+)
+
+const (
+	UserBillingModePrepaid  = "prepaid"  // 预付费，额度用尽（含信用额度）即停止服务
+	UserBillingModePostpaid = "postpaid" // 后付费，按月出账单结算
+)
+
+const (
+	WebhookSubscriptionStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	WebhookSubscriptionStatusDisabled = 2 // also don't use 0
+)
+
+const (
+	WebhookDeliveryStatusPending = "pending"
+	WebhookDeliveryStatusSuccess = "success"
+	WebhookDeliveryStatusFailed  = "failed"
+)
+
+const (
+	TaskCallbackStatusPending = "pending"
+	TaskCallbackStatusSuccess = "success"
+	TaskCallbackStatusFailed  = "failed"
+)
+
+const (
+	InvoiceStatusDraft  = "draft"
+	InvoiceStatusIssued = "issued"
+	InvoiceStatusPaid   = "paid"
+	InvoiceStatusVoid   = "void"
 )
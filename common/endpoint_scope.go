@@ -0,0 +1,92 @@
+package common
+
+import "strings"
+
+// 令牌可访问的接口范围，令牌未配置范围时不限制
+const (
+	EndpointScopeChat        = "chat"        // /v1/chat/completions、/v1/completions、/v1/edits
+	EndpointScopeResponses   = "responses"   // /v1/responses
+	EndpointScopeMessages    = "messages"    // Claude /v1/messages
+	EndpointScopeGemini      = "gemini"      // Gemini generateContent 等原生接口
+	EndpointScopeEmbeddings  = "embeddings"  // OpenAI 与 Gemini 的向量接口
+	EndpointScopeRerank      = "rerank"      // /v1/rerank
+	EndpointScopeModerations = "moderations" // /v1/moderations
+	EndpointScopeImages      = "images"      // /v1/images/*
+	EndpointScopeAudio       = "audio"       // /v1/audio/*
+	EndpointScopeRealtime    = "realtime"    // /v1/realtime
+	EndpointScopeVideo       = "video"       // 视频生成与查询，含 Kling、即梦
+	EndpointScopeMidjourney  = "midjourney"  // /mj/*
+	EndpointScopeSuno        = "suno"        // /suno/*
+)
+
+var AllEndpointScopes = []string{
+	EndpointScopeChat,
+	EndpointScopeResponses,
+	EndpointScopeMessages,
+	EndpointScopeGemini,
+	EndpointScopeEmbeddings,
+	EndpointScopeRerank,
+	EndpointScopeModerations,
+	EndpointScopeImages,
+	EndpointScopeAudio,
+	EndpointScopeRealtime,
+	EndpointScopeVideo,
+	EndpointScopeMidjourney,
+	EndpointScopeSuno,
+}
+
+func IsValidEndpointScope(scope string) bool {
+	for _, s := range AllEndpointScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// EndpointScopeOfPath 返回请求路径所属的接口范围，模型列表、额度查询等辅助接口返回空字符串，不受范围限制
+func EndpointScopeOfPath(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/v1/chat/completions"),
+		strings.HasPrefix(path, "/v1/completions"),
+		strings.HasPrefix(path, "/v1/edits"):
+		return EndpointScopeChat
+	case strings.HasPrefix(path, "/v1/responses"):
+		return EndpointScopeResponses
+	case strings.HasPrefix(path, "/v1/messages"):
+		return EndpointScopeMessages
+	case strings.HasPrefix(path, "/v1/embeddings"),
+		strings.HasPrefix(path, "/v1/engines/") && strings.HasSuffix(path, "/embeddings"):
+		return EndpointScopeEmbeddings
+	case strings.HasPrefix(path, "/v1/rerank"):
+		return EndpointScopeRerank
+	case strings.HasPrefix(path, "/v1/moderations"):
+		return EndpointScopeModerations
+	case strings.HasPrefix(path, "/v1/images/"):
+		return EndpointScopeImages
+	case strings.HasPrefix(path, "/v1/audio/"):
+		return EndpointScopeAudio
+	case strings.HasPrefix(path, "/v1/realtime"):
+		return EndpointScopeRealtime
+	case strings.HasPrefix(path, "/v1/video"),
+		strings.HasPrefix(path, "/kling/"),
+		strings.HasPrefix(path, "/jimeng/"):
+		return EndpointScopeVideo
+	case strings.HasPrefix(path, "/suno/"):
+		return EndpointScopeSuno
+	case strings.Contains(path, "/mj/"):
+		return EndpointScopeMidjourney
+	case strings.HasPrefix(path, "/v1beta/models/"), strings.HasPrefix(path, "/v1/models/"):
+		// Gemini 原生接口以 :action 结尾，不带 action 的为模型查询
+		idx := strings.LastIndex(path, ":")
+		if idx < 0 {
+			return ""
+		}
+		action := path[idx+1:]
+		if action == "embedContent" || action == "batchEmbedContents" {
+			return EndpointScopeEmbeddings
+		}
+		return EndpointScopeGemini
+	}
+	return ""
+}
@@ -146,6 +146,56 @@ func ParseMultipartFormReusable(c *gin.Context) (*multipart.Form, error) {
 	return form, nil
 }
 
+// RemoveMultipartField 从 multipart 请求体中删除指定字段，返回该字段的值与删除后的请求体；
+// 其余部分按原样复制并沿用原 boundary，Content-Type 无需改动。字段不存在时 found 为 false
+func RemoveMultipartField(body []byte, contentType string, field string) (value string, stripped []byte, found bool, err error) {
+	boundary, err := parseBoundary(contentType)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err = writer.SetBoundary(boundary); err != nil {
+		return "", nil, false, err
+	}
+	for {
+		part, err := reader.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", nil, false, err
+		}
+		if part.FormName() == field {
+			data, err := io.ReadAll(part)
+			if err != nil {
+				return "", nil, false, err
+			}
+			if !found {
+				value = string(data)
+				found = true
+			}
+			continue
+		}
+		w, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return "", nil, false, err
+		}
+		if _, err = io.Copy(w, part); err != nil {
+			return "", nil, false, err
+		}
+	}
+	if !found {
+		return "", nil, false, nil
+	}
+	if err = writer.Close(); err != nil {
+		return "", nil, false, err
+	}
+	return value, buf.Bytes(), true, nil
+}
+
 func processFormMap(formMap map[string]any, v any) error {
 	jsonData, err := Marshal(formMap)
 	if err != nil {
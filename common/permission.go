@@ -0,0 +1,88 @@
+package common
+
+// 细粒度权限，管理接口按权限校验；内置角色（RoleGuestUser…RoleRootUser）对应固定的权限预设，
+// 自定义角色由管理员从下列权限中组合并分配给用户，用户权限为内置预设与自定义角色权限的并集。
+const (
+	PermissionSelfManage       = "self.manage"        // 个人信息、充值、2FA、订阅等个人功能
+	PermissionTokenManage      = "token.manage"       // 管理自己的令牌
+	PermissionLogReadSelf      = "log.read.self"      // 查看自己的日志、任务与统计
+	PermissionResellerManage   = "reseller.manage"    // 管理分销子用户
+	PermissionChannelRead      = "channel.read"       // 查看渠道、测试渠道
+	PermissionChannelWrite     = "channel.write"      // 新增、修改、删除渠道
+	PermissionChannelKeyReveal = "channel.key.reveal" // 查看渠道密钥
+	PermissionUserRead         = "user.read"          // 查看用户
+	PermissionUserManage       = "user.manage"        // 新增、修改、封禁、删除用户
+	PermissionLogReadAll       = "log.read.all"       // 查看所有用户的日志、任务与统计
+	PermissionLogDelete        = "log.delete"         // 清理历史日志
+	PermissionTaskManage       = "task.manage"        // 强制失败、退款异步任务
+	PermissionBillingManage    = "billing.manage"     // 充值订单、兑换码、发票
+	PermissionModelManage      = "model.manage"       // 模型、供应商、分组及预填组
+	PermissionOptionRead       = "option.read"        // 查看系统设置
+	PermissionOptionWrite      = "option.write"       // 修改系统设置、同步倍率
+	PermissionRoleManage       = "role.manage"        // 管理自定义角色并分配给用户
+)
+
+// AllPermissions 全部权限，顺序即前端展示顺序
+var AllPermissions = []string{
+	PermissionSelfManage,
+	PermissionTokenManage,
+	PermissionLogReadSelf,
+	PermissionResellerManage,
+	PermissionChannelRead,
+	PermissionChannelWrite,
+	PermissionChannelKeyReveal,
+	PermissionUserRead,
+	PermissionUserManage,
+	PermissionLogReadAll,
+	PermissionLogDelete,
+	PermissionTaskManage,
+	PermissionBillingManage,
+	PermissionModelManage,
+	PermissionOptionRead,
+	PermissionOptionWrite,
+	PermissionRoleManage,
+}
+
+var commonUserPermissions = []string{
+	PermissionSelfManage,
+	PermissionTokenManage,
+	PermissionLogReadSelf,
+}
+
+var adminUserPermissions = append([]string{
+	PermissionResellerManage,
+	PermissionChannelRead,
+	PermissionChannelWrite,
+	PermissionUserRead,
+	PermissionUserManage,
+	PermissionLogReadAll,
+	PermissionLogDelete,
+	PermissionTaskManage,
+	PermissionBillingManage,
+	PermissionModelManage,
+}, commonUserPermissions...)
+
+// BuiltinRolePermissions 内置角色的权限预设，与原有的角色等级校验保持一致
+func BuiltinRolePermissions(role int) []string {
+	switch {
+	case role >= RoleRootUser:
+		return AllPermissions
+	case role >= RoleAdminUser:
+		return adminUserPermissions
+	case role >= RoleResellerUser:
+		return append([]string{PermissionResellerManage}, commonUserPermissions...)
+	case role >= RoleCommonUser:
+		return commonUserPermissions
+	default:
+		return []string{}
+	}
+}
+
+func IsValidPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
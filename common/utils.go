@@ -222,6 +222,34 @@ func IsIP(s string) bool {
 	return ip != nil
 }
 
+// IsIPRule 判断是否为合法的 IP 或 CIDR 规则
+func IsIPRule(rule string) bool {
+	if strings.Contains(rule, "/") {
+		_, _, err := net.ParseCIDR(rule)
+		return err == nil
+	}
+	return IsIP(rule)
+}
+
+// IsIPAllowed 判断 IP 是否命中单个 IP 或 CIDR 规则
+func IsIPAllowed(clientIp string, rules []string) bool {
+	ip := net.ParseIP(clientIp)
+	if ip == nil {
+		return false
+	}
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if strings.Contains(rule, "/") {
+			if _, network, err := net.ParseCIDR(rule); err == nil && network.Contains(ip) {
+				return true
+			}
+		} else if ruleIp := net.ParseIP(rule); ruleIp != nil && ruleIp.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func GetUUID() string {
 	code := uuid.New().String()
 	code = strings.Replace(code, "-", "", -1)
@@ -9,15 +9,20 @@ const (
 
 	ContextKeyOriginalModel    ContextKey = "original_model"
 	ContextKeyRequestStartTime ContextKey = "request_start_time"
+	ContextKeyTaskCallbackUrl  ContextKey = "task_callback_url"
 
 	/* token related keys */
 	ContextKeyTokenUnlimited         ContextKey = "token_unlimited_quota"
 	ContextKeyTokenKey               ContextKey = "token_key"
 	ContextKeyTokenId                ContextKey = "token_id"
 	ContextKeyTokenGroup             ContextKey = "token_group"
+	ContextKeyTokenCallbackUrl       ContextKey = "token_callback_url"
 	ContextKeyTokenSpecificChannelId ContextKey = "specific_channel_id"
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
+	ContextKeyTokenMaxInputTokens    ContextKey = "token_max_input_tokens"
+	ContextKeyTokenMaxOutputTokens   ContextKey = "token_max_output_tokens"
+	ContextKeyEphemeralKeyId         ContextKey = "ephemeral_key_id"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -47,7 +52,15 @@ const (
 	ContextKeyUsingGroup  ContextKey = "group"
 	ContextKeyUserName    ContextKey = "username"
 
+	ContextKeyResellerId     ContextKey = "reseller_id"
+	ContextKeyResellerMarkup ContextKey = "reseller_markup"
+
 	ContextKeyLocalCountTokens ContextKey = "local_count_tokens"
 
+	/* responses api store related keys */
+	ContextKeyResponsesInputItems ContextKey = "responses_input_items"
+	ContextKeyResponsesPreviousId ContextKey = "responses_previous_id"
+	ContextKeyResponsesResult     ContextKey = "responses_result"
+
 	ContextKeySystemPromptOverride ContextKey = "system_prompt_override"
 )
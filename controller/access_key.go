@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxUserAccessKeys = 50
+
+type AccessKeyRequest struct {
+	Id          int      `json:"id"`
+	Name        string   `json:"name"`
+	Scopes      []string `json:"scopes"`
+	AllowIps    string   `json:"allow_ips"`
+	ExpiredTime int64    `json:"expired_time"`
+	Status      int      `json:"status"`
+}
+
+// rejectAccessKeySession 管理密钥本身不能用于管理密钥，避免借此扩大权限范围
+func rejectAccessKeySession(c *gin.Context) bool {
+	if c.GetInt("access_key_id") != 0 {
+		common.ApiErrorMsg(c, "请登录后管理密钥，管理密钥不能用于此操作")
+		return true
+	}
+	return false
+}
+
+// validateAccessKeyRequest 校验密钥参数，返回规范化后的权限范围与 IP 白名单
+func validateAccessKeyRequest(c *gin.Context, req *AccessKeyRequest) (string, string, bool) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 64 {
+		common.ApiErrorMsg(c, "密钥名称不能为空且不能超过 64 个字符")
+		return "", "", false
+	}
+	if req.ExpiredTime != -1 && req.ExpiredTime <= common.GetTimestamp() {
+		common.ApiErrorMsg(c, "过期时间无效")
+		return "", "", false
+	}
+	if len(req.Scopes) == 0 {
+		common.ApiErrorMsg(c, "请至少选择一个权限")
+		return "", "", false
+	}
+	granted, err := model.GetUserPermissions(c.GetInt("id"), c.GetInt("role"))
+	if err != nil {
+		common.ApiError(c, err)
+		return "", "", false
+	}
+	seen := make(map[string]bool)
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, s := range req.Scopes {
+		s = strings.TrimSpace(s)
+		if seen[s] {
+			continue
+		}
+		if !common.IsValidPermission(s) {
+			common.ApiErrorMsg(c, "未知的权限: "+s)
+			return "", "", false
+		}
+		if !granted[s] {
+			common.ApiErrorMsg(c, "无法授予自己没有的权限: "+s)
+			return "", "", false
+		}
+		seen[s] = true
+		scopes = append(scopes, s)
+	}
+	allowIps := make([]string, 0)
+	for _, rule := range strings.Split(req.AllowIps, "\n") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		if !common.IsIPRule(rule) {
+			common.ApiErrorMsg(c, "IP 白名单格式错误: "+rule)
+			return "", "", false
+		}
+		allowIps = append(allowIps, rule)
+	}
+	return strings.Join(scopes, ","), strings.Join(allowIps, "\n"), true
+}
+
+func GetAccessKeys(c *gin.Context) {
+	keys, err := model.GetUserAccessKeys(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, keys)
+}
+
+// AddAccessKey 创建管理密钥，明文只在创建时返回一次
+func AddAccessKey(c *gin.Context) {
+	if rejectAccessKeySession(c) {
+		return
+	}
+	var req AccessKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	scopes, allowIps, ok := validateAccessKeyRequest(c, &req)
+	if !ok {
+		return
+	}
+	userId := c.GetInt("id")
+	keys, err := model.GetUserAccessKeys(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if len(keys) >= maxUserAccessKeys {
+		common.ApiErrorMsg(c, "管理密钥数量已达上限")
+		return
+	}
+	key := model.AccessKey{
+		UserId:      userId,
+		Name:        req.Name,
+		Scopes:      scopes,
+		AllowIps:    allowIps,
+		ExpiredTime: req.ExpiredTime,
+	}
+	plain, err := key.Insert()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"key":        plain,
+		"access_key": &key,
+	})
+}
+
+func UpdateAccessKey(c *gin.Context) {
+	if rejectAccessKeySession(c) {
+		return
+	}
+	var req AccessKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	key, err := model.GetAccessKeyById(req.Id, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Status != model.AccessKeyStatusEnabled && req.Status != model.AccessKeyStatusRevoked {
+		common.ApiErrorMsg(c, "状态无效")
+		return
+	}
+	scopes, allowIps, ok := validateAccessKeyRequest(c, &req)
+	if !ok {
+		return
+	}
+	key.Name = req.Name
+	key.Scopes = scopes
+	key.AllowIps = allowIps
+	key.ExpiredTime = req.ExpiredTime
+	key.Status = req.Status
+	if err := key.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, key)
+}
+
+func DeleteAccessKey(c *gin.Context) {
+	if rejectAccessKeySession(c) {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteAccessKeyById(id, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
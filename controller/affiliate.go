@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminRefundTopUpRequest struct {
+	TradeNo string `json:"trade_no"`
+}
+
+// GetAffiliateReport 邀请报表：佣金汇总及直接邀请的用户列表
+func GetAffiliateReport(c *gin.Context) {
+	userId := c.GetInt("id")
+	pageInfo := common.GetPageQuery(c)
+	summary, err := model.GetAffiliateCommissionSummary(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	referrals, total, err := model.GetAffiliateReferrals(userId, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(referrals)
+	common.ApiSuccess(c, gin.H{
+		"summary":   summary,
+		"referrals": pageInfo,
+	})
+}
+
+func GetAffiliateCommissions(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	commissions, total, err := model.GetUserAffiliateCommissions(c.GetInt("id"), c.Query("status"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(commissions)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// AdminRefundTopUp 管理员标记订单已退款，扣回额度并冲正邀请佣金
+func AdminRefundTopUp(c *gin.Context) {
+	var req AdminRefundTopUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.TradeNo == "" {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+
+	// 订单级互斥，防止与补单并发
+	LockOrder(req.TradeNo)
+	defer UnlockOrder(req.TradeNo)
+
+	if err := model.RefundTopUp(req.TradeNo); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+var autoSettleAffiliateCommissionsOnce sync.Once
+
+// AutomaticallySettleAffiliateCommissions 定时结算到期的邀请佣金
+func AutomaticallySettleAffiliateCommissions() {
+	// 只在Master节点结算
+	if !common.IsMasterNode {
+		return
+	}
+	autoSettleAffiliateCommissionsOnce.Do(func() {
+		for {
+			count, err := model.SettleDueAffiliateCommissions(500)
+			if err != nil {
+				common.SysError("failed to settle affiliate commissions: " + err.Error())
+			} else if count > 0 {
+				common.SysLog(fmt.Sprintf("settled %d affiliate commissions", count))
+			}
+			time.Sleep(10 * time.Minute)
+		}
+	})
+}
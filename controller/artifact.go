@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// ArtifactItem 返回给用户的转存记录，附带签名访问地址
+type ArtifactItem struct {
+	*model.Artifact
+	Url string `json:"url"`
+}
+
+func serveArtifact(c *gin.Context, artifact *model.Artifact, cacheControl string) {
+	reader, err := service.OpenArtifact(c.Request.Context(), artifact)
+	if err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to open artifact %s: %s", artifact.Key, err.Error()))
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": gin.H{
+				"message": "Failed to read artifact",
+				"type":    "server_error",
+			},
+		})
+		return
+	}
+	defer reader.Close()
+	c.Writer.Header().Set("Content-Type", artifact.ContentType)
+	c.Writer.Header().Set("Content-Length", strconv.FormatInt(artifact.Size, 10))
+	c.Writer.Header().Set("Cache-Control", cacheControl)
+	c.Writer.WriteHeader(http.StatusOK)
+	if _, err = io.Copy(c.Writer, reader); err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to stream artifact %s: %s", artifact.Key, err.Error()))
+	}
+}
+
+// GetArtifactContent 通过签名地址访问转存内容，无需登录
+func GetArtifactContent(c *gin.Context) {
+	key := c.Param("key")
+	if !service.VerifyArtifactSignature(key, c.Query("expires"), c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"message": "invalid or expired signature",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+	artifact, err := model.GetArtifactByKey(key)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": "artifact not found",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+	serveArtifact(c, artifact, "private, max-age=3600")
+}
+
+func GetUserArtifacts(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	artifacts, total, err := model.GetUserArtifacts(c.GetInt("id"), c.Query("source"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	items := make([]ArtifactItem, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		items = append(items, ArtifactItem{Artifact: artifact, Url: service.SignArtifactUrl(artifact)})
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(items)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetUserArtifactUsage(c *gin.Context) {
+	usage, err := model.GetUserArtifactUsage(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, usage)
+}
+
+// onTaskFinished 任务进入终态后转存结果，再投递回调，保证回调中带有网关地址
+func onTaskFinished(task *model.Task) {
+	service.PublishTaskFinishedEvent(task)
+	gopool.Go(func() {
+		if task.Status == model.TaskStatusSuccess && service.IsArtifactStorageEnabled() {
+			mirrorTaskArtifacts(task)
+		}
+		service.TriggerTaskCallback(task)
+	})
+}
+
+func mirrorTaskArtifacts(task *model.Task) {
+	channel, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to mirror task %s: %s", task.TaskID, err.Error()))
+		return
+	}
+	client, err := service.GetHttpClientWithProxy(channel.GetSetting().Proxy)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to mirror task %s: %s", task.TaskID, err.Error()))
+		return
+	}
+	var urls []string
+	var headers map[string]string
+	if task.Platform == constant.TaskPlatformSuno {
+		var songs []dto.SunoSong
+		if err := common.Unmarshal(task.Data, &songs); err == nil {
+			for _, song := range songs {
+				if song.AudioURL != "" {
+					urls = append(urls, song.AudioURL)
+				}
+			}
+		}
+	} else {
+		videoURL, videoHeaders, err := getTaskVideoSource(task, channel)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to resolve video url of task %s: %s", task.TaskID, err.Error()))
+			return
+		}
+		urls = append(urls, videoURL)
+		headers = videoHeaders
+	}
+	for _, u := range urls {
+		if !strings.HasPrefix(u, "http") {
+			continue
+		}
+		_, err := service.MirrorArtifact(service.MirrorArtifactRequest{
+			UserId:  task.UserId,
+			Source:  model.ArtifactSourceTask,
+			TaskId:  task.TaskID,
+			Url:     u,
+			Headers: headers,
+			Client:  client,
+			Trusted: headers != nil,
+		})
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to mirror task %s: %s", task.TaskID, err.Error()))
+		}
+	}
+}
+
+// mirrorMidjourneyArtifact Midjourney 任务成功后转存图片
+func mirrorMidjourneyArtifact(task *model.Midjourney) {
+	if task.ImageUrl == "" || !service.IsArtifactStorageEnabled() {
+		return
+	}
+	gopool.Go(func() {
+		var client *http.Client
+		if channel, err := model.CacheGetChannel(task.ChannelId); err == nil {
+			client, _ = service.GetHttpClientWithProxy(channel.GetSetting().Proxy)
+		}
+		_, err := service.MirrorArtifact(service.MirrorArtifactRequest{
+			UserId: task.UserId,
+			Source: model.ArtifactSourceMidjourney,
+			TaskId: task.MjId,
+			Url:    task.ImageUrl,
+			Client: client,
+		})
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to mirror midjourney task %s: %s", task.MjId, err.Error()))
+		}
+	})
+}
+
+var autoCleanupArtifactsOnce sync.Once
+
+// AutomaticallyCleanupArtifacts 定时清理超过保留期的转存文件
+func AutomaticallyCleanupArtifacts() {
+	// 只在Master节点清理
+	if !common.IsMasterNode {
+		return
+	}
+	autoCleanupArtifactsOnce.Do(func() {
+		for {
+			service.CleanupExpiredArtifacts()
+			time.Sleep(time.Hour)
+		}
+	})
+}
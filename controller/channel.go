@@ -493,6 +493,11 @@ func validateChannel(channel *model.Channel, isAdd bool) error {
 	if err := channel.ValidateSettings(); err != nil {
 		return fmt.Errorf("渠道额外设置[channel setting] 格式错误：%s", err.Error())
 	}
+	if channel.Type != constant.ChannelTypeUnknown && channel.GetSetting().ToolCallEmulation {
+		if apiType, _ := common.ChannelType2APIType(channel.Type); !service.SupportsToolCallEmulation(apiType) {
+			return fmt.Errorf("该渠道类型不支持模拟函数调用[tool_call_emulation]")
+		}
+	}
 
 	// 如果是添加操作，检查 channel 和 key 是否为空
 	if isAdd {
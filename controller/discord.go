@@ -12,6 +12,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 
 	"github.com/gin-contrib/sessions"
@@ -159,6 +160,7 @@ func DiscordOAuth(c *gin.Context) {
 				})
 				return
 			}
+			service.PublishUserRegisteredEvent(&user, "discord")
 		} else {
 			c.JSON(http.StatusOK, gin.H{
 				"success": false,
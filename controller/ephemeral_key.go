@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 临时密钥有效期范围，与 OpenAI realtime client secret 一致
+const (
+	ephemeralKeyDefaultTTL = 600
+	ephemeralKeyMinTTL     = 10
+	ephemeralKeyMaxTTL     = 7200
+)
+
+// EphemeralKeyRequest 兼容 OpenAI POST /v1/realtime/client_secrets 的请求体，
+// 额外支持 model、quota 与 single_use 字段
+type EphemeralKeyRequest struct {
+	ExpiresAfter *struct {
+		Anchor  string `json:"anchor"`
+		Seconds int    `json:"seconds"`
+	} `json:"expires_after,omitempty"`
+	Session   map[string]any `json:"session,omitempty"`
+	Model     string         `json:"model,omitempty"`
+	Quota     int            `json:"quota,omitempty"` // 消费上限，0 不限制
+	SingleUse bool           `json:"single_use,omitempty"`
+}
+
+func ephemeralKeyError(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{
+		"error": dto.OpenAIError{
+			Message: common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			Type:    "invalid_request_error",
+			Code:    "invalid_ephemeral_key_request",
+		},
+	})
+}
+
+// CreateEphemeralKey 使用普通令牌签发短期临时密钥，供浏览器、移动端直连 /v1/realtime 接口
+func CreateEphemeralKey(c *gin.Context) {
+	if common.GetContextKeyInt(c, constant.ContextKeyEphemeralKeyId) != 0 {
+		ephemeralKeyError(c, http.StatusForbidden, "临时密钥不能签发新的临时密钥")
+		return
+	}
+	var req EphemeralKeyRequest
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		ephemeralKeyError(c, http.StatusBadRequest, "读取请求失败: "+err.Error())
+		return
+	}
+	// 请求体可以为空，全部使用默认值
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := common.Unmarshal(body, &req); err != nil {
+			ephemeralKeyError(c, http.StatusBadRequest, "无效的请求参数: "+err.Error())
+			return
+		}
+	}
+	ttl := ephemeralKeyDefaultTTL
+	if req.ExpiresAfter != nil && req.ExpiresAfter.Seconds != 0 {
+		ttl = req.ExpiresAfter.Seconds
+	}
+	if ttl < ephemeralKeyMinTTL || ttl > ephemeralKeyMaxTTL {
+		ephemeralKeyError(c, http.StatusBadRequest, fmt.Sprintf("expires_after.seconds 应在 %d 到 %d 之间", ephemeralKeyMinTTL, ephemeralKeyMaxTTL))
+		return
+	}
+	modelName := req.Model
+	if modelName == "" && req.Session != nil {
+		modelName, _ = req.Session["model"].(string)
+	}
+	if modelName != "" && common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		limits, _ := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+		if !limits[modelName] {
+			ephemeralKeyError(c, http.StatusForbidden, "该令牌无权访问模型 "+modelName)
+			return
+		}
+	}
+	if req.Quota < 0 {
+		ephemeralKeyError(c, http.StatusBadRequest, "quota 不能为负数")
+		return
+	}
+
+	key := model.EphemeralKey{
+		UserId:      c.GetInt("id"),
+		TokenId:     common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+		Model:       modelName,
+		QuotaLimit:  req.Quota,
+		SingleUse:   req.SingleUse,
+		ExpiredTime: common.GetTimestamp() + int64(ttl),
+	}
+	plain, err := key.Insert()
+	if err != nil {
+		common.SysError("failed to create ephemeral key: " + err.Error())
+		ephemeralKeyError(c, http.StatusInternalServerError, "签发临时密钥失败")
+		return
+	}
+	session := req.Session
+	if session == nil {
+		session = map[string]any{}
+	}
+	if modelName != "" {
+		session["model"] = modelName
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"value":      plain,
+		"expires_at": key.ExpiredTime,
+		"session":    session,
+		"quota":      key.QuotaLimit,
+		"single_use": key.SingleUse,
+	})
+}
+
+var autoCleanEphemeralKeysOnce sync.Once
+
+// AutomaticallyCleanEphemeralKeys 定期清理过期的临时密钥
+func AutomaticallyCleanEphemeralKeys() {
+	// 只在Master节点清理
+	if !common.IsMasterNode {
+		return
+	}
+	autoCleanEphemeralKeysOnce.Do(func() {
+		for {
+			if cnt, err := model.DeleteExpiredEphemeralKeys(); err != nil {
+				common.SysError("failed to clean expired ephemeral keys: " + err.Error())
+			} else if cnt > 0 {
+				common.SysLog(fmt.Sprintf("cleaned %d expired ephemeral keys", cnt))
+			}
+			time.Sleep(time.Hour)
+		}
+	})
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -154,6 +155,7 @@ func GitHubOAuth(c *gin.Context) {
 				})
 				return
 			}
+			service.PublishUserRegisteredEvent(&user, "github")
 		} else {
 			c.JSON(http.StatusOK, gin.H{
 				"success": false,
@@ -227,6 +229,8 @@ func GenerateOAuthCode(c *gin.Context) {
 		session.Set("aff", affCode)
 	}
 	session.Set("oauth_state", state)
+	// 多个 OIDC 提供方共用回调地址，由会话记录本次使用的提供方
+	session.Set("oauth_provider", c.Query("provider"))
 	err := session.Save()
 	if err != nil {
 		common.ApiError(c, err)
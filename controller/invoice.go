@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GenerateInvoiceRequest struct {
+	UserId int  `json:"user_id"`
+	Year   int  `json:"year"`
+	Month  int  `json:"month"`
+	Issue  bool `json:"issue"`
+}
+
+type UpdateInvoiceStatusRequest struct {
+	Id     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+func GetAllInvoices(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	status := c.Query("status")
+	invoices, total, err := model.GetAllInvoices(userId, status, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(invoices)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetUserInvoices(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	invoices, total, err := model.GetUserInvoices(c.GetInt("id"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(invoices)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GenerateInvoice(c *gin.Context) {
+	var req GenerateInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserId == 0 {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if req.Month < 1 || req.Month > 12 || req.Year < 2000 {
+		common.ApiErrorMsg(c, "账单月份无效")
+		return
+	}
+	periodStart, periodEnd := model.GetMonthPeriod(req.Year, time.Month(req.Month))
+	invoice, err := model.GenerateInvoice(req.UserId, periodStart, periodEnd, req.Issue)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, invoice)
+}
+
+func UpdateInvoiceStatus(c *gin.Context) {
+	var req UpdateInvoiceStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Id == 0 {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	invoice, err := model.UpdateInvoiceStatus(req.Id, req.Status)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	invoice.Items = ""
+	common.ApiSuccess(c, invoice)
+}
+
+func ExportInvoice(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	invoice, err := model.GetInvoiceById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	writeInvoiceExport(c, invoice)
+}
+
+func ExportUserInvoice(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	invoice, err := model.GetUserInvoiceById(c.GetInt("id"), id)
+	if err != nil || invoice.Status == common.InvoiceStatusDraft {
+		common.ApiErrorMsg(c, "账单不存在")
+		return
+	}
+	writeInvoiceExport(c, invoice)
+}
+
+func writeInvoiceExport(c *gin.Context, invoice *model.Invoice) {
+	format := c.DefaultQuery("format", service.InvoiceFormatJSON)
+	var data []byte
+	var err error
+	var contentType string
+	switch format {
+	case service.InvoiceFormatJSON:
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+			"data": gin.H{
+				"invoice": invoice,
+				"items":   invoice.GetItems(),
+			},
+		})
+		return
+	case service.InvoiceFormatCSV:
+		data, err = service.RenderInvoiceCSV(invoice)
+		contentType = "text/csv; charset=utf-8"
+	case service.InvoiceFormatHTML:
+		data, err = service.RenderInvoiceHTML(invoice)
+		contentType = "text/html; charset=utf-8"
+	default:
+		err = errors.New("不支持的导出格式")
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if format == service.InvoiceFormatCSV {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", invoice.InvoiceNo))
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+var autoGenerateInvoicesOnce sync.Once
+
+// AutomaticallyGenerateInvoices 每小时检查一次，为后付费用户生成上月账单
+func AutomaticallyGenerateInvoices() {
+	// 只在Master节点生成账单
+	if !common.IsMasterNode {
+		return
+	}
+	autoGenerateInvoicesOnce.Do(func() {
+		for {
+			setting := operation_setting.GetInvoiceSetting()
+			if setting.AutoGenerateEnabled {
+				count, err := service.GenerateMonthlyInvoices(time.Now(), setting.AutoIssueEnabled)
+				if err != nil {
+					common.SysError("failed to generate monthly invoices: " + err.Error())
+				} else if count > 0 {
+					common.SysLog(fmt.Sprintf("generated %d monthly invoices", count))
+				}
+			}
+			time.Sleep(time.Hour)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+func LdapLogin(c *gin.Context) {
+	settings := system_setting.GetLDAPSettings()
+	if !settings.Enabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "管理员未开启 LDAP 登录",
+			"success": false,
+		})
+		return
+	}
+	var loginRequest LoginRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&loginRequest)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无效的参数",
+			"success": false,
+		})
+		return
+	}
+	username := strings.TrimSpace(loginRequest.Username)
+	if username == "" || loginRequest.Password == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无效的参数",
+			"success": false,
+		})
+		return
+	}
+	ldapUser, err := service.LDAPAuthenticate(username, loginRequest.Password)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	if len(settings.RequiredGroups) > 0 {
+		allowed := false
+		for _, group := range settings.RequiredGroups {
+			if ldapUser.InLDAPGroup(group) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			c.JSON(http.StatusOK, gin.H{
+				"message": "该账户不在允许登录的 LDAP 分组中",
+				"success": false,
+			})
+			return
+		}
+	}
+	group, role := service.ResolveLDAPGroupMapping(ldapUser, settings.GroupMappings)
+
+	user := model.User{
+		LdapId: ldapUser.Id,
+	}
+	if model.IsLdapIdAlreadyTaken(user.LdapId) {
+		err := user.FillUserByLdapId()
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"message": err.Error(),
+				"success": false,
+			})
+			return
+		}
+		// 超级管理员与 SCIM 管理的用户不随 LDAP 分组同步
+		if settings.SyncOnLogin && user.Role < common.RoleRootUser && !model.IsScimUser(user.Id) {
+			if err := syncLoginUserGroup(&user, group, role); err != nil {
+				common.ApiError(c, err)
+				return
+			}
+		}
+	} else {
+		if !settings.AutoProvision {
+			c.JSON(http.StatusOK, gin.H{
+				"message": "该 LDAP 账户尚未开通，请联系管理员",
+				"success": false,
+			})
+			return
+		}
+		user.Username, err = generateAvailableUsername(ldapUser.Username, "ldap_user")
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		user.DisplayName = truncateRunes(ldapUser.DisplayName, 20)
+		if user.DisplayName == "" {
+			user.DisplayName = user.Username
+		}
+		if len(ldapUser.Email) <= 50 {
+			user.Email = ldapUser.Email
+		}
+		user.Group = group
+		user.Role = role
+		if err := user.Insert(0); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"message": err.Error(),
+				"success": false,
+			})
+			return
+		}
+		service.PublishUserRegisteredEvent(&user, "ldap")
+	}
+
+	if user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户已被封禁",
+			"success": false,
+		})
+		return
+	}
+	setupPasswordLogin(&user, c)
+}
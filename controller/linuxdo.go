@@ -13,6 +13,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -240,6 +241,7 @@ func LinuxdoOAuth(c *gin.Context) {
 					})
 					return
 				}
+				service.PublishUserRegisteredEvent(&user, "linuxdo")
 			} else {
 				c.JSON(http.StatusOK, gin.H{
 					"success": false,
@@ -10,181 +10,160 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 
 	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
 )
 
-func UpdateMidjourneyTaskBulk() {
-	//imageModel := "midjourney"
-	ctx := context.TODO()
-	for {
-		time.Sleep(time.Duration(15) * time.Second)
-
-		tasks := model.GetAllUnFinishTasks()
-		if len(tasks) == 0 {
-			continue
-		}
+// updateMidjourneyTaskAll 按批通过 list-by-condition 查询渠道下的 Midjourney 任务
+func updateMidjourneyTaskAll(ctx context.Context, channelId int, taskIds []string, taskM map[string]*model.Midjourney) {
+	logger.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的任务有: %d", channelId, len(taskIds)))
+	setting := operation_setting.GetTaskPollerSetting()
+	batches := lo.Chunk(taskIds, max(setting.BatchSize, 1))
+	forEachLimit(len(batches), setting.ChannelConcurrency, func(i int) {
+		updateMidjourneyTaskBatch(ctx, channelId, batches[i], taskM)
+	})
+}
 
-		logger.LogInfo(ctx, fmt.Sprintf("检测到未完成的任务数有: %v", len(tasks)))
-		taskChannelM := make(map[int][]string)
-		taskM := make(map[string]*model.Midjourney)
-		nullTaskIds := make([]int, 0)
-		for _, task := range tasks {
-			if task.MjId == "" {
-				// 统计失败的未完成任务
-				nullTaskIds = append(nullTaskIds, task.Id)
+func updateMidjourneyTaskBatch(ctx context.Context, channelId int, taskIds []string, taskM map[string]*model.Midjourney) {
+	if len(taskIds) == 0 {
+		return
+	}
+	midjourneyChannel, err := model.CacheGetChannel(channelId)
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("CacheGetChannel: %v", err))
+		reason := fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId)
+		for _, taskId := range taskIds {
+			task := taskM[taskId]
+			if task == nil {
 				continue
 			}
-			taskM[task.MjId] = task
-			taskChannelM[task.ChannelId] = append(taskChannelM[task.ChannelId], task.MjId)
-		}
-		if len(nullTaskIds) > 0 {
-			err := model.MjBulkUpdateByTaskIds(nullTaskIds, map[string]any{
-				"status":   "FAILURE",
-				"progress": "100%",
-			})
-			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("Fix null mj_id task error: %v", err))
-			} else {
-				logger.LogInfo(ctx, fmt.Sprintf("Fix null mj_id task success: %v", nullTaskIds))
+			if _, err := failMidjourneyTask(ctx, task, reason); err != nil {
+				logger.LogInfo(ctx, fmt.Sprintf("UpdateMidjourneyTask error: %v", err))
 			}
 		}
-		if len(taskChannelM) == 0 {
+		return
+	}
+	requestUrl := fmt.Sprintf("%s/mj/task/list-by-condition", *midjourneyChannel.BaseURL)
+
+	body, _ := json.Marshal(map[string]any{
+		"ids": taskIds,
+	})
+	req, err := http.NewRequest("POST", requestUrl, bytes.NewBuffer(body))
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Get Task error: %v", err))
+		return
+	}
+	// 设置超时时间
+	timeout := time.Second * 15
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	// 使用带有超时的 context 创建新的请求
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("mj-api-secret", midjourneyChannel.Key)
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Get Task Do req error: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logger.LogError(ctx, fmt.Sprintf("Get Task status code: %d", resp.StatusCode))
+		return
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Get Task parse body error: %v", err))
+		return
+	}
+	var responseItems []dto.MidjourneyDto
+	err = json.Unmarshal(responseBody, &responseItems)
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Get Task parse body error2: %v, body: %s", err, string(responseBody)))
+		return
+	}
+
+	taskTimeout := operation_setting.GetTaskTimeout(constant.TaskPlatformMidjourney)
+	for _, responseItem := range responseItems {
+		task := taskM[responseItem.MjId]
+		if task == nil {
 			continue
 		}
 
-		for channelId, taskIds := range taskChannelM {
-			logger.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的任务有: %d", channelId, len(taskIds)))
-			if len(taskIds) == 0 {
-				continue
-			}
-			midjourneyChannel, err := model.CacheGetChannel(channelId)
-			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("CacheGetChannel: %v", err))
-				err := model.MjBulkUpdate(taskIds, map[string]any{
-					"fail_reason": fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId),
-					"status":      "FAILURE",
-					"progress":    "100%",
-				})
-				if err != nil {
-					logger.LogInfo(ctx, fmt.Sprintf("UpdateMidjourneyTask error: %v", err))
-				}
-				continue
-			}
-			requestUrl := fmt.Sprintf("%s/mj/task/list-by-condition", *midjourneyChannel.BaseURL)
+		useTime := (time.Now().UnixNano() / int64(time.Millisecond)) - task.SubmitTime
+		// 超过平台最长存活时间且进度不是100%，则认为任务失败
+		if taskTimeout > 0 && useTime > taskTimeout*1000 && task.Progress != "100%" {
+			responseItem.FailReason = fmt.Sprintf("上游任务超时（超过 %d 秒）", taskTimeout)
+			responseItem.Status = "FAILURE"
+		}
+		if !checkMjTaskNeedUpdate(task, responseItem) {
+			continue
+		}
+		preStatus := task.Status
+		preProgress := task.Progress
+		task.Code = 1
+		task.Progress = responseItem.Progress
+		task.PromptEn = responseItem.PromptEn
+		task.State = responseItem.State
+		task.SubmitTime = responseItem.SubmitTime
+		task.StartTime = responseItem.StartTime
+		task.FinishTime = responseItem.FinishTime
+		task.ImageUrl = responseItem.ImageUrl
+		task.Status = responseItem.Status
+		task.FailReason = responseItem.FailReason
+		if responseItem.Properties != nil {
+			propertiesStr, _ := json.Marshal(responseItem.Properties)
+			task.Properties = string(propertiesStr)
+		}
+		if responseItem.Buttons != nil {
+			buttonStr, _ := json.Marshal(responseItem.Buttons)
+			task.Buttons = string(buttonStr)
+		}
+		// 映射 VideoUrl
+		task.VideoUrl = responseItem.VideoUrl
 
-			body, _ := json.Marshal(map[string]any{
-				"ids": taskIds,
-			})
-			req, err := http.NewRequest("POST", requestUrl, bytes.NewBuffer(body))
+		// 映射 VideoUrls - 将数组序列化为 JSON 字符串
+		if responseItem.VideoUrls != nil && len(responseItem.VideoUrls) > 0 {
+			videoUrlsStr, err := json.Marshal(responseItem.VideoUrls)
 			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("Get Task error: %v", err))
-				continue
-			}
-			// 设置超时时间
-			timeout := time.Second * 15
-			ctx, cancel := context.WithTimeout(context.Background(), timeout)
-			// 使用带有超时的 context 创建新的请求
-			req = req.WithContext(ctx)
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("mj-api-secret", midjourneyChannel.Key)
-			resp, err := service.GetHttpClient().Do(req)
-			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("Get Task Do req error: %v", err))
-				continue
+				logger.LogError(ctx, fmt.Sprintf("序列化 VideoUrls 失败: %v", err))
+				task.VideoUrls = "[]" // 失败时设置为空数组
+			} else {
+				task.VideoUrls = string(videoUrlsStr)
 			}
-			if resp.StatusCode != http.StatusOK {
-				logger.LogError(ctx, fmt.Sprintf("Get Task status code: %d", resp.StatusCode))
-				continue
+		} else {
+			task.VideoUrls = "" // 空值时清空字段
+		}
+
+		shouldReturnQuota := false
+		if (task.Progress != "100%" && responseItem.FailReason != "") || (task.Progress == "100%" && task.Status == "FAILURE") {
+			logger.LogInfo(ctx, task.MjId+" 构建失败，"+task.FailReason)
+			task.Progress = "100%"
+			if task.Quota != 0 {
+				shouldReturnQuota = true
 			}
-			responseBody, err := io.ReadAll(resp.Body)
-			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("Get Task parse body error: %v", err))
-				continue
+		}
+		err = task.Update()
+		if err != nil {
+			logger.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
+		} else {
+			if task.Status == "SUCCESS" && preStatus != task.Status {
+				mirrorMidjourneyArtifact(task)
 			}
-			var responseItems []dto.MidjourneyDto
-			err = json.Unmarshal(responseBody, &responseItems)
-			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("Get Task parse body error2: %v, body: %s", err, string(responseBody)))
-				continue
+			if shouldReturnQuota {
+				refundMidjourneyTask(ctx, task, fmt.Sprintf("构图失败 %s，补偿 %s", task.MjId, logger.LogQuota(task.Quota)))
 			}
-			resp.Body.Close()
-			req.Body.Close()
-			cancel()
-
-			for _, responseItem := range responseItems {
-				task := taskM[responseItem.MjId]
-
-				useTime := (time.Now().UnixNano() / int64(time.Millisecond)) - task.SubmitTime
-				// 如果时间超过一小时，且进度不是100%，则认为任务失败
-				if useTime > 3600000 && task.Progress != "100%" {
-					responseItem.FailReason = "上游任务超时（超过1小时）"
-					responseItem.Status = "FAILURE"
-				}
-				if !checkMjTaskNeedUpdate(task, responseItem) {
-					continue
-				}
-				task.Code = 1
-				task.Progress = responseItem.Progress
-				task.PromptEn = responseItem.PromptEn
-				task.State = responseItem.State
-				task.SubmitTime = responseItem.SubmitTime
-				task.StartTime = responseItem.StartTime
-				task.FinishTime = responseItem.FinishTime
-				task.ImageUrl = responseItem.ImageUrl
-				task.Status = responseItem.Status
-				task.FailReason = responseItem.FailReason
-				if responseItem.Properties != nil {
-					propertiesStr, _ := json.Marshal(responseItem.Properties)
-					task.Properties = string(propertiesStr)
-				}
-				if responseItem.Buttons != nil {
-					buttonStr, _ := json.Marshal(responseItem.Buttons)
-					task.Buttons = string(buttonStr)
-				}
-				// 映射 VideoUrl
-				task.VideoUrl = responseItem.VideoUrl
-
-				// 映射 VideoUrls - 将数组序列化为 JSON 字符串
-				if responseItem.VideoUrls != nil && len(responseItem.VideoUrls) > 0 {
-					videoUrlsStr, err := json.Marshal(responseItem.VideoUrls)
-					if err != nil {
-						logger.LogError(ctx, fmt.Sprintf("序列化 VideoUrls 失败: %v", err))
-						task.VideoUrls = "[]" // 失败时设置为空数组
-					} else {
-						task.VideoUrls = string(videoUrlsStr)
-					}
-				} else {
-					task.VideoUrls = "" // 空值时清空字段
-				}
-
-				shouldReturnQuota := false
-				if (task.Progress != "100%" && responseItem.FailReason != "") || (task.Progress == "100%" && task.Status == "FAILURE") {
-					logger.LogInfo(ctx, task.MjId+" 构建失败，"+task.FailReason)
-					task.Progress = "100%"
-					if task.Quota != 0 {
-						shouldReturnQuota = true
-					}
-				}
-				err = task.Update()
-				if err != nil {
-					logger.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
-				} else {
-					if shouldReturnQuota {
-						err = model.IncreaseUserQuota(task.UserId, task.Quota, false)
-						if err != nil {
-							logger.LogError(ctx, "fail to increase user quota: "+err.Error())
-						}
-						logContent := fmt.Sprintf("构图失败 %s，补偿 %s", task.MjId, logger.LogQuota(task.Quota))
-						model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-					}
-				}
+			if preProgress != "100%" && task.Progress == "100%" {
+				service.PublishMidjourneyFinishedEvent(task)
 			}
 		}
 	}
@@ -1,9 +1,11 @@
 package controller
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -12,6 +14,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 
 	"github.com/gin-contrib/sessions"
@@ -35,21 +38,69 @@ type OidcUser struct {
 	Picture           string `json:"picture"`
 }
 
-func getOidcUserInfoByCode(code string) (*OidcUser, error) {
+// getOidcProvider 取本次登录使用的提供方，未指定时为默认提供方
+func getOidcProvider(c *gin.Context) *system_setting.OIDCProvider {
+	slug := c.Query("provider")
+	if slug == "" {
+		slug, _ = sessions.Default(c).Get("oauth_provider").(string)
+	}
+	provider := system_setting.GetOIDCProvider(slug)
+	if provider == nil || !provider.Enabled {
+		return nil
+	}
+	return provider
+}
+
+// getPublicOidcProviders 登录页展示的额外 OIDC 提供方，不含密钥与映射规则
+func getPublicOidcProviders() []gin.H {
+	providers := make([]gin.H, 0)
+	for _, provider := range system_setting.GetOIDCSettings().Providers {
+		if !provider.Enabled {
+			continue
+		}
+		providers = append(providers, gin.H{
+			"slug":                   provider.Slug,
+			"name":                   provider.Name,
+			"client_id":              provider.ClientId,
+			"authorization_endpoint": provider.AuthorizationEndpoint,
+			"scopes":                 provider.Scopes,
+		})
+	}
+	return providers
+}
+
+// decodeIdTokenClaims 解析 ID Token 的声明。ID Token 直接从令牌端点经 TLS 获取，按 OIDC Core 3.1.3.7 可不校验签名
+func decodeIdTokenClaims(idToken string) map[string]any {
+	claims := make(map[string]any)
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return claims
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return claims
+	}
+	if err := common.Unmarshal(payload, &claims); err != nil {
+		return make(map[string]any)
+	}
+	return claims
+}
+
+func getOidcUserInfoByCode(provider *system_setting.OIDCProvider, code string) (*OidcUser, map[string]any, error) {
 	if code == "" {
-		return nil, errors.New("无效的参数")
+		return nil, nil, errors.New("无效的参数")
 	}
 
 	values := url.Values{}
-	values.Set("client_id", system_setting.GetOIDCSettings().ClientId)
-	values.Set("client_secret", system_setting.GetOIDCSettings().ClientSecret)
+	values.Set("client_id", provider.ClientId)
+	values.Set("client_secret", provider.ClientSecret)
 	values.Set("code", code)
 	values.Set("grant_type", "authorization_code")
 	values.Set("redirect_uri", fmt.Sprintf("%s/oauth/oidc", system_setting.ServerAddress))
 	formData := values.Encode()
-	req, err := http.NewRequest("POST", system_setting.GetOIDCSettings().TokenEndpoint, strings.NewReader(formData))
+	req, err := http.NewRequest("POST", provider.TokenEndpoint, strings.NewReader(formData))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Accept", "application/json")
@@ -59,46 +110,58 @@ func getOidcUserInfoByCode(code string) (*OidcUser, error) {
 	res, err := client.Do(req)
 	if err != nil {
 		common.SysLog(err.Error())
-		return nil, errors.New("无法连接至 OIDC 服务器，请稍后重试！")
+		return nil, nil, errors.New("无法连接至 OIDC 服务器，请稍后重试！")
 	}
 	defer res.Body.Close()
 	var oidcResponse OidcResponse
 	err = json.NewDecoder(res.Body).Decode(&oidcResponse)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if oidcResponse.AccessToken == "" {
 		common.SysLog("OIDC 获取 Token 失败，请检查设置！")
-		return nil, errors.New("OIDC 获取 Token 失败，请检查设置！")
+		return nil, nil, errors.New("OIDC 获取 Token 失败，请检查设置！")
 	}
 
-	req, err = http.NewRequest("GET", system_setting.GetOIDCSettings().UserInfoEndpoint, nil)
+	req, err = http.NewRequest("GET", provider.UserInfoEndpoint, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	req.Header.Set("Authorization", "Bearer "+oidcResponse.AccessToken)
 	res2, err := client.Do(req)
 	if err != nil {
 		common.SysLog(err.Error())
-		return nil, errors.New("无法连接至 OIDC 服务器，请稍后重试！")
+		return nil, nil, errors.New("无法连接至 OIDC 服务器，请稍后重试！")
 	}
 	defer res2.Body.Close()
 	if res2.StatusCode != http.StatusOK {
 		common.SysLog("OIDC 获取用户信息失败！请检查设置！")
-		return nil, errors.New("OIDC 获取用户信息失败！请检查设置！")
+		return nil, nil, errors.New("OIDC 获取用户信息失败！请检查设置！")
 	}
 
+	userInfo, err := io.ReadAll(res2.Body)
+	if err != nil {
+		return nil, nil, err
+	}
 	var oidcUser OidcUser
-	err = json.NewDecoder(res2.Body).Decode(&oidcUser)
+	err = common.Unmarshal(userInfo, &oidcUser)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	// UserInfo 的声明覆盖 ID Token 中的同名声明
+	claims := decodeIdTokenClaims(oidcResponse.IDToken)
+	var userInfoClaims map[string]any
+	if err := common.Unmarshal(userInfo, &userInfoClaims); err == nil {
+		for k, v := range userInfoClaims {
+			claims[k] = v
+		}
 	}
 	if oidcUser.OpenID == "" || oidcUser.Email == "" {
 		common.SysLog("OIDC 获取用户信息为空！请检查设置！")
-		return nil, errors.New("OIDC 获取用户信息为空！请检查设置！")
+		return nil, nil, errors.New("OIDC 获取用户信息为空！请检查设置！")
 	}
-	return &oidcUser, nil
+	return &oidcUser, claims, nil
 }
 
 func OidcAuth(c *gin.Context) {
@@ -116,7 +179,8 @@ func OidcAuth(c *gin.Context) {
 		OidcBind(c)
 		return
 	}
-	if !system_setting.GetOIDCSettings().Enabled {
+	provider := getOidcProvider(c)
+	if provider == nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "管理员未开启通过 OIDC 登录以及注册",
@@ -124,13 +188,14 @@ func OidcAuth(c *gin.Context) {
 		return
 	}
 	code := c.Query("code")
-	oidcUser, err := getOidcUserInfoByCode(code)
+	oidcUser, claims, err := getOidcUserInfoByCode(provider, code)
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	provision := service.ResolveOIDCProvisioning(&provider.Provisioning, claims)
 	user := model.User{
-		OidcId: oidcUser.OpenID,
+		OidcId: provider.OidcId(oidcUser.OpenID),
 	}
 	if model.IsOidcIdAlreadyTaken(user.OidcId) {
 		err := user.FillUserByOidcId()
@@ -141,34 +206,70 @@ func OidcAuth(c *gin.Context) {
 			})
 			return
 		}
-	} else {
-		if common.RegisterEnabled {
-			user.Email = oidcUser.Email
-			if oidcUser.PreferredUsername != "" {
-				user.Username = oidcUser.PreferredUsername
-			} else {
-				user.Username = "oidc_" + strconv.Itoa(model.GetMaxUserId()+1)
-			}
-			if oidcUser.Name != "" {
-				user.DisplayName = oidcUser.Name
-			} else {
-				user.DisplayName = "OIDC User"
-			}
-			err := user.Insert(0)
-			if err != nil {
+		// 超级管理员与 SCIM 管理的用户不随声明同步
+		if provider.Provisioning.SyncOnLogin && user.Role < common.RoleRootUser && !model.IsScimUser(user.Id) {
+			if !provision.Allowed {
 				c.JSON(http.StatusOK, gin.H{
 					"success": false,
-					"message": err.Error(),
+					"message": provision.Reason,
 				})
 				return
 			}
-		} else {
+			if err := syncLoginUserGroup(&user, provision.Group, provision.Role); err != nil {
+				common.ApiError(c, err)
+				return
+			}
+		}
+	} else if scimUser := findLinkableScimUser(provider, provision, claims, oidcUser.Email); scimUser != nil {
+		// SCIM 预先同步的用户首次通过 OIDC 登录时按邮箱绑定，分组与角色仍由 SCIM 管理
+		scimUser.OidcId = user.OidcId
+		if err := scimUser.Update(false); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		user = *scimUser
+	} else {
+		if !common.RegisterEnabled {
 			c.JSON(http.StatusOK, gin.H{
 				"success": false,
 				"message": "管理员关闭了新用户注册",
 			})
 			return
 		}
+		if !provision.Allowed {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": provision.Reason,
+			})
+			return
+		}
+		user.Email = oidcUser.Email
+		if oidcUser.PreferredUsername != "" {
+			user.Username = oidcUser.PreferredUsername
+		} else {
+			user.Username = "oidc_" + strconv.Itoa(model.GetMaxUserId()+1)
+		}
+		if oidcUser.Name != "" {
+			user.DisplayName = oidcUser.Name
+		} else {
+			user.DisplayName = "OIDC User"
+		}
+		user.Group = provision.Group
+		user.Role = provision.Role
+		err := user.Insert(0)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		if provision.Quota > 0 && provision.Quota != user.Quota {
+			if err := adjustOidcUserQuota(&user, provision.Quota); err != nil {
+				common.SysError(fmt.Sprintf("failed to set initial quota of oidc user %d: %s", user.Id, err.Error()))
+			}
+		}
+		service.PublishUserRegisteredEvent(&user, "oidc")
 	}
 
 	if user.Status != common.UserStatusEnabled {
@@ -181,8 +282,53 @@ func OidcAuth(c *gin.Context) {
 	setupLogin(&user, c)
 }
 
+// findLinkableScimUser 提供方开启 link_scim_users、邮箱已验证且通过准入规则时，返回可按邮箱绑定的 SCIM 用户
+func findLinkableScimUser(provider *system_setting.OIDCProvider, provision *service.OIDCProvisionResult, claims map[string]any, email string) *model.User {
+	if !provider.Provisioning.LinkScimUsers || !provision.Allowed || !service.IsOIDCEmailVerified(claims) {
+		return nil
+	}
+	scimUser, err := model.FindScimUserForOidc(email)
+	if err != nil {
+		return nil
+	}
+	return scimUser
+}
+
+// syncLoginUserGroup 外部身份登录时同步分组与角色，角色变化时撤销用户已有的会话
+func syncLoginUserGroup(user *model.User, group string, role int) error {
+	if user.Group == group && user.Role == role {
+		return nil
+	}
+	roleChanged := user.Role != role
+	user.Group = group
+	user.Role = role
+	if err := user.Update(false); err != nil {
+		return err
+	}
+	if roleChanged {
+		revokeUserSessions(user.Id, "")
+	}
+	return nil
+}
+
+// adjustOidcUserQuota 将新用户的额度调整为映射规则指定的初始额度
+func adjustOidcUserQuota(user *model.User, quota int) error {
+	var err error
+	if quota > user.Quota {
+		err = model.IncreaseUserQuota(user.Id, quota-user.Quota, true)
+	} else {
+		err = model.DecreaseUserQuota(user.Id, user.Quota-quota)
+	}
+	if err != nil {
+		return err
+	}
+	user.Quota = quota
+	return nil
+}
+
 func OidcBind(c *gin.Context) {
-	if !system_setting.GetOIDCSettings().Enabled {
+	provider := getOidcProvider(c)
+	if provider == nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "管理员未开启通过 OIDC 登录以及注册",
@@ -190,13 +336,13 @@ func OidcBind(c *gin.Context) {
 		return
 	}
 	code := c.Query("code")
-	oidcUser, err := getOidcUserInfoByCode(code)
+	oidcUser, _, err := getOidcUserInfoByCode(provider, code)
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
 	user := model.User{
-		OidcId: oidcUser.OpenID,
+		OidcId: provider.OidcId(oidcUser.OpenID),
 	}
 	if model.IsOidcIdAlreadyTaken(user.OidcId) {
 		c.JSON(http.StatusOK, gin.H{
@@ -214,7 +360,7 @@ func OidcBind(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	user.OidcId = oidcUser.OpenID
+	user.OidcId = provider.OidcId(oidcUser.OpenID)
 	err = user.Update(false)
 	if err != nil {
 		common.ApiError(c, err)
@@ -0,0 +1,330 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PermissionRoleRequest struct {
+	Id          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type UserPermissionRolesRequest struct {
+	RoleIds []int `json:"role_ids"`
+}
+
+// GetPermissions 返回全部权限及内置角色的权限预设
+func GetPermissions(c *gin.Context) {
+	common.ApiSuccess(c, gin.H{
+		"permissions": common.AllPermissions,
+		"builtin_roles": []gin.H{
+			{"role": common.RoleGuestUser, "permissions": common.BuiltinRolePermissions(common.RoleGuestUser)},
+			{"role": common.RoleCommonUser, "permissions": common.BuiltinRolePermissions(common.RoleCommonUser)},
+			{"role": common.RoleResellerUser, "permissions": common.BuiltinRolePermissions(common.RoleResellerUser)},
+			{"role": common.RoleAdminUser, "permissions": common.BuiltinRolePermissions(common.RoleAdminUser)},
+			{"role": common.RoleRootUser, "permissions": common.BuiltinRolePermissions(common.RoleRootUser)},
+		},
+	})
+}
+
+// GetSelfPermissions 返回当前用户的有效权限
+func GetSelfPermissions(c *gin.Context) {
+	granted, err := model.GetUserPermissions(c.GetInt("id"), c.GetInt("role"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	permissions := make([]string, 0, len(granted))
+	for _, p := range common.AllPermissions {
+		if granted[p] {
+			permissions = append(permissions, p)
+		}
+	}
+	common.ApiSuccess(c, permissions)
+}
+
+func GetPermissionRoles(c *gin.Context) {
+	roles, err := model.GetAllPermissionRoles()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, roles)
+}
+
+// validatePermissionRole 校验角色参数，操作者只能授予自己拥有的权限，返回规范化后的权限列表
+func validatePermissionRole(c *gin.Context, req *PermissionRoleRequest) (string, bool) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 64 {
+		common.ApiErrorMsg(c, "角色名称不能为空且不能超过 64 个字符")
+		return "", false
+	}
+	if len(req.Description) > 255 {
+		common.ApiErrorMsg(c, "角色描述过长")
+		return "", false
+	}
+	granted, err := model.GetUserPermissions(c.GetInt("id"), c.GetInt("role"))
+	if err != nil {
+		common.ApiError(c, err)
+		return "", false
+	}
+	seen := make(map[string]bool)
+	permissions := make([]string, 0, len(req.Permissions))
+	for _, p := range req.Permissions {
+		p = strings.TrimSpace(p)
+		if seen[p] {
+			continue
+		}
+		if !common.IsValidPermission(p) {
+			common.ApiErrorMsg(c, "未知的权限: "+p)
+			return "", false
+		}
+		if !granted[p] {
+			common.ApiErrorMsg(c, "无法授予自己没有的权限: "+p)
+			return "", false
+		}
+		seen[p] = true
+		permissions = append(permissions, p)
+	}
+	if dup, err := model.IsPermissionRoleNameDuplicated(req.Id, req.Name); err != nil {
+		common.ApiError(c, err)
+		return "", false
+	} else if dup {
+		common.ApiErrorMsg(c, "角色名称已存在")
+		return "", false
+	}
+	return strings.Join(permissions, ","), true
+}
+
+func CreatePermissionRole(c *gin.Context) {
+	var req PermissionRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	req.Id = 0
+	permissions, ok := validatePermissionRole(c, &req)
+	if !ok {
+		return
+	}
+	role := model.PermissionRole{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: permissions,
+	}
+	if err := role.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, &role)
+}
+
+func UpdatePermissionRole(c *gin.Context) {
+	var req PermissionRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	role, err := model.GetPermissionRoleById(req.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !canOperatePermissionRoles(c, role) {
+		return
+	}
+	permissions, ok := validatePermissionRole(c, &req)
+	if !ok {
+		return
+	}
+	role.Name = req.Name
+	role.Description = req.Description
+	role.Permissions = permissions
+	if err := role.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, role)
+}
+
+func DeletePermissionRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	role, err := model.GetPermissionRoleById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !canOperatePermissionRoles(c, role) {
+		return
+	}
+	if err := model.DeletePermissionRoleById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// canOperatePermissionRoles 操作者必须拥有角色中的全部权限，避免借助角色管理提升权限
+func canOperatePermissionRoles(c *gin.Context, roles ...*model.PermissionRole) bool {
+	granted, err := model.GetUserPermissions(c.GetInt("id"), c.GetInt("role"))
+	if err != nil {
+		common.ApiError(c, err)
+		return false
+	}
+	for _, role := range roles {
+		for _, p := range role.GetPermissions() {
+			if !granted[p] {
+				common.ApiErrorMsg(c, "无权操作包含权限 "+p+" 的角色")
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// canManageUser 判断操作者能否管理拥有指定角色等级的目标用户（userId 为 0 表示尚未创建的用户）。
+// 操作者须拥有目标用户的全部有效权限；双方权限完全相同时，再按角色等级判定（高于目标或为超级管理员）
+func canManageUser(c *gin.Context, userId int, role int) (bool, error) {
+	myRole := c.GetInt("role")
+	mine, err := model.GetUserPermissions(c.GetInt("id"), myRole)
+	if err != nil {
+		return false, err
+	}
+	theirs := make(map[string]bool)
+	if userId != 0 {
+		theirs, err = model.GetUserPermissions(userId, role)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		for _, p := range common.BuiltinRolePermissions(role) {
+			theirs[p] = true
+		}
+	}
+	for p := range theirs {
+		if !mine[p] {
+			return false, nil
+		}
+	}
+	if len(mine) > len(theirs) {
+		return true, nil
+	}
+	return myRole > role || myRole == common.RoleRootUser, nil
+}
+
+// getManagedUser 获取被分配角色的用户，不能操作权限不低于自己的用户
+func getManagedUser(c *gin.Context) (*model.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	if ok, err := canManageUser(c, user.Id, user.Role); err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	} else if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权管理同级或更高等级用户的角色",
+		})
+		return nil, false
+	}
+	return user, true
+}
+
+func GetUserPermissionRoles(c *gin.Context) {
+	user, ok := getManagedUser(c)
+	if !ok {
+		return
+	}
+	roleIds, err := model.GetUserPermissionRoleIds(user.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	granted, err := model.GetUserPermissions(user.Id, user.Role)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	permissions := make([]string, 0, len(granted))
+	for _, p := range common.AllPermissions {
+		if granted[p] {
+			permissions = append(permissions, p)
+		}
+	}
+	common.ApiSuccess(c, gin.H{
+		"role_ids":    roleIds,
+		"permissions": permissions,
+	})
+}
+
+func UpdateUserPermissionRoles(c *gin.Context) {
+	user, ok := getManagedUser(c)
+	if !ok {
+		return
+	}
+	var req UserPermissionRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	roleIds := make([]int, 0, len(req.RoleIds))
+	seen := make(map[int]bool)
+	roles := make([]*model.PermissionRole, 0, len(req.RoleIds))
+	for _, id := range req.RoleIds {
+		if seen[id] {
+			continue
+		}
+		role, err := model.GetPermissionRoleById(id)
+		if err != nil {
+			common.ApiErrorMsg(c, "角色不存在")
+			return
+		}
+		seen[id] = true
+		roleIds = append(roleIds, id)
+		roles = append(roles, role)
+	}
+	// 被移除的角色同样需要操作者拥有其全部权限
+	currentIds, err := model.GetUserPermissionRoleIds(user.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	for _, id := range currentIds {
+		if seen[id] {
+			continue
+		}
+		role, err := model.GetPermissionRoleById(id)
+		if err != nil {
+			continue
+		}
+		roles = append(roles, role)
+	}
+	if !canOperatePermissionRoles(c, roles...) {
+		return
+	}
+	if err := model.SetUserPermissionRoles(user.Id, roleIds); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, roleIds)
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -61,6 +62,30 @@ func geminiRelayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewA
 	return err
 }
 
+// applyTokenMaxOutputTokens 校验文本类请求的 max_tokens 是否超过令牌单次请求上限，未指定时以上限补全
+func applyTokenMaxOutputTokens(request dto.Request, meta *types.TokenCountMeta, maxOutputTokens int) error {
+	var setMaxTokens func(uint)
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		setMaxTokens = func(n uint) { r.MaxTokens = n }
+	case *dto.ClaudeRequest:
+		setMaxTokens = func(n uint) { r.MaxTokens = n }
+	case *dto.OpenAIResponsesRequest:
+		setMaxTokens = func(n uint) { r.MaxOutputTokens = n }
+	case *dto.GeminiChatRequest:
+		setMaxTokens = func(n uint) { r.GenerationConfig.MaxOutputTokens = n }
+	default:
+		return nil
+	}
+	if meta.MaxTokens > maxOutputTokens {
+		return fmt.Errorf("max_tokens %d 超过令牌单次请求上限 %d", meta.MaxTokens, maxOutputTokens)
+	}
+	if meta.MaxTokens == 0 {
+		setMaxTokens(uint(maxOutputTokens))
+	}
+	return nil
+}
+
 func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	requestId := c.GetString(common.RequestIdKey)
@@ -114,8 +139,27 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
+	// 网关保存了上一轮响应时，在选择渠道前展开 previous_response_id
+	if responsesReq, ok := request.(*dto.OpenAIResponsesRequest); ok {
+		if err := service.PrepareResponsesRequest(c, responsesReq); err != nil {
+			statusCode := http.StatusBadRequest
+			if errors.Is(err, service.ErrPreviousResponseNotFound) {
+				statusCode = http.StatusNotFound
+			}
+			newAPIError = types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, statusCode, types.ErrOptionWithSkipRetry())
+			return
+		}
+	}
+
 	meta := request.GetTokenCountMeta()
 
+	if maxOutputTokens := common.GetContextKeyInt(c, constant.ContextKeyTokenMaxOutputTokens); maxOutputTokens > 0 {
+		if err := applyTokenMaxOutputTokens(request, meta, maxOutputTokens); err != nil {
+			newAPIError = types.NewErrorWithStatusCode(err, types.ErrorCodeTokenLimitExceeded, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+			return
+		}
+	}
+
 	if setting.ShouldCheckPromptSensitive() {
 		contains, words := service.CheckSensitiveText(meta.CombineText)
 		if contains {
@@ -131,6 +175,12 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
+	if maxInputTokens := common.GetContextKeyInt(c, constant.ContextKeyTokenMaxInputTokens); maxInputTokens > 0 && tokens > maxInputTokens {
+		newAPIError = types.NewErrorWithStatusCode(fmt.Errorf("输入 token 数 %d 超过令牌单次请求上限 %d", tokens, maxInputTokens),
+			types.ErrorCodeTokenLimitExceeded, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		return
+	}
+
 	relayInfo.SetEstimatePromptTokens(tokens)
 
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
@@ -365,6 +415,48 @@ func RelayMidjourney(c *gin.Context) {
 	}
 }
 
+// RelayCountTokens 处理 Claude /v1/messages/count_tokens 与 Gemini models/*:countTokens，不计费
+func RelayCountTokens(c *gin.Context, relayFormat types.RelayFormat) {
+	var newAPIError *types.NewAPIError
+	defer func() {
+		if newAPIError == nil {
+			return
+		}
+		logger.LogError(c, fmt.Sprintf("count tokens error: %s", newAPIError.Error()))
+		newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), c.GetString(common.RequestIdKey)))
+		if relayFormat == types.RelayFormatClaude {
+			c.JSON(newAPIError.StatusCode, gin.H{
+				"type":  "error",
+				"error": newAPIError.ToClaudeError(),
+			})
+		} else {
+			c.JSON(newAPIError.StatusCode, gin.H{
+				"error": newAPIError.ToOpenAIError(),
+			})
+		}
+	}()
+
+	request, err := helper.GetAndValidateRequest(c, relayFormat)
+	if err != nil {
+		newAPIError = types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest)
+		return
+	}
+	relayInfo, err := relaycommon.GenRelayInfo(c, relayFormat, request, nil)
+	if err != nil {
+		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
+		return
+	}
+	tokens, newAPIError := relay.CountTokensHelper(c, relayInfo)
+	if newAPIError != nil {
+		return
+	}
+	if relayFormat == types.RelayFormatClaude {
+		c.JSON(http.StatusOK, dto.ClaudeCountTokensResponse{InputTokens: tokens})
+	} else {
+		c.JSON(http.StatusOK, dto.GeminiCountTokensResponse{TotalTokens: tokens})
+	}
+}
+
 func RelayNotImplemented(c *gin.Context) {
 	err := dto.OpenAIError{
 		Message: "API not implemented",
@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ResellerSubUserRequest struct {
+	Id          int    `json:"id"`
+	Username    string `json:"username" validate:"max=20"`
+	Password    string `json:"password"`
+	DisplayName string `json:"display_name" validate:"max=20"`
+	Quota       int    `json:"quota"`
+	Status      int    `json:"status"`
+	Remark      string `json:"remark" validate:"max=255"`
+}
+
+type ResellerMarkupRequest struct {
+	Markup float64 `json:"markup"`
+}
+
+func validateSubUserPassword(password string) bool {
+	return len(password) >= 8 && len(password) <= 20
+}
+
+func GetResellerSubUsers(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	users, total, err := model.GetResellerSubUsers(c.GetInt("id"), c.Query("keyword"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(users)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetResellerSubUser(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	user, err := model.GetResellerSubUser(c.GetInt("id"), id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, user)
+}
+
+// CreateResellerSubUser 分销商创建子用户
+func CreateResellerSubUser(c *gin.Context) {
+	var req ResellerSubUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" || !validateSubUserPassword(req.Password) {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if err := common.Validate.Struct(&req); err != nil {
+		common.ApiErrorMsg(c, "输入不合法 "+err.Error())
+		return
+	}
+	if req.Quota < 0 {
+		common.ApiErrorMsg(c, "额度不能为负数")
+		return
+	}
+	reseller, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if reseller.ParentId != 0 {
+		common.ApiErrorMsg(c, "子用户无法创建下级用户")
+		return
+	}
+	if req.DisplayName == "" {
+		req.DisplayName = req.Username
+	}
+	user := &model.User{
+		Username:    req.Username,
+		Password:    req.Password,
+		DisplayName: req.DisplayName,
+		Quota:       req.Quota,
+		Remark:      req.Remark,
+	}
+	if err := model.CreateResellerSubUser(reseller, user); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(reseller.Id, model.LogTypeManage, "创建子用户 "+user.Username)
+	common.ApiSuccess(c, gin.H{"id": user.Id})
+}
+
+// UpdateResellerSubUser 分销商修改子用户信息、额度及状态
+func UpdateResellerSubUser(c *gin.Context) {
+	var req ResellerSubUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Id == 0 {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if err := common.Validate.Struct(&req); err != nil {
+		common.ApiErrorMsg(c, "输入不合法 "+err.Error())
+		return
+	}
+	if req.Password != "" && !validateSubUserPassword(req.Password) {
+		common.ApiErrorMsg(c, "密码长度应为 8 到 20 位")
+		return
+	}
+	if req.Quota < 0 {
+		common.ApiErrorMsg(c, "额度不能为负数")
+		return
+	}
+	if req.Status != common.UserStatusEnabled && req.Status != common.UserStatusDisabled {
+		common.ApiErrorMsg(c, "无效的用户状态")
+		return
+	}
+	user, err := model.GetResellerSubUser(c.GetInt("id"), req.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.DisplayName == "" {
+		req.DisplayName = user.Username
+	}
+	if err := model.UpdateResellerSubUser(user, req.DisplayName, req.Password, req.Quota, req.Status, req.Remark); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Password != "" || req.Status == common.UserStatusDisabled {
+		revokeUserSessions(user.Id, "")
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// UpdateResellerMarkup 分销商设置对子用户的加价倍率
+func UpdateResellerMarkup(c *gin.Context) {
+	var req ResellerMarkupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if req.Markup < 1 || req.Markup > 100 {
+		common.ApiErrorMsg(c, "加价倍率需在 1 到 100 之间")
+		return
+	}
+	if err := model.UpdateResellerMarkup(c.GetInt("id"), req.Markup); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetResellerStat(c *gin.Context) {
+	stat, err := model.GetResellerStat(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, stat)
+}
+
+// GetResellerLogs 分销商查看子用户的使用日志
+func GetResellerLogs(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	subUserId, _ := strconv.Atoi(c.Query("user_id"))
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	tokenName := c.Query("token_name")
+	modelName := c.Query("model_name")
+	logs, total, err := model.GetResellerLogs(c.GetInt("id"), subUserId, logType, startTimestamp, endTimestamp, modelName, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func storedResponseNotFound(c *gin.Context, responseId string) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": dto.OpenAIError{
+			Message: common.MessageWithRequestId(fmt.Sprintf("Response with id '%s' not found.", responseId), c.GetString(common.RequestIdKey)),
+			Type:    "invalid_request_error",
+			Code:    "response_not_found",
+		},
+	})
+}
+
+func getUserStoredResponse(c *gin.Context) *model.StoredResponse {
+	responseId := c.Param("id")
+	if !service.IsResponseStoreEnabled() {
+		storedResponseNotFound(c, responseId)
+		return nil
+	}
+	stored, err := model.GetStoredResponse(c.GetInt("id"), responseId, common.GetTimestamp())
+	if err != nil {
+		storedResponseNotFound(c, responseId)
+		return nil
+	}
+	return stored
+}
+
+// GetStoredResponse GET /v1/responses/:id，返回网关保存的响应对象
+func GetStoredResponse(c *gin.Context) {
+	stored := getUserStoredResponse(c)
+	if stored == nil {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", stored.Response)
+}
+
+// DeleteStoredResponse DELETE /v1/responses/:id
+func DeleteStoredResponse(c *gin.Context) {
+	responseId := c.Param("id")
+	deleted := false
+	if service.IsResponseStoreEnabled() {
+		var err error
+		deleted, err = model.DeleteStoredResponse(c.GetInt("id"), responseId)
+		if err != nil {
+			common.SysError("failed to delete stored response: " + err.Error())
+		}
+	}
+	if !deleted {
+		storedResponseNotFound(c, responseId)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      responseId,
+		"object":  "response",
+		"deleted": true,
+	})
+}
+
+// ListStoredResponseInputItems GET /v1/responses/:id/input_items，支持 limit、order、after 分页参数
+func ListStoredResponseInputItems(c *gin.Context) {
+	stored := getUserStoredResponse(c)
+	if stored == nil {
+		return
+	}
+	var items []map[string]any
+	if err := common.Unmarshal(stored.InputItems, &items); err != nil {
+		common.SysError("failed to unmarshal stored response input items: " + err.Error())
+		items = nil
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+	// 默认按时间倒序返回，与 OpenAI 一致
+	if c.DefaultQuery("order", "desc") != "asc" {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if after := c.Query("after"); after != "" {
+		for i, item := range items {
+			if id, _ := item["id"].(string); id == after {
+				items = items[i+1:]
+				break
+			}
+		}
+	}
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+
+	data := make([]map[string]any, 0, len(items))
+	data = append(data, items...)
+	var firstId, lastId any
+	if len(data) > 0 {
+		firstId = data[0]["id"]
+		lastId = data[len(data)-1]["id"]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":   "list",
+		"data":     data,
+		"first_id": firstId,
+		"last_id":  lastId,
+		"has_more": hasMore,
+	})
+}
+
+var autoCleanStoredResponsesOnce sync.Once
+
+// AutomaticallyCleanStoredResponses 定期清理过期的响应
+func AutomaticallyCleanStoredResponses() {
+	// 只在Master节点清理
+	if !common.IsMasterNode {
+		return
+	}
+	autoCleanStoredResponsesOnce.Do(func() {
+		for {
+			if cnt, err := model.DeleteExpiredStoredResponses(common.GetTimestamp()); err != nil {
+				common.SysError("failed to clean expired stored responses: " + err.Error())
+			} else if cnt > 0 {
+				common.SysLog(fmt.Sprintf("cleaned %d expired stored responses", cnt))
+			}
+			time.Sleep(time.Hour)
+		}
+	})
+}
@@ -0,0 +1,730 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/scim"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	scimDefaultCount    = 100
+	scimMaxCount        = 200
+	scimRoleGroupPrefix = "role:"
+)
+
+type scimPatchRequest struct {
+	Schemas    []string              `json:"schemas"`
+	Operations []scim.PatchOperation `json:"Operations"`
+}
+
+// scimGroup SCIM 分组，对应网关的用户分组或通过 RoleGroups 映射的用户角色
+type scimGroup struct {
+	Id     string
+	Name   string
+	Role   int
+	IsRole bool
+}
+
+func (g *scimGroup) hasMember(user *model.User) bool {
+	if g.IsRole {
+		return user.Role == g.Role
+	}
+	return user.Group == g.Name
+}
+
+func scimBaseUrl(c *gin.Context) string {
+	if system_setting.ServerAddress != "" {
+		return strings.TrimSuffix(system_setting.ServerAddress, "/") + "/scim/v2"
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/scim/v2"
+}
+
+func scimTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
+
+func decodeScimBody(c *gin.Context, v any) bool {
+	if err := common.DecodeJson(c.Request.Body, v); err != nil {
+		scim.RenderError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return false
+	}
+	return true
+}
+
+// scimPage 按 startIndex（从 1 开始）与 count 分页
+func scimPage(c *gin.Context, resources []map[string]any) {
+	startIndex, _ := strconv.Atoi(c.Query("startIndex"))
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count := scimDefaultCount
+	if v := c.Query("count"); v != "" {
+		count, _ = strconv.Atoi(v)
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	total := len(resources)
+	start := startIndex - 1
+	if start > total {
+		start = total
+	}
+	end := start + count
+	if end > total {
+		end = total
+	}
+	scim.Render(c, http.StatusOK, scim.ListResponse(resources[start:end], total, startIndex))
+}
+
+// filterScimResources 按 filter 参数过滤资源，返回 false 表示已输出错误
+func filterScimResources(c *gin.Context, resources []map[string]any) ([]map[string]any, bool) {
+	expr := strings.TrimSpace(c.Query("filter"))
+	if expr == "" {
+		return resources, true
+	}
+	filter, err := scim.ParseFilter(expr)
+	if err != nil {
+		scim.RenderError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return nil, false
+	}
+	matched := make([]map[string]any, 0)
+	for _, resource := range resources {
+		if filter.Match(resource) {
+			matched = append(matched, resource)
+		}
+	}
+	return matched, true
+}
+
+func parseScimBool(v any) (bool, bool) {
+	switch value := v.(type) {
+	case bool:
+		return value, true
+	case string:
+		// Azure AD 会以字符串 "True"/"False" 发送布尔值
+		if strings.EqualFold(value, "true") {
+			return true, true
+		}
+		if strings.EqualFold(value, "false") {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+func scimString(resource map[string]any, name string) string {
+	if v, ok := scim.GetAttr(resource, name).(string); ok {
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+// scimUserGroups 用户所属的 SCIM 分组：用户分组以及角色匹配的 RoleGroups
+func scimUserGroups(user *model.User) []any {
+	groups := make([]any, 0)
+	for _, g := range getScimGroups() {
+		if g.hasMember(user) {
+			groups = append(groups, map[string]any{"value": g.Id, "display": g.Name})
+		}
+	}
+	return groups
+}
+
+func scimUserResource(c *gin.Context, data *model.ScimUserWithUser) map[string]any {
+	user, scimUser := data.User, data.ScimUser
+	id := strconv.Itoa(user.Id)
+	resource := map[string]any{
+		"schemas":    []any{scim.SchemaUser},
+		"id":         id,
+		"externalId": scimUser.ExternalId,
+		"userName":   scimUser.UserName,
+		"name": map[string]any{
+			"givenName":  scimUser.GivenName,
+			"familyName": scimUser.FamilyName,
+			"formatted":  strings.TrimSpace(scimUser.GivenName + " " + scimUser.FamilyName),
+		},
+		"displayName": user.DisplayName,
+		"emails":      []any{},
+		"active":      user.Status == common.UserStatusEnabled,
+		"groups":      scimUserGroups(user),
+		"meta": map[string]any{
+			"resourceType": "User",
+			"created":      scimTime(scimUser.CreatedTime),
+			"lastModified": scimTime(scimUser.UpdatedTime),
+			"location":     scimBaseUrl(c) + "/Users/" + id,
+		},
+	}
+	if user.Email != "" {
+		resource["emails"] = []any{map[string]any{"value": user.Email, "type": "work", "primary": true}}
+	}
+	return resource
+}
+
+// applyScimUserResource 将 SCIM 用户资源写回本地用户，groups 为只读属性，通过 Groups 接口维护
+func applyScimUserResource(resource map[string]any, user *model.User, scimUser *model.ScimUser) error {
+	userName := scimString(resource, "userName")
+	if userName == "" {
+		return errors.New("userName is required")
+	}
+	if len(userName) > 255 {
+		return errors.New("userName is too long")
+	}
+	scimUser.UserName = userName
+	scimUser.ExternalId = truncateRunes(scimString(resource, "externalId"), 255)
+	scimUser.GivenName = truncateRunes(scimString(resource, "name.givenName"), 128)
+	scimUser.FamilyName = truncateRunes(scimString(resource, "name.familyName"), 128)
+
+	displayName := scimString(resource, "displayName")
+	if displayName == "" {
+		displayName = scimString(resource, "name.formatted")
+	}
+	if displayName == "" {
+		displayName = strings.TrimSpace(scimUser.GivenName + " " + scimUser.FamilyName)
+	}
+	if displayName == "" {
+		displayName = strings.Split(userName, "@")[0]
+	}
+	user.DisplayName = truncateRunes(displayName, 20)
+
+	email := ""
+	emails, ok := scim.GetAttr(resource, "emails").([]any)
+	if !ok && scim.GetAttr(resource, "emails") != nil {
+		emails = []any{scim.GetAttr(resource, "emails")}
+	}
+	for _, v := range emails {
+		elem, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		value := scimString(elem, "value")
+		if value == "" {
+			continue
+		}
+		if primary, _ := parseScimBool(scim.GetAttr(elem, "primary")); primary || email == "" {
+			email = value
+		}
+	}
+	if email == "" && strings.Contains(userName, "@") {
+		email = userName
+	}
+	user.Email = truncateRunes(email, 50)
+
+	if v := scim.GetAttr(resource, "active"); v != nil {
+		active, ok := parseScimBool(v)
+		if !ok {
+			return errors.New("active must be a boolean")
+		}
+		if active {
+			user.Status = common.UserStatusEnabled
+		} else {
+			user.Status = common.UserStatusDisabled
+		}
+	}
+	return nil
+}
+
+// saveScimUser 保存用户，从启用变为停用时禁用其全部令牌并撤销登录会话
+func saveScimUser(data *model.ScimUserWithUser, wasEnabled bool, roleChanged bool) error {
+	if err := model.UpdateScimUser(data.User, data.ScimUser); err != nil {
+		return err
+	}
+	deactivated := wasEnabled && data.User.Status != common.UserStatusEnabled
+	if deactivated {
+		if err := model.DisableUserTokens(data.User.Id); err != nil {
+			return err
+		}
+	}
+	if deactivated || roleChanged {
+		revokeUserSessions(data.User.Id, "")
+	}
+	return nil
+}
+
+func getScimUserByParam(c *gin.Context) (*model.ScimUserWithUser, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		scim.RenderError(c, http.StatusNotFound, "", "user not found")
+		return nil, false
+	}
+	data, err := model.GetScimUser(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		scim.RenderError(c, http.StatusNotFound, "", "user not found")
+		return nil, false
+	}
+	if err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return nil, false
+	}
+	return data, true
+}
+
+func ScimListUsers(c *gin.Context) {
+	users, err := model.GetAllScimUsers()
+	if err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	resources := make([]map[string]any, 0, len(users))
+	for _, data := range users {
+		resources = append(resources, scimUserResource(c, data))
+	}
+	resources, ok := filterScimResources(c, resources)
+	if !ok {
+		return
+	}
+	scimPage(c, resources)
+}
+
+func ScimGetUser(c *gin.Context) {
+	data, ok := getScimUserByParam(c)
+	if !ok {
+		return
+	}
+	scim.Render(c, http.StatusOK, scimUserResource(c, data))
+}
+
+func ScimCreateUser(c *gin.Context) {
+	var resource map[string]any
+	if !decodeScimBody(c, &resource) {
+		return
+	}
+	user := &model.User{
+		Role:   common.RoleCommonUser,
+		Status: common.UserStatusEnabled,
+		Group:  "default",
+	}
+	scimUser := &model.ScimUser{}
+	if err := applyScimUserResource(resource, user, scimUser); err != nil {
+		scim.RenderError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	taken, err := model.IsScimUserNameTaken(scimUser.UserName, 0)
+	if err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	if taken {
+		scim.RenderError(c, http.StatusConflict, "uniqueness", "userName already exists")
+		return
+	}
+	user.Username, err = generateAvailableUsername(strings.Split(scimUser.UserName, "@")[0], "scim_user")
+	if err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	if err := model.CreateScimUser(user, scimUser); err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	common.SysLog(fmt.Sprintf("SCIM created user %d (%s)", user.Id, scimUser.UserName))
+	data := &model.ScimUserWithUser{ScimUser: scimUser, User: user}
+	result := scimUserResource(c, data)
+	c.Header("Location", scimBaseUrl(c)+"/Users/"+strconv.Itoa(user.Id))
+	scim.Render(c, http.StatusCreated, result)
+}
+
+// updateScimUser 将完整的 SCIM 资源写回用户并保存
+func updateScimUser(c *gin.Context, data *model.ScimUserWithUser, resource map[string]any) {
+	wasEnabled := data.User.Status == common.UserStatusEnabled
+	if err := applyScimUserResource(resource, data.User, data.ScimUser); err != nil {
+		scim.RenderError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	taken, err := model.IsScimUserNameTaken(data.ScimUser.UserName, data.User.Id)
+	if err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	if taken {
+		scim.RenderError(c, http.StatusConflict, "uniqueness", "userName already exists")
+		return
+	}
+	if err := saveScimUser(data, wasEnabled, false); err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scim.Render(c, http.StatusOK, scimUserResource(c, data))
+}
+
+func ScimReplaceUser(c *gin.Context) {
+	data, ok := getScimUserByParam(c)
+	if !ok {
+		return
+	}
+	var resource map[string]any
+	if !decodeScimBody(c, &resource) {
+		return
+	}
+	updateScimUser(c, data, resource)
+}
+
+func ScimPatchUser(c *gin.Context) {
+	data, ok := getScimUserByParam(c)
+	if !ok {
+		return
+	}
+	var req scimPatchRequest
+	if !decodeScimBody(c, &req) {
+		return
+	}
+	resource := scimUserResource(c, data)
+	if err := scim.ApplyPatch(resource, req.Operations); err != nil {
+		renderScimPatchError(c, err)
+		return
+	}
+	updateScimUser(c, data, resource)
+}
+
+// ScimDeleteUser 删除 SCIM 用户，本地用户软删除并禁用令牌、撤销会话
+func ScimDeleteUser(c *gin.Context) {
+	data, ok := getScimUserByParam(c)
+	if !ok {
+		return
+	}
+	if err := model.DeleteScimUser(data.User.Id); err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	if err := model.DisableUserTokens(data.User.Id); err != nil {
+		common.SysError(fmt.Sprintf("failed to disable tokens of user %d: %s", data.User.Id, err.Error()))
+	}
+	revokeUserSessions(data.User.Id, "")
+	common.SysLog(fmt.Sprintf("SCIM deleted user %d (%s)", data.User.Id, data.ScimUser.UserName))
+	c.Status(http.StatusNoContent)
+}
+
+func renderScimPatchError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, scim.ErrInvalidPath):
+		scim.RenderError(c, http.StatusBadRequest, "invalidPath", err.Error())
+	default:
+		scim.RenderError(c, http.StatusBadRequest, "invalidValue", err.Error())
+	}
+}
+
+// getScimGroups 列出可同步的分组：RoleGroups 中配置的角色分组以及全部用户分组
+func getScimGroups() []*scimGroup {
+	groups := make([]*scimGroup, 0)
+	for name, role := range system_setting.GetScimSettings().RoleGroups {
+		if role <= common.RoleGuestUser || role >= common.RoleRootUser {
+			continue
+		}
+		groups = append(groups, &scimGroup{Id: scimRoleGroupPrefix + name, Name: name, Role: role, IsRole: true})
+	}
+	for name := range ratio_setting.GetGroupRatioCopy() {
+		groups = append(groups, &scimGroup{Id: name, Name: name})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Id < groups[j].Id
+	})
+	return groups
+}
+
+func findScimGroup(id string) *scimGroup {
+	for _, g := range getScimGroups() {
+		if g.Id == id {
+			return g
+		}
+	}
+	return nil
+}
+
+// findScimGroupByName 按显示名称查找分组，同名时角色分组优先
+func findScimGroupByName(name string) *scimGroup {
+	var found *scimGroup
+	for _, g := range getScimGroups() {
+		if g.Name == name && (found == nil || g.IsRole) {
+			found = g
+		}
+	}
+	return found
+}
+
+func scimGroupResource(c *gin.Context, g *scimGroup, users []*model.ScimUserWithUser, includeMembers bool) map[string]any {
+	resource := map[string]any{
+		"schemas":     []any{scim.SchemaGroup},
+		"id":          g.Id,
+		"displayName": g.Name,
+		"meta": map[string]any{
+			"resourceType": "Group",
+			"location":     scimBaseUrl(c) + "/Groups/" + g.Id,
+		},
+	}
+	if includeMembers {
+		members := make([]any, 0)
+		for _, data := range users {
+			if g.hasMember(data.User) {
+				members = append(members, map[string]any{
+					"value":   strconv.Itoa(data.User.Id),
+					"display": data.ScimUser.UserName,
+					"$ref":    scimBaseUrl(c) + "/Users/" + strconv.Itoa(data.User.Id),
+				})
+			}
+		}
+		resource["members"] = members
+	}
+	return resource
+}
+
+// scimMemberIds 从 members 属性中取出成员用户 ID
+func scimMemberIds(members any) map[int]bool {
+	ids := make(map[int]bool)
+	list, ok := members.([]any)
+	if !ok && members != nil {
+		list = []any{members}
+	}
+	for _, v := range list {
+		elem, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(fmt.Sprint(elem["value"])))
+		if err == nil {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// setScimGroupMembers 将分组成员调整为 memberIds，不在其中的 SCIM 用户移出分组：
+// 用户分组移出后回到 default，角色分组移出后降为普通用户。不属于 SCIM 的用户 ID 会被忽略
+func setScimGroupMembers(g *scimGroup, users []*model.ScimUserWithUser, memberIds map[int]bool) error {
+	for _, data := range users {
+		want := memberIds[data.User.Id]
+		if g.hasMember(data.User) == want {
+			continue
+		}
+		roleChanged := false
+		if g.IsRole {
+			if want {
+				data.User.Role = g.Role
+			} else {
+				data.User.Role = common.RoleCommonUser
+			}
+			roleChanged = true
+		} else if want {
+			data.User.Group = g.Name
+		} else {
+			data.User.Group = "default"
+		}
+		if err := saveScimUser(data, false, roleChanged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getScimGroupByParam(c *gin.Context) (*scimGroup, []*model.ScimUserWithUser, bool) {
+	g := findScimGroup(c.Param("id"))
+	if g == nil {
+		scim.RenderError(c, http.StatusNotFound, "", "group not found")
+		return nil, nil, false
+	}
+	users, err := model.GetAllScimUsers()
+	if err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return nil, nil, false
+	}
+	return g, users, true
+}
+
+func scimIncludeMembers(c *gin.Context) bool {
+	for _, attr := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attr), "members") {
+			return false
+		}
+	}
+	return true
+}
+
+func ScimListGroups(c *gin.Context) {
+	users, err := model.GetAllScimUsers()
+	if err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	groups := getScimGroups()
+	resources := make([]map[string]any, 0, len(groups))
+	for _, g := range groups {
+		resources = append(resources, scimGroupResource(c, g, users, true))
+	}
+	resources, ok := filterScimResources(c, resources)
+	if !ok {
+		return
+	}
+	if !scimIncludeMembers(c) {
+		for _, resource := range resources {
+			delete(resource, "members")
+		}
+	}
+	scimPage(c, resources)
+}
+
+func ScimGetGroup(c *gin.Context) {
+	g, users, ok := getScimGroupByParam(c)
+	if !ok {
+		return
+	}
+	scim.Render(c, http.StatusOK, scimGroupResource(c, g, users, scimIncludeMembers(c)))
+}
+
+// ScimCreateGroup 分组与角色由网关配置决定，IdP 推送分组时按名称关联已有分组并加入成员
+func ScimCreateGroup(c *gin.Context) {
+	var resource map[string]any
+	if !decodeScimBody(c, &resource) {
+		return
+	}
+	g := findScimGroupByName(scimString(resource, "displayName"))
+	if g == nil {
+		scim.RenderError(c, http.StatusBadRequest, "invalidValue", "group is not configured in the gateway, add it as a user group or in scim.role_groups first")
+		return
+	}
+	users, err := model.GetAllScimUsers()
+	if err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	memberIds := scimMemberIds(scim.GetAttr(resource, "members"))
+	for _, data := range users {
+		if g.hasMember(data.User) {
+			memberIds[data.User.Id] = true
+		}
+	}
+	if err := setScimGroupMembers(g, users, memberIds); err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	c.Header("Location", scimBaseUrl(c)+"/Groups/"+g.Id)
+	scim.Render(c, http.StatusCreated, scimGroupResource(c, g, users, true))
+}
+
+func ScimReplaceGroup(c *gin.Context) {
+	g, users, ok := getScimGroupByParam(c)
+	if !ok {
+		return
+	}
+	var resource map[string]any
+	if !decodeScimBody(c, &resource) {
+		return
+	}
+	if err := setScimGroupMembers(g, users, scimMemberIds(scim.GetAttr(resource, "members"))); err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scim.Render(c, http.StatusOK, scimGroupResource(c, g, users, true))
+}
+
+func ScimPatchGroup(c *gin.Context) {
+	g, users, ok := getScimGroupByParam(c)
+	if !ok {
+		return
+	}
+	var req scimPatchRequest
+	if !decodeScimBody(c, &req) {
+		return
+	}
+	resource := scimGroupResource(c, g, users, true)
+	if err := scim.ApplyPatch(resource, req.Operations); err != nil {
+		renderScimPatchError(c, err)
+		return
+	}
+	if name := scimString(resource, "displayName"); name != g.Name {
+		scim.RenderError(c, http.StatusBadRequest, "mutability", "group displayName cannot be changed")
+		return
+	}
+	if err := setScimGroupMembers(g, users, scimMemberIds(scim.GetAttr(resource, "members"))); err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scim.Render(c, http.StatusOK, scimGroupResource(c, g, users, true))
+}
+
+// ScimDeleteGroup 分组本身保留，只移出全部 SCIM 成员
+func ScimDeleteGroup(c *gin.Context) {
+	g, users, ok := getScimGroupByParam(c)
+	if !ok {
+		return
+	}
+	if err := setScimGroupMembers(g, users, map[int]bool{}); err != nil {
+		scim.RenderError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func ScimServiceProviderConfig(c *gin.Context) {
+	scim.Render(c, http.StatusOK, gin.H{
+		"schemas":        []string{scim.SchemaServiceProviderConfig},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxCount},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with the SCIM bearer token configured in the gateway",
+			"primary":     true,
+		}},
+		"meta": gin.H{"resourceType": "ServiceProviderConfig", "location": scimBaseUrl(c) + "/ServiceProviderConfig"},
+	})
+}
+
+func ScimResourceTypes(c *gin.Context) {
+	resources := []map[string]any{
+		{
+			"schemas":  []any{scim.SchemaResourceType},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   scim.SchemaUser,
+			"meta":     map[string]any{"resourceType": "ResourceType", "location": scimBaseUrl(c) + "/ResourceTypes/User"},
+		},
+		{
+			"schemas":  []any{scim.SchemaResourceType},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   scim.SchemaGroup,
+			"meta":     map[string]any{"resourceType": "ResourceType", "location": scimBaseUrl(c) + "/ResourceTypes/Group"},
+		},
+	}
+	scim.Render(c, http.StatusOK, scim.ListResponse(resources, len(resources), 1))
+}
+
+func ScimSchemas(c *gin.Context) {
+	resources := []map[string]any{
+		{"id": scim.SchemaUser, "name": "User", "description": "User Account"},
+		{"id": scim.SchemaGroup, "name": "Group", "description": "Group"},
+	}
+	scim.Render(c, http.StatusOK, scim.ListResponse(resources, len(resources), 1))
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/relay/channel"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CancelTask 取消未完成的异步任务，上游取消成功后按任务所处阶段退还额度
+func CancelTask(c *gin.Context) {
+	task, taskErr := cancelTask(c, c.GetInt("id"), c.Param("task_id"))
+	if taskErr != nil {
+		c.JSON(taskErr.StatusCode, taskErr)
+		return
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/videos/") {
+		c.JSON(http.StatusOK, task.ToOpenAIVideo())
+		return
+	}
+	c.JSON(http.StatusOK, dto.TaskResponse[any]{
+		Code: "success",
+		Data: relay.TaskModel2Dto(task),
+	})
+}
+
+func cancelTask(c *gin.Context, userId int, taskId string) (*model.Task, *dto.TaskError) {
+	if !operation_setting.GetTaskCancelSetting().Enabled {
+		return nil, service.TaskErrorWrapperLocal(errors.New("task cancellation is disabled"), "task_cancel_disabled", http.StatusForbidden)
+	}
+	task, exist, err := model.GetByTaskId(userId, taskId)
+	if err != nil {
+		return nil, service.TaskErrorWrapper(err, "get_task_failed", http.StatusInternalServerError)
+	}
+	if !exist {
+		return nil, service.TaskErrorWrapperLocal(errors.New("task_not_exist"), "task_not_exist", http.StatusNotFound)
+	}
+	if task.IsFinished() {
+		return nil, service.TaskErrorWrapperLocal(errors.New("task is already finished"), "task_already_finished", http.StatusBadRequest)
+	}
+
+	ch, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		return nil, service.TaskErrorWrapperLocal(err, "channel_not_found", http.StatusBadRequest)
+	}
+	adaptor := relay.GetTaskAdaptor(task.Platform)
+	canceler, ok := adaptor.(channel.TaskCanceler)
+	if adaptor == nil || !ok {
+		return nil, service.TaskErrorWrapperLocal(channel.ErrTaskCancelNotSupported, "cancel_not_supported", http.StatusBadRequest)
+	}
+	resp, err := canceler.CancelTask(getTaskChannelBaseURL(ch), task.GetChannelKey(ch), map[string]any{
+		"task_id": task.TaskID,
+		"action":  task.Action,
+	}, ch.GetSetting().Proxy)
+	if errors.Is(err, channel.ErrTaskCancelNotSupported) {
+		return nil, service.TaskErrorWrapperLocal(err, "cancel_not_supported", http.StatusBadRequest)
+	}
+	if err != nil {
+		return nil, service.TaskErrorWrapper(err, "cancel_task_failed", http.StatusBadGateway)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, service.TaskErrorWrapperLocal(fmt.Errorf("upstream returned status %d: %s", resp.StatusCode, string(body)), "cancel_task_failed", http.StatusBadGateway)
+	}
+
+	preStatus := task.Status
+	now := time.Now().Unix()
+	ok, err = model.CancelUnfinishedTask(task.ID, "cancelled by user", now)
+	if err != nil {
+		return nil, service.TaskErrorWrapper(err, "cancel_task_failed", http.StatusInternalServerError)
+	}
+	if !ok {
+		// 取消期间任务已被轮询更新为终态，返回最新状态
+		latest, err := model.GetTaskById(task.ID)
+		if err != nil {
+			return nil, service.TaskErrorWrapper(err, "get_task_failed", http.StatusInternalServerError)
+		}
+		return latest, nil
+	}
+	task.Status = model.TaskStatusCancelled
+	task.Progress = "100%"
+	task.FailReason = "cancelled by user"
+	task.FinishTime = now
+	if task.ScheduleCallback() {
+		if err := task.SaveCallbackResult(); err != nil {
+			logger.LogError(c, fmt.Sprintf("Failed to schedule callback of task %s: %s", task.TaskID, err.Error()))
+		}
+	}
+
+	refundQuota := int(float64(task.Quota) * getTaskCancelRefundRatio(preStatus))
+	if refundQuota > 0 {
+		refundTask(c, task, refundQuota, fmt.Sprintf("取消异步任务 %s，退还 %s", task.TaskID, logger.LogQuota(refundQuota)))
+	}
+	onTaskFinished(task)
+	return task, nil
+}
+
+// getTaskCancelRefundRatio 尚未开始生成的任务按排队比例退款，已开始生成的按生成中比例退款
+func getTaskCancelRefundRatio(status model.TaskStatus) float64 {
+	setting := operation_setting.GetTaskCancelSetting()
+	ratio := setting.InProgressRefundRatio
+	switch status {
+	case "", model.TaskStatusNotStart, model.TaskStatusSubmitted, model.TaskStatusQueued:
+		ratio = setting.QueuedRefundRatio
+	}
+	return min(max(ratio, 0), 1)
+}
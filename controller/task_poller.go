@@ -0,0 +1,321 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// 异步任务轮询：所有节点都参与轮询，节点通过心跳登记，按 平台+渠道 用一致性哈希分片，
+// 每个节点只加载自己负责且已取得租约的渠道下的任务，处理期间持续续期租约，防止分片切换期间重复查询；
+// 主控租约的持有者负责修复无上游 ID 的任务。
+// 超过最长存活时间的任务在持有渠道租约时标记为失败并退款，与查询互斥。
+// 节点宕机后心跳过期，其负责的渠道会自动分配给其他节点。
+
+const (
+	taskPollerTick        = 5 * time.Second
+	taskPollerLeaderLease = "leader"
+)
+
+var (
+	autoPollTasksOnce sync.Once
+	taskPollerNodeId  = newTaskPollerNodeId()
+
+	// 各渠道下任务的下一次轮询时间，key 为 平台:渠道ID，内层 key 为任务 ID
+	taskNextPollAt     = make(map[string]map[string]int64)
+	taskNextPollAtLock sync.Mutex
+)
+
+type taskPollUnit struct {
+	platform   constant.TaskPlatform
+	channelId  int
+	taskIds    []string
+	expiredIds []string // 超过最长存活时间的任务
+}
+
+func (u *taskPollUnit) key() string {
+	return fmt.Sprintf("%s:%d", u.platform, u.channelId)
+}
+
+func newTaskPollerNodeId() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), common.GetRandomString(6))
+}
+
+// AutomaticallyPollTasks 定时轮询异步任务及 Midjourney 任务的进度
+func AutomaticallyPollTasks() {
+	if !constant.UpdateTask {
+		return
+	}
+	autoPollTasksOnce.Do(func() {
+		common.SysLog(fmt.Sprintf("task poller started, node id: %s", taskPollerNodeId))
+		for {
+			time.Sleep(taskPollerTick)
+			pollTasks()
+		}
+	})
+}
+
+func pollTasks() {
+	ctx := context.TODO()
+	setting := operation_setting.GetTaskPollerSetting()
+	leaseSeconds := max(setting.LeaseSeconds, 3*int(taskPollerTick/time.Second))
+
+	if err := model.HeartbeatTaskPollerNode(taskPollerNodeId); err != nil {
+		common.SysError("failed to report task poller heartbeat: " + err.Error())
+	}
+	nodes, err := model.GetActiveTaskPollerNodes(leaseSeconds)
+	if err != nil {
+		common.SysError("failed to get task poller nodes: " + err.Error())
+	}
+	if len(nodes) == 0 {
+		nodes = []string{taskPollerNodeId}
+	}
+	if model.AcquireTaskPollerLease(taskPollerLeaderLease, taskPollerNodeId, leaseSeconds) {
+		fixNullTaskIds(ctx)
+	}
+
+	// 只取存在未完成任务的渠道，任务在取得渠道租约后再加载
+	units := make(map[string]*taskPollUnit)
+	addUnit := func(platform constant.TaskPlatform, channelId int) {
+		unit := &taskPollUnit{platform: platform, channelId: channelId}
+		if pickTaskPollerNode(nodes, unit.key()) == taskPollerNodeId {
+			units[unit.key()] = unit
+		}
+	}
+	channels, err := model.GetUnfinishedTaskChannels()
+	if err != nil {
+		common.SysError("failed to get unfinished task channels: " + err.Error())
+	}
+	for _, ch := range channels {
+		if ch.Platform != constant.TaskPlatformMidjourney {
+			addUnit(ch.Platform, ch.ChannelId)
+		}
+	}
+	mjChannelIds, err := model.GetUnfinishedMidjourneyChannelIds()
+	if err != nil {
+		common.SysError("failed to get unfinished midjourney channels: " + err.Error())
+	}
+	for _, channelId := range mjChannelIds {
+		addUnit(constant.TaskPlatformMidjourney, channelId)
+	}
+	pruneTaskNextPollAt(units)
+	if len(units) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(setting.MaxChannels, 1))
+	for _, unit := range units {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(unit *taskPollUnit) {
+			defer func() {
+				<-sem
+				wg.Done()
+				if r := recover(); r != nil {
+					common.SysError(fmt.Sprintf("task poller panic on %s: %v", unit.key(), r))
+				}
+			}()
+			runTaskPollUnit(ctx, unit, leaseSeconds)
+		}(unit)
+	}
+	wg.Wait()
+}
+
+func runTaskPollUnit(ctx context.Context, unit *taskPollUnit, leaseSeconds int) {
+	leaseName := unit.key()
+	if !model.AcquireTaskPollerLease(leaseName, taskPollerNodeId, leaseSeconds) {
+		return
+	}
+	defer model.ReleaseTaskPollerLease(leaseName, taskPollerNodeId)
+	stopRenew := renewTaskPollerLease(leaseName, leaseSeconds)
+	defer stopRenew()
+
+	taskM := make(map[string]*model.Task)
+	mjTaskM := make(map[string]*model.Midjourney)
+	if unit.platform == constant.TaskPlatformMidjourney {
+		tasks, err := model.GetUnfinishedMidjourneysByChannel(unit.channelId)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Failed to load midjourney tasks of channel #%d: %s", unit.channelId, err.Error()))
+			return
+		}
+		submitTimes := make(map[string]int64, len(tasks))
+		for _, task := range tasks {
+			mjTaskM[task.MjId] = task
+			// Midjourney 的提交时间为毫秒
+			submitTimes[task.MjId] = task.SubmitTime / 1000
+		}
+		scheduleTaskPollUnit(unit, submitTimes)
+	} else {
+		tasks, err := model.GetUnfinishedTasksByChannel(unit.platform, unit.channelId, constant.TaskQueryLimit)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Failed to load tasks of %s: %s", unit.key(), err.Error()))
+			return
+		}
+		submitTimes := make(map[string]int64, len(tasks))
+		for _, task := range tasks {
+			taskM[task.TaskID] = task
+			submitTime := task.SubmitTime
+			if submitTime == 0 {
+				submitTime = task.CreatedAt
+			}
+			submitTimes[task.TaskID] = submitTime
+		}
+		scheduleTaskPollUnit(unit, submitTimes)
+	}
+
+	if len(unit.expiredIds) > 0 {
+		sweepStuckTasks(ctx, unit, taskM, mjTaskM)
+	}
+	if len(unit.taskIds) == 0 {
+		return
+	}
+	switch unit.platform {
+	case constant.TaskPlatformMidjourney:
+		updateMidjourneyTaskAll(ctx, unit.channelId, unit.taskIds, mjTaskM)
+	case constant.TaskPlatformSuno:
+		_ = updateSunoTaskAll(ctx, unit.channelId, unit.taskIds, taskM)
+	default:
+		if err := updateVideoTaskAll(ctx, unit.platform, unit.channelId, unit.taskIds, taskM); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Channel #%d failed to update video async tasks: %s", unit.channelId, err.Error()))
+		}
+	}
+}
+
+// scheduleTaskPollUnit 按提交时间区分超时任务与本次到期需要查询的任务，并记录下一次轮询时间
+func scheduleTaskPollUnit(unit *taskPollUnit, submitTimes map[string]int64) {
+	now := time.Now().Unix()
+	platform := string(unit.platform)
+	timeout := operation_setting.GetTaskTimeout(platform)
+
+	taskNextPollAtLock.Lock()
+	defer taskNextPollAtLock.Unlock()
+	prev := taskNextPollAt[unit.key()]
+	next := make(map[string]int64, len(submitTimes))
+	for taskId, submitTime := range submitTimes {
+		if timeout > 0 && submitTime > 0 && now-submitTime > timeout {
+			unit.expiredIds = append(unit.expiredIds, taskId)
+			continue
+		}
+		if nextAt, ok := prev[taskId]; ok && nextAt > now {
+			next[taskId] = nextAt
+			continue
+		}
+		unit.taskIds = append(unit.taskIds, taskId)
+		next[taskId] = now + operation_setting.GetTaskPollInterval(platform, now-submitTime)
+	}
+	// 只保留仍未完成的任务
+	taskNextPollAt[unit.key()] = next
+}
+
+// renewTaskPollerLease 在处理渠道期间定期续期租约，返回停止续期的函数
+func renewTaskPollerLease(name string, leaseSeconds int) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Duration(leaseSeconds) * time.Second / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !model.AcquireTaskPollerLease(name, taskPollerNodeId, leaseSeconds) {
+					common.SysError(fmt.Sprintf("failed to renew task poller lease %s", name))
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+func fixNullTaskIds(ctx context.Context) {
+	nullTaskIds, err := model.GetUnfinishedTaskIdsWithoutTaskId()
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Get null task_id tasks error: %v", err))
+	}
+	nullMjIds, err := model.GetUnfinishedMidjourneyIdsWithoutMjId()
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Get null mj_id tasks error: %v", err))
+	}
+	if len(nullTaskIds) > 0 {
+		err := model.TaskBulkUpdateByID(nullTaskIds, map[string]any{
+			"status":   "FAILURE",
+			"progress": "100%",
+		})
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Fix null task_id task error: %v", err))
+		} else {
+			logger.LogInfo(ctx, fmt.Sprintf("Fix null task_id task success: %v", nullTaskIds))
+		}
+	}
+	if len(nullMjIds) > 0 {
+		err := model.MjBulkUpdateByTaskIds(nullMjIds, map[string]any{
+			"status":   "FAILURE",
+			"progress": "100%",
+		})
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Fix null mj_id task error: %v", err))
+		} else {
+			logger.LogInfo(ctx, fmt.Sprintf("Fix null mj_id task success: %v", nullMjIds))
+		}
+	}
+}
+
+// pickTaskPollerNode 最高随机权重哈希，节点增减时只迁移少量渠道
+func pickTaskPollerNode(nodes []string, key string) string {
+	var picked string
+	var best uint64
+	for _, node := range nodes {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(node + "|" + key))
+		if sum := h.Sum64(); picked == "" || sum > best {
+			picked, best = node, sum
+		}
+	}
+	return picked
+}
+
+// pruneTaskNextPollAt 清理已不由本节点负责或已没有未完成任务的渠道的轮询记录
+func pruneTaskNextPollAt(units map[string]*taskPollUnit) {
+	taskNextPollAtLock.Lock()
+	defer taskNextPollAtLock.Unlock()
+	for key := range taskNextPollAt {
+		if _, ok := units[key]; !ok {
+			delete(taskNextPollAt, key)
+		}
+	}
+}
+
+// forEachLimit 以不超过 limit 的并发执行 fn(0..n-1) 并等待全部完成
+func forEachLimit(n int, limit int, fn func(i int)) {
+	if n == 0 {
+		return
+	}
+	limit = min(max(limit, 1), n)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, limit)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// refundTask 退还任务预扣额度（取消任务时可部分退还），通过条件更新保证同一任务只退一次
+func refundTask(ctx context.Context, task *model.Task, quota int, logContent string) bool {
+	if quota == 0 {
+		return false
+	}
+	now := time.Now().Unix()
+	if !model.ClaimTaskRefund(task.ID, now) {
+		logger.LogWarn(ctx, fmt.Sprintf("Task %s already refunded, skip refund", task.TaskID))
+		return false
+	}
+	task.RefundTime = now
+	if err := model.IncreaseUserQuota(task.UserId, quota, false); err != nil {
+		logger.LogWarn(ctx, "Failed to increase user quota: "+err.Error())
+	} else {
+		model.RefundResellerConsumption(task.UserId, quota)
+	}
+	model.RecordRefundLog(task.UserId, taskModelName(task), quota, logContent)
+	return true
+}
+
+// taskModelName 返回任务提交时消费日志使用的模型名称
+func taskModelName(task *model.Task) string {
+	if task.Properties.OriginModelName != "" {
+		return task.Properties.OriginModelName
+	}
+	return service.CoverTaskActionToModelName(task.Platform, task.Action)
+}
+
+// failTask 将未结束的任务标记为失败并退款，任务已结束时返回 false
+func failTask(ctx context.Context, task *model.Task, reason string) (bool, error) {
+	now := time.Now().Unix()
+	ok, err := model.FailUnfinishedTask(task.ID, reason, now)
+	if err != nil || !ok {
+		return false, err
+	}
+	task.Status = model.TaskStatusFailure
+	task.Progress = "100%"
+	task.FailReason = reason
+	task.FinishTime = now
+	if task.ScheduleCallback() {
+		if err := task.SaveCallbackResult(); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Failed to schedule callback of task %s: %s", task.TaskID, err.Error()))
+		}
+	}
+	refundTask(ctx, task, task.Quota, fmt.Sprintf("异步任务 %s 失败（%s），退还 %s", task.TaskID, reason, logger.LogQuota(task.Quota)))
+	onTaskFinished(task)
+	return true, nil
+}
+
+// failPolledTasks 轮询无法继续时逐个将任务标记为失败并退款，已被取消或强制终止的任务保持不变
+func failPolledTasks(ctx context.Context, taskIds []string, taskM map[string]*model.Task, reason string) error {
+	var lastErr error
+	for _, taskId := range taskIds {
+		task := taskM[taskId]
+		if task == nil {
+			continue
+		}
+		if _, err := failTask(ctx, task, reason); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// failMidjourneyTask 将未完成的 Midjourney 任务标记为失败并退款
+func failMidjourneyTask(ctx context.Context, task *model.Midjourney, reason string) (bool, error) {
+	now := time.Now().UnixMilli()
+	ok, err := model.FailUnfinishedMidjourney(task.Id, reason, now)
+	if err != nil || !ok {
+		return false, err
+	}
+	refundMidjourneyTask(ctx, task, fmt.Sprintf("绘图任务 %s 失败（%s），退还 %s", task.MjId, reason, logger.LogQuota(task.Quota)))
+	task.Status = "FAILURE"
+	task.Progress = "100%"
+	task.FailReason = reason
+	task.FinishTime = now
+	service.PublishMidjourneyFinishedEvent(task)
+	return true, nil
+}
+
+// refundMidjourneyTask 退还 Midjourney 任务的额度，轮询与超时清理可能同时处理同一任务，通过条件更新保证只退一次
+func refundMidjourneyTask(ctx context.Context, task *model.Midjourney, logContent string) bool {
+	if task.Quota == 0 {
+		return false
+	}
+	now := time.Now().Unix()
+	if !model.ClaimMidjourneyRefund(task.Id, now) {
+		logger.LogWarn(ctx, fmt.Sprintf("Midjourney task %s already refunded, skip refund", task.MjId))
+		return false
+	}
+	task.RefundTime = now
+	if err := model.IncreaseUserQuota(task.UserId, task.Quota, false); err != nil {
+		logger.LogError(ctx, "fail to increase user quota: "+err.Error())
+	} else {
+		model.RefundResellerConsumption(task.UserId, task.Quota)
+	}
+	model.RecordRefundLog(task.UserId, service.CoverActionToModelName(task.Action), task.Quota, logContent)
+	return true
+}
+
+// sweepStuckTasks 处理超过最长存活时间的任务，在持有渠道租约时调用
+func sweepStuckTasks(ctx context.Context, unit *taskPollUnit, taskM map[string]*model.Task, mjTaskM map[string]*model.Midjourney) {
+	for _, taskId := range unit.expiredIds {
+		var ok bool
+		var err error
+		reason := "任务超时未完成"
+		if unit.platform == constant.TaskPlatformMidjourney {
+			if task := mjTaskM[taskId]; task != nil {
+				ok, err = failMidjourneyTask(ctx, task, reason)
+			}
+		} else if task := taskM[taskId]; task != nil {
+			ok, err = failTask(ctx, task, reason)
+		}
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Failed to expire stuck task %s: %s", taskId, err.Error()))
+		} else if ok {
+			logger.LogInfo(ctx, fmt.Sprintf("Stuck task %s on channel #%d marked as failed", taskId, unit.channelId))
+		}
+	}
+}
+
+type forceTaskRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ForceFailTask 管理员强制将未结束的任务标记为失败并退还额度
+func ForceFailTask(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req forceTaskRequest
+	_ = c.ShouldBindJSON(&req)
+	if req.Reason == "" {
+		req.Reason = "管理员强制终止"
+	}
+	task, err := model.GetTaskById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	ok, err := failTask(c.Request.Context(), task, req.Reason)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !ok {
+		common.ApiError(c, errors.New("任务已结束"))
+		return
+	}
+	common.ApiSuccess(c, task)
+}
+
+// ForceRefundTask 管理员退还任务预扣额度，不改变任务状态，每个任务只能退款一次
+func ForceRefundTask(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req forceTaskRequest
+	_ = c.ShouldBindJSON(&req)
+	if req.Reason == "" {
+		req.Reason = "管理员手动退款"
+	}
+	task, err := model.GetTaskById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if task.Quota == 0 {
+		common.ApiError(c, errors.New("任务没有可退还的额度"))
+		return
+	}
+	if !refundTask(c.Request.Context(), task, task.Quota, fmt.Sprintf("异步任务 %s %s，退还 %s", task.TaskID, req.Reason, logger.LogQuota(task.Quota))) {
+		common.ApiError(c, errors.New("任务已退款"))
+		return
+	}
+	common.ApiSuccess(c, task)
+}
+
+// ForceFailMidjourney 管理员强制将未完成的 Midjourney 任务标记为失败并退还额度
+func ForceFailMidjourney(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req forceTaskRequest
+	_ = c.ShouldBindJSON(&req)
+	if req.Reason == "" {
+		req.Reason = "管理员强制终止"
+	}
+	task := model.GetMjByuId(id)
+	if task == nil {
+		common.ApiError(c, errors.New("任务不存在"))
+		return
+	}
+	ok, err := failMidjourneyTask(c.Request.Context(), task, req.Reason)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !ok {
+		common.ApiError(c, errors.New("任务已结束"))
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
@@ -15,17 +15,11 @@ import (
 	"github.com/QuantumNous/new-api/relay"
 	"github.com/QuantumNous/new-api/relay/channel"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
-)
 
-func UpdateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
-	for channelId, taskIds := range taskChannelM {
-		if err := updateVideoTaskAll(ctx, platform, channelId, taskIds, taskM); err != nil {
-			logger.LogError(ctx, fmt.Sprintf("Channel #%d failed to update video async tasks: %s", channelId, err.Error()))
-		}
-	}
-	return nil
-}
+	"github.com/samber/lo"
+)
 
 func updateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, channelId int, taskIds []string, taskM map[string]*model.Task) error {
 	logger.LogInfo(ctx, fmt.Sprintf("Channel #%d pending video tasks: %d", channelId, len(taskIds)))
@@ -34,11 +28,7 @@ func updateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, cha
 	}
 	cacheGetChannel, err := model.CacheGetChannel(channelId)
 	if err != nil {
-		errUpdate := model.TaskBulkUpdate(taskIds, map[string]any{
-			"fail_reason": fmt.Sprintf("Failed to get channel info, channel ID: %d", channelId),
-			"status":      "FAILURE",
-			"progress":    "100%",
-		})
+		errUpdate := failPolledTasks(ctx, taskIds, taskM, fmt.Sprintf("Failed to get channel info, channel ID: %d", channelId))
 		if errUpdate != nil {
 			common.SysLog(fmt.Sprintf("UpdateVideoTask error: %v", errUpdate))
 		}
@@ -54,19 +44,49 @@ func updateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, cha
 	}
 	info.ApiKey = cacheGetChannel.Key
 	adaptor.Init(info)
-	for _, taskId := range taskIds {
-		if err := updateVideoSingleTask(ctx, adaptor, cacheGetChannel, taskId, taskM); err != nil {
-			logger.LogError(ctx, fmt.Sprintf("Failed to update video task %s: %s", taskId, err.Error()))
+	setting := operation_setting.GetTaskPollerSetting()
+	forEachLimit(len(taskIds), setting.ChannelConcurrency, func(i int) {
+		if err := updateVideoSingleTask(ctx, adaptor, cacheGetChannel, taskIds[i], taskM); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Failed to update video task %s: %s", taskIds[i], err.Error()))
 		}
-	}
+	})
 	return nil
 }
 
-func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, channel *model.Channel, taskId string, taskM map[string]*model.Task) error {
-	baseURL := constant.ChannelBaseURLs[channel.Type]
+func getTaskChannelBaseURL(channel *model.Channel) string {
 	if channel.GetBaseURL() != "" {
-		baseURL = channel.GetBaseURL()
+		return channel.GetBaseURL()
+	}
+	return constant.ChannelBaseURLs[channel.Type]
+}
+
+// chunkTaskIdsByKey 按提交时使用的 Key 分组后再按批拆分，多 Key 渠道的任务只能用各自的 Key 查询
+func chunkTaskIdsByKey(channel *model.Channel, taskIds []string, taskM map[string]*model.Task, batchSize int) ([][]string, []string) {
+	keyTaskIds := make(map[string][]string)
+	keys := make([]string, 0)
+	for _, taskId := range taskIds {
+		key := channel.Key
+		if task := taskM[taskId]; task != nil {
+			key = task.GetChannelKey(channel)
+		}
+		if _, ok := keyTaskIds[key]; !ok {
+			keys = append(keys, key)
+		}
+		keyTaskIds[key] = append(keyTaskIds[key], taskId)
 	}
+	var batches [][]string
+	var batchKeys []string
+	for _, key := range keys {
+		for _, batch := range lo.Chunk(keyTaskIds[key], max(batchSize, 1)) {
+			batches = append(batches, batch)
+			batchKeys = append(batchKeys, key)
+		}
+	}
+	return batches, batchKeys
+}
+
+func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, channel *model.Channel, taskId string, taskM map[string]*model.Task) error {
+	baseURL := getTaskChannelBaseURL(channel)
 	proxy := channel.GetSetting().Proxy
 
 	task := taskM[taskId]
@@ -74,7 +94,7 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 		logger.LogError(ctx, fmt.Sprintf("Task %s not found in taskM", taskId))
 		return fmt.Errorf("task %s not found", taskId)
 	}
-	resp, err := adaptor.FetchTask(baseURL, channel.Key, map[string]any{
+	resp, err := adaptor.FetchTask(baseURL, task.GetChannelKey(channel), map[string]any{
 		"task_id": taskId,
 		"action":  task.Action,
 	}, proxy)
@@ -89,11 +109,17 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 	if err != nil {
 		return fmt.Errorf("readAll failed for task %s: %w", taskId, err)
 	}
+	return applyVideoTaskResult(ctx, adaptor, task, responseBody)
+}
 
+// applyVideoTaskResult 解析上游返回的任务状态并更新任务、处理计费
+func applyVideoTaskResult(ctx context.Context, adaptor channel.TaskAdaptor, task *model.Task, responseBody []byte) error {
+	taskId := task.TaskID
 	logger.LogDebug(ctx, fmt.Sprintf("UpdateVideoSingleTask response: %s", string(responseBody)))
 
 	taskResult := &relaycommon.TaskInfo{}
 	// try parse as New API response format
+	var err error
 	var responseItems dto.TaskResponse[model.Task]
 	if err = common.Unmarshal(responseBody, &responseItems); err == nil && responseItems.IsSuccess() {
 		logger.LogDebug(ctx, fmt.Sprintf("UpdateVideoSingleTask parsed as new api response format: %+v", responseItems))
@@ -142,96 +168,6 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 		if !(len(taskResult.Url) > 5 && taskResult.Url[:5] == "data:") {
 			task.FailReason = taskResult.Url
 		}
-
-		// 如果返回了 total_tokens 并且配置了模型倍率(非固定价格),则重新计费
-		if taskResult.TotalTokens > 0 {
-			// 获取模型名称
-			var taskData map[string]interface{}
-			if err := json.Unmarshal(task.Data, &taskData); err == nil {
-				if modelName, ok := taskData["model"].(string); ok && modelName != "" {
-					// 获取模型价格和倍率
-					modelRatio, hasRatioSetting, _ := ratio_setting.GetModelRatio(modelName)
-					// 只有配置了倍率(非固定价格)时才按 token 重新计费
-					if hasRatioSetting && modelRatio > 0 {
-						// 获取用户和组的倍率信息
-						group := task.Group
-						if group == "" {
-							user, err := model.GetUserById(task.UserId, false)
-							if err == nil {
-								group = user.Group
-							}
-						}
-						if group != "" {
-							groupRatio := ratio_setting.GetGroupRatio(group)
-							userGroupRatio, hasUserGroupRatio := ratio_setting.GetGroupGroupRatio(group, group)
-
-							var finalGroupRatio float64
-							if hasUserGroupRatio {
-								finalGroupRatio = userGroupRatio
-							} else {
-								finalGroupRatio = groupRatio
-							}
-
-							// 计算实际应扣费额度: totalTokens * modelRatio * groupRatio
-							actualQuota := int(float64(taskResult.TotalTokens) * modelRatio * finalGroupRatio)
-
-							// 计算差额
-							preConsumedQuota := task.Quota
-							quotaDelta := actualQuota - preConsumedQuota
-
-							if quotaDelta > 0 {
-								// 需要补扣费
-								logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费后补扣费：%s（实际消耗：%s，预扣费：%s，tokens：%d）",
-									task.TaskID,
-									logger.LogQuota(quotaDelta),
-									logger.LogQuota(actualQuota),
-									logger.LogQuota(preConsumedQuota),
-									taskResult.TotalTokens,
-								))
-								if err := model.DecreaseUserQuota(task.UserId, quotaDelta); err != nil {
-									logger.LogError(ctx, fmt.Sprintf("补扣费失败: %s", err.Error()))
-								} else {
-									model.UpdateUserUsedQuotaAndRequestCount(task.UserId, quotaDelta)
-									model.UpdateChannelUsedQuota(task.ChannelId, quotaDelta)
-									task.Quota = actualQuota // 更新任务记录的实际扣费额度
-
-									// 记录消费日志
-									logContent := fmt.Sprintf("视频任务成功补扣费，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，补扣费 %s",
-										modelRatio, finalGroupRatio, taskResult.TotalTokens,
-										logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota), logger.LogQuota(quotaDelta))
-									model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-								}
-							} else if quotaDelta < 0 {
-								// 需要退还多扣的费用
-								refundQuota := -quotaDelta
-								logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费后返还：%s（实际消耗：%s，预扣费：%s，tokens：%d）",
-									task.TaskID,
-									logger.LogQuota(refundQuota),
-									logger.LogQuota(actualQuota),
-									logger.LogQuota(preConsumedQuota),
-									taskResult.TotalTokens,
-								))
-								if err := model.IncreaseUserQuota(task.UserId, refundQuota, false); err != nil {
-									logger.LogError(ctx, fmt.Sprintf("退还预扣费失败: %s", err.Error()))
-								} else {
-									task.Quota = actualQuota // 更新任务记录的实际扣费额度
-
-									// 记录退款日志
-									logContent := fmt.Sprintf("视频任务成功退还多扣费用，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，退还 %s",
-										modelRatio, finalGroupRatio, taskResult.TotalTokens,
-										logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota), logger.LogQuota(refundQuota))
-									model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-								}
-							} else {
-								// quotaDelta == 0, 预扣费刚好准确
-								logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费准确（%s，tokens：%d）",
-									task.TaskID, logger.LogQuota(actualQuota), taskResult.TotalTokens))
-							}
-						}
-					}
-				}
-			}
-		}
 	case model.TaskStatusFailure:
 		logger.LogJson(ctx, fmt.Sprintf("Task %s failed", taskId), task)
 		task.Status = model.TaskStatusFailure
@@ -255,23 +191,136 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 	if taskResult.Progress != "" {
 		task.Progress = taskResult.Progress
 	}
-	if err := task.Update(); err != nil {
+	task.ScheduleCallback()
+	updated, err := task.UpdateUnfinished()
+	if err != nil {
 		common.SysLog("UpdateVideoTask task error: " + err.Error())
-		shouldRefund = false
+		return nil
+	}
+	if !updated {
+		// 轮询期间任务已被管理员强制终止或被用户取消，以数据库中的结果为准
+		logger.LogWarn(ctx, fmt.Sprintf("Task %s already finished, skip poll result", task.TaskID))
+		return nil
+	}
+	if task.Status == model.TaskStatusSuccess {
+		settleVideoTaskQuota(ctx, task, taskResult)
+	}
+	if preStatus != task.Status {
+		onTaskFinished(task)
 	}
 
 	if shouldRefund {
 		// 任务失败且之前状态不是失败才退还额度，防止重复退还
-		if err := model.IncreaseUserQuota(task.UserId, quota, false); err != nil {
-			logger.LogWarn(ctx, "Failed to increase user quota: "+err.Error())
-		}
-		logContent := fmt.Sprintf("Video async task failed %s, refund %s", task.TaskID, logger.LogQuota(quota))
-		model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+		refundTask(ctx, task, quota, fmt.Sprintf("Video async task failed %s, refund %s", task.TaskID, logger.LogQuota(quota)))
 	}
 
 	return nil
 }
 
+// settleVideoTaskQuota 任务成功且返回了 total_tokens、模型配置了倍率(非固定价格)时按 token 重新计费，
+// 只在轮询结果成功写入后调用，避免任务已被强制终止或取消时再补扣或退还
+func settleVideoTaskQuota(ctx context.Context, task *model.Task, taskResult *relaycommon.TaskInfo) {
+	if taskResult.TotalTokens <= 0 {
+		return
+	}
+	preConsumedQuota := task.Quota
+	defer func() {
+		if task.Quota == preConsumedQuota {
+			return
+		}
+		if err := model.UpdateTaskQuota(task.ID, task.Quota); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to update quota of task %s: %s", task.TaskID, err.Error()))
+		}
+	}()
+	// 获取模型名称
+	var taskData map[string]interface{}
+	if err := json.Unmarshal(task.Data, &taskData); err == nil {
+		if modelName, ok := taskData["model"].(string); ok && modelName != "" {
+			// 获取模型价格和倍率
+			modelRatio, hasRatioSetting, _ := ratio_setting.GetModelRatio(modelName)
+			// 只有配置了倍率(非固定价格)时才按 token 重新计费
+			if hasRatioSetting && modelRatio > 0 {
+				// 获取用户和组的倍率信息
+				group := task.Group
+				if group == "" {
+					user, err := model.GetUserById(task.UserId, false)
+					if err == nil {
+						group = user.Group
+					}
+				}
+				if group != "" {
+					groupRatio := ratio_setting.GetGroupRatio(group)
+					userGroupRatio, hasUserGroupRatio := ratio_setting.GetGroupGroupRatio(group, group)
+
+					var finalGroupRatio float64
+					if hasUserGroupRatio {
+						finalGroupRatio = userGroupRatio
+					} else {
+						finalGroupRatio = groupRatio
+					}
+					finalGroupRatio *= model.GetUserResellerMarkup(task.UserId)
+
+					// 计算实际应扣费额度: totalTokens * modelRatio * groupRatio
+					actualQuota := int(float64(taskResult.TotalTokens) * modelRatio * finalGroupRatio)
+
+					// 计算差额
+					quotaDelta := actualQuota - preConsumedQuota
+
+					if quotaDelta > 0 {
+						// 需要补扣费
+						logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费后补扣费：%s（实际消耗：%s，预扣费：%s，tokens：%d）",
+							task.TaskID,
+							logger.LogQuota(quotaDelta),
+							logger.LogQuota(actualQuota),
+							logger.LogQuota(preConsumedQuota),
+							taskResult.TotalTokens,
+						))
+						if err := model.DecreaseUserQuota(task.UserId, quotaDelta); err != nil {
+							logger.LogError(ctx, fmt.Sprintf("补扣费失败: %s", err.Error()))
+						} else {
+							model.UpdateUserUsedQuotaAndRequestCount(task.UserId, quotaDelta)
+							model.UpdateChannelUsedQuota(task.ChannelId, quotaDelta)
+							task.Quota = actualQuota // 更新任务记录的实际扣费额度
+
+							// 记录消费日志
+							logContent := fmt.Sprintf("视频任务成功补扣费，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，补扣费 %s",
+								modelRatio, finalGroupRatio, taskResult.TotalTokens,
+								logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota), logger.LogQuota(quotaDelta))
+							model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+						}
+					} else if quotaDelta < 0 {
+						// 需要退还多扣的费用
+						refundQuota := -quotaDelta
+						logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费后返还：%s（实际消耗：%s，预扣费：%s，tokens：%d）",
+							task.TaskID,
+							logger.LogQuota(refundQuota),
+							logger.LogQuota(actualQuota),
+							logger.LogQuota(preConsumedQuota),
+							taskResult.TotalTokens,
+						))
+						if err := model.IncreaseUserQuota(task.UserId, refundQuota, false); err != nil {
+							logger.LogError(ctx, fmt.Sprintf("退还预扣费失败: %s", err.Error()))
+						} else {
+							model.RefundResellerConsumption(task.UserId, refundQuota)
+							task.Quota = actualQuota // 更新任务记录的实际扣费额度
+
+							// 记录退款日志
+							logContent := fmt.Sprintf("视频任务成功退还多扣费用，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，退还 %s",
+								modelRatio, finalGroupRatio, taskResult.TotalTokens,
+								logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota), logger.LogQuota(refundQuota))
+							model.RecordRefundLog(task.UserId, taskModelName(task), refundQuota, logContent)
+						}
+					} else {
+						// quotaDelta == 0, 预扣费刚好准确
+						logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费准确（%s，tokens：%d）",
+							task.TaskID, logger.LogQuota(actualQuota), taskResult.TotalTokens))
+					}
+				}
+			}
+		}
+	}
+}
+
 func redactVideoResponseBody(body []byte) []byte {
 	var m map[string]any
 	if err := json.Unmarshal(body, &m); err != nil {
@@ -1,12 +1,16 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -135,6 +139,44 @@ func GetTokenUsage(c *gin.Context) {
 	})
 }
 
+// validateTokenAccessPolicy 校验令牌的 IP 白名单、接口范围、来源白名单与单次请求上限
+func validateTokenAccessPolicy(token *model.Token) error {
+	if token.AllowIps != nil {
+		for _, rule := range strings.FieldsFunc(*token.AllowIps, isTokenRuleSeparator) {
+			if !common.IsIPRule(rule) {
+				return fmt.Errorf("IP 白名单格式错误: %s", rule)
+			}
+		}
+	}
+	endpoints := strings.FieldsFunc(token.AllowEndpoints, isTokenRuleSeparator)
+	for _, endpoint := range endpoints {
+		if !common.IsValidEndpointScope(endpoint) {
+			return fmt.Errorf("未知的接口范围: %s，可选值: %s", endpoint, strings.Join(common.AllEndpointScopes, ", "))
+		}
+	}
+	token.AllowEndpoints = strings.Join(endpoints, ",")
+	for _, origin := range strings.FieldsFunc(token.AllowOrigins, isTokenRuleSeparator) {
+		if strings.HasPrefix(origin, "*.") && len(origin) > 2 {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return fmt.Errorf("来源白名单格式错误: %s，应为 https://example.com 或 *.example.com", origin)
+		}
+	}
+	if len(token.AllowOrigins) > 1024 {
+		return errors.New("来源白名单过长")
+	}
+	if token.MaxInputTokens < 0 || token.MaxOutputTokens < 0 {
+		return errors.New("单次请求 token 上限不能为负数")
+	}
+	return nil
+}
+
+func isTokenRuleSeparator(r rune) bool {
+	return r == '\n' || r == '\r' || r == ',' || r == ' '
+}
+
 func AddToken(c *gin.Context) {
 	token := model.Token{}
 	err := c.ShouldBindJSON(&token)
@@ -149,6 +191,16 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if token.CallbackUrl != "" {
+		if err := service.ValidateTaskCallbackUrl(token.CallbackUrl); err != nil {
+			common.ApiErrorMsg(c, "回调地址不合法: "+err.Error())
+			return
+		}
+	}
+	if err := validateTokenAccessPolicy(&token); err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -158,6 +210,11 @@ func AddToken(c *gin.Context) {
 		common.SysLog("failed to generate token key: " + err.Error())
 		return
 	}
+	callbackSecret, err := common.GenerateRandomCharsKey(32)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	cleanToken := model.Token{
 		UserId:             c.GetInt("id"),
 		Name:               token.Name,
@@ -171,6 +228,12 @@ func AddToken(c *gin.Context) {
 		ModelLimits:        token.ModelLimits,
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
+		CallbackUrl:        token.CallbackUrl,
+		CallbackSecret:     callbackSecret,
+		AllowEndpoints:     token.AllowEndpoints,
+		AllowOrigins:       token.AllowOrigins,
+		MaxInputTokens:     token.MaxInputTokens,
+		MaxOutputTokens:    token.MaxOutputTokens,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -215,6 +278,18 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
+	if token.CallbackUrl != "" {
+		if err := service.ValidateTaskCallbackUrl(token.CallbackUrl); err != nil {
+			common.ApiErrorMsg(c, "回调地址不合法: "+err.Error())
+			return
+		}
+	}
+	if statusOnly == "" {
+		if err := validateTokenAccessPolicy(&token); err != nil {
+			common.ApiErrorMsg(c, err.Error())
+			return
+		}
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		common.ApiError(c, err)
@@ -248,6 +323,19 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.ModelLimits = token.ModelLimits
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
+		cleanToken.CallbackUrl = token.CallbackUrl
+		cleanToken.AllowEndpoints = token.AllowEndpoints
+		cleanToken.AllowOrigins = token.AllowOrigins
+		cleanToken.MaxInputTokens = token.MaxInputTokens
+		cleanToken.MaxOutputTokens = token.MaxOutputTokens
+		// 旧令牌没有回调密钥时补充生成，reset_callback_secret=true 时重新生成
+		if cleanToken.CallbackSecret == "" || c.Query("reset_callback_secret") == "true" {
+			cleanToken.CallbackSecret, err = common.GenerateRandomCharsKey(32)
+			if err != nil {
+				common.ApiError(c, err)
+				return
+			}
+		}
 	}
 	err = cleanToken.Update()
 	if err != nil {
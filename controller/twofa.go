@@ -520,8 +520,10 @@ func AdminDisable2FA(c *gin.Context) {
 		return
 	}
 
-	myRole := c.GetInt("role")
-	if myRole <= targetUser.Role && myRole != common.RoleRootUser {
+	if ok, err := canManageUser(c, targetUser.Id, targetUser.Role); err != nil {
+		common.ApiError(c, err)
+		return
+	} else if !ok {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权操作同级或更高级用户的2FA设置",
@@ -542,6 +544,8 @@ func AdminDisable2FA(c *gin.Context) {
 		return
 	}
 
+	revokeUserSessions(userId, "")
+
 	// 记录操作日志
 	adminId := c.GetInt("id")
 	model.RecordLog(userId, model.LogTypeManage,
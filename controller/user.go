@@ -2,9 +2,11 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,6 +17,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 
 	"github.com/QuantumNous/new-api/constant"
 
@@ -66,6 +69,11 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	setupPasswordLogin(&user, c)
+}
+
+// setupPasswordLogin 密码类登录校验通过后，启用 2FA 的用户先进入待验证状态，否则直接登录
+func setupPasswordLogin(user *model.User, c *gin.Context) {
 	// 检查是否启用2FA
 	if model.IsTwoFAEnabled(user.Id) {
 		// 设置pending session，等待2FA验证
@@ -91,10 +99,11 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	setupLogin(&user, c)
+	setupLogin(user, c)
 }
 
 // setup session & cookies and then return user info
+// 会话存储在用户变化时重新生成会话 ID，登录前的会话 ID 不会被沿用
 func setupLogin(user *model.User, c *gin.Context) {
 	session := sessions.Default(c)
 	session.Set("id", user.Id)
@@ -128,6 +137,8 @@ func setupLogin(user *model.User, c *gin.Context) {
 func Logout(c *gin.Context) {
 	session := sessions.Default(c)
 	session.Clear()
+	// MaxAge < 0 时删除服务端会话记录
+	session.Options(sessions.Options{Path: "/", MaxAge: -1})
 	err := session.Save()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -221,6 +232,7 @@ func Register(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.PublishUserRegisteredEvent(&cleanUser, "password")
 
 	// 获取插入后的用户ID
 	var insertedUser model.User
@@ -315,8 +327,10 @@ func GetUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= user.Role && myRole != common.RoleRootUser {
+	if ok, err := canManageUser(c, user.Id, user.Role); err != nil {
+		common.ApiError(c, err)
+		return
+	} else if !ok {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权获取同级或更高等级用户的信息",
@@ -332,6 +346,14 @@ func GetUser(c *gin.Context) {
 }
 
 func GenerateAccessToken(c *gin.Context) {
+	// 旧版 access token 拥有用户全部权限，不允许通过限定范围的管理密钥生成
+	if rejectAccessKeySession(c) {
+		return
+	}
+	if !system_setting.GetLegacyAccessTokenSettings().Enabled {
+		common.ApiErrorMsg(c, "旧版 access token 已停用，请使用管理密钥")
+		return
+	}
 	id := c.GetInt("id")
 	user, err := model.GetUserById(id, true)
 	if err != nil {
@@ -440,6 +462,15 @@ func GetSelf(c *gin.Context) {
 
 	// 计算用户权限信息
 	permissions := calculateUserPermissions(userRole)
+	if granted, err := model.GetUserPermissions(user.Id, user.Role); err == nil {
+		grants := make([]string, 0, len(granted))
+		for _, p := range common.AllPermissions {
+			if granted[p] {
+				grants = append(grants, p)
+			}
+		}
+		permissions["grants"] = grants
+	}
 
 	// 获取用户设置并提取sidebar_modules
 	userSetting := user.GetSetting()
@@ -457,6 +488,7 @@ func GetSelf(c *gin.Context) {
 		"oidc_id":           user.OidcId,
 		"wechat_id":         user.WeChatId,
 		"telegram_id":       user.TelegramId,
+		"ldap_id":           user.LdapId,
 		"group":             user.Group,
 		"quota":             user.Quota,
 		"used_quota":        user.UsedQuota,
@@ -469,6 +501,8 @@ func GetSelf(c *gin.Context) {
 		"linux_do_id":       user.LinuxDOId,
 		"setting":           user.Setting,
 		"stripe_customer":   user.StripeCustomer,
+		"credit_limit":      user.CreditLimit,
+		"billing_mode":      user.BillingMode,
 		"sidebar_modules":   userSetting.SidebarModules, // 正确提取sidebar_modules字段
 		"permissions":       permissions,                // 新增权限字段
 	}
@@ -598,9 +632,16 @@ func GetUserModels(c *gin.Context) {
 	return
 }
 
+// updateUserRequest 管理端只提交部分字段，未提交 credit_limit 时不修改信用额度
+type updateUserRequest struct {
+	model.User
+	CreditLimit *int `json:"credit_limit"`
+}
+
 func UpdateUser(c *gin.Context) {
-	var updatedUser model.User
-	err := json.NewDecoder(c.Request.Body).Decode(&updatedUser)
+	var req updateUserRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	updatedUser := req.User
 	if err != nil || updatedUser.Id == 0 {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -623,32 +664,54 @@ func UpdateUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= originUser.Role && myRole != common.RoleRootUser {
+	if ok, err := canManageUser(c, originUser.Id, originUser.Role); err != nil {
+		common.ApiError(c, err)
+		return
+	} else if !ok {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权更新同权限等级或更高权限等级的用户信息",
 		})
 		return
 	}
-	if myRole <= updatedUser.Role && myRole != common.RoleRootUser {
+	if ok, err := canManageUser(c, originUser.Id, updatedUser.Role); err != nil {
+		common.ApiError(c, err)
+		return
+	} else if !ok {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权将其他用户权限等级提升到大于等于自己的权限等级",
 		})
 		return
 	}
+	if req.CreditLimit != nil && *req.CreditLimit < 0 {
+		common.ApiErrorMsg(c, "信用额度不能为负数")
+		return
+	}
+	if updatedUser.BillingMode != "" && updatedUser.BillingMode != common.UserBillingModePrepaid && updatedUser.BillingMode != common.UserBillingModePostpaid {
+		common.ApiErrorMsg(c, "无效的计费模式")
+		return
+	}
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
 	}
 	updatePassword := updatedUser.Password != ""
-	if err := updatedUser.Edit(updatePassword); err != nil {
+	if err := updatedUser.Edit(updatePassword, req.CreditLimit); err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	if updatePassword {
+		revokeUserSessions(originUser.Id, "")
+	}
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", logger.LogQuota(originUser.Quota), logger.LogQuota(updatedUser.Quota)))
 	}
+	if req.CreditLimit != nil && originUser.CreditLimit != *req.CreditLimit {
+		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户信用额度从 %s修改为 %s", logger.LogQuota(originUser.CreditLimit), logger.LogQuota(*req.CreditLimit)))
+	}
+	if updatedUser.BillingMode != "" && originUser.BillingMode != updatedUser.BillingMode {
+		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户计费模式从 %s 修改为 %s", originUser.BillingMode, updatedUser.BillingMode))
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -750,6 +813,10 @@ func UpdateSelf(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if updatePassword {
+		// 修改密码后保留当前会话，其余会话失效
+		revokeUserSessions(cleanUser.Id, currentSessionId(c))
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -786,8 +853,17 @@ func DeleteUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= originUser.Role {
+	if originUser.Role == common.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无法删除超级管理员用户",
+		})
+		return
+	}
+	if ok, err := canManageUser(c, originUser.Id, originUser.Role); err != nil {
+		common.ApiError(c, err)
+		return
+	} else if !ok {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权删除同权限等级或更高权限等级的用户",
@@ -802,6 +878,7 @@ func DeleteUser(c *gin.Context) {
 		})
 		return
 	}
+	revokeUserSessions(id, "")
 }
 
 func DeleteSelf(c *gin.Context) {
@@ -821,6 +898,7 @@ func DeleteSelf(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	revokeUserSessions(id, "")
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -849,8 +927,17 @@ func CreateUser(c *gin.Context) {
 	if user.DisplayName == "" {
 		user.DisplayName = user.Username
 	}
-	myRole := c.GetInt("role")
-	if user.Role >= myRole {
+	if user.Role >= common.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无法创建超级管理员用户",
+		})
+		return
+	}
+	if ok, err := canManageUser(c, 0, user.Role); err != nil {
+		common.ApiError(c, err)
+		return
+	} else if !ok {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无法创建权限大于等于自己的用户",
@@ -868,6 +955,7 @@ func CreateUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.PublishUserRegisteredEvent(&cleanUser, "admin")
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -905,8 +993,10 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
-	myRole := c.GetInt("role")
-	if myRole <= user.Role && myRole != common.RoleRootUser {
+	if ok, err := canManageUser(c, user.Id, user.Role); err != nil {
+		common.ApiError(c, err)
+		return
+	} else if !ok {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权更新同权限等级或更高权限等级的用户信息",
@@ -941,7 +1031,10 @@ func ManageUser(c *gin.Context) {
 			return
 		}
 	case "promote":
-		if myRole != common.RoleRootUser {
+		if ok, err := canManageUser(c, user.Id, common.RoleAdminUser); err != nil {
+			common.ApiError(c, err)
+			return
+		} else if !ok {
 			c.JSON(http.StatusOK, gin.H{
 				"success": false,
 				"message": "普通管理员用户无法提升其他用户为管理员",
@@ -956,6 +1049,32 @@ func ManageUser(c *gin.Context) {
 			return
 		}
 		user.Role = common.RoleAdminUser
+	case "reseller":
+		if user.Role != common.RoleCommonUser {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "只有普通用户可以设为分销商",
+			})
+			return
+		}
+		if user.ParentId != 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "分销商的子用户无法设为分销商",
+			})
+			return
+		}
+		if ok, err := canManageUser(c, user.Id, common.RoleResellerUser); err != nil {
+			common.ApiError(c, err)
+			return
+		} else if !ok {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权将其他用户设为分销商",
+			})
+			return
+		}
+		user.Role = common.RoleResellerUser
 	case "demote":
 		if user.Role == common.RoleRootUser {
 			c.JSON(http.StatusOK, gin.H{
@@ -978,6 +1097,11 @@ func ManageUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	// 封禁、删除或降级后使已有会话失效，会话中缓存的状态与角色不再可信
+	switch req.Action {
+	case "disable", "delete", "demote":
+		revokeUserSessions(user.Id, "")
+	}
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -1108,6 +1232,14 @@ type UpdateUserSettingRequest struct {
 	GotifyUrl                  string  `json:"gotify_url,omitempty"`
 	GotifyToken                string  `json:"gotify_token,omitempty"`
 	GotifyPriority             int     `json:"gotify_priority,omitempty"`
+	SlackWebhookUrl            string  `json:"slack_webhook_url,omitempty"`
+	DiscordWebhookUrl          string  `json:"discord_webhook_url,omitempty"`
+	FeishuWebhookUrl           string  `json:"feishu_webhook_url,omitempty"`
+	FeishuSecret               string  `json:"feishu_secret,omitempty"`
+	DingTalkWebhookUrl         string  `json:"dingtalk_webhook_url,omitempty"`
+	DingTalkSecret             string  `json:"dingtalk_secret,omitempty"`
+	TelegramBotToken           string  `json:"telegram_bot_token,omitempty"`
+	TelegramChatId             string  `json:"telegram_chat_id,omitempty"`
 	AcceptUnsetModelRatioModel bool    `json:"accept_unset_model_ratio_model"`
 	RecordIpLog                bool    `json:"record_ip_log"`
 }
@@ -1123,7 +1255,7 @@ func UpdateUserSetting(c *gin.Context) {
 	}
 
 	// 验证预警类型
-	if req.QuotaWarningType != dto.NotifyTypeEmail && req.QuotaWarningType != dto.NotifyTypeWebhook && req.QuotaWarningType != dto.NotifyTypeBark && req.QuotaWarningType != dto.NotifyTypeGotify {
+	if req.QuotaWarningType != dto.NotifyTypeEmail && req.QuotaWarningType != dto.NotifyTypeWebhook && req.QuotaWarningType != dto.NotifyTypeBark && req.QuotaWarningType != dto.NotifyTypeGotify && !service.IsChatOpsNotifyType(req.QuotaWarningType) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无效的预警类型",
@@ -1232,6 +1364,39 @@ func UpdateUserSetting(c *gin.Context) {
 		}
 	}
 
+	// 聊天机器人类通知，验证对应的Webhook地址或机器人配置
+	switch req.QuotaWarningType {
+	case dto.NotifyTypeSlack:
+		if msg := validateNotifyWebhookUrl(req.SlackWebhookUrl, "Slack Webhook地址"); msg != "" {
+			common.ApiErrorMsg(c, msg)
+			return
+		}
+	case dto.NotifyTypeDiscord:
+		if msg := validateNotifyWebhookUrl(req.DiscordWebhookUrl, "Discord Webhook地址"); msg != "" {
+			common.ApiErrorMsg(c, msg)
+			return
+		}
+	case dto.NotifyTypeFeishu:
+		if msg := validateNotifyWebhookUrl(req.FeishuWebhookUrl, "飞书机器人Webhook地址"); msg != "" {
+			common.ApiErrorMsg(c, msg)
+			return
+		}
+	case dto.NotifyTypeDingTalk:
+		if msg := validateNotifyWebhookUrl(req.DingTalkWebhookUrl, "钉钉机器人Webhook地址"); msg != "" {
+			common.ApiErrorMsg(c, msg)
+			return
+		}
+	case dto.NotifyTypeTelegram:
+		if req.TelegramBotToken == "" || req.TelegramChatId == "" {
+			common.ApiErrorMsg(c, "Telegram机器人令牌和会话ID不能为空")
+			return
+		}
+		if strings.ContainsAny(req.TelegramBotToken, "/?#") {
+			common.ApiErrorMsg(c, "无效的Telegram机器人令牌")
+			return
+		}
+	}
+
 	userId := c.GetInt("id")
 	user, err := model.GetUserById(userId, true)
 	if err != nil {
@@ -1277,6 +1442,23 @@ func UpdateUserSetting(c *gin.Context) {
 		}
 	}
 
+	// 如果是聊天机器人类型，添加对应配置到设置中
+	switch req.QuotaWarningType {
+	case dto.NotifyTypeSlack:
+		settings.SlackWebhookUrl = req.SlackWebhookUrl
+	case dto.NotifyTypeDiscord:
+		settings.DiscordWebhookUrl = req.DiscordWebhookUrl
+	case dto.NotifyTypeFeishu:
+		settings.FeishuWebhookUrl = req.FeishuWebhookUrl
+		settings.FeishuSecret = req.FeishuSecret
+	case dto.NotifyTypeDingTalk:
+		settings.DingTalkWebhookUrl = req.DingTalkWebhookUrl
+		settings.DingTalkSecret = req.DingTalkSecret
+	case dto.NotifyTypeTelegram:
+		settings.TelegramBotToken = req.TelegramBotToken
+		settings.TelegramChatId = req.TelegramChatId
+	}
+
 	// 更新用户设置
 	user.SetSetting(settings)
 	if err := user.Update(false); err != nil {
@@ -1292,3 +1474,43 @@ func UpdateUserSetting(c *gin.Context) {
 		"message": "设置已更新",
 	})
 }
+
+// validateNotifyWebhookUrl 校验通知Webhook地址，返回错误信息，为空表示通过
+func validateNotifyWebhookUrl(webhookUrl string, name string) string {
+	if webhookUrl == "" {
+		return name + "不能为空"
+	}
+	if _, err := url.ParseRequestURI(webhookUrl); err != nil {
+		return "无效的" + name
+	}
+	if !strings.HasPrefix(webhookUrl, "https://") && !strings.HasPrefix(webhookUrl, "http://") {
+		return name + "必须以http://或https://开头"
+	}
+	return ""
+}
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.\-]`)
+
+// generateAvailableUsername 由外部账号名生成不超过 20 个字符且未被占用的本地用户名，冲突时追加随机后缀
+func generateAvailableUsername(name string, fallback string) (string, error) {
+	base := usernameInvalidChars.ReplaceAllString(name, "")
+	if base == "" {
+		base = fallback
+	}
+	base = truncateRunes(base, 20)
+	for i := 0; i < 10; i++ {
+		candidate := base
+		if i > 0 {
+			suffix := "_" + common.GetRandomString(4)
+			candidate = truncateRunes(base, 20-len(suffix)) + suffix
+		}
+		exist, err := model.CheckUserExistOrDeleted(candidate, "")
+		if err != nil {
+			return "", err
+		}
+		if !exist {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("failed to generate a unique username")
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+var autoCleanUserSessionsOnce sync.Once
+
+// AutomaticallyCleanUserSessions 定期清理过期的服务端会话
+func AutomaticallyCleanUserSessions() {
+	// 只在Master节点清理
+	if !common.IsMasterNode {
+		return
+	}
+	autoCleanUserSessionsOnce.Do(func() {
+		for {
+			if cnt, err := model.DeleteExpiredUserSessions(); err != nil {
+				common.SysError("failed to clean expired user sessions: " + err.Error())
+			} else if cnt > 0 {
+				common.SysLog(fmt.Sprintf("cleaned %d expired user sessions", cnt))
+			}
+			time.Sleep(time.Hour)
+		}
+	})
+}
+
+// currentSessionId 当前请求的会话 ID，使用 access token 或管理密钥时为空
+func currentSessionId(c *gin.Context) string {
+	if c.GetBool("use_access_token") {
+		return ""
+	}
+	return sessions.Default(c).ID()
+}
+
+// revokeUserSessions 撤销用户的登录会话，失败只记录日志，不影响触发撤销的操作
+func revokeUserSessions(userId int, exceptSessionId string) {
+	if err := model.RevokeUserSessions(userId, exceptSessionId); err != nil {
+		common.SysError(fmt.Sprintf("failed to revoke sessions of user %d: %s", userId, err.Error()))
+	}
+}
+
+func renderUserSessions(c *gin.Context, userId int, sessionId string) {
+	userSessions, err := model.GetUserSessions(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	items := make([]gin.H, 0, len(userSessions))
+	for _, userSession := range userSessions {
+		items = append(items, gin.H{
+			"id":             userSession.Id,
+			"ip":             userSession.Ip,
+			"user_agent":     userSession.UserAgent,
+			"created_time":   userSession.CreatedTime,
+			"last_seen_time": userSession.LastSeenTime,
+			"expires_at":     userSession.ExpiresAt,
+			"current":        userSession.IsCurrentSession(sessionId),
+		})
+	}
+	common.ApiSuccess(c, items)
+}
+
+func GetSelfSessions(c *gin.Context) {
+	renderUserSessions(c, c.GetInt("id"), currentSessionId(c))
+}
+
+func RevokeSelfSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.RevokeUserSession(id, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// RevokeSelfOtherSessions 撤销当前会话以外的全部会话
+func RevokeSelfOtherSessions(c *gin.Context) {
+	if err := model.RevokeUserSessions(c.GetInt("id"), currentSessionId(c)); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// getSessionManagedUser 管理员只能管理低于自己等级的用户的会话
+func getSessionManagedUser(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return 0, false
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return 0, false
+	}
+	if ok, err := canManageUser(c, user.Id, user.Role); err != nil {
+		common.ApiError(c, err)
+		return 0, false
+	} else if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权管理同级或更高等级用户的会话",
+		})
+		return 0, false
+	}
+	return user.Id, true
+}
+
+func GetUserSessions(c *gin.Context) {
+	userId, ok := getSessionManagedUser(c)
+	if !ok {
+		return
+	}
+	renderUserSessions(c, userId, "")
+}
+
+func RevokeUserSession(c *gin.Context) {
+	userId, ok := getSessionManagedUser(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("session_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.RevokeUserSession(id, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func RevokeUserSessions(c *gin.Context) {
+	userId, ok := getSessionManagedUser(c)
+	if !ok {
+		return
+	}
+	if err := model.RevokeUserSessions(userId, ""); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
@@ -60,6 +60,12 @@ func VideoProxy(c *gin.Context) {
 		return
 	}
 
+	// 已转存的结果直接从网关存储读取，避免上游链接过期
+	if artifact := model.GetTaskArtifact(model.ArtifactSourceTask, task.TaskID); artifact != nil {
+		serveArtifact(c, artifact, "public, max-age=86400")
+		return
+	}
+
 	channel, err := model.CacheGetChannel(task.ChannelId)
 	if err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to get task %s: not found", taskID))
@@ -71,12 +77,7 @@ func VideoProxy(c *gin.Context) {
 		})
 		return
 	}
-	baseURL := channel.GetBaseURL()
-	if baseURL == "" {
-		baseURL = "https://api.openai.com"
-	}
 
-	var videoURL string
 	proxy := channel.GetSetting().Proxy
 	client, err := service.GetHttpClientWithProxy(proxy)
 	if err != nil {
@@ -104,38 +105,19 @@ func VideoProxy(c *gin.Context) {
 		return
 	}
 
-	switch channel.Type {
-	case constant.ChannelTypeGemini:
-		apiKey := task.PrivateData.Key
-		if apiKey == "" {
-			logger.LogError(c.Request.Context(), fmt.Sprintf("Missing stored API key for Gemini task %s", taskID))
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": gin.H{
-					"message": "API key not stored for task",
-					"type":    "server_error",
-				},
-			})
-			return
-		}
-
-		videoURL, err = getGeminiVideoURL(channel, task, apiKey)
-		if err != nil {
-			logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to resolve Gemini video URL for task %s: %s", taskID, err.Error()))
-			c.JSON(http.StatusBadGateway, gin.H{
-				"error": gin.H{
-					"message": "Failed to resolve Gemini video URL",
-					"type":    "server_error",
-				},
-			})
-			return
-		}
-		req.Header.Set("x-goog-api-key", apiKey)
-	case constant.ChannelTypeOpenAI, constant.ChannelTypeSora:
-		videoURL = fmt.Sprintf("%s/v1/videos/%s/content", baseURL, task.TaskID)
-		req.Header.Set("Authorization", "Bearer "+channel.Key)
-	default:
-		// Video URL is directly in task.FailReason
-		videoURL = task.FailReason
+	videoURL, headers, err := getTaskVideoSource(task, channel)
+	if err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to resolve video URL for task %s: %s", taskID, err.Error()))
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": gin.H{
+				"message": "Failed to resolve video URL",
+				"type":    "server_error",
+			},
+		})
+		return
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
 	}
 
 	req.URL, err = url.Parse(videoURL)
@@ -187,3 +169,28 @@ func VideoProxy(c *gin.Context) {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to stream video content: %s", err.Error()))
 	}
 }
+
+// getTaskVideoSource 解析任务视频的上游地址及所需的鉴权请求头
+func getTaskVideoSource(task *model.Task, channel *model.Channel) (string, map[string]string, error) {
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = "https://api.openai.com"
+	}
+	switch channel.Type {
+	case constant.ChannelTypeGemini:
+		apiKey := task.PrivateData.Key
+		if apiKey == "" {
+			return "", nil, fmt.Errorf("API key not stored for task")
+		}
+		videoURL, err := getGeminiVideoURL(channel, task, apiKey)
+		if err != nil {
+			return "", nil, err
+		}
+		return videoURL, map[string]string{"x-goog-api-key": apiKey}, nil
+	case constant.ChannelTypeOpenAI, constant.ChannelTypeSora:
+		return fmt.Sprintf("%s/v1/videos/%s/content", baseURL, task.TaskID), map[string]string{"Authorization": "Bearer " + task.GetChannelKey(channel)}, nil
+	default:
+		// Video URL is directly in task.FailReason
+		return task.FailReason, nil, nil
+	}
+}
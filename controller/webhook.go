@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookSubscriptionRequest struct {
+	Id         int      `json:"id"`
+	Name       string   `json:"name"`
+	Url        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+	Global     bool     `json:"global"`
+	Status     int      `json:"status"`
+}
+
+// canSubscribeGlobalEvents 全局订阅会收到渠道状态与用户注册等系统级事件，需同时拥有 channel.read 与 user.read 权限
+func canSubscribeGlobalEvents(c *gin.Context) (bool, error) {
+	granted, err := model.GetUserPermissions(c.GetInt("id"), c.GetInt("role"))
+	if err != nil {
+		return false, err
+	}
+	return granted[common.PermissionChannelRead] && granted[common.PermissionUserRead], nil
+}
+
+func GetWebhookEventTypes(c *gin.Context) {
+	isAdmin, err := canSubscribeGlobalEvents(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	eventTypes := make([]gin.H, 0, len(dto.EventTypes))
+	for _, eventType := range dto.EventTypes {
+		if dto.AdminEventTypes[eventType] && !isAdmin {
+			continue
+		}
+		eventTypes = append(eventTypes, gin.H{
+			"type":   eventType,
+			"global": dto.AdminEventTypes[eventType],
+		})
+	}
+	common.ApiSuccess(c, eventTypes)
+}
+
+func GetWebhookSubscriptions(c *gin.Context) {
+	subscriptions, err := model.GetUserWebhookSubscriptions(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subscriptions)
+}
+
+// validateWebhookSubscription 校验订阅参数，返回规范化后的事件类型列表
+func validateWebhookSubscription(c *gin.Context, req *WebhookSubscriptionRequest) (string, bool) {
+	isAdmin, err := canSubscribeGlobalEvents(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return "", false
+	}
+	if req.Global && !isAdmin {
+		common.ApiErrorMsg(c, "仅管理员可以创建全局订阅")
+		return "", false
+	}
+	if len(req.Name) > 64 {
+		common.ApiErrorMsg(c, "订阅名称过长")
+		return "", false
+	}
+	if len(req.Secret) > 128 {
+		common.ApiErrorMsg(c, "签名密钥过长")
+		return "", false
+	}
+	if req.Url == "" || len(req.Url) > 512 || !(strings.HasPrefix(req.Url, "https://") || strings.HasPrefix(req.Url, "http://")) {
+		common.ApiErrorMsg(c, "Webhook 地址无效")
+		return "", false
+	}
+	fetchSetting := system_setting.GetFetchSetting()
+	if err := common.ValidateURLWithFetchSetting(req.Url, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		common.ApiErrorMsg(c, fmt.Sprintf("Webhook 地址不被允许: %s", err.Error()))
+		return "", false
+	}
+	if len(req.EventTypes) == 0 {
+		common.ApiErrorMsg(c, "请至少选择一个事件类型")
+		return "", false
+	}
+	for _, eventType := range req.EventTypes {
+		if eventType == "*" {
+			continue
+		}
+		if !dto.IsValidEventType(eventType) {
+			common.ApiErrorMsg(c, "无效的事件类型: "+eventType)
+			return "", false
+		}
+		if dto.AdminEventTypes[eventType] && !req.Global {
+			common.ApiErrorMsg(c, "系统事件仅支持全局订阅: "+eventType)
+			return "", false
+		}
+	}
+	if req.Status != common.WebhookSubscriptionStatusEnabled && req.Status != common.WebhookSubscriptionStatusDisabled {
+		req.Status = common.WebhookSubscriptionStatusEnabled
+	}
+	return strings.Join(req.EventTypes, ","), true
+}
+
+func AddWebhookSubscription(c *gin.Context) {
+	var req WebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	eventTypes, ok := validateWebhookSubscription(c, &req)
+	if !ok {
+		return
+	}
+	if req.Secret == "" {
+		req.Secret = common.GetRandomString(32)
+	}
+	subscription := &model.WebhookSubscription{
+		UserId:     c.GetInt("id"),
+		Name:       req.Name,
+		Url:        req.Url,
+		Secret:     req.Secret,
+		EventTypes: eventTypes,
+		Global:     req.Global,
+		Status:     req.Status,
+	}
+	if err := subscription.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subscription)
+}
+
+func UpdateWebhookSubscription(c *gin.Context) {
+	var req WebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Id == 0 {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	subscription, err := model.GetWebhookSubscriptionById(req.Id, c.GetInt("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "订阅不存在")
+		return
+	}
+	eventTypes, ok := validateWebhookSubscription(c, &req)
+	if !ok {
+		return
+	}
+	subscription.Name = req.Name
+	subscription.Url = req.Url
+	subscription.EventTypes = eventTypes
+	subscription.Global = req.Global
+	subscription.Status = req.Status
+	// 未填写密钥时保留原密钥
+	if req.Secret != "" {
+		subscription.Secret = req.Secret
+	}
+	if err := subscription.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subscription)
+}
+
+func DeleteWebhookSubscription(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteWebhookSubscription(id, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetWebhookDeliveries(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	subscriptionId, _ := strconv.Atoi(c.Query("subscription_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	params := model.WebhookDeliveryQueryParams{
+		SubscriptionId: subscriptionId,
+		EventType:      c.Query("event_type"),
+		Status:         c.Query("status"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+	deliveries, total, err := model.GetUserWebhookDeliveries(c.GetInt("id"), params, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(deliveries)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func RedeliverWebhook(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	delivery, err := model.GetWebhookDeliveryById(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "投递记录不存在")
+		return
+	}
+	if err := model.ResetWebhookDelivery(delivery); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.DeliverWebhook(delivery)
+	common.ApiSuccess(c, delivery)
+}
+
+var autoRetryWebhookDeliveriesOnce sync.Once
+
+// AutomaticallyRetryWebhookDeliveries 定时重试到期的事件投递，投递前会抢占记录，可在多个节点同时运行
+func AutomaticallyRetryWebhookDeliveries() {
+	autoRetryWebhookDeliveriesOnce.Do(func() {
+		lastCleanup := time.Now()
+		for {
+			time.Sleep(10 * time.Second)
+			service.RetryDueWebhookDeliveries()
+			service.RetryDueTaskCallbacks()
+			if common.IsMasterNode && time.Since(lastCleanup) > time.Hour {
+				service.CleanupWebhookDeliveries()
+				lastCleanup = time.Now()
+			}
+		}
+	})
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -102,6 +103,7 @@ func WeChatAuth(c *gin.Context) {
 				})
 				return
 			}
+			service.PublishUserRegisteredEvent(&user, "wechat")
 		} else {
 			c.JSON(http.StatusOK, gin.H{
 				"success": false,
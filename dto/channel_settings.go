@@ -7,6 +7,14 @@ type ChannelSettings struct {
 	PassThroughBodyEnabled bool   `json:"pass_through_body_enabled,omitempty"`
 	SystemPrompt           string `json:"system_prompt,omitempty"`
 	SystemPromptOverride   bool   `json:"system_prompt_override,omitempty"`
+	// 结构化输出：native 仅校验，prompt 注入 schema 提示词，tool 强制工具调用，为空不处理
+	StructuredOutputMode string `json:"structured_output_mode,omitempty"`
+	// 结构化输出校验失败后重新请求的次数，为 0 时只做本地修复
+	StructuredOutputMaxRetries int `json:"structured_output_max_retries,omitempty"`
+	// 通过系统提示词模拟函数调用，用于不支持 tools 的上游
+	ToolCallEmulation bool `json:"tool_call_emulation,omitempty"`
+	// 上游原生执行 mcp 工具（如 OpenAI Responses API）时透传，不由网关执行
+	MCPPassThrough bool `json:"mcp_pass_through,omitempty"`
 }
 
 type VertexKeyType string
@@ -0,0 +1,47 @@
+package dto
+
+const (
+	EventTypeTopupCompleted  = "topup.completed"
+	EventTypeChannelDisabled = "channel.disabled"
+	EventTypeChannelEnabled  = "channel.enabled"
+	EventTypeTokenExhausted  = "token.exhausted"
+	EventTypeTaskFinished    = "task.finished"
+	EventTypeUserRegistered  = "user.registered"
+	EventTypeQuotaLow        = "quota.low"
+)
+
+// EventTypes 所有可订阅的事件类型
+var EventTypes = []string{
+	EventTypeTopupCompleted,
+	EventTypeChannelDisabled,
+	EventTypeChannelEnabled,
+	EventTypeTokenExhausted,
+	EventTypeTaskFinished,
+	EventTypeUserRegistered,
+	EventTypeQuotaLow,
+}
+
+// AdminEventTypes 系统级事件，仅管理员的全局订阅可以接收
+var AdminEventTypes = map[string]bool{
+	EventTypeChannelDisabled: true,
+	EventTypeChannelEnabled:  true,
+	EventTypeUserRegistered:  true,
+}
+
+func IsValidEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event 对外投递的事件负载
+type Event struct {
+	Id        string         `json:"id"`
+	Type      string         `json:"type"`
+	UserId    int            `json:"user_id,omitempty"`
+	CreatedAt int64          `json:"created_at"`
+	Data      map[string]any `json:"data"`
+}
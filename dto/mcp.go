@@ -0,0 +1,73 @@
+package dto
+
+import "encoding/json"
+
+// 请求中 type 为 mcp 的工具与网关返回的 mcp 输出项，字段与 OpenAI Responses API 一致
+
+const (
+	ToolTypeMCP = "mcp"
+
+	MCPItemTypeListTools        = "mcp_list_tools"
+	MCPItemTypeCall             = "mcp_call"
+	MCPItemTypeApprovalRequest  = "mcp_approval_request"
+	MCPItemTypeApprovalResponse = "mcp_approval_response"
+)
+
+type MCPToolOptions struct {
+	ServerLabel       string            `json:"server_label,omitempty"`
+	ServerUrl         string            `json:"server_url,omitempty"`
+	ServerDescription string            `json:"server_description,omitempty"`
+	Headers           map[string]string `json:"headers,omitempty"`
+	Authorization     string            `json:"authorization,omitempty"`
+	// 字符串数组，或 {"tool_names": [...], "read_only": true}
+	AllowedTools json.RawMessage `json:"allowed_tools,omitempty"`
+	// "always"、"never"，或 {"always": {"tool_names": [...]}, "never": {"tool_names": [...]}}，默认 always
+	RequireApproval json.RawMessage `json:"require_approval,omitempty"`
+}
+
+type MCPTool struct {
+	Type string `json:"type"`
+	MCPToolOptions
+}
+
+type MCPListedTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema,omitempty"`
+	Annotations map[string]any  `json:"annotations,omitempty"`
+}
+
+type MCPListToolsItem struct {
+	Type        string          `json:"type"`
+	ID          string          `json:"id"`
+	ServerLabel string          `json:"server_label"`
+	Tools       []MCPListedTool `json:"tools"`
+	Error       *string         `json:"error,omitempty"`
+}
+
+type MCPCallItem struct {
+	Type              string  `json:"type"`
+	ID                string  `json:"id"`
+	ServerLabel       string  `json:"server_label"`
+	Name              string  `json:"name"`
+	Arguments         string  `json:"arguments"`
+	Output            *string `json:"output"`
+	Error             *string `json:"error"`
+	ApprovalRequestID string  `json:"approval_request_id,omitempty"`
+	Status            string  `json:"status,omitempty"`
+}
+
+type MCPApprovalRequestItem struct {
+	Type        string `json:"type"`
+	ID          string `json:"id"`
+	ServerLabel string `json:"server_label"`
+	Name        string `json:"name"`
+	Arguments   string `json:"arguments"`
+}
+
+type MCPApprovalResponse struct {
+	Type              string `json:"type,omitempty"`
+	ApprovalRequestID string `json:"approval_request_id"`
+	Approve           bool   `json:"approve"`
+	Reason            string `json:"reason,omitempty"`
+}
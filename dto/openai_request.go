@@ -96,6 +96,8 @@ type GeneralOpenAIRequest struct {
 	ReturnImages           bool            `json:"return_images,omitempty"`
 	ReturnRelatedQuestions bool            `json:"return_related_questions,omitempty"`
 	SearchMode             string          `json:"search_mode,omitempty"`
+	// 对网关返回的 mcp_approval_request 的批准结果，不会发往上游
+	MCPApprovals []MCPApprovalResponse `json:"mcp_approvals,omitempty"`
 }
 
 func (r *GeneralOpenAIRequest) GetTokenCountMeta() *types.TokenCountMeta {
@@ -241,6 +243,8 @@ type ToolCallRequest struct {
 	Type     string          `json:"type"`
 	Function FunctionRequest `json:"function,omitempty"`
 	Custom   json.RawMessage `json:"custom,omitempty"`
+	// type 为 mcp 时的服务配置，由网关执行，不会发往上游
+	*MCPToolOptions
 }
 
 type FunctionRequest struct {
@@ -968,7 +972,8 @@ func (r *OpenAIResponsesRequest) ParseInput() []MediaInput {
 						continue
 					}
 					switch typeVal {
-					case "input_text":
+					case "input_text", "output_text":
+						// output_text 来自展开 previous_response_id 后的历史输出
 						text, _ := item["text"].(string)
 						mediaInputs = append(mediaInputs, MediaInput{Type: "input_text", Text: text})
 					case "input_image":
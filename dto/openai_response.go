@@ -44,6 +44,8 @@ type OpenAITextResponse struct {
 	Choices []OpenAITextResponseChoice `json:"choices"`
 	Error   any                        `json:"error,omitempty"`
 	Usage   `json:"usage"`
+	// 网关执行 mcp 工具时产生的输出项
+	MCPOutput []any `json:"mcp_output,omitempty"`
 }
 
 // GetOpenAIError 从动态错误类型中提取OpenAIError结构
@@ -146,6 +148,7 @@ type ChatCompletionsStreamResponse struct {
 	SystemFingerprint *string                               `json:"system_fingerprint"`
 	Choices           []ChatCompletionsStreamResponseChoice `json:"choices"`
 	Usage             *Usage                                `json:"usage"`
+	MCPOutput         []any                                 `json:"mcp_output,omitempty"`
 }
 
 func (c *ChatCompletionsStreamResponse) IsFinished() bool {
@@ -10,6 +10,14 @@ type UserSetting struct {
 	GotifyUrl             string  `json:"gotify_url,omitempty"`                     // GotifyUrl Gotify服务器地址
 	GotifyToken           string  `json:"gotify_token,omitempty"`                   // GotifyToken Gotify应用令牌
 	GotifyPriority        int     `json:"gotify_priority"`                          // GotifyPriority Gotify消息优先级
+	SlackWebhookUrl       string  `json:"slack_webhook_url,omitempty"`              // SlackWebhookUrl Slack Incoming Webhook地址
+	DiscordWebhookUrl     string  `json:"discord_webhook_url,omitempty"`            // DiscordWebhookUrl Discord Webhook地址
+	FeishuWebhookUrl      string  `json:"feishu_webhook_url,omitempty"`             // FeishuWebhookUrl 飞书/Lark机器人Webhook地址
+	FeishuSecret          string  `json:"feishu_secret,omitempty"`                  // FeishuSecret 飞书机器人签名校验密钥
+	DingTalkWebhookUrl    string  `json:"dingtalk_webhook_url,omitempty"`           // DingTalkWebhookUrl 钉钉机器人Webhook地址
+	DingTalkSecret        string  `json:"dingtalk_secret,omitempty"`                // DingTalkSecret 钉钉机器人加签密钥
+	TelegramBotToken      string  `json:"telegram_bot_token,omitempty"`             // TelegramBotToken Telegram机器人令牌
+	TelegramChatId        string  `json:"telegram_chat_id,omitempty"`               // TelegramChatId Telegram会话ID
 	AcceptUnsetRatioModel bool    `json:"accept_unset_model_ratio_model,omitempty"` // AcceptUnsetRatioModel 是否接受未设置价格的模型
 	RecordIpLog           bool    `json:"record_ip_log,omitempty"`                  // 是否记录请求和错误日志IP
 	SidebarModules        string  `json:"sidebar_modules,omitempty"`                // SidebarModules 左侧边栏模块配置
@@ -20,4 +28,10 @@ var (
 	NotifyTypeWebhook = "webhook" // Webhook
 	NotifyTypeBark    = "bark"    // Bark 推送
 	NotifyTypeGotify  = "gotify"  // Gotify 推送
+
+	NotifyTypeSlack    = "slack"    // Slack Incoming Webhook
+	NotifyTypeDiscord  = "discord"  // Discord Webhook
+	NotifyTypeFeishu   = "feishu"   // 飞书/Lark 机器人
+	NotifyTypeDingTalk = "dingtalk" // 钉钉机器人
+	NotifyTypeTelegram = "telegram" // Telegram 机器人
 )
@@ -12,7 +12,6 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
-	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/controller"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/middleware"
@@ -23,7 +22,6 @@ import (
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
@@ -102,14 +100,16 @@ func main() {
 
 	go controller.AutomaticallyTestChannels()
 
-	if common.IsMasterNode && constant.UpdateTask {
-		gopool.Go(func() {
-			controller.UpdateMidjourneyTaskBulk()
-		})
-		gopool.Go(func() {
-			controller.UpdateTaskBulk()
-		})
-	}
+	go controller.AutomaticallyGenerateInvoices()
+	go controller.AutomaticallyRetryWebhookDeliveries()
+	go controller.AutomaticallySettleAffiliateCommissions()
+	go controller.AutomaticallyCleanupArtifacts()
+	go controller.AutomaticallyCleanUserSessions()
+	go controller.AutomaticallyCleanEphemeralKeys()
+	go controller.AutomaticallyCleanStoredResponses()
+
+	// 所有节点均参与任务轮询，通过租约协调分片
+	go controller.AutomaticallyPollTasks()
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		common.BatchUpdateEnabled = true
 		common.SysLog("batch update enabled with interval " + strconv.Itoa(common.BatchUpdateInterval) + "s")
@@ -135,12 +135,22 @@ func main() {
 			},
 		})
 	}))
+	// 配置 TRUSTED_PROXIES（逗号分隔的 IP 或 CIDR）后，只信任这些代理传入的 X-Forwarded-For
+	if trustedProxies := os.Getenv("TRUSTED_PROXIES"); trustedProxies != "" {
+		proxies := strings.Split(trustedProxies, ",")
+		for i := range proxies {
+			proxies[i] = strings.TrimSpace(proxies[i])
+		}
+		if err := server.SetTrustedProxies(proxies); err != nil {
+			common.FatalLog("invalid TRUSTED_PROXIES: " + err.Error())
+		}
+	}
 	// This will cause SSE not to work!!!
 	//server.Use(gzip.Gzip(gzip.DefaultCompression))
 	server.Use(middleware.RequestId())
 	middleware.SetUpLogger(server)
-	// Initialize session store
-	store := cookie.NewStore([]byte(common.SessionSecret))
+	// Initialize session store，会话保存在服务端，可查看及撤销
+	store := model.NewSessionStore([]byte(common.SessionSecret))
 	store.Options(sessions.Options{
 		Path:     "/",
 		MaxAge:   2592000, // 30 days
@@ -148,6 +158,7 @@ func main() {
 		Secure:   false,
 		SameSite: http.SameSiteStrictMode,
 	})
+	server.Use(middleware.SessionClientIp())
 	server.Use(sessions.Sessions("session", store))
 
 	InjectUmamiAnalytics()
@@ -3,6 +3,7 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -27,13 +29,14 @@ func validUserInfo(username string, role int) bool {
 	return true
 }
 
-func authHelper(c *gin.Context, minRole int) {
+func authHelper(c *gin.Context, minRole int, permissions ...string) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
 	id := session.Get("id")
 	status := session.Get("status")
 	useAccessToken := false
+	var accessKey *model.AccessKey
 	if username == nil {
 		// Check access token
 		accessToken := c.Request.Header.Get("Authorization")
@@ -45,7 +48,33 @@ func authHelper(c *gin.Context, minRole int) {
 			c.Abort()
 			return
 		}
-		user := model.ValidateAccessToken(accessToken)
+		var user *model.User
+		if strings.HasPrefix(strings.TrimPrefix(accessToken, "Bearer "), model.AccessKeyPrefix) {
+			key, err := model.ValidateAccessKey(accessToken, c.ClientIP())
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"success": false,
+					"message": "无权进行此操作，" + err.Error(),
+				})
+				c.Abort()
+				return
+			}
+			user, err = model.GetUserById(key.UserId, false)
+			if err != nil {
+				user = nil
+			}
+			accessKey = key
+		} else {
+			if !system_setting.GetLegacyAccessTokenSettings().Enabled {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"success": false,
+					"message": "无权进行此操作，旧版 access token 已停用，请使用管理密钥",
+				})
+				c.Abort()
+				return
+			}
+			user = model.ValidateAccessToken(accessToken)
+		}
 		if user != nil && user.Username != "" {
 			if !validUserInfo(user.Username, user.Role) {
 				c.JSON(http.StatusOK, gin.H{
@@ -122,12 +151,45 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
+	if accessKey != nil && len(permissions) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权进行此操作，管理密钥不能访问该接口",
+		})
+		c.Abort()
+		return
+	}
+	if len(permissions) > 0 {
+		granted, err := model.GetUserPermissions(id.(int), role.(int))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权进行此操作，获取用户权限失败",
+			})
+			c.Abort()
+			return
+		}
+		for _, permission := range permissions {
+			// 使用管理密钥时，权限还需在密钥的范围内
+			if !granted[permission] || (accessKey != nil && !accessKey.HasScope(permission)) {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "无权进行此操作，缺少权限 " + permission,
+				})
+				c.Abort()
+				return
+			}
+		}
+	}
 	c.Set("username", username)
 	c.Set("role", role)
 	c.Set("id", id)
 	c.Set("group", session.Get("group"))
 	c.Set("user_group", session.Get("group"))
 	c.Set("use_access_token", useAccessToken)
+	if accessKey != nil {
+		c.Set("access_key_id", accessKey.Id)
+	}
 
 	//userCache, err := model.GetUserCache(id.(int))
 	//if err != nil {
@@ -160,6 +222,12 @@ func UserAuth() func(c *gin.Context) {
 	}
 }
 
+func ResellerAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleResellerUser)
+	}
+}
+
 func AdminAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		authHelper(c, common.RoleAdminUser)
@@ -172,6 +240,13 @@ func RootAuth() func(c *gin.Context) {
 	}
 }
 
+// PermissionAuth 要求用户拥有全部指定权限，权限来自内置角色预设及分配的自定义角色
+func PermissionAuth(permissions ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleGuestUser, permissions...)
+	}
+}
+
 func WssAuth(c *gin.Context) {
 
 }
@@ -228,6 +303,28 @@ func TokenAuth() func(c *gin.Context) {
 			parts = strings.Split(key, "-")
 			key = parts[0]
 		}
+		// 临时密钥换成签发令牌继续校验，消费计入签发令牌
+		var ephemeralKey *model.EphemeralKey
+		if model.IsEphemeralKey(key) {
+			ek, err := model.ValidateEphemeralKey(key)
+			if err != nil {
+				abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error(), "invalid_ephemeral_key")
+				return
+			}
+			parent, err := model.GetTokenById(ek.TokenId)
+			if err != nil {
+				abortWithOpenAiMessage(c, http.StatusUnauthorized, "临时密钥的签发令牌不可用", "invalid_ephemeral_key")
+				return
+			}
+			// 临时密钥只能用于签发时面向的 realtime 会话，不能访问其他接口
+			if common.EndpointScopeOfPath(c.Request.URL.Path) != common.EndpointScopeRealtime || strings.HasPrefix(c.Request.URL.Path, "/v1/realtime/client_secrets") {
+				abortWithOpenAiMessage(c, http.StatusForbidden, "临时密钥只能用于 realtime 接口", "endpoint_not_allowed")
+				return
+			}
+			ephemeralKey = ek
+			key = parent.Key
+			parts = parts[:1]
+		}
 		token, err := model.ValidateUserToken(key)
 		if token != nil {
 			id := c.GetInt("id")
@@ -240,13 +337,18 @@ func TokenAuth() func(c *gin.Context) {
 			return
 		}
 
-		allowIpsMap := token.GetIpLimitsMap()
-		if len(allowIpsMap) != 0 {
-			clientIp := c.ClientIP()
-			if _, ok := allowIpsMap[clientIp]; !ok {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中")
-				return
-			}
+		// 临时密钥沿用签发令牌的 IP 白名单
+		if !token.IsIpAllowed(c.ClientIP()) {
+			abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中", "ip_not_allowed")
+			return
+		}
+		if !token.IsOriginAllowed(requestOrigin(c)) {
+			abortWithOpenAiMessage(c, http.StatusForbidden, "请求来源不在令牌允许访问的列表中", "origin_not_allowed")
+			return
+		}
+		if scope := common.EndpointScopeOfPath(c.Request.URL.Path); !token.IsEndpointAllowed(scope) {
+			abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("该令牌无权访问 %s 接口", scope), "endpoint_not_allowed")
+			return
 		}
 
 		userCache, err := model.GetUserCache(token.UserId)
@@ -262,6 +364,19 @@ func TokenAuth() func(c *gin.Context) {
 
 		userCache.WriteContext(c)
 
+		// 分销商被封禁时其子用户一并停用
+		if userCache.ParentId != 0 {
+			resellerCache, err := model.GetUserCache(userCache.ParentId)
+			if err != nil {
+				abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if resellerCache.Status != common.UserStatusEnabled {
+				abortWithOpenAiMessage(c, http.StatusForbidden, "用户已被封禁")
+				return
+			}
+		}
+
 		userGroup := userCache.Group
 		tokenGroup := token.Group
 		if tokenGroup != "" {
@@ -285,6 +400,15 @@ func TokenAuth() func(c *gin.Context) {
 		if err != nil {
 			return
 		}
+		if ephemeralKey != nil {
+			common.SetContextKey(c, constant.ContextKeyEphemeralKeyId, ephemeralKey.Id)
+			// 临时密钥不继承签发令牌的任务回调地址
+			common.SetContextKey(c, constant.ContextKeyTokenCallbackUrl, "")
+			if ephemeralKey.Model != "" {
+				c.Set("token_model_limit_enabled", true)
+				c.Set("token_model_limit", map[string]bool{ephemeralKey.Model: true})
+			}
+		}
 		c.Next()
 	}
 }
@@ -308,6 +432,9 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 		c.Set("token_model_limit_enabled", false)
 	}
 	c.Set("token_group", token.Group)
+	c.Set("token_callback_url", token.CallbackUrl)
+	common.SetContextKey(c, constant.ContextKeyTokenMaxInputTokens, token.MaxInputTokens)
+	common.SetContextKey(c, constant.ContextKeyTokenMaxOutputTokens, token.MaxOutputTokens)
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
@@ -318,3 +445,19 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	return nil
 }
+
+// requestOrigin 返回请求的来源，优先使用 Origin，其次取 Referer 的 scheme://host
+func requestOrigin(c *gin.Context) string {
+	if origin := c.Request.Header.Get("Origin"); origin != "" && origin != "null" {
+		return origin
+	}
+	referer := c.Request.Header.Get("Referer")
+	if referer == "" {
+		return ""
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
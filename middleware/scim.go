@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/service/scim"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScimAuth 校验 IdP 使用的 SCIM Bearer 密钥，该密钥与用户令牌、管理密钥相互独立
+func ScimAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		settings := system_setting.GetScimSettings()
+		if !settings.Enabled || settings.Token == "" {
+			scim.RenderError(c, http.StatusForbidden, "", "SCIM provisioning is disabled")
+			c.Abort()
+			return
+		}
+		auth := c.Request.Header.Get("Authorization")
+		token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		if auth == token || subtle.ConstantTimeCompare([]byte(token), []byte(settings.Token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			scim.RenderError(c, http.StatusUnauthorized, "", "invalid SCIM bearer token")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
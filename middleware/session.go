@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionClientIp 将 gin 解析的客户端 IP 传给会话存储，需在 sessions 中间件之前注册
+func SessionClientIp() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.Request = model.WithSessionClientIp(c.Request, c.ClientIP())
+		c.Next()
+	}
+}
@@ -0,0 +1,150 @@
+package model
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// AccessKeyPrefix 管理密钥前缀，用于与旧版单一 access token 区分
+const AccessKeyPrefix = "nak-"
+
+const (
+	AccessKeyStatusEnabled = 1
+	AccessKeyStatusRevoked = 2
+)
+
+// 最近使用时间的最小写入间隔，避免每次请求都写库
+const accessKeyTouchInterval = 60
+
+// AccessKey 用户的管理 API 密钥，每个密钥单独限定权限范围、有效期与来源 IP，库中只保存哈希
+type AccessKey struct {
+	Id           int    `json:"id"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Name         string `json:"name" gorm:"type:varchar(64);default:''"`
+	KeyHash      string `json:"-" gorm:"type:char(64);uniqueIndex"`
+	KeyPrefix    string `json:"key_prefix" gorm:"type:varchar(16);default:''"` // 明文前几位，仅用于展示
+	Scopes       string `json:"scopes" gorm:"type:text"`                       // 逗号分隔的权限
+	AllowIps     string `json:"allow_ips" gorm:"type:text"`                    // 换行分隔的 IP 或 CIDR，为空不限制
+	Status       int    `json:"status" gorm:"default:1"`
+	ExpiredTime  int64  `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	LastUsedTime int64  `json:"last_used_time" gorm:"bigint;default:0"`
+	LastUsedIp   string `json:"last_used_ip" gorm:"type:varchar(64);default:''"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+}
+
+func hashAccessKey(key string) string {
+	return hex.EncodeToString(common.Sha256Raw([]byte(key)))
+}
+
+func (key *AccessKey) GetScopes() []string {
+	scopes := make([]string, 0)
+	for _, s := range strings.Split(key.Scopes, ",") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+func (key *AccessKey) HasScope(permission string) bool {
+	for _, s := range key.GetScopes() {
+		if s == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsIpAllowed 校验来源 IP 是否在白名单内，支持单个 IP 与 CIDR
+func (key *AccessKey) IsIpAllowed(clientIp string) bool {
+	if strings.TrimSpace(key.AllowIps) == "" {
+		return true
+	}
+	return common.IsIPAllowed(clientIp, strings.Split(key.AllowIps, "\n"))
+}
+
+// Insert 生成密钥并保存，返回仅此一次可见的明文
+func (key *AccessKey) Insert() (string, error) {
+	random, err := common.GenerateRandomKey(48)
+	if err != nil {
+		return "", err
+	}
+	plain := AccessKeyPrefix + random
+	key.KeyHash = hashAccessKey(plain)
+	key.KeyPrefix = plain[:len(AccessKeyPrefix)+6]
+	key.Status = AccessKeyStatusEnabled
+	key.CreatedTime = common.GetTimestamp()
+	if err := DB.Create(key).Error; err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+func (key *AccessKey) Update() error {
+	return DB.Model(key).Select("name", "scopes", "allow_ips", "status", "expired_time").Updates(key).Error
+}
+
+func GetUserAccessKeys(userId int) (keys []*AccessKey, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&keys).Error
+	return keys, err
+}
+
+func GetAccessKeyById(id int, userId int) (*AccessKey, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	key := AccessKey{}
+	err := DB.First(&key, "id = ? and user_id = ?", id, userId).Error
+	return &key, err
+}
+
+func DeleteAccessKeyById(id int, userId int) error {
+	result := DB.Where("id = ? and user_id = ?", id, userId).Delete(&AccessKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("密钥不存在")
+	}
+	return nil
+}
+
+// ValidateAccessKey 校验管理密钥的状态、有效期与来源 IP，并异步记录最近使用时间
+func ValidateAccessKey(plain string, clientIp string) (*AccessKey, error) {
+	plain = strings.TrimSpace(strings.TrimPrefix(plain, "Bearer "))
+	if !strings.HasPrefix(plain, AccessKeyPrefix) {
+		return nil, errors.New("管理密钥无效")
+	}
+	key := AccessKey{}
+	if err := DB.First(&key, "key_hash = ?", hashAccessKey(plain)).Error; err != nil {
+		return nil, errors.New("管理密钥无效")
+	}
+	if key.Status != AccessKeyStatusEnabled {
+		return nil, errors.New("管理密钥已被撤销")
+	}
+	now := common.GetTimestamp()
+	if key.ExpiredTime != -1 && key.ExpiredTime < now {
+		return nil, errors.New("管理密钥已过期")
+	}
+	if !key.IsIpAllowed(clientIp) {
+		return nil, errors.New("您的 IP 不在管理密钥允许访问的列表中")
+	}
+	if now-key.LastUsedTime >= accessKeyTouchInterval {
+		gopool.Go(func() {
+			err := DB.Model(&AccessKey{}).Where("id = ?", key.Id).Updates(map[string]any{
+				"last_used_time": now,
+				"last_used_ip":   clientIp,
+			}).Error
+			if err != nil {
+				common.SysLog("failed to update access key last used time: " + err.Error())
+			}
+		})
+	}
+	return &key, nil
+}
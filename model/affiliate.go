@@ -0,0 +1,296 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"gorm.io/gorm"
+)
+
+// AffiliateCommission 邀请佣金，被邀请用户充值成功后按级别发放给邀请人，结算期满后计入邀请额度
+type AffiliateCommission struct {
+	Id          int     `json:"id"`
+	UserId      int     `json:"user_id" gorm:"index"`      // 获得佣金的邀请人
+	FromUserId  int     `json:"from_user_id" gorm:"index"` // 充值的被邀请用户
+	Level       int     `json:"level" gorm:"uniqueIndex:idx_aff_commission_topup_level,priority:2"`
+	TopUpId     int     `json:"top_up_id" gorm:"uniqueIndex:idx_aff_commission_topup_level,priority:1"`
+	TradeNo     string  `json:"trade_no" gorm:"type:varchar(255);index"`
+	TopUpQuota  int     `json:"top_up_quota"`
+	Rate        float64 `json:"rate"` // 佣金比例（%）
+	Quota       int     `json:"quota"`
+	Status      string  `json:"status" gorm:"type:varchar(16);index:idx_aff_commission_settle,priority:1"`
+	SettleTime  int64   `json:"settle_time" gorm:"bigint;index:idx_aff_commission_settle,priority:2"` // 预计结算时间
+	SettledTime int64   `json:"settled_time" gorm:"bigint"`
+	CreatedTime int64   `json:"created_time" gorm:"bigint;index"`
+	// ReversalShortfall 冲正时邀请额度不足（已划转或已使用）而未能扣回的部分
+	ReversalShortfall int `json:"reversal_shortfall" gorm:"default:0"`
+}
+
+// CreateTopUpCommissions 为充值成功的订单创建一、二级邀请佣金，同一订单同一级别只会创建一次
+func CreateTopUpCommissions(topUp *TopUp) {
+	setting := operation_setting.GetAffiliateSetting()
+	if !setting.CommissionEnabled || topUp == nil || topUp.Quota <= 0 {
+		return
+	}
+	fromUser, err := GetUserById(topUp.UserId, false)
+	if err != nil {
+		return
+	}
+	now := common.GetTimestamp()
+	inviterId := fromUser.InviterId
+	for level := 1; level <= 2 && inviterId != 0; level++ {
+		inviter, err := GetUserById(inviterId, false)
+		if err != nil {
+			return
+		}
+		rate := operation_setting.GetAffiliateRate(inviter.Group, level)
+		quota := int(float64(topUp.Quota) * rate / 100)
+		if rate > 0 && quota > 0 {
+			commission := &AffiliateCommission{
+				UserId:      inviter.Id,
+				FromUserId:  topUp.UserId,
+				Level:       level,
+				TopUpId:     topUp.Id,
+				TradeNo:     topUp.TradeNo,
+				TopUpQuota:  topUp.Quota,
+				Rate:        rate,
+				Quota:       quota,
+				Status:      common.AffiliateCommissionStatusPending,
+				SettleTime:  now + int64(setting.SettlementDays)*24*60*60,
+				CreatedTime: now,
+			}
+			if err := DB.Create(commission).Error; err != nil {
+				common.SysError(fmt.Sprintf("failed to create affiliate commission for top up %s: %s", topUp.TradeNo, err.Error()))
+			}
+		}
+		inviterId = inviter.InviterId
+	}
+}
+
+// SettleDueAffiliateCommissions 结算到期佣金，计入邀请人的邀请额度
+func SettleDueAffiliateCommissions(limit int) (int, error) {
+	var commissions []*AffiliateCommission
+	now := common.GetTimestamp()
+	err := DB.Where("status = ? and settle_time <= ?", common.AffiliateCommissionStatusPending, now).
+		Order("id asc").Limit(limit).Find(&commissions).Error
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, commission := range commissions {
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			// 条件更新保证同一条佣金只结算一次
+			result := tx.Model(&AffiliateCommission{}).
+				Where("id = ? and status = ?", commission.Id, common.AffiliateCommissionStatusPending).
+				Updates(map[string]interface{}{"status": common.AffiliateCommissionStatusSettled, "settled_time": now})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return nil
+			}
+			count++
+			return tx.Model(&User{}).Where("id = ?", commission.UserId).Updates(map[string]interface{}{
+				"aff_quota":   gorm.Expr("aff_quota + ?", commission.Quota),
+				"aff_history": gorm.Expr("aff_history + ?", commission.Quota),
+			}).Error
+		})
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to settle affiliate commission %d: %s", commission.Id, err.Error()))
+		}
+	}
+	return count, nil
+}
+
+// reverseTopUpCommissions 冲正订单的佣金，已结算的佣金从邀请额度中扣回，
+// 邀请额度最多扣到 0，不足的部分记录在 ReversalShortfall 中
+func reverseTopUpCommissions(tx *gorm.DB, topUpId int) ([]*AffiliateCommission, error) {
+	var commissions []*AffiliateCommission
+	err := tx.Where("top_up_id = ? and status <> ?", topUpId, common.AffiliateCommissionStatusReversed).Find(&commissions).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, commission := range commissions {
+		updates := map[string]interface{}{"status": common.AffiliateCommissionStatusReversed}
+		if commission.Status == common.AffiliateCommissionStatusSettled {
+			inviter := &User{}
+			err = tx.Set("gorm:query_option", "FOR UPDATE").Select("id, aff_quota, aff_history").
+				Where("id = ?", commission.UserId).First(inviter).Error
+			if err != nil {
+				return nil, err
+			}
+			deduct := min(commission.Quota, max(inviter.AffQuota, 0))
+			err = tx.Model(&User{}).Where("id = ?", commission.UserId).Updates(map[string]interface{}{
+				"aff_quota":   gorm.Expr("aff_quota - ?", deduct),
+				"aff_history": gorm.Expr("aff_history - ?", min(commission.Quota, max(inviter.AffHistoryQuota, 0))),
+			}).Error
+			if err != nil {
+				return nil, err
+			}
+			commission.ReversalShortfall = commission.Quota - deduct
+			updates["reversal_shortfall"] = commission.ReversalShortfall
+		}
+		err = tx.Model(commission).Updates(updates).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return commissions, nil
+}
+
+// RefundTopUp 标记充值订单已退款，扣回到账额度并冲正相关佣金。
+// 支付渠道的退款回调未接入，渠道侧退款后需由管理员通过 /api/user/topup/refund 手动登记。
+func RefundTopUp(tradeNo string) error {
+	if tradeNo == "" {
+		return errors.New("未提供订单号")
+	}
+	topUp := &TopUp{}
+	var refundQuota int
+	var reversed []*AffiliateCommission
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("trade_no = ?", tradeNo).First(topUp).Error; err != nil {
+			return errors.New("充值订单不存在")
+		}
+		if topUp.Status != common.TopUpStatusSuccess {
+			return errors.New("只有已完成的订单可以退款")
+		}
+		topUp.Status = common.TopUpStatusRefunded
+		if err := tx.Save(topUp).Error; err != nil {
+			return err
+		}
+		refundQuota = topUp.CreditedQuota()
+		if refundQuota > 0 {
+			if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota - ?", refundQuota)).Error; err != nil {
+				return err
+			}
+		}
+		var err error
+		reversed, err = reverseTopUpCommissions(tx, topUp.Id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_ = invalidateUserCache(topUp.UserId)
+	RecordLog(topUp.UserId, LogTypeManage, fmt.Sprintf("充值订单 %s 已退款，扣回额度 %s", topUp.TradeNo, logger.LogQuota(refundQuota)))
+	for _, commission := range reversed {
+		if commission.ReversalShortfall > 0 {
+			RecordLog(commission.UserId, LogTypeSystem, fmt.Sprintf("被邀请用户充值订单退款，冲正邀请佣金 %s，邀请额度不足，未扣回 %s",
+				logger.LogQuota(commission.Quota), logger.LogQuota(commission.ReversalShortfall)))
+			common.SysLog(fmt.Sprintf("affiliate commission %d reversed with shortfall %d for user %d", commission.Id, commission.ReversalShortfall, commission.UserId))
+			continue
+		}
+		RecordLog(commission.UserId, LogTypeSystem, fmt.Sprintf("被邀请用户充值订单退款，冲正邀请佣金 %s", logger.LogQuota(commission.Quota)))
+	}
+	return nil
+}
+
+func GetUserAffiliateCommissions(userId int, status string, pageInfo *common.PageInfo) (commissions []*AffiliateCommission, total int64, err error) {
+	query := DB.Model(&AffiliateCommission{}).Where("user_id = ?", userId)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&commissions).Error
+	return commissions, total, err
+}
+
+// AffiliateCommissionSummary 按状态汇总的佣金
+type AffiliateCommissionSummary struct {
+	PendingQuota  int `json:"pending_quota"`
+	SettledQuota  int `json:"settled_quota"`
+	ReversedQuota int `json:"reversed_quota"`
+}
+
+func GetAffiliateCommissionSummary(userId int) (*AffiliateCommissionSummary, error) {
+	var rows []struct {
+		Status string
+		Quota  int
+	}
+	err := DB.Model(&AffiliateCommission{}).Select("status, sum(quota) as quota").
+		Where("user_id = ?", userId).Group("status").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	summary := &AffiliateCommissionSummary{}
+	for _, row := range rows {
+		switch row.Status {
+		case common.AffiliateCommissionStatusPending:
+			summary.PendingQuota = row.Quota
+		case common.AffiliateCommissionStatusSettled:
+			summary.SettledQuota = row.Quota
+		case common.AffiliateCommissionStatusReversed:
+			summary.ReversedQuota = row.Quota
+		}
+	}
+	return summary, nil
+}
+
+// AffiliateReferral 被邀请用户及其为邀请人带来的佣金
+type AffiliateReferral struct {
+	Id            int    `json:"id"`
+	Username      string `json:"username"`
+	DisplayName   string `json:"display_name"`
+	PendingQuota  int    `json:"pending_quota"`
+	SettledQuota  int    `json:"settled_quota"`
+	ReversedQuota int    `json:"reversed_quota"`
+}
+
+// GetAffiliateReferrals 获取直接邀请的用户及其带来的佣金
+func GetAffiliateReferrals(userId int, pageInfo *common.PageInfo) (referrals []*AffiliateReferral, total int64, err error) {
+	query := DB.Model(&User{}).Where("inviter_id = ?", userId)
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []*User
+	err = query.Select("id, username, display_name").Order("id desc").
+		Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	referrals = make([]*AffiliateReferral, 0, len(users))
+	if len(users) == 0 {
+		return referrals, total, nil
+	}
+	userIds := make([]int, 0, len(users))
+	referralMap := make(map[int]*AffiliateReferral, len(users))
+	for _, user := range users {
+		referral := &AffiliateReferral{
+			Id:          user.Id,
+			Username:    user.Username,
+			DisplayName: user.DisplayName,
+		}
+		referrals = append(referrals, referral)
+		referralMap[user.Id] = referral
+		userIds = append(userIds, user.Id)
+	}
+	var rows []struct {
+		FromUserId int
+		Status     string
+		Quota      int
+	}
+	err = DB.Model(&AffiliateCommission{}).Select("from_user_id, status, sum(quota) as quota").
+		Where("user_id = ? and from_user_id in ?", userId, userIds).
+		Group("from_user_id, status").Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, row := range rows {
+		referral := referralMap[row.FromUserId]
+		switch row.Status {
+		case common.AffiliateCommissionStatusPending:
+			referral.PendingQuota = row.Quota
+		case common.AffiliateCommissionStatusSettled:
+			referral.SettledQuota = row.Quota
+		case common.AffiliateCommissionStatusReversed:
+			referral.ReversedQuota = row.Quota
+		}
+	}
+	return referrals, total, nil
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	ArtifactSourceTask       = "task"
+	ArtifactSourceMidjourney = "midjourney"
+	ArtifactSourceImage      = "image"
+)
+
+// Artifact 转存到网关存储的生成结果（图片、视频、音频）
+type Artifact struct {
+	Id          int    `json:"id"`
+	Key         string `json:"key" gorm:"column:artifact_key;type:varchar(64);uniqueIndex"` // 对外访问标识
+	UserId      int    `json:"user_id" gorm:"index"`
+	Source      string `json:"source" gorm:"type:varchar(16)"`
+	TaskId      string `json:"task_id" gorm:"type:varchar(191);index"` // 任务 id 或 Midjourney id，图片接口为空
+	Backend     string `json:"backend" gorm:"type:varchar(16)"`
+	StorageKey  string `json:"-" gorm:"type:varchar(512)"`
+	ContentType string `json:"content_type" gorm:"type:varchar(128)"`
+	Size        int64  `json:"size"`
+	Quota       int    `json:"quota"` // 存储费用
+	OriginUrl   string `json:"-" gorm:"type:text"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint;index"`
+	ExpiresTime int64  `json:"expires_time" gorm:"bigint;index"` // 0 为永久保留
+}
+
+func (artifact *Artifact) Insert() error {
+	return DB.Create(artifact).Error
+}
+
+func GetArtifactByKey(key string) (*Artifact, error) {
+	artifact := &Artifact{}
+	err := DB.First(artifact, "artifact_key = ?", key).Error
+	if err != nil {
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// GetTaskArtifact 获取任务最新转存的结果，没有时返回 nil
+func GetTaskArtifact(source string, taskId string) *Artifact {
+	if taskId == "" {
+		return nil
+	}
+	artifact := &Artifact{}
+	err := DB.Where("source = ? and task_id = ?", source, taskId).Order("id desc").First(artifact).Error
+	if err != nil {
+		return nil
+	}
+	return artifact
+}
+
+func GetUserArtifacts(userId int, source string, pageInfo *common.PageInfo) (artifacts []*Artifact, total int64, err error) {
+	query := DB.Model(&Artifact{}).Where("user_id = ?", userId)
+	if source != "" {
+		query = query.Where("source = ?", source)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&artifacts).Error
+	return artifacts, total, err
+}
+
+// ArtifactUsage 用户存储用量
+type ArtifactUsage struct {
+	Count int64 `json:"count"`
+	Size  int64 `json:"size"`
+	Quota int64 `json:"quota"`
+}
+
+func GetUserArtifactUsage(userId int) (*ArtifactUsage, error) {
+	usage := &ArtifactUsage{}
+	err := DB.Model(&Artifact{}).Select("count(*) as count, coalesce(sum(size), 0) as size, coalesce(sum(quota), 0) as quota").
+		Where("user_id = ?", userId).Scan(usage).Error
+	return usage, err
+}
+
+func GetExpiredArtifacts(now int64, limit int) (artifacts []*Artifact, err error) {
+	err = DB.Where("expires_time > 0 and expires_time <= ?", now).Order("id asc").Limit(limit).Find(&artifacts).Error
+	return artifacts, err
+}
+
+func DeleteArtifactById(id int) error {
+	return DB.Delete(&Artifact{}, id).Error
+}
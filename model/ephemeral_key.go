@@ -0,0 +1,125 @@
+package model
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// EphemeralKeyPrefix 临时密钥前缀，与 OpenAI realtime client secret 保持一致
+const EphemeralKeyPrefix = "ek_"
+
+// 过期后保留一段时间再清理，便于排查日志
+const ephemeralKeyRetentionSeconds = 86400
+
+// EphemeralKey 由普通令牌签发的短期密钥，供浏览器、移动端直连使用，消费计入签发令牌与用户，库中只保存哈希
+type EphemeralKey struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	TokenId     int    `json:"token_id" gorm:"index"`
+	KeyHash     string `json:"-" gorm:"type:char(64);uniqueIndex"`
+	Model       string `json:"model" gorm:"type:varchar(255);default:''"` // 允许使用的模型，为空不限制
+	QuotaLimit  int    `json:"quota_limit" gorm:"default:0"`              // 消费上限，0 不限制
+	UsedQuota   int    `json:"used_quota" gorm:"default:0"`
+	SingleUse   bool   `json:"single_use"`
+	Consumed    bool   `json:"consumed"` // 单次密钥是否已被使用
+	ExpiredTime int64  `json:"expired_time" gorm:"bigint;index"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+func hashEphemeralKey(key string) string {
+	return hex.EncodeToString(common.Sha256Raw([]byte(key)))
+}
+
+// IsEphemeralKey 判断是否为临时密钥
+func IsEphemeralKey(key string) bool {
+	return strings.HasPrefix(key, EphemeralKeyPrefix)
+}
+
+// Insert 生成密钥并保存，返回仅此一次可见的明文
+func (key *EphemeralKey) Insert() (string, error) {
+	// 临时密钥会放在 Sec-WebSocket-Protocol 中传递，只使用字母与数字
+	random, err := common.GenerateRandomCharsKey(48)
+	if err != nil {
+		return "", err
+	}
+	plain := EphemeralKeyPrefix + random
+	key.KeyHash = hashEphemeralKey(plain)
+	key.CreatedTime = common.GetTimestamp()
+	if err := DB.Create(key).Error; err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+// ValidateEphemeralKey 校验临时密钥的有效期与消费上限，单次密钥在此处原子地标记为已使用
+func ValidateEphemeralKey(plain string) (*EphemeralKey, error) {
+	if !IsEphemeralKey(plain) {
+		return nil, errors.New("无效的临时密钥")
+	}
+	key := EphemeralKey{}
+	if err := DB.First(&key, "key_hash = ?", hashEphemeralKey(plain)).Error; err != nil {
+		return nil, errors.New("无效的临时密钥")
+	}
+	if key.ExpiredTime < common.GetTimestamp() {
+		return nil, errors.New("该临时密钥已过期")
+	}
+	if key.QuotaLimit > 0 && key.UsedQuota >= key.QuotaLimit {
+		return nil, errors.New("该临时密钥额度已用尽")
+	}
+	if key.SingleUse {
+		if key.Consumed {
+			return nil, errors.New("该临时密钥已被使用")
+		}
+		result := DB.Model(&EphemeralKey{}).Where("id = ? AND consumed = ?", key.Id, false).Update("consumed", true)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, errors.New("该临时密钥已被使用")
+		}
+		key.Consumed = true
+	}
+	return &key, nil
+}
+
+func GetEphemeralKeyById(id int) (*EphemeralKey, error) {
+	key := EphemeralKey{}
+	err := DB.First(&key, "id = ?", id).Error
+	return &key, err
+}
+
+// IncreaseEphemeralKeyUsedQuota 累加临时密钥的消费额度，quota 为负数时返还
+func IncreaseEphemeralKeyUsedQuota(id int, quota int) error {
+	if quota == 0 {
+		return nil
+	}
+	return DB.Model(&EphemeralKey{}).Where("id = ?", id).Update("used_quota", gorm.Expr("used_quota + ?", quota)).Error
+}
+
+// ConsumeEphemeralKeyQuota 在消费上限内原子地累加临时密钥的消费额度，超出上限时不做修改并返回错误
+func ConsumeEphemeralKeyQuota(id int, quota int) error {
+	if quota <= 0 {
+		return IncreaseEphemeralKeyUsedQuota(id, quota)
+	}
+	result := DB.Model(&EphemeralKey{}).
+		Where("id = ? AND (quota_limit <= 0 OR used_quota + ? <= quota_limit)", id, quota).
+		Update("used_quota", gorm.Expr("used_quota + ?", quota))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("ephemeral key quota is not enough")
+	}
+	return nil
+}
+
+// DeleteExpiredEphemeralKeys 清理过期超过保留时间的临时密钥
+func DeleteExpiredEphemeralKeys() (int64, error) {
+	result := DB.Where("expired_time < ?", common.GetTimestamp()-ephemeralKeyRetentionSeconds).Delete(&EphemeralKey{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,276 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+)
+
+// Invoice 后付费账单，按自然月从消费日志汇总生成
+type Invoice struct {
+	Id           int     `json:"id"`
+	UserId       int     `json:"user_id" gorm:"uniqueIndex:idx_invoice_user_period,priority:1"`
+	Username     string  `json:"username" gorm:"index;default:''"`
+	InvoiceNo    string  `json:"invoice_no" gorm:"type:varchar(64);uniqueIndex"`
+	PeriodStart  int64   `json:"period_start" gorm:"bigint;uniqueIndex:idx_invoice_user_period,priority:2"`
+	PeriodEnd    int64   `json:"period_end" gorm:"bigint"`
+	Quota        int     `json:"quota" gorm:"default:0"`
+	Amount       float64 `json:"amount" gorm:"default:0"` // Quota / QuotaPerUnit，单位美元
+	RequestCount int     `json:"request_count" gorm:"default:0"`
+	Status       string  `json:"status" gorm:"type:varchar(16);index;default:'draft'"`
+	Items        string  `json:"items,omitempty" gorm:"type:text"`
+	Remark       string  `json:"remark,omitempty" gorm:"type:varchar(255)"`
+	CreatedTime  int64   `json:"created_time" gorm:"bigint"`
+	IssuedTime   int64   `json:"issued_time" gorm:"bigint"`
+	PaidTime     int64   `json:"paid_time" gorm:"bigint"`
+}
+
+// InvoiceItem 账单明细，按日期、令牌、模型聚合
+type InvoiceItem struct {
+	Day              string `json:"day"`
+	TokenName        string `json:"token_name"`
+	ModelName        string `json:"model_name"`
+	RequestCount     int    `json:"request_count"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Quota            int    `json:"quota"`        // 扣除退款后的额度
+	RefundQuota      int    `json:"refund_quota"` // 本期退还的额度
+}
+
+func (invoice *Invoice) GetItems() []InvoiceItem {
+	items := make([]InvoiceItem, 0)
+	if invoice.Items == "" {
+		return items
+	}
+	if err := common.UnmarshalJsonStr(invoice.Items, &items); err != nil {
+		common.SysLog(fmt.Sprintf("failed to unmarshal invoice %d items: %s", invoice.Id, err.Error()))
+	}
+	return items
+}
+
+// GetMonthPeriod 返回指定月份的起止时间戳，结束时间为下月第一秒（不含）
+func GetMonthPeriod(year int, month time.Month) (int64, int64) {
+	start := time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
+	return start.Unix(), start.AddDate(0, 1, 0).Unix()
+}
+
+func IsValidInvoiceStatus(status string) bool {
+	switch status {
+	case common.InvoiceStatusDraft, common.InvoiceStatusIssued, common.InvoiceStatusPaid, common.InvoiceStatusVoid:
+		return true
+	}
+	return false
+}
+
+func GetInvoiceById(id int) (*Invoice, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	var invoice Invoice
+	err := DB.First(&invoice, "id = ?", id).Error
+	return &invoice, err
+}
+
+func GetUserInvoiceById(userId int, id int) (*Invoice, error) {
+	var invoice Invoice
+	err := DB.First(&invoice, "id = ? and user_id = ?", id, userId).Error
+	return &invoice, err
+}
+
+func GetAllInvoices(userId int, status string, pageInfo *common.PageInfo) (invoices []*Invoice, total int64, err error) {
+	query := DB.Model(&Invoice{})
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	// 列表不返回明细，明细通过导出接口获取
+	err = query.Omit("items").Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&invoices).Error
+	return invoices, total, err
+}
+
+func GetUserInvoices(userId int, pageInfo *common.PageInfo) (invoices []*Invoice, total int64, err error) {
+	query := DB.Model(&Invoice{}).Where("user_id = ? and status <> ?", userId, common.InvoiceStatusDraft)
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Omit("items").Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&invoices).Error
+	return invoices, total, err
+}
+
+func GetPostpaidUserIds() (ids []int, err error) {
+	err = DB.Model(&User{}).Where("billing_mode = ?", common.UserBillingModePostpaid).Pluck("id", &ids).Error
+	return ids, err
+}
+
+func InvoiceExists(userId int, periodStart int64) bool {
+	var count int64
+	DB.Model(&Invoice{}).Where("user_id = ? and period_start = ?", userId, periodStart).Count(&count)
+	return count > 0
+}
+
+// summarizeConsumeLogs 按日期、令牌、模型汇总消费日志，并扣除同期的退款。
+// 退款日志不含令牌信息，按退款日期与模型单独成项
+func summarizeConsumeLogs(userId int, periodStart int64, periodEnd int64) ([]InvoiceItem, error) {
+	type itemKey struct {
+		day       string
+		tokenName string
+		modelName string
+	}
+	summary := make(map[itemKey]*InvoiceItem)
+	var logs []*Log
+	err := LOG_DB.Model(&Log{}).
+		Select("id, created_at, type, token_name, model_name, quota, prompt_tokens, completion_tokens").
+		Where("user_id = ? and type in ? and created_at >= ? and created_at < ?", userId, []int{LogTypeConsume, LogTypeRefund}, periodStart, periodEnd).
+		FindInBatches(&logs, 1000, func(tx *gorm.DB, batch int) error {
+			for _, log := range logs {
+				key := itemKey{
+					day:       time.Unix(log.CreatedAt, 0).Format("2006-01-02"),
+					tokenName: log.TokenName,
+					modelName: log.ModelName,
+				}
+				item, ok := summary[key]
+				if !ok {
+					item = &InvoiceItem{Day: key.day, TokenName: key.tokenName, ModelName: key.modelName}
+					summary[key] = item
+				}
+				if log.Type == LogTypeRefund {
+					item.Quota -= log.Quota
+					item.RefundQuota += log.Quota
+					continue
+				}
+				item.RequestCount++
+				item.PromptTokens += log.PromptTokens
+				item.CompletionTokens += log.CompletionTokens
+				item.Quota += log.Quota
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+	items := make([]InvoiceItem, 0, len(summary))
+	for _, item := range summary {
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Day != items[j].Day {
+			return items[i].Day < items[j].Day
+		}
+		if items[i].TokenName != items[j].TokenName {
+			return items[i].TokenName < items[j].TokenName
+		}
+		return items[i].ModelName < items[j].ModelName
+	})
+	return items, nil
+}
+
+// GenerateInvoice 生成或重新生成指定周期的账单，已出账或已结清的账单不会被覆盖
+func GenerateInvoice(userId int, periodStart int64, periodEnd int64, issue bool) (*Invoice, error) {
+	if periodEnd <= periodStart {
+		return nil, errors.New("账单周期无效")
+	}
+	username, err := GetUsernameById(userId, true)
+	if err != nil {
+		return nil, err
+	}
+	items, err := summarizeConsumeLogs(userId, periodStart, periodEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := &Invoice{}
+	err = DB.Where("user_id = ? and period_start = ?", userId, periodStart).First(invoice).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if invoice.Id != 0 && invoice.Status != common.InvoiceStatusDraft {
+		return nil, fmt.Errorf("账单 %s 已处于 %s 状态，无法重新生成", invoice.InvoiceNo, invoice.Status)
+	}
+
+	quota := 0
+	requestCount := 0
+	for _, item := range items {
+		quota += item.Quota
+		requestCount += item.RequestCount
+	}
+	invoice.UserId = userId
+	invoice.Username = username
+	invoice.InvoiceNo = fmt.Sprintf("INV-%s-%d", time.Unix(periodStart, 0).Format("200601"), userId)
+	invoice.PeriodStart = periodStart
+	invoice.PeriodEnd = periodEnd
+	invoice.Quota = quota
+	invoice.Amount = float64(quota) / common.QuotaPerUnit
+	invoice.RequestCount = requestCount
+	invoice.Items = common.GetJsonString(items)
+	invoice.Status = common.InvoiceStatusDraft
+	if invoice.CreatedTime == 0 {
+		invoice.CreatedTime = common.GetTimestamp()
+	}
+	if issue {
+		invoice.Status = common.InvoiceStatusIssued
+		invoice.IssuedTime = common.GetTimestamp()
+	}
+	if err = DB.Save(invoice).Error; err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// UpdateInvoiceStatus 更新账单状态，结清后账单金额将返还到用户余额以抵消透支
+func UpdateInvoiceStatus(id int, status string) (*Invoice, error) {
+	if !IsValidInvoiceStatus(status) {
+		return nil, errors.New("无效的账单状态")
+	}
+	invoice := &Invoice{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(invoice, "id = ?", id).Error; err != nil {
+			return errors.New("账单不存在")
+		}
+		if invoice.Status == status {
+			return nil
+		}
+		switch invoice.Status {
+		case common.InvoiceStatusPaid, common.InvoiceStatusVoid:
+			return fmt.Errorf("账单已处于 %s 状态，无法修改", invoice.Status)
+		}
+		if status == common.InvoiceStatusDraft {
+			return errors.New("无法将账单改回草稿状态")
+		}
+		now := common.GetTimestamp()
+		switch status {
+		case common.InvoiceStatusIssued:
+			invoice.IssuedTime = now
+		case common.InvoiceStatusPaid:
+			if invoice.IssuedTime == 0 {
+				invoice.IssuedTime = now
+			}
+			invoice.PaidTime = now
+			if invoice.Quota > 0 {
+				if err := tx.Model(&User{}).Where("id = ?", invoice.UserId).Update("quota", gorm.Expr("quota + ?", invoice.Quota)).Error; err != nil {
+					return err
+				}
+			}
+		}
+		invoice.Status = status
+		return tx.Save(invoice).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if status == common.InvoiceStatusPaid && invoice.Quota > 0 {
+		_ = invalidateUserCache(invoice.UserId)
+		RecordLog(invoice.UserId, LogTypeTopup, fmt.Sprintf("后付费账单 %s 已结清，结算额度 %s", invoice.InvoiceNo, logger.LogQuota(invoice.Quota)))
+	}
+	return invoice, nil
+}
@@ -267,6 +267,20 @@ func migrateDB() error {
 		&Setup{},
 		&TwoFA{},
 		&TwoFABackupCode{},
+		&Invoice{},
+		&WebhookSubscription{},
+		&WebhookDelivery{},
+		&AffiliateCommission{},
+		&Artifact{},
+		&TaskPollerNode{},
+		&TaskPollerLease{},
+		&PermissionRole{},
+		&UserPermissionRole{},
+		&AccessKey{},
+		&UserSession{},
+		&ScimUser{},
+		&EphemeralKey{},
+		&StoredResponse{},
 	)
 	if err != nil {
 		return err
@@ -300,6 +314,20 @@ func migrateDBFast() error {
 		{&Setup{}, "Setup"},
 		{&TwoFA{}, "TwoFA"},
 		{&TwoFABackupCode{}, "TwoFABackupCode"},
+		{&Invoice{}, "Invoice"},
+		{&WebhookSubscription{}, "WebhookSubscription"},
+		{&WebhookDelivery{}, "WebhookDelivery"},
+		{&AffiliateCommission{}, "AffiliateCommission"},
+		{&Artifact{}, "Artifact"},
+		{&TaskPollerNode{}, "TaskPollerNode"},
+		{&TaskPollerLease{}, "TaskPollerLease"},
+		{&PermissionRole{}, "PermissionRole"},
+		{&UserPermissionRole{}, "UserPermissionRole"},
+		{&AccessKey{}, "AccessKey"},
+		{&UserSession{}, "UserSession"},
+		{&ScimUser{}, "ScimUser"},
+		{&EphemeralKey{}, "EphemeralKey"},
+		{&StoredResponse{}, "StoredResponse"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -23,6 +23,7 @@ type Midjourney struct {
 	Quota       int    `json:"quota"`
 	Buttons     string `json:"buttons"`
 	Properties  string `json:"properties"`
+	RefundTime  int64  `json:"refund_time,omitempty" gorm:"bigint;default:0"`
 }
 
 // TaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
@@ -101,6 +102,27 @@ func GetAllUnFinishTasks() []*Midjourney {
 	return tasks
 }
 
+// GetUnfinishedMidjourneyChannelIds 获取存在未完成 Midjourney 任务的渠道
+func GetUnfinishedMidjourneyChannelIds() ([]int, error) {
+	var channelIds []int
+	err := DB.Model(&Midjourney{}).Where("progress != ? AND mj_id != ''", "100%").Distinct().Pluck("channel_id", &channelIds).Error
+	return channelIds, err
+}
+
+// GetUnfinishedMidjourneysByChannel 获取渠道下已提交到上游的未完成 Midjourney 任务
+func GetUnfinishedMidjourneysByChannel(channelId int) ([]*Midjourney, error) {
+	var tasks []*Midjourney
+	err := DB.Where("progress != ? AND channel_id = ? AND mj_id != ''", "100%", channelId).Find(&tasks).Error
+	return tasks, err
+}
+
+// GetUnfinishedMidjourneyIdsWithoutMjId 获取没有上游任务 ID 的未完成 Midjourney 任务
+func GetUnfinishedMidjourneyIdsWithoutMjId() ([]int, error) {
+	var ids []int
+	err := DB.Model(&Midjourney{}).Where("progress != ? AND (mj_id = '' OR mj_id IS NULL)", "100%").Pluck("id", &ids).Error
+	return ids, err
+}
+
 func GetByOnlyMJId(mjId string) *Midjourney {
 	var mj *Midjourney
 	var err error
@@ -153,10 +175,30 @@ func (midjourney *Midjourney) Insert() error {
 
 func (midjourney *Midjourney) Update() error {
 	var err error
-	err = DB.Save(midjourney).Error
+	// 退款状态只通过 ClaimMidjourneyRefund 修改
+	err = DB.Omit("refund_time").Save(midjourney).Error
 	return err
 }
 
+// ClaimMidjourneyRefund 标记任务已退款，已退款过的任务返回 false
+func ClaimMidjourneyRefund(id int, now int64) bool {
+	result := DB.Model(&Midjourney{}).Where("id = ? AND (refund_time = 0 OR refund_time IS NULL)", id).Update("refund_time", now)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// FailUnfinishedMidjourney 将未完成的 Midjourney 任务标记为失败，通过条件更新保证只处理一次
+func FailUnfinishedMidjourney(id int, reason string, now int64) (bool, error) {
+	result := DB.Model(&Midjourney{}).
+		Where("id = ? AND progress != ?", id, "100%").
+		Updates(map[string]any{
+			"status":      "FAILURE",
+			"progress":    "100%",
+			"fail_reason": reason,
+			"finish_time": now,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
 func MjBulkUpdate(mjIds []string, params map[string]any) error {
 	return DB.Model(&Midjourney{}).
 		Where("mj_id in (?)", mjIds).
@@ -0,0 +1,180 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// PermissionRole 自定义角色，由管理员从 common.AllPermissions 中组合权限
+type PermissionRole struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Description string `json:"description" gorm:"type:varchar(255);default:''"`
+	Permissions string `json:"permissions" gorm:"type:text"` // 逗号分隔的权限
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// UserPermissionRole 用户与自定义角色的分配关系
+type UserPermissionRole struct {
+	Id     int `json:"id"`
+	UserId int `json:"user_id" gorm:"uniqueIndex:idx_user_permission_role"`
+	RoleId int `json:"role_id" gorm:"uniqueIndex:idx_user_permission_role;index"`
+}
+
+// 用户权限缓存，角色变更时清空本节点缓存，其他节点最迟在过期后生效
+const userPermissionCacheTTL = 60 * time.Second
+
+type userPermissionCacheEntry struct {
+	permissions map[string]bool
+	expiresAt   time.Time
+}
+
+var (
+	userPermissionCache     = make(map[int]*userPermissionCacheEntry)
+	userPermissionCacheLock sync.RWMutex
+)
+
+func (role *PermissionRole) GetPermissions() []string {
+	permissions := make([]string, 0)
+	for _, p := range strings.Split(role.Permissions, ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions
+}
+
+func (role *PermissionRole) Insert() error {
+	role.CreatedTime = common.GetTimestamp()
+	role.UpdatedTime = role.CreatedTime
+	return DB.Create(role).Error
+}
+
+func (role *PermissionRole) Update() error {
+	role.UpdatedTime = common.GetTimestamp()
+	err := DB.Model(role).Select("name", "description", "permissions", "updated_time").Updates(role).Error
+	if err == nil {
+		clearUserPermissionCache()
+	}
+	return err
+}
+
+func IsPermissionRoleNameDuplicated(id int, name string) (bool, error) {
+	var cnt int64
+	err := DB.Model(&PermissionRole{}).Where("name = ? AND id <> ?", name, id).Count(&cnt).Error
+	return cnt > 0, err
+}
+
+func GetAllPermissionRoles() (roles []*PermissionRole, err error) {
+	err = DB.Order("id asc").Find(&roles).Error
+	return roles, err
+}
+
+func GetPermissionRoleById(id int) (*PermissionRole, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	role := PermissionRole{Id: id}
+	err := DB.First(&role, "id = ?", id).Error
+	return &role, err
+}
+
+// DeletePermissionRoleById 删除角色并解除其在所有用户上的分配
+func DeletePermissionRoleById(id int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", id).Delete(&UserPermissionRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&PermissionRole{}, id).Error
+	})
+	if err == nil {
+		clearUserPermissionCache()
+	}
+	return err
+}
+
+func GetUserPermissionRoleIds(userId int) (roleIds []int, err error) {
+	err = DB.Model(&UserPermissionRole{}).Where("user_id = ?", userId).Order("role_id asc").Pluck("role_id", &roleIds).Error
+	return roleIds, err
+}
+
+// SetUserPermissionRoles 以 roleIds 覆盖用户的自定义角色
+func SetUserPermissionRoles(userId int, roleIds []int) error {
+	if len(roleIds) > 0 {
+		var cnt int64
+		if err := DB.Model(&PermissionRole{}).Where("id IN ?", roleIds).Count(&cnt).Error; err != nil {
+			return err
+		}
+		if int(cnt) != len(roleIds) {
+			return errors.New("角色不存在")
+		}
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&UserPermissionRole{}).Error; err != nil {
+			return err
+		}
+		for _, roleId := range roleIds {
+			if err := tx.Create(&UserPermissionRole{UserId: userId, RoleId: roleId}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		userPermissionCacheLock.Lock()
+		delete(userPermissionCache, userId)
+		userPermissionCacheLock.Unlock()
+	}
+	return err
+}
+
+// GetUserPermissions 用户的有效权限：内置角色预设与自定义角色权限的并集
+func GetUserPermissions(userId int, role int) (map[string]bool, error) {
+	userPermissionCacheLock.RLock()
+	entry, ok := userPermissionCache[userId]
+	userPermissionCacheLock.RUnlock()
+	if !ok || time.Now().After(entry.expiresAt) {
+		var roles []*PermissionRole
+		err := DB.Model(&PermissionRole{}).
+			Joins("JOIN user_permission_roles ON user_permission_roles.role_id = permission_roles.id").
+			Where("user_permission_roles.user_id = ?", userId).
+			Find(&roles).Error
+		if err != nil {
+			return nil, err
+		}
+		custom := make(map[string]bool)
+		for _, r := range roles {
+			for _, p := range r.GetPermissions() {
+				custom[p] = true
+			}
+		}
+		entry = &userPermissionCacheEntry{permissions: custom, expiresAt: time.Now().Add(userPermissionCacheTTL)}
+		userPermissionCacheLock.Lock()
+		userPermissionCache[userId] = entry
+		userPermissionCacheLock.Unlock()
+	}
+
+	// 内置角色可能随时变更，不参与缓存
+	permissions := make(map[string]bool, len(entry.permissions))
+	for p := range entry.permissions {
+		permissions[p] = true
+	}
+	for _, p := range common.BuiltinRolePermissions(role) {
+		permissions[p] = true
+	}
+	return permissions, nil
+}
+
+func clearUserPermissionCache() {
+	userPermissionCacheLock.Lock()
+	userPermissionCache = make(map[int]*userPermissionCacheEntry)
+	userPermissionCacheLock.Unlock()
+}
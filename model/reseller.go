@@ -0,0 +1,245 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+)
+
+// GetResellerMarkup 返回分销商的加价倍率，未设置或小于 1 时按 1 处理
+func GetResellerMarkup(reseller *UserBase) float64 {
+	if reseller == nil || reseller.Markup < 1 {
+		return 1
+	}
+	return reseller.Markup
+}
+
+// GetUserResellerMarkup 返回用户作为分销商子用户的加价倍率，非子用户为 1
+func GetUserResellerMarkup(userId int) float64 {
+	userCache, err := GetUserCache(userId)
+	if err != nil || userCache.ParentId == 0 {
+		return 1
+	}
+	resellerCache, err := GetUserCache(userCache.ParentId)
+	if err != nil {
+		return 1
+	}
+	return GetResellerMarkup(resellerCache)
+}
+
+// chargeResellerConsumption 子用户消费后按平台价格扣除分销商额度，差价计入分销商利润
+// quota 为子用户按加价后价格实际消费的额度，可以为负数（任务补扣或退还）
+func chargeResellerConsumption(userId int, quota int) {
+	if quota == 0 {
+		return
+	}
+	userCache, err := GetUserCache(userId)
+	if err != nil || userCache.ParentId == 0 {
+		return
+	}
+	resellerCache, err := GetUserCache(userCache.ParentId)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to get reseller %d of user %d: %s", userCache.ParentId, userId, err.Error()))
+		return
+	}
+	cost := int(math.Round(float64(quota) / GetResellerMarkup(resellerCache)))
+	margin := quota - cost
+	if cost > 0 {
+		err = DecreaseUserQuota(resellerCache.Id, cost)
+	} else if cost < 0 {
+		err = IncreaseUserQuota(resellerCache.Id, -cost, false)
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to charge reseller %d: %s", resellerCache.Id, err.Error()))
+		return
+	}
+	err = DB.Model(&User{}).Where("id = ?", resellerCache.Id).Updates(map[string]interface{}{
+		"used_quota":      gorm.Expr("used_quota + ?", cost),
+		"reseller_margin": gorm.Expr("reseller_margin + ?", margin),
+	}).Error
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update reseller %d margin: %s", resellerCache.Id, err.Error()))
+	}
+}
+
+// RefundResellerConsumption 子用户的消费被退还时，按同样的倍率退还分销商额度并冲减利润
+func RefundResellerConsumption(userId int, quota int) {
+	chargeResellerConsumption(userId, -quota)
+}
+
+func GetResellerSubUsers(resellerId int, keyword string, pageInfo *common.PageInfo) (users []*User, total int64, err error) {
+	query := DB.Model(&User{}).Where("parent_id = ?", resellerId)
+	if keyword != "" {
+		query = query.Where("username LIKE ? or display_name LIKE ? or email LIKE ?", "%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Omit("password", "access_token").Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&users).Error
+	return users, total, err
+}
+
+// GetResellerSubUser 获取分销商名下的子用户，非其名下用户返回错误
+func GetResellerSubUser(resellerId int, userId int) (*User, error) {
+	if userId == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	user := &User{}
+	err := DB.Omit("password", "access_token").Where("id = ? and parent_id = ?", userId, resellerId).First(user).Error
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	return user, nil
+}
+
+// CreateResellerSubUser 创建分销商子用户，子用户继承分销商的分组，额度由分销商分配
+func CreateResellerSubUser(reseller *User, user *User) error {
+	exist, err := CheckUserExistOrDeleted(user.Username, "")
+	if err != nil {
+		return err
+	}
+	if exist {
+		return errors.New("用户名已存在，或已注销")
+	}
+	user.Password, err = common.Password2Hash(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Role = common.RoleCommonUser
+	user.Status = common.UserStatusEnabled
+	user.Group = reseller.Group
+	user.ParentId = reseller.Id
+	user.AffCode = common.GetRandomString(4)
+	user.SetSetting(dto.UserSetting{SidebarModules: generateDefaultSidebarConfigForRole(common.RoleCommonUser)})
+	if err = DB.Create(user).Error; err != nil {
+		return err
+	}
+	if user.Quota > 0 {
+		RecordLog(user.Id, LogTypeManage, fmt.Sprintf("分销商分配额度 %s", logger.LogQuota(user.Quota)))
+	}
+	return nil
+}
+
+// UpdateResellerSubUser 更新子用户的基本信息、额度和状态，password 为空时不修改密码
+func UpdateResellerSubUser(user *User, displayName string, password string, quota int, status int, remark string) error {
+	updates := map[string]interface{}{
+		"display_name": displayName,
+		"quota":        quota,
+		"status":       status,
+		"remark":       remark,
+	}
+	if password != "" {
+		hashed, err := common.Password2Hash(password)
+		if err != nil {
+			return err
+		}
+		updates["password"] = hashed
+	}
+	if err := DB.Model(&User{}).Where("id = ?", user.Id).Updates(updates).Error; err != nil {
+		return err
+	}
+	if quota != user.Quota {
+		RecordLog(user.Id, LogTypeManage, fmt.Sprintf("分销商将额度从 %s 修改为 %s", logger.LogQuota(user.Quota), logger.LogQuota(quota)))
+	}
+	return invalidateUserCache(user.Id)
+}
+
+func GetResellerSubUserIds(resellerId int) (ids []int, err error) {
+	err = DB.Model(&User{}).Where("parent_id = ?", resellerId).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// GetResellerLogs 获取分销商名下所有子用户的日志
+func GetResellerLogs(resellerId int, subUserId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int) (logs []*Log, total int64, err error) {
+	var userIds []int
+	if subUserId != 0 {
+		if _, err = GetResellerSubUser(resellerId, subUserId); err != nil {
+			return nil, 0, err
+		}
+		userIds = []int{subUserId}
+	} else {
+		userIds, err = GetResellerSubUserIds(resellerId)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if len(userIds) == 0 {
+		return []*Log{}, 0, nil
+	}
+	tx := LOG_DB.Where("logs.user_id in ?", userIds)
+	if logType != LogTypeUnknown {
+		tx = tx.Where("logs.type = ?", logType)
+	}
+	if modelName != "" {
+		tx = tx.Where("logs.model_name like ?", modelName)
+	}
+	if tokenName != "" {
+		tx = tx.Where("logs.token_name = ?", tokenName)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("logs.created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("logs.created_at <= ?", endTimestamp)
+	}
+	if err = tx.Model(&Log{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("logs.id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	formatUserLogs(logs)
+	return logs, total, nil
+}
+
+// ResellerStat 分销商汇总数据
+type ResellerStat struct {
+	SubUserCount   int64   `json:"sub_user_count"`
+	SubUsedQuota   int64   `json:"sub_used_quota"`  // 子用户按加价后价格累计消费
+	SubRequests    int64   `json:"sub_requests"`    // 子用户累计请求次数
+	ResellerMargin int     `json:"reseller_margin"` // 累计利润
+	Markup         float64 `json:"markup"`          // 当前加价倍率
+	Quota          int     `json:"quota"`           // 分销商当前余额
+	UsedQuota      int     `json:"used_quota"`      // 分销商按平台价格累计消费（含子用户）
+}
+
+func GetResellerStat(resellerId int) (*ResellerStat, error) {
+	reseller, err := GetUserById(resellerId, false)
+	if err != nil {
+		return nil, err
+	}
+	stat := &ResellerStat{
+		ResellerMargin: reseller.ResellerMargin,
+		Markup:         GetResellerMarkup(reseller.ToBaseUser()),
+		Quota:          reseller.Quota,
+		UsedQuota:      reseller.UsedQuota,
+	}
+	var sums struct {
+		Count        int64
+		UsedQuota    int64
+		RequestCount int64
+	}
+	err = DB.Model(&User{}).Select("count(*) as count, coalesce(sum(used_quota), 0) as used_quota, coalesce(sum(request_count), 0) as request_count").
+		Where("parent_id = ?", resellerId).Scan(&sums).Error
+	if err != nil {
+		return nil, err
+	}
+	stat.SubUserCount = sums.Count
+	stat.SubUsedQuota = sums.UsedQuota
+	stat.SubRequests = sums.RequestCount
+	return stat, nil
+}
+
+func UpdateResellerMarkup(resellerId int, markup float64) error {
+	if err := DB.Model(&User{}).Where("id = ?", resellerId).Update("reseller_markup", markup).Error; err != nil {
+		return err
+	}
+	return invalidateUserCache(resellerId)
+}
@@ -0,0 +1,147 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// ScimUser 通过 SCIM 同步的用户，记录 IdP 侧的 userName 与 externalId
+type ScimUser struct {
+	UserId      int    `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	UserName    string `json:"user_name" gorm:"type:varchar(255);uniqueIndex"`
+	ExternalId  string `json:"external_id" gorm:"type:varchar(255);index;default:''"`
+	GivenName   string `json:"given_name" gorm:"type:varchar(128);default:''"`
+	FamilyName  string `json:"family_name" gorm:"type:varchar(128);default:''"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// ScimUserWithUser SCIM 用户及其对应的本地用户
+type ScimUserWithUser struct {
+	ScimUser *ScimUser
+	User     *User
+}
+
+func GetScimUser(userId int) (*ScimUserWithUser, error) {
+	scimUser := &ScimUser{}
+	if err := DB.First(scimUser, "user_id = ?", userId).Error; err != nil {
+		return nil, err
+	}
+	user := &User{}
+	if err := DB.Omit("password", "access_token").First(user, "id = ?", userId).Error; err != nil {
+		return nil, err
+	}
+	return &ScimUserWithUser{ScimUser: scimUser, User: user}, nil
+}
+
+// GetAllScimUsers 返回全部 SCIM 用户，过滤与分页在内存中完成
+func GetAllScimUsers() ([]*ScimUserWithUser, error) {
+	var scimUsers []*ScimUser
+	if err := DB.Order("user_id asc").Find(&scimUsers).Error; err != nil {
+		return nil, err
+	}
+	if len(scimUsers) == 0 {
+		return []*ScimUserWithUser{}, nil
+	}
+	userIds := make([]int, 0, len(scimUsers))
+	for _, scimUser := range scimUsers {
+		userIds = append(userIds, scimUser.UserId)
+	}
+	var users []*User
+	if err := DB.Omit("password", "access_token").Where("id IN ?", userIds).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	userMap := make(map[int]*User, len(users))
+	for _, user := range users {
+		userMap[user.Id] = user
+	}
+	result := make([]*ScimUserWithUser, 0, len(scimUsers))
+	for _, scimUser := range scimUsers {
+		if user, ok := userMap[scimUser.UserId]; ok {
+			result = append(result, &ScimUserWithUser{ScimUser: scimUser, User: user})
+		}
+	}
+	return result, nil
+}
+
+// IsScimUser 用户是否由 SCIM 同步管理
+func IsScimUser(userId int) bool {
+	var cnt int64
+	DB.Model(&ScimUser{}).Where("user_id = ?", userId).Count(&cnt)
+	return cnt > 0
+}
+
+func IsScimUserNameTaken(userName string, exceptUserId int) (bool, error) {
+	var cnt int64
+	err := DB.Model(&ScimUser{}).Where("user_name = ? AND user_id <> ?", userName, exceptUserId).Count(&cnt).Error
+	return cnt > 0, err
+}
+
+// CreateScimUser 创建本地用户及 SCIM 关联，关联失败时删除刚创建的用户
+func CreateScimUser(user *User, scimUser *ScimUser) error {
+	if err := user.Insert(0); err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	scimUser.UserId = user.Id
+	scimUser.CreatedTime = now
+	scimUser.UpdatedTime = now
+	if err := DB.Create(scimUser).Error; err != nil {
+		_ = DB.Unscoped().Delete(&User{}, user.Id).Error
+		return err
+	}
+	return nil
+}
+
+// UpdateScimUser 保存 SCIM 同步的用户属性
+func UpdateScimUser(user *User, scimUser *ScimUser) error {
+	scimUser.UpdatedTime = common.GetTimestamp()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", user.Id).Updates(map[string]any{
+			"display_name": user.DisplayName,
+			"email":        user.Email,
+			"status":       user.Status,
+			"group":        user.Group,
+			"role":         user.Role,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(scimUser).Select("user_name", "external_id", "given_name", "family_name", "updated_time").Updates(scimUser).Error
+	})
+	if err != nil {
+		return err
+	}
+	return invalidateUserCache(user.Id)
+}
+
+// DeleteScimUser 删除 SCIM 用户，本地用户软删除
+func DeleteScimUser(userId int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&ScimUser{}, "user_id = ?", userId).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&User{}, userId).Error
+	})
+	if err != nil {
+		return err
+	}
+	return invalidateUserCache(userId)
+}
+
+// FindScimUserForOidc OIDC 首次登录时按邮箱查找尚未绑定 OIDC 的 SCIM 用户
+func FindScimUserForOidc(email string) (*User, error) {
+	if email == "" {
+		return nil, errors.New("email is empty")
+	}
+	user := &User{}
+	err := DB.Joins("JOIN scim_users ON scim_users.user_id = users.id").
+		Where("users.email = ? AND (users.oidc_id = '' OR users.oidc_id IS NULL)", email).
+		First(user).Error
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"encoding/json"
+)
+
+// StoredResponse 网关保存的 Responses API 响应，用于展开 previous_response_id，不依赖上游是否保存状态
+type StoredResponse struct {
+	Id          int             `json:"id"`
+	ResponseId  string          `json:"response_id" gorm:"type:varchar(191);uniqueIndex"`
+	UserId      int             `json:"user_id" gorm:"index"`
+	Model       string          `json:"model" gorm:"type:varchar(255)"`
+	InputItems  json.RawMessage `json:"-" gorm:"type:json"` // 展开后的完整输入，包含之前轮次的输入与输出
+	Response    json.RawMessage `json:"-" gorm:"type:json"` // 响应对象
+	Size        int64           `json:"size"`
+	CreatedTime int64           `json:"created_time" gorm:"bigint;index"`
+	ExpiresTime int64           `json:"expires_time" gorm:"bigint;index"` // 0 为永久保留
+}
+
+func (response *StoredResponse) Insert() error {
+	return DB.Create(response).Error
+}
+
+// GetStoredResponse 获取用户保存的响应，已过期的视为不存在
+func GetStoredResponse(userId int, responseId string, now int64) (*StoredResponse, error) {
+	response := &StoredResponse{}
+	err := DB.Where("user_id = ? and response_id = ? and (expires_time = 0 or expires_time > ?)", userId, responseId, now).
+		First(response).Error
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func DeleteStoredResponse(userId int, responseId string) (bool, error) {
+	result := DB.Where("user_id = ? and response_id = ?", userId, responseId).Delete(&StoredResponse{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// TrimUserStoredResponses 用户保存的响应超过空间上限时，从最早的记录开始淘汰
+func TrimUserStoredResponses(userId int, maxSize int64) (int, error) {
+	var total int64
+	err := DB.Model(&StoredResponse{}).Where("user_id = ?", userId).Select("COALESCE(SUM(size), 0)").Scan(&total).Error
+	if err != nil {
+		return 0, err
+	}
+	excess := total - maxSize
+	ids := make([]int, 0)
+	lastId := 0
+	for excess > 0 {
+		var records []StoredResponse
+		err = DB.Model(&StoredResponse{}).Select("id, size").Where("user_id = ? and id > ?", userId, lastId).
+			Order("id asc").Limit(100).Find(&records).Error
+		if err != nil {
+			return 0, err
+		}
+		if len(records) == 0 {
+			break
+		}
+		for _, record := range records {
+			if excess <= 0 {
+				break
+			}
+			ids = append(ids, record.Id)
+			excess -= record.Size
+			lastId = record.Id
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return len(ids), DB.Where("id in ?", ids).Delete(&StoredResponse{}).Error
+}
+
+// DeleteExpiredStoredResponses 清理过期的响应
+func DeleteExpiredStoredResponses(now int64) (int64, error) {
+	result := DB.Where("expires_time > 0 and expires_time <= ?", now).Delete(&StoredResponse{})
+	return result.RowsAffected, result.Error
+}
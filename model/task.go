@@ -1,13 +1,18 @@
 package model
 
 import (
+	"crypto/sha256"
 	"database/sql/driver"
+	"encoding/hex"
 	"encoding/json"
 	"time"
 
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	commonRelay "github.com/QuantumNous/new-api/relay/common"
+
+	"gorm.io/gorm"
 )
 
 type TaskStatus string
@@ -23,6 +28,8 @@ func (t TaskStatus) ToVideoStatus() string {
 		status = dto.VideoStatusCompleted
 	case TaskStatusFailure:
 		status = dto.VideoStatusFailed
+	case TaskStatusCancelled:
+		status = dto.VideoStatusCancelled
 	default:
 		status = dto.VideoStatusUnknown // Default fallback
 	}
@@ -37,6 +44,7 @@ const (
 	TaskStatusFailure               = "FAILURE"
 	TaskStatusSuccess               = "SUCCESS"
 	TaskStatusUnknown               = "UNKNOWN"
+	TaskStatusCancelled             = "CANCELLED"
 )
 
 type Task struct {
@@ -60,6 +68,16 @@ type Task struct {
 	// 禁止返回给用户，内部可能包含key等隐私信息
 	PrivateData TaskPrivateData `json:"-" gorm:"column:private_data;type:json"`
 	Data        json.RawMessage `json:"data" gorm:"type:json"`
+	// 任务回调：提交时指定的回调地址，任务结束后投递，失败按退避重试
+	CallbackUrl      string `json:"callback_url,omitempty" gorm:"type:varchar(1024)"`
+	CallbackStatus   string `json:"callback_status,omitempty" gorm:"type:varchar(16);index:idx_task_callback,priority:1"`
+	CallbackAttempts int    `json:"callback_attempts,omitempty"`
+	CallbackNextAt   int64  `json:"-" gorm:"bigint;index:idx_task_callback,priority:2"`
+	CallbackCode     int    `json:"callback_code,omitempty"` // 最后一次投递的响应状态码
+	CallbackError    string `json:"callback_error,omitempty" gorm:"type:text"`
+	CallbackTime     int64  `json:"callback_time,omitempty" gorm:"bigint"` // 投递成功时间
+	// 退还预扣额度的时间，非 0 表示已退款，只能通过 ClaimTaskRefund 修改
+	RefundTime int64 `json:"refund_time,omitempty" gorm:"bigint;default:0"`
 }
 
 func (t *Task) SetData(data any) {
@@ -95,7 +113,10 @@ func (m Properties) Value() (driver.Value, error) {
 }
 
 type TaskPrivateData struct {
-	Key string `json:"key,omitempty"`
+	Key      string `json:"key,omitempty"`
+	TokenId  int    `json:"token_id,omitempty"`  // 提交任务的令牌，用于回调签名
+	KeyIndex int    `json:"key_index,omitempty"` // 多 Key 渠道提交任务时使用的 Key 索引
+	KeyHash  string `json:"key_hash,omitempty"`  // 该 Key 的指纹，Key 被删除导致索引变化时用于重新定位
 }
 
 func (p *TaskPrivateData) Scan(val interface{}) error {
@@ -113,6 +134,38 @@ func (p TaskPrivateData) Value() (driver.Value, error) {
 	return json.Marshal(p)
 }
 
+func taskKeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// GetChannelKey 返回提交任务时使用的渠道密钥，查询、下载、取消任务都应使用该密钥。
+// 多 Key 渠道按记录的索引取 Key，不受 Key 启用状态影响；Key 被删除导致索引变化时按指纹重新定位
+func (t *Task) GetChannelKey(channel *Channel) string {
+	if t.PrivateData.Key != "" {
+		return t.PrivateData.Key
+	}
+	if !channel.ChannelInfo.IsMultiKey {
+		return channel.Key
+	}
+	keys := channel.GetKeys()
+	if len(keys) == 0 {
+		return ""
+	}
+	index := t.PrivateData.KeyIndex
+	if index >= 0 && index < len(keys) && (t.PrivateData.KeyHash == "" || taskKeyFingerprint(keys[index]) == t.PrivateData.KeyHash) {
+		return keys[index]
+	}
+	if t.PrivateData.KeyHash != "" {
+		for _, key := range keys {
+			if taskKeyFingerprint(key) == t.PrivateData.KeyHash {
+				return key
+			}
+		}
+	}
+	return keys[0]
+}
+
 // SyncTaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
 type SyncTaskQueryParams struct {
 	Platform       constant.TaskPlatform
@@ -133,6 +186,10 @@ func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.RelayInfo)
 		if relayInfo.ChannelMeta.ChannelType == constant.ChannelTypeGemini {
 			privateData.Key = relayInfo.ChannelMeta.ApiKey
 		}
+		if relayInfo.ChannelMeta.ChannelIsMultiKey {
+			privateData.KeyIndex = relayInfo.ChannelMeta.ChannelMultiKeyIndex
+			privateData.KeyHash = taskKeyFingerprint(relayInfo.ChannelMeta.ApiKey)
+		}
 		if relayInfo.UpstreamModelName != "" {
 			properties.UpstreamModelName = relayInfo.UpstreamModelName
 		}
@@ -141,6 +198,10 @@ func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.RelayInfo)
 		}
 	}
 
+	if relayInfo != nil && relayInfo.TaskRelayInfo != nil && relayInfo.CallbackUrl != "" {
+		privateData.TokenId = relayInfo.TokenId
+	}
+
 	t := &Task{
 		UserId:      relayInfo.UserId,
 		Group:       relayInfo.UsingGroup,
@@ -152,6 +213,9 @@ func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.RelayInfo)
 		Properties:  properties,
 		PrivateData: privateData,
 	}
+	if relayInfo.TaskRelayInfo != nil {
+		t.CallbackUrl = relayInfo.CallbackUrl
+	}
 	return t
 }
 
@@ -240,13 +304,44 @@ func GetAllUnFinishSyncTasks(limit int) []*Task {
 	var tasks []*Task
 	var err error
 	// get all tasks progress is not 100%
-	err = DB.Where("progress != ?", "100%").Where("status != ?", TaskStatusFailure).Where("status != ?", TaskStatusSuccess).Limit(limit).Order("id").Find(&tasks).Error
+	err = DB.Where("progress != ?", "100%").Where("status != ?", TaskStatusFailure).Where("status != ?", TaskStatusSuccess).Where("status != ?", TaskStatusCancelled).Limit(limit).Order("id").Find(&tasks).Error
 	if err != nil {
 		return nil
 	}
 	return tasks
 }
 
+// TaskPollChannel 存在未完成任务的 平台+渠道
+type TaskPollChannel struct {
+	Platform  constant.TaskPlatform
+	ChannelId int
+}
+
+func unfinishedTaskQuery() *gorm.DB {
+	return DB.Model(&Task{}).Where("progress != ?", "100%").Where("status NOT IN ?", []TaskStatus{TaskStatusFailure, TaskStatusSuccess, TaskStatusCancelled})
+}
+
+// GetUnfinishedTaskChannels 获取存在未完成任务的 平台+渠道，轮询节点据此分片后只加载自己负责的渠道
+func GetUnfinishedTaskChannels() ([]TaskPollChannel, error) {
+	var channels []TaskPollChannel
+	err := unfinishedTaskQuery().Where("task_id != ''").Distinct("platform", "channel_id").Find(&channels).Error
+	return channels, err
+}
+
+// GetUnfinishedTasksByChannel 获取渠道下已提交到上游的未完成任务
+func GetUnfinishedTasksByChannel(platform constant.TaskPlatform, channelId int, limit int) ([]*Task, error) {
+	var tasks []*Task
+	err := unfinishedTaskQuery().Where("platform = ? AND channel_id = ? AND task_id != ''", platform, channelId).Order("id").Limit(limit).Find(&tasks).Error
+	return tasks, err
+}
+
+// GetUnfinishedTaskIdsWithoutTaskId 获取没有上游任务 ID 的未完成任务
+func GetUnfinishedTaskIdsWithoutTaskId() ([]int64, error) {
+	var ids []int64
+	err := unfinishedTaskQuery().Where("(task_id = '' OR task_id IS NULL)").Pluck("id", &ids).Error
+	return ids, err
+}
+
 func GetByOnlyTaskId(taskId string) (*Task, bool, error) {
 	if taskId == "" {
 		return nil, false, nil
@@ -302,10 +397,98 @@ func (Task *Task) Insert() error {
 
 func (Task *Task) Update() error {
 	var err error
-	err = DB.Save(Task).Error
+	err = DB.Omit("refund_time").Save(Task).Error
 	return err
 }
 
+// taskPollResultColumns 轮询结果会修改的字段
+var taskPollResultColumns = []string{"status", "progress", "fail_reason", "submit_time", "start_time", "finish_time", "data", "callback_status", "callback_next_at", "updated_at"}
+
+// UpdateUnfinished 写回轮询结果，只在任务仍未结束时更新，避免覆盖轮询期间管理员强制终止或用户取消的结果；
+// 返回 false 表示任务已结束，调用方不应再执行成功或退款的后续处理
+func (t *Task) UpdateUnfinished() (bool, error) {
+	result := DB.Model(t).
+		Where("status NOT IN ?", []TaskStatus{TaskStatusSuccess, TaskStatusFailure, TaskStatusCancelled}).
+		Select(taskPollResultColumns).Updates(t)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateTaskQuota 更新任务按实际用量结算后的额度
+func UpdateTaskQuota(id int64, quota int) error {
+	return DB.Model(&Task{}).Where("id = ?", id).Update("quota", quota).Error
+}
+
+func GetTaskById(id int64) (*Task, error) {
+	var task Task
+	err := DB.Where("id = ?", id).First(&task).Error
+	return &task, err
+}
+
+// IsFinished 任务是否已进入终态
+func (t *Task) IsFinished() bool {
+	return t.Status == TaskStatusSuccess || t.Status == TaskStatusFailure || t.Status == TaskStatusCancelled
+}
+
+// FailUnfinishedTask 将未结束的任务标记为失败，通过条件更新保证多个节点并发处理时只有一个成功
+func FailUnfinishedTask(id int64, reason string, now int64) (bool, error) {
+	return finishUnfinishedTask(id, TaskStatusFailure, reason, now)
+}
+
+// CancelUnfinishedTask 将未结束的任务标记为已取消
+func CancelUnfinishedTask(id int64, reason string, now int64) (bool, error) {
+	return finishUnfinishedTask(id, TaskStatusCancelled, reason, now)
+}
+
+func finishUnfinishedTask(id int64, status TaskStatus, reason string, now int64) (bool, error) {
+	result := DB.Model(&Task{}).
+		Where("id = ? AND status NOT IN ?", id, []TaskStatus{TaskStatusSuccess, TaskStatusFailure, TaskStatusCancelled}).
+		Updates(map[string]any{
+			"status":      status,
+			"progress":    "100%",
+			"fail_reason": reason,
+			"finish_time": now,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// ClaimTaskRefund 标记任务已退款，已退款过的任务返回 false
+func ClaimTaskRefund(id int64, now int64) bool {
+	// 升级前已存在的任务 refund_time 为 NULL
+	result := DB.Model(&Task{}).Where("id = ? AND (refund_time = 0 OR refund_time IS NULL)", id).Update("refund_time", now)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// ScheduleCallback 任务进入终态时登记回调，由调用方保存任务后触发投递
+func (t *Task) ScheduleCallback() bool {
+	if t.CallbackUrl == "" || t.CallbackStatus != "" {
+		return false
+	}
+	if !t.IsFinished() {
+		return false
+	}
+	t.CallbackStatus = common.TaskCallbackStatusPending
+	t.CallbackNextAt = time.Now().Unix()
+	return true
+}
+
+// ClaimTaskCallback 通过条件更新抢占回调投递，避免多个节点重复投递
+func ClaimTaskCallback(id int64, now int64, leaseSeconds int64) bool {
+	result := DB.Model(&Task{}).
+		Where("id = ? and callback_status = ? and callback_next_at <= ?", id, common.TaskCallbackStatusPending, now).
+		Update("callback_next_at", now+leaseSeconds)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+func (t *Task) SaveCallbackResult() error {
+	return DB.Model(t).Select("callback_status", "callback_attempts", "callback_next_at", "callback_code", "callback_error", "callback_time").Updates(t).Error
+}
+
+func GetDueTaskCallbacks(now int64, limit int) (tasks []*Task, err error) {
+	err = DB.Where("callback_status = ? and callback_next_at <= ?", common.TaskCallbackStatusPending, now).
+		Order("callback_next_at asc").Limit(limit).Find(&tasks).Error
+	return tasks, err
+}
+
 func TaskBulkUpdate(TaskIds []string, params map[string]any) error {
 	if len(TaskIds) == 0 {
 		return nil
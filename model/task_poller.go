@@ -0,0 +1,137 @@
+package model
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm/clause"
+)
+
+// 任务轮询协调：节点通过心跳登记在线状态，按渠道分片轮询，渠道租约保证同一时刻只有一个节点查询同一渠道。
+// 启用 Redis 时使用 Redis，否则使用数据库表。
+
+const (
+	taskPollerNodesKey     = "task_poller:nodes"
+	taskPollerLeaseKeyPref = "task_poller:lease:"
+)
+
+// TaskPollerNode 轮询节点心跳
+type TaskPollerNode struct {
+	NodeId    string `json:"node_id" gorm:"primaryKey;type:varchar(128)"`
+	Heartbeat int64  `json:"heartbeat" gorm:"bigint;index"`
+}
+
+// TaskPollerLease 轮询租约
+type TaskPollerLease struct {
+	Name      string `json:"name" gorm:"primaryKey;type:varchar(128)"`
+	Holder    string `json:"holder" gorm:"type:varchar(128)"`
+	ExpiresAt int64  `json:"expires_at" gorm:"bigint"`
+}
+
+var acquireLeaseScript = redis.NewScript(`
+local holder = redis.call("GET", KEYS[1])
+if holder == ARGV[1] then
+	redis.call("EXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if not holder then
+	redis.call("SET", KEYS[1], ARGV[1], "EX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// HeartbeatTaskPollerNode 上报节点心跳
+func HeartbeatTaskPollerNode(nodeId string) error {
+	now := time.Now().Unix()
+	if common.RedisEnabled {
+		return common.RDB.ZAdd(context.Background(), taskPollerNodesKey, &redis.Z{Score: float64(now), Member: nodeId}).Err()
+	}
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "node_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"heartbeat"}),
+	}).Create(&TaskPollerNode{NodeId: nodeId, Heartbeat: now}).Error
+}
+
+// GetActiveTaskPollerNodes 获取 ttl 秒内有心跳的节点，按节点 ID 排序，并清理过期节点
+func GetActiveTaskPollerNodes(ttl int) ([]string, error) {
+	since := time.Now().Unix() - int64(ttl)
+	var nodes []string
+	if common.RedisEnabled {
+		ctx := context.Background()
+		if err := common.RDB.ZRemRangeByScore(ctx, taskPollerNodesKey, "-inf", "("+strconv.FormatInt(since, 10)).Err(); err != nil {
+			return nil, err
+		}
+		members, err := common.RDB.ZRange(ctx, taskPollerNodesKey, 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		nodes = members
+	} else {
+		if err := DB.Where("heartbeat < ?", since).Delete(&TaskPollerNode{}).Error; err != nil {
+			return nil, err
+		}
+		if err := DB.Model(&TaskPollerNode{}).Pluck("node_id", &nodes).Error; err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// AcquireTaskPollerLease 获取或续期租约，租约已被其他节点持有且未过期时返回 false
+func AcquireTaskPollerLease(name string, holder string, ttl int) bool {
+	if common.RedisEnabled {
+		res, err := acquireLeaseScript.Run(context.Background(), common.RDB, []string{taskPollerLeaseKeyPref + name}, holder, ttl).Int()
+		if err != nil {
+			common.SysError("failed to acquire task poller lease: " + err.Error())
+			return false
+		}
+		return res == 1
+	}
+	now := time.Now().Unix()
+	result := DB.Model(&TaskPollerLease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", name, holder, now).
+		Updates(map[string]any{"holder": holder, "expires_at": now + int64(ttl)})
+	if result.Error == nil && result.RowsAffected > 0 {
+		return true
+	}
+	result = DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&TaskPollerLease{Name: name, Holder: holder, ExpiresAt: now + int64(ttl)})
+	if result.Error == nil && result.RowsAffected > 0 {
+		return true
+	}
+	// 部分数据库在更新值未变化时 RowsAffected 为 0，这里再确认一次持有者
+	var lease TaskPollerLease
+	if err := DB.Where("name = ?", name).First(&lease).Error; err != nil {
+		return false
+	}
+	return lease.Holder == holder && lease.ExpiresAt >= now
+}
+
+// ReleaseTaskPollerLease 释放自己持有的租约
+func ReleaseTaskPollerLease(name string, holder string) {
+	var err error
+	if common.RedisEnabled {
+		err = releaseLeaseScript.Run(context.Background(), common.RDB, []string{taskPollerLeaseKeyPref + name}, holder).Err()
+		if err == redis.Nil {
+			err = nil
+		}
+	} else {
+		err = DB.Where("name = ? AND holder = ?", name, holder).Delete(&TaskPollerLease{}).Error
+	}
+	if err != nil {
+		common.SysError("failed to release task poller lease: " + err.Error())
+	}
+}
@@ -27,6 +27,12 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
+	CallbackUrl        string         `json:"callback_url" gorm:"type:varchar(1024);default:''"`   // 异步任务默认回调地址
+	CallbackSecret     string         `json:"callback_secret" gorm:"type:varchar(64);default:''"`  // 异步任务回调签名密钥，为空时不签名
+	AllowEndpoints     string         `json:"allow_endpoints" gorm:"type:varchar(512);default:''"` // 允许访问的接口范围，逗号分隔，为空不限制
+	AllowOrigins       string         `json:"allow_origins" gorm:"type:varchar(1024);default:''"`  // 允许的 Origin/Referer，换行分隔，为空不限制
+	MaxInputTokens     int            `json:"max_input_tokens" gorm:"default:0"`                   // 单次请求最大输入 token，0 不限制
+	MaxOutputTokens    int            `json:"max_output_tokens" gorm:"default:0"`                  // 单次请求最大 max_tokens，0 不限制
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -34,26 +40,66 @@ func (token *Token) Clean() {
 	token.Key = ""
 }
 
-func (token *Token) GetIpLimitsMap() map[string]any {
-	// delete empty spaces
-	//split with \n
-	ipLimitsMap := make(map[string]any)
+// splitTokenRules 按换行或逗号拆分规则，忽略空项
+func splitTokenRules(rules string) []string {
+	return strings.FieldsFunc(rules, func(r rune) bool {
+		return r == '\n' || r == ',' || r == '\r' || r == ' '
+	})
+}
+
+// IsIpAllowed 判断客户端 IP 是否在令牌的 IP 白名单中，支持 CIDR，白名单为空时不限制
+func (token *Token) IsIpAllowed(clientIp string) bool {
 	if token.AllowIps == nil {
-		return ipLimitsMap
-	}
-	cleanIps := strings.ReplaceAll(*token.AllowIps, " ", "")
-	if cleanIps == "" {
-		return ipLimitsMap
-	}
-	ips := strings.Split(cleanIps, "\n")
-	for _, ip := range ips {
-		ip = strings.TrimSpace(ip)
-		ip = strings.ReplaceAll(ip, ",", "")
-		if common.IsIP(ip) {
-			ipLimitsMap[ip] = true
+		return true
+	}
+	rules := splitTokenRules(*token.AllowIps)
+	if len(rules) == 0 {
+		return true
+	}
+	return common.IsIPAllowed(clientIp, rules)
+}
+
+// IsEndpointAllowed 判断令牌是否可以访问指定接口范围，scope 为空表示不受限制的辅助接口
+func (token *Token) IsEndpointAllowed(scope string) bool {
+	if scope == "" || strings.TrimSpace(token.AllowEndpoints) == "" {
+		return true
+	}
+	for _, allowed := range splitTokenRules(token.AllowEndpoints) {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOriginAllowed 判断请求来源是否在令牌的来源白名单中，规则为 scheme://host[:port] 或 *.example.com 形式的通配域名
+func (token *Token) IsOriginAllowed(origin string) bool {
+	rules := splitTokenRules(token.AllowOrigins)
+	if len(rules) == 0 {
+		return true
+	}
+	if origin == "" {
+		return false
+	}
+	origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	host := origin
+	if idx := strings.Index(host, "://"); idx >= 0 {
+		host = host[idx+3:]
+	}
+	if idx := strings.LastIndex(host, ":"); idx >= 0 && !strings.HasSuffix(host, "]") {
+		host = host[:idx]
+	}
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSuffix(rule, "/"))
+		if strings.HasPrefix(rule, "*.") {
+			if strings.HasSuffix(host, rule[1:]) {
+				return true
+			}
+		} else if rule == origin {
+			return true
 		}
 	}
-	return ipLimitsMap
+	return false
 }
 
 func GetAllUserTokens(userId int, startIdx int, num int) ([]*Token, error) {
@@ -185,7 +231,8 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "callback_url", "callback_secret",
+		"allow_endpoints", "allow_origins", "max_input_tokens", "max_output_tokens").Updates(token).Error
 	return err
 }
 
@@ -362,3 +409,29 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 
 	return len(tokens), nil
 }
+
+// DisableUserTokens 禁用用户全部启用中的令牌并清除缓存
+func DisableUserTokens(userId int) error {
+	var tokens []*Token
+	if err := DB.Where("user_id = ? and status = ?", userId, common.TokenStatusEnabled).Find(&tokens).Error; err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(tokens))
+	for _, token := range tokens {
+		ids = append(ids, token.Id)
+	}
+	if err := DB.Model(&Token{}).Where("id IN ?", ids).Update("status", common.TokenStatusDisabled).Error; err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		for _, token := range tokens {
+			if err := cacheDeleteToken(token.Key); err != nil {
+				common.SysLog("failed to delete token cache: " + err.Error())
+			}
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
@@ -16,6 +17,7 @@ type TopUp struct {
 	UserId        int     `json:"user_id" gorm:"index"`
 	Amount        int64   `json:"amount"`
 	Money         float64 `json:"money"`
+	Quota         int     `json:"quota" gorm:"default:0"` // 实际到账额度，退款时据此扣回
 	TradeNo       string  `json:"trade_no" gorm:"unique;type:varchar(255);index"`
 	PaymentMethod string  `json:"payment_method" gorm:"type:varchar(50)"`
 	CreateTime    int64   `json:"create_time"`
@@ -35,6 +37,26 @@ func (topUp *TopUp) Update() error {
 	return err
 }
 
+// CreditedQuota 返回订单到账的额度。Quota 字段加入前完成的订单该值为 0，
+// 此时按各支付渠道完成时的算法从 Amount / Money 还原：
+// - Stripe 订单：Money * QuotaPerUnit
+// - Creem 订单（无支付方式，ref_ 前缀单号）：Amount 即额度
+// - 其他订单（如易支付）：Amount * QuotaPerUnit
+func (topUp *TopUp) CreditedQuota() int {
+	if topUp.Quota > 0 {
+		return topUp.Quota
+	}
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	switch {
+	case topUp.PaymentMethod == "stripe":
+		return int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
+	case topUp.PaymentMethod == "" && strings.HasPrefix(topUp.TradeNo, "ref_"):
+		return int(topUp.Amount)
+	default:
+		return int(decimal.NewFromInt(topUp.Amount).Mul(dQuotaPerUnit).IntPart())
+	}
+}
+
 func GetTopUpById(id int) *TopUp {
 	var topUp *TopUp
 	var err error
@@ -78,6 +100,8 @@ func Recharge(referenceId string, customerId string) (err error) {
 			return errors.New("充值订单状态错误")
 		}
 
+		quota = topUp.Money * common.QuotaPerUnit
+		topUp.Quota = int(quota)
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
 		err = tx.Save(topUp).Error
@@ -85,7 +109,6 @@ func Recharge(referenceId string, customerId string) (err error) {
 			return err
 		}
 
-		quota = topUp.Money * common.QuotaPerUnit
 		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(map[string]interface{}{"stripe_customer": customerId, "quota": gorm.Expr("quota + ?", quota)}).Error
 		if err != nil {
 			return err
@@ -99,6 +122,7 @@ func Recharge(referenceId string, customerId string) (err error) {
 	}
 
 	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", logger.FormatQuota(int(quota)), topUp.Amount))
+	CreateTopUpCommissions(topUp)
 
 	return nil
 }
@@ -248,6 +272,7 @@ func ManualCompleteTopUp(tradeNo string) error {
 	var userId int
 	var quotaToAdd int
 	var payMoney float64
+	var completedTopUp *TopUp
 
 	err := DB.Transaction(func(tx *gorm.DB) error {
 		topUp := &TopUp{}
@@ -281,6 +306,7 @@ func ManualCompleteTopUp(tradeNo string) error {
 		}
 
 		// 标记完成
+		topUp.Quota = quotaToAdd
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
 		if err := tx.Save(topUp).Error; err != nil {
@@ -294,6 +320,7 @@ func ManualCompleteTopUp(tradeNo string) error {
 
 		userId = topUp.UserId
 		payMoney = topUp.Money
+		completedTopUp = topUp
 		return nil
 	})
 
@@ -303,6 +330,9 @@ func ManualCompleteTopUp(tradeNo string) error {
 
 	// 事务外记录日志，避免阻塞
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney))
+	if completedTopUp != nil {
+		CreateTopUpCommissions(completedTopUp)
+	}
 	return nil
 }
 func RechargeCreem(referenceId string, customerEmail string, customerName string) (err error) {
@@ -328,6 +358,9 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 			return errors.New("充值订单状态错误")
 		}
 
+		// Creem 直接使用 Amount 作为充值额度（整数）
+		quota = topUp.Amount
+		topUp.Quota = int(quota)
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
 		err = tx.Save(topUp).Error
@@ -335,9 +368,6 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 			return err
 		}
 
-		// Creem 直接使用 Amount 作为充值额度（整数）
-		quota = topUp.Amount
-
 		// 构建更新字段，优先使用邮箱，如果邮箱为空则使用用户名
 		updateFields := map[string]interface{}{
 			"quota": gorm.Expr("quota + ?", quota),
@@ -371,6 +401,7 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 	}
 
 	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用Creem充值成功，充值额度: %v，支付金额：%.2f", quota, topUp.Money))
+	CreateTopUpCommissions(topUp)
 
 	return nil
 }
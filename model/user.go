@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
@@ -31,6 +32,7 @@ type User struct {
 	OidcId           string         `json:"oidc_id" gorm:"column:oidc_id;index"`
 	WeChatId         string         `json:"wechat_id" gorm:"column:wechat_id;index"`
 	TelegramId       string         `json:"telegram_id" gorm:"column:telegram_id;index"`
+	LdapId           string         `json:"ldap_id" gorm:"column:ldap_id;index"`
 	VerificationCode string         `json:"verification_code" gorm:"-:all"`                                    // this field is only for Email verification, don't save it to database!
 	AccessToken      *string        `json:"access_token" gorm:"type:char(32);column:access_token;uniqueIndex"` // this token is for system management
 	Quota            int            `json:"quota" gorm:"type:int;default:0"`
@@ -47,17 +49,26 @@ type User struct {
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
 	Remark           string         `json:"remark,omitempty" gorm:"type:varchar(255)" validate:"max=255"`
 	StripeCustomer   string         `json:"stripe_customer" gorm:"type:varchar(64);column:stripe_customer;index"`
+	CreditLimit      int            `json:"credit_limit" gorm:"type:int;default:0;column:credit_limit"`                 // 信用额度，允许余额透支到 -CreditLimit
+	BillingMode      string         `json:"billing_mode" gorm:"type:varchar(16);default:'prepaid';column:billing_mode"` // prepaid, postpaid
+	ParentId         int            `json:"parent_id" gorm:"type:int;default:0;column:parent_id;index"`                 // 所属分销商，0 表示平台直属用户
+	ResellerMarkup   float64        `json:"reseller_markup" gorm:"default:0;column:reseller_markup"`                    // 分销商加价倍率，子用户按平台价格乘以该倍率计费
+	ResellerMargin   int            `json:"reseller_margin" gorm:"type:int;default:0;column:reseller_margin"`           // 分销商累计利润
 }
 
 func (user *User) ToBaseUser() *UserBase {
 	cache := &UserBase{
-		Id:       user.Id,
-		Group:    user.Group,
-		Quota:    user.Quota,
-		Status:   user.Status,
-		Username: user.Username,
-		Setting:  user.Setting,
-		Email:    user.Email,
+		Id:          user.Id,
+		Group:       user.Group,
+		Quota:       user.Quota,
+		Status:      user.Status,
+		Username:    user.Username,
+		Setting:     user.Setting,
+		Email:       user.Email,
+		CreditLimit: user.CreditLimit,
+		BillingMode: user.BillingMode,
+		ParentId:    user.ParentId,
+		Markup:      user.ResellerMarkup,
 	}
 	return cache
 }
@@ -447,7 +458,8 @@ func (user *User) Update(updatePassword bool) error {
 	return updateUserCache(*user)
 }
 
-func (user *User) Edit(updatePassword bool) error {
+// Edit 更新用户资料，creditLimit 为 nil 时保留原信用额度
+func (user *User) Edit(updatePassword bool, creditLimit *int) error {
 	var err error
 	if updatePassword {
 		user.Password, err = common.Password2Hash(user.Password)
@@ -464,6 +476,12 @@ func (user *User) Edit(updatePassword bool) error {
 		"quota":        newUser.Quota,
 		"remark":       newUser.Remark,
 	}
+	if creditLimit != nil {
+		updates["credit_limit"] = *creditLimit
+	}
+	if newUser.BillingMode != "" {
+		updates["billing_mode"] = newUser.BillingMode
+	}
 	if updatePassword {
 		updates["password"] = newUser.Password
 	}
@@ -556,6 +574,14 @@ func (user *User) FillUserByOidcId() error {
 	return nil
 }
 
+func (user *User) FillUserByLdapId() error {
+	if user.LdapId == "" {
+		return errors.New("LDAP id 为空！")
+	}
+	DB.Where(User{LdapId: user.LdapId}).First(user)
+	return nil
+}
+
 func (user *User) FillUserByWeChatId() error {
 	if user.WeChatId == "" {
 		return errors.New("WeChat id 为空！")
@@ -595,6 +621,10 @@ func IsOidcIdAlreadyTaken(oidcId string) bool {
 	return DB.Where("oidc_id = ?", oidcId).Find(&User{}).RowsAffected == 1
 }
 
+func IsLdapIdAlreadyTaken(ldapId string) bool {
+	return DB.Where("ldap_id = ?", ldapId).Find(&User{}).RowsAffected == 1
+}
+
 func IsTelegramIdAlreadyTaken(telegramId string) bool {
 	return DB.Unscoped().Where("telegram_id = ?", telegramId).Find(&User{}).RowsAffected == 1
 }
@@ -608,7 +638,20 @@ func ResetUserPasswordByEmail(email string, password string) error {
 		return err
 	}
 	err = DB.Model(&User{}).Where("email = ?", email).Update("password", hashedPassword).Error
-	return err
+	if err != nil {
+		return err
+	}
+	// 重置密码后使已有会话全部失效
+	var userIds []int
+	if err := DB.Model(&User{}).Where("email = ?", email).Pluck("id", &userIds).Error; err != nil {
+		return err
+	}
+	for _, userId := range userIds {
+		if err := RevokeUserSessions(userId, ""); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func IsAdmin(userId int) bool {
@@ -694,6 +737,31 @@ func GetUserQuota(id int, fromDB bool) (quota int, err error) {
 	return quota, nil
 }
 
+// GetUserSpendableQuota returns the quota the user can still consume,
+// including the credit limit for trusted accounts.
+func GetUserSpendableQuota(id int) (spendable int, quota int, err error) {
+	userCache, err := GetUserCache(id)
+	if err != nil {
+		return 0, 0, err
+	}
+	spendable = userCache.GetSpendableQuota()
+	// 子用户的消费同时受所属分销商余额限制，分销商余额按加价倍率折算
+	if userCache.ParentId != 0 {
+		resellerCache, err := GetUserCache(userCache.ParentId)
+		if err != nil {
+			return 0, 0, err
+		}
+		resellerSpendable := resellerCache.GetSpendableQuota()
+		if resellerSpendable < math.MaxInt32 {
+			resellerSpendable = int(float64(resellerSpendable) * GetResellerMarkup(resellerCache))
+		}
+		if resellerSpendable < spendable {
+			spendable = resellerSpendable
+		}
+	}
+	return spendable, userCache.Quota, nil
+}
+
 func GetUserUsedQuota(id int) (quota int, err error) {
 	err = DB.Model(&User{}).Where("id = ?", id).Select("used_quota").Find(&quota).Error
 	return quota, err
@@ -835,6 +903,7 @@ func GetRootUser() (user *User) {
 }
 
 func UpdateUserUsedQuotaAndRequestCount(id int, quota int) {
+	chargeResellerConsumption(id, quota)
 	if common.BatchUpdateEnabled {
 		addNewRecord(BatchUpdateTypeUsedQuota, id, quota)
 		addNewRecord(BatchUpdateTypeRequestCount, id, 1)
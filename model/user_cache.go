@@ -2,6 +2,7 @@ package model
 
 import (
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -22,6 +23,12 @@ type UserBase struct {
 	Status   int    `json:"status"`
 	Username string `json:"username"`
 	Setting  string `json:"setting"`
+	// CreditLimit 与 BillingMode 用于判断余额是否允许透支
+	CreditLimit int    `json:"credit_limit"`
+	BillingMode string `json:"billing_mode"`
+	// ParentId 为子用户所属分销商，Markup 为分销商设置的加价倍率
+	ParentId int     `json:"parent_id"`
+	Markup   float64 `json:"markup"`
 }
 
 func (user *UserBase) WriteContext(c *gin.Context) {
@@ -31,6 +38,19 @@ func (user *UserBase) WriteContext(c *gin.Context) {
 	common.SetContextKey(c, constant.ContextKeyUserEmail, user.Email)
 	common.SetContextKey(c, constant.ContextKeyUserName, user.Username)
 	common.SetContextKey(c, constant.ContextKeyUserSetting, user.GetSetting())
+	common.SetContextKey(c, constant.ContextKeyResellerId, user.ParentId)
+	if user.ParentId != 0 {
+		resellerCache, _ := GetUserCache(user.ParentId)
+		common.SetContextKey(c, constant.ContextKeyResellerMarkup, GetResellerMarkup(resellerCache))
+	}
+}
+
+// GetSpendableQuota 返回用户可消费额度：余额加信用额度，后付费且未设置信用额度时不限制
+func (user *UserBase) GetSpendableQuota() int {
+	if user.BillingMode == common.UserBillingModePostpaid && user.CreditLimit <= 0 {
+		return math.MaxInt32
+	}
+	return user.Quota + user.CreditLimit
 }
 
 func (user *UserBase) GetSetting() dto.UserSetting {
@@ -100,13 +120,17 @@ func GetUserCache(userId int) (userCache *UserBase, err error) {
 
 	// Create cache object from user data
 	userCache = &UserBase{
-		Id:       user.Id,
-		Group:    user.Group,
-		Quota:    user.Quota,
-		Status:   user.Status,
-		Username: user.Username,
-		Setting:  user.Setting,
-		Email:    user.Email,
+		Id:          user.Id,
+		Group:       user.Group,
+		Quota:       user.Quota,
+		Status:      user.Status,
+		Username:    user.Username,
+		Setting:     user.Setting,
+		Email:       user.Email,
+		CreditLimit: user.CreditLimit,
+		BillingMode: user.BillingMode,
+		ParentId:    user.ParentId,
+		Markup:      user.ResellerMarkup,
 	}
 
 	return userCache, nil
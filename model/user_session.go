@@ -0,0 +1,324 @@
+package model
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-contrib/sessions"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+	"gorm.io/gorm"
+)
+
+// UserSession 服务端保存的登录会话，cookie 中只保存签名后的会话 ID，删除记录即可使会话失效
+type UserSession struct {
+	Id           int    `json:"id"`
+	SessionId    string `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	UserId       int    `json:"user_id" gorm:"index"` // 0 表示尚未登录的会话（如 OAuth state）
+	Ip           string `json:"ip" gorm:"type:varchar(64);default:''"`
+	UserAgent    string `json:"user_agent" gorm:"type:varchar(255);default:''"`
+	Data         string `json:"-" gorm:"type:text"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	LastSeenTime int64  `json:"last_seen_time" gorm:"bigint"`
+	ExpiresAt    int64  `json:"expires_at" gorm:"bigint;index"`
+}
+
+const (
+	userSessionCacheSeconds  = 300
+	userSessionTouchInterval = 60   // 最近活跃时间的最小写入间隔
+	anonymousSessionSeconds  = 1800 // 未登录会话（OAuth state、两步验证等）的有效期
+)
+
+func userSessionCacheKey(sessionId string) string {
+	return "user_session:" + sessionId
+}
+
+func getUserSessionBySessionId(sessionId string) (*UserSession, error) {
+	userSession := &UserSession{}
+	if common.RedisEnabled {
+		if err := common.RedisHGetObj(userSessionCacheKey(sessionId), userSession); err == nil && userSession.Id != 0 {
+			return userSession, nil
+		}
+	}
+	// 撤销后的旧 cookie 很常见，用 Find 避免记录 record not found 日志
+	result := DB.Where("session_id = ?", sessionId).Limit(1).Find(userSession)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if common.RedisEnabled {
+		if err := common.RedisHSetObj(userSessionCacheKey(sessionId), userSession, time.Duration(userSessionCacheSeconds)*time.Second); err != nil {
+			common.SysLog("failed to cache user session: " + err.Error())
+		}
+	}
+	return userSession, nil
+}
+
+func invalidateUserSessionCache(sessionIds ...string) {
+	if !common.RedisEnabled {
+		return
+	}
+	for _, sessionId := range sessionIds {
+		if err := common.RedisDelKey(userSessionCacheKey(sessionId)); err != nil {
+			common.SysLog("failed to delete user session cache: " + err.Error())
+		}
+	}
+}
+
+// GetUserSessions 列出用户未过期的会话
+func GetUserSessions(userId int) (userSessions []*UserSession, err error) {
+	err = DB.Where("user_id = ? and expires_at > ?", userId, common.GetTimestamp()).Order("last_seen_time desc").Find(&userSessions).Error
+	return userSessions, err
+}
+
+// IsCurrentSession 判断会话是否为发起请求的会话
+func (userSession *UserSession) IsCurrentSession(sessionId string) bool {
+	return sessionId != "" && userSession.SessionId == sessionId
+}
+
+// RevokeUserSession 撤销用户的单个会话
+func RevokeUserSession(id int, userId int) error {
+	userSession := &UserSession{}
+	if err := DB.First(userSession, "id = ? and user_id = ?", id, userId).Error; err != nil {
+		return errors.New("会话不存在")
+	}
+	if err := DB.Delete(userSession).Error; err != nil {
+		return err
+	}
+	invalidateUserSessionCache(userSession.SessionId)
+	return nil
+}
+
+// RevokeUserSessions 撤销用户的全部会话，exceptSessionId 不为空时保留该会话
+func RevokeUserSessions(userId int, exceptSessionId string) error {
+	if userId == 0 {
+		return nil
+	}
+	var sessionIds []string
+	query := DB.Model(&UserSession{}).Where("user_id = ?", userId)
+	if exceptSessionId != "" {
+		query = query.Where("session_id <> ?", exceptSessionId)
+	}
+	if err := query.Pluck("session_id", &sessionIds).Error; err != nil {
+		return err
+	}
+	if len(sessionIds) == 0 {
+		return nil
+	}
+	if err := DB.Where("session_id IN ?", sessionIds).Delete(&UserSession{}).Error; err != nil {
+		return err
+	}
+	invalidateUserSessionCache(sessionIds...)
+	return nil
+}
+
+// DeleteExpiredUserSessions 清理过期会话
+func DeleteExpiredUserSessions() (int64, error) {
+	result := DB.Where("expires_at < ?", common.GetTimestamp()).Delete(&UserSession{})
+	return result.RowsAffected, result.Error
+}
+
+// SessionStore 基于数据库（启用 Redis 时带缓存）的会话存储，实现 gin-contrib/sessions 的 Store 接口
+type SessionStore struct {
+	Codecs  []securecookie.Codec
+	options *gsessions.Options
+}
+
+func NewSessionStore(keyPairs ...[]byte) *SessionStore {
+	store := &SessionStore{
+		Codecs:  securecookie.CodecsFromPairs(keyPairs...),
+		options: &gsessions.Options{Path: "/", MaxAge: 86400 * 30},
+	}
+	// 会话数据保存在服务端，不受 cookie 大小限制
+	for _, codec := range store.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxLength(0)
+		}
+	}
+	return store
+}
+
+func (s *SessionStore) Options(options sessions.Options) {
+	s.options = options.ToGorillaOptions()
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(options.MaxAge)
+		}
+	}
+}
+
+func (s *SessionStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New 按 cookie 中的会话 ID 加载会话，会话不存在、已撤销或已过期时返回新会话
+func (s *SessionStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(s, name)
+	opts := *s.options
+	session.Options = &opts
+	session.IsNew = true
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var sessionId string
+	if err := securecookie.DecodeMulti(name, c.Value, &sessionId, s.Codecs...); err != nil {
+		return session, nil
+	}
+	userSession, err := getUserSessionBySessionId(sessionId)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return session, err
+		}
+		return session, nil
+	}
+	now := common.GetTimestamp()
+	if userSession.ExpiresAt < now {
+		return session, nil
+	}
+	if err := securecookie.DecodeMulti(name, userSession.Data, &session.Values, s.Codecs...); err != nil {
+		return session, nil
+	}
+	session.ID = sessionId
+	session.IsNew = false
+	if userSession.UserId != 0 && now-userSession.LastSeenTime >= userSessionTouchInterval {
+		ip := requestClientIp(r)
+		gopool.Go(func() {
+			err := DB.Model(&UserSession{}).Where("id = ?", userSession.Id).Updates(map[string]any{
+				"last_seen_time": now,
+				"ip":             ip,
+			}).Error
+			if err != nil {
+				common.SysLog("failed to update user session last seen time: " + err.Error())
+				return
+			}
+			invalidateUserSessionCache(sessionId)
+		})
+	}
+	return session, nil
+}
+
+// Save 保存会话数据并写入 cookie，MaxAge <= 0 时删除会话
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.Options.MaxAge <= 0 {
+		if session.ID != "" {
+			if err := DB.Where("session_id = ?", session.ID).Delete(&UserSession{}).Error; err != nil {
+				return err
+			}
+			invalidateUserSessionCache(session.ID)
+		}
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	userId, _ := session.Values["id"].(int)
+	// 没有数据的未登录会话不落库
+	if userId == 0 && len(session.Values) == 0 && session.ID == "" {
+		return nil
+	}
+	data, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	maxAge := int64(session.Options.MaxAge)
+	if userId == 0 {
+		maxAge = min(maxAge, anonymousSessionSeconds)
+	}
+	expiresAt := now + maxAge
+	if session.ID != "" {
+		// 登录或切换用户时重新生成会话 ID，防止会话固定攻击
+		existing, err := getUserSessionBySessionId(session.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && existing.UserId != userId {
+			if err := DB.Where("session_id = ?", session.ID).Delete(&UserSession{}).Error; err != nil {
+				return err
+			}
+			invalidateUserSessionCache(session.ID)
+			session.ID = ""
+		}
+	}
+	if session.ID != "" {
+		result := DB.Model(&UserSession{}).Where("session_id = ?", session.ID).Updates(map[string]any{
+			"user_id":        userId,
+			"data":           data,
+			"last_seen_time": now,
+			"expires_at":     expiresAt,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		invalidateUserSessionCache(session.ID)
+		if result.RowsAffected == 0 {
+			// MySQL 在值未变化时同样返回 0，需确认会话是否已被撤销；已撤销则重新生成 ID，避免复用
+			var cnt int64
+			if err := DB.Model(&UserSession{}).Where("session_id = ?", session.ID).Count(&cnt).Error; err != nil {
+				return err
+			}
+			if cnt == 0 {
+				session.ID = ""
+			}
+		}
+	}
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+		userSession := &UserSession{
+			SessionId:    session.ID,
+			UserId:       userId,
+			Ip:           requestClientIp(r),
+			UserAgent:    truncateUserAgent(r.UserAgent()),
+			Data:         data,
+			CreatedTime:  now,
+			LastSeenTime: now,
+			ExpiresAt:    expiresAt,
+		}
+		if err := DB.Create(userSession).Error; err != nil {
+			return fmt.Errorf("failed to create session: %w", err)
+		}
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+type sessionClientIpKey struct{}
+
+// WithSessionClientIp 记录 gin 按信任代理配置解析出的客户端 IP，供会话存储记录来源
+func WithSessionClientIp(r *http.Request, ip string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionClientIpKey{}, ip))
+}
+
+// requestClientIp 取请求来源 IP，未经 WithSessionClientIp 设置时使用连接地址，不信任客户端提供的请求头
+func requestClientIp(r *http.Request) string {
+	if ip, ok := r.Context().Value(sessionClientIpKey{}).(string); ok && ip != "" {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr)); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func truncateUserAgent(userAgent string) string {
+	if len(userAgent) > 255 {
+		return userAgent[:255]
+	}
+	return userAgent
+}
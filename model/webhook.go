@@ -0,0 +1,191 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// WebhookSubscription 事件订阅，用户订阅自身事件，管理员可创建全局订阅接收系统事件
+type WebhookSubscription struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Name        string `json:"name" gorm:"type:varchar(64);default:''"`
+	Url         string `json:"url" gorm:"type:varchar(512)"`
+	Secret      string `json:"secret" gorm:"type:varchar(128);default:''"`
+	EventTypes  string `json:"event_types" gorm:"type:text"` // 逗号分隔的事件类型
+	Global      bool   `json:"global" gorm:"default:false"`  // 全局订阅：接收系统事件及所有用户的事件，仅管理员可设置
+	Status      int    `json:"status" gorm:"default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// WebhookDelivery 事件投递记录（outbox），失败后按指数退避重试
+type WebhookDelivery struct {
+	Id             int    `json:"id"`
+	SubscriptionId int    `json:"subscription_id" gorm:"index"`
+	UserId         int    `json:"user_id" gorm:"index"` // 订阅所属用户
+	EventId        string `json:"event_id" gorm:"type:varchar(64);index"`
+	EventType      string `json:"event_type" gorm:"type:varchar(64);index"`
+	Payload        string `json:"payload" gorm:"type:text"`
+	Status         string `json:"status" gorm:"type:varchar(16);index:idx_webhook_delivery_due,priority:1"`
+	Attempts       int    `json:"attempts" gorm:"default:0"`
+	NextAttemptAt  int64  `json:"next_attempt_at" gorm:"bigint;index:idx_webhook_delivery_due,priority:2"`
+	ResponseCode   int    `json:"response_code" gorm:"default:0"`
+	LastError      string `json:"last_error" gorm:"type:text"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint;index"`
+	DeliveredTime  int64  `json:"delivered_time" gorm:"bigint"`
+}
+
+func (subscription *WebhookSubscription) GetEventTypes() []string {
+	eventTypes := make([]string, 0)
+	for _, t := range strings.Split(subscription.EventTypes, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			eventTypes = append(eventTypes, t)
+		}
+	}
+	return eventTypes
+}
+
+func (subscription *WebhookSubscription) Subscribes(eventType string) bool {
+	for _, t := range subscription.GetEventTypes() {
+		if t == eventType || t == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (subscription *WebhookSubscription) Insert() error {
+	subscription.CreatedTime = common.GetTimestamp()
+	subscription.UpdatedTime = subscription.CreatedTime
+	return DB.Create(subscription).Error
+}
+
+func (subscription *WebhookSubscription) Update() error {
+	subscription.UpdatedTime = common.GetTimestamp()
+	return DB.Model(subscription).Select("name", "url", "secret", "event_types", "global", "status", "updated_time").Updates(subscription).Error
+}
+
+func GetUserWebhookSubscriptions(userId int) (subscriptions []*WebhookSubscription, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func GetWebhookSubscriptionById(id int, userId int) (*WebhookSubscription, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	subscription := &WebhookSubscription{}
+	err := DB.First(subscription, "id = ? and user_id = ?", id, userId).Error
+	return subscription, err
+}
+
+func DeleteWebhookSubscription(id int, userId int) error {
+	result := DB.Where("id = ? and user_id = ?", id, userId).Delete(&WebhookSubscription{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("订阅不存在")
+	}
+	return nil
+}
+
+// GetEventSubscriptions 查找应接收事件的订阅：事件所属用户的订阅与全局订阅
+func GetEventSubscriptions(eventType string, userId int) ([]*WebhookSubscription, error) {
+	var subscriptions []*WebhookSubscription
+	query := DB.Where("status = ?", common.WebhookSubscriptionStatusEnabled)
+	if userId != 0 {
+		query = query.Where("user_id = ? OR global = ?", userId, true)
+	} else {
+		query = query.Where("global = ?", true)
+	}
+	if err := query.Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+	matched := make([]*WebhookSubscription, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		if subscription.Subscribes(eventType) {
+			matched = append(matched, subscription)
+		}
+	}
+	return matched, nil
+}
+
+func CreateWebhookDeliveries(deliveries []*WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return DB.Create(&deliveries).Error
+}
+
+// ClaimWebhookDelivery 通过条件更新抢占投递，避免多个节点重复投递同一条记录
+func ClaimWebhookDelivery(id int, now int64, leaseSeconds int64) bool {
+	result := DB.Model(&WebhookDelivery{}).
+		Where("id = ? and status = ? and next_attempt_at <= ?", id, common.WebhookDeliveryStatusPending, now).
+		Update("next_attempt_at", now+leaseSeconds)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+func (delivery *WebhookDelivery) SaveResult() error {
+	return DB.Model(delivery).Select("status", "attempts", "next_attempt_at", "response_code", "last_error", "delivered_time").Updates(delivery).Error
+}
+
+func GetDueWebhookDeliveries(now int64, limit int) (deliveries []*WebhookDelivery, err error) {
+	err = DB.Where("status = ? and next_attempt_at <= ?", common.WebhookDeliveryStatusPending, now).
+		Order("next_attempt_at asc").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func GetWebhookDeliveryById(id int, userId int) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{}
+	err := DB.First(delivery, "id = ? and user_id = ?", id, userId).Error
+	return delivery, err
+}
+
+type WebhookDeliveryQueryParams struct {
+	SubscriptionId int
+	EventType      string
+	Status         string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+func GetUserWebhookDeliveries(userId int, params WebhookDeliveryQueryParams, pageInfo *common.PageInfo) (deliveries []*WebhookDelivery, total int64, err error) {
+	query := DB.Model(&WebhookDelivery{}).Where("user_id = ?", userId)
+	if params.SubscriptionId != 0 {
+		query = query.Where("subscription_id = ?", params.SubscriptionId)
+	}
+	if params.EventType != "" {
+		query = query.Where("event_type = ?", params.EventType)
+	}
+	if params.Status != "" {
+		query = query.Where("status = ?", params.Status)
+	}
+	if params.StartTimestamp != 0 {
+		query = query.Where("created_time >= ?", params.StartTimestamp)
+	}
+	if params.EndTimestamp != 0 {
+		query = query.Where("created_time <= ?", params.EndTimestamp)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+// ResetWebhookDelivery 重新投递：重置为待投递状态并立即可被抢占
+func ResetWebhookDelivery(delivery *WebhookDelivery) error {
+	delivery.Status = common.WebhookDeliveryStatusPending
+	delivery.NextAttemptAt = common.GetTimestamp()
+	return DB.Model(delivery).Select("status", "next_attempt_at").Updates(delivery).Error
+}
+
+func DeleteOldWebhookDeliveries(targetTimestamp int64) (int64, error) {
+	result := DB.Where("created_time < ? and status <> ?", targetTimestamp, common.WebhookDeliveryStatusPending).Delete(&WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
@@ -1,6 +1,7 @@
 package channel
 
 import (
+	"errors"
 	"io"
 	"net/http"
 
@@ -52,6 +53,23 @@ type TaskAdaptor interface {
 	ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error)
 }
 
+// ErrTaskCancelNotSupported 上游不支持取消该任务
+var ErrTaskCancelNotSupported = errors.New("task cancellation is not supported by upstream")
+
+// TaskCanceler 上游支持取消任务时实现，body 与 FetchTask 相同，包含 task_id 与 action
+type TaskCanceler interface {
+	CancelTask(baseUrl, key string, body map[string]any, proxy string) (*http.Response, error)
+}
+
+// ErrTokenCountNotSupported 渠道或请求格式不支持上游 token 计数
+var ErrTokenCountNotSupported = errors.New("token counting is not supported by upstream")
+
+// TokenCounter 上游提供输入 token 计数接口时实现，request 为 *dto.ClaudeRequest 或 *dto.GeminiChatRequest，
+// 不支持的请求返回 ErrTokenCountNotSupported
+type TokenCounter interface {
+	CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error)
+}
+
 type OpenAIVideoConverter interface {
 	ConvertToOpenAIVideo(originTask *model.Task) ([]byte, error)
 }
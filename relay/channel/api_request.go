@@ -1,6 +1,7 @@
 package channel
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -89,6 +90,48 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 	return resp, nil
 }
 
+// DoTokenCountRequest 向上游 token 计数接口发送 JSON 请求并解析响应
+func DoTokenCountRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, fullRequestURL string, body any, result any) error {
+	jsonData, err := common2.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal request failed: %w", err)
+	}
+	if common2.DebugEnabled {
+		println("fullRequestURL:", fullRequestURL)
+	}
+	req, err := http.NewRequest(http.MethodPost, fullRequestURL, bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("new request failed: %w", err)
+	}
+	headers := req.Header
+	headerOverride, err := processHeaderOverride(info)
+	if err != nil {
+		return err
+	}
+	for key, value := range headerOverride {
+		headers.Set(key, value)
+	}
+	err = a.SetupRequestHeader(c, &headers, info)
+	if err != nil {
+		return fmt.Errorf("setup request header failed: %w", err)
+	}
+	headers.Set("Content-Type", "application/json")
+	headers.Set("Accept", "application/json")
+	resp, err := doRequest(c, req, info)
+	if err != nil {
+		return fmt.Errorf("do request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response body failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upstream returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return common2.Unmarshal(respBody, result)
+}
+
 func DoFormRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	fullRequestURL, err := a.GetRequestURL(info)
 	if err != nil {
@@ -180,3 +180,11 @@ func (a *Adaptor) GetModelList() (models []string) {
 func (a *Adaptor) GetChannelName() string {
 	return ChannelName
 }
+
+func (a *Adaptor) CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	claudeReq, ok := request.(*dto.ClaudeRequest)
+	if !ok || isNovaModel(getAwsModelID(info.UpstreamModelName)) {
+		return 0, channel.ErrTokenCountNotSupported
+	}
+	return awsCountTokens(c, info, claudeReq)
+}
@@ -1,6 +1,7 @@
 package aws
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,6 +14,7 @@ import (
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -151,6 +153,40 @@ func doAwsClientRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor,
 	}
 }
 
+// awsCountTokens 调用 Bedrock CountTokens，请求体与 InvokeModel 相同
+func awsCountTokens(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (int, error) {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return 0, err
+	}
+	countRequest := *request
+	if countRequest.MaxTokens == 0 {
+		countRequest.MaxTokens = uint(model_setting.GetClaudeSettings().GetDefaultMaxTokens(countRequest.Model))
+	}
+	data, err := common.Marshal(countRequest)
+	if err != nil {
+		return 0, err
+	}
+	awsClaudeReq, err := formatRequest(bytes.NewReader(data), c.Request.Header)
+	if err != nil {
+		return 0, err
+	}
+	body, err := common.Marshal(awsClaudeReq)
+	if err != nil {
+		return 0, err
+	}
+	output, err := awsCli.CountTokens(c.Request.Context(), &bedrockruntime.CountTokensInput{
+		ModelId: aws.String(getAwsModelID(info.UpstreamModelName)),
+		Input: &bedrockruntimeTypes.CountTokensInputMemberInvokeModel{
+			Value: bedrockruntimeTypes.InvokeModelTokensRequest{Body: body},
+		},
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "CountTokens")
+	}
+	return int(aws.ToInt32(output.InputTokens)), nil
+}
+
 func getAwsRegionPrefix(awsRegionId string) string {
 	parts := strings.Split(awsRegionId, "-")
 	regionPrefix := ""
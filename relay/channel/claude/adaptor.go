@@ -131,3 +131,16 @@ func (a *Adaptor) GetModelList() []string {
 func (a *Adaptor) GetChannelName() string {
 	return ChannelName
 }
+
+func (a *Adaptor) CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	claudeReq, ok := request.(*dto.ClaudeRequest)
+	if !ok || a.RequestMode != RequestModeMessage {
+		return 0, channel.ErrTokenCountNotSupported
+	}
+	var resp dto.ClaudeCountTokensResponse
+	fullRequestURL := fmt.Sprintf("%s/v1/messages/count_tokens", info.ChannelBaseUrl)
+	if err := channel.DoTokenCountRequest(a, c, info, fullRequestURL, claudeReq.ToCountTokensRequest(), &resp); err != nil {
+		return 0, err
+	}
+	return resp.InputTokens, nil
+}
@@ -144,6 +144,16 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 
 	version := model_setting.GetGeminiVersionSetting(info.UpstreamModelName)
 
+	if info.RelayMode == constant.RelayModeRealtime {
+		baseUrl := info.ChannelBaseUrl
+		if strings.HasPrefix(baseUrl, "https://") {
+			baseUrl = "wss://" + strings.TrimPrefix(baseUrl, "https://")
+		} else if strings.HasPrefix(baseUrl, "http://") {
+			baseUrl = "ws://" + strings.TrimPrefix(baseUrl, "http://")
+		}
+		return fmt.Sprintf("%s/ws/google.ai.generativelanguage.%s.GenerativeService.BidiGenerateContent", baseUrl, version), nil
+	}
+
 	if strings.HasPrefix(info.UpstreamModelName, "imagen") {
 		return fmt.Sprintf("%s/%s/models/%s:predict", info.ChannelBaseUrl, version, info.UpstreamModelName), nil
 	}
@@ -240,10 +250,16 @@ func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommo
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	if info.RelayMode == constant.RelayModeRealtime {
+		return channel.DoWssRequest(a, c, info, requestBody)
+	}
 	return channel.DoApiRequest(a, c, info, requestBody)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
+	if info.RelayMode == constant.RelayModeRealtime {
+		return GeminiLiveHandler(c, info)
+	}
 	if info.RelayMode == constant.RelayModeGemini {
 		if strings.Contains(info.RequestURLPath, ":embedContent") ||
 			strings.Contains(info.RequestURLPath, ":batchEmbedContents") {
@@ -282,3 +298,51 @@ func (a *Adaptor) GetModelList() []string {
 func (a *Adaptor) GetChannelName() string {
 	return ChannelName
 }
+
+// CountTokensBody countTokens 只需要影响输入 token 的字段
+func CountTokensBody(request *dto.GeminiChatRequest) map[string]any {
+	body := map[string]any{
+		"contents": request.Contents,
+	}
+	if request.SystemInstructions != nil {
+		body["systemInstruction"] = request.SystemInstructions
+	}
+	if len(request.Tools) > 0 {
+		body["tools"] = request.Tools
+	}
+	return body
+}
+
+// CountTokensURL 将生成接口地址转换为同一模型的 countTokens 地址，非生成类模型返回空字符串
+func CountTokensURL(generateURL string) string {
+	if !strings.Contains(generateURL, ":generateContent") {
+		return ""
+	}
+	return strings.Replace(generateURL, ":generateContent", ":countTokens", 1)
+}
+
+func (a *Adaptor) CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	geminiReq, ok := request.(*dto.GeminiChatRequest)
+	if !ok {
+		return 0, channel.ErrTokenCountNotSupported
+	}
+	info.IsStream = false
+	generateURL, err := a.GetRequestURL(info)
+	if err != nil {
+		return 0, err
+	}
+	fullRequestURL := CountTokensURL(generateURL)
+	if fullRequestURL == "" {
+		return 0, channel.ErrTokenCountNotSupported
+	}
+	generateRequest := CountTokensBody(geminiReq)
+	generateRequest["model"] = "models/" + info.UpstreamModelName
+	body := map[string]any{
+		"generateContentRequest": generateRequest,
+	}
+	var resp dto.GeminiCountTokensResponse
+	if err := channel.DoTokenCountRequest(a, c, info, fullRequestURL, body, &resp); err != nil {
+		return 0, err
+	}
+	return resp.TotalTokens, nil
+}
@@ -0,0 +1,690 @@
+package gemini
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// Gemini Live 预置音色，OpenAI 音色名无法对应时使用上游默认音色
+var liveVoices = []string{"Puck", "Charon", "Kore", "Fenrir", "Aoede", "Leda", "Orus", "Zephyr"}
+
+// liveTranslator 将 OpenAI Realtime 事件转换为 Gemini Live（BidiGenerateContent）协议。
+// Gemini Live 只能在连接开始时发送一次 setup，因此 setup 延迟到客户端第一次发送非 session.update 事件时发出，
+// 之后的 session.update 只有音频格式会生效（格式转换在网关完成）
+type liveTranslator struct {
+	c       *gin.Context
+	info    *relaycommon.RelayInfo
+	session dto.RealtimeSession
+	// 客户端将 turn_detection 设为 null 时关闭上游自动语音检测，由 commit 划分用户发言
+	manualTurn bool
+
+	setupSent bool
+	ready     bool // 收到 setupComplete 之前上游消息先缓存
+	pending   []any
+
+	pendingTurns []dto.GeminiChatContent // 等待 response.create 的文本消息
+	activityOpen bool
+	callNames    map[string]string // call_id 到函数名，用于回填 toolResponse
+
+	inputItemId     string
+	inputTranscript strings.Builder
+
+	responseId  string
+	messageItem map[string]any
+	output      []map[string]any
+	transcript  strings.Builder
+	text        strings.Builder
+	usage       *dto.RealtimeUsage
+}
+
+func newLiveTranslator(c *gin.Context, info *relaycommon.RelayInfo) *liveTranslator {
+	return &liveTranslator{
+		c:    c,
+		info: info,
+		session: dto.RealtimeSession{
+			Modalities:        []string{"text", "audio"},
+			InputAudioFormat:  "pcm16",
+			OutputAudioFormat: "pcm16",
+			TurnDetection:     map[string]any{"type": "server_vad"},
+			Tools:             []dto.RealTimeTool{},
+		},
+		callNames: make(map[string]string),
+	}
+}
+
+func liveEventId() string {
+	return "event_" + common.GetRandomString(20)
+}
+
+func (t *liveTranslator) sessionObject() map[string]any {
+	return map[string]any{
+		"id":                        "sess_" + common.GetRandomString(20),
+		"object":                    "realtime.session",
+		"model":                     t.info.OriginModelName,
+		"modalities":                t.session.Modalities,
+		"instructions":              t.session.Instructions,
+		"voice":                     t.session.Voice,
+		"input_audio_format":        t.session.InputAudioFormat,
+		"output_audio_format":       t.session.OutputAudioFormat,
+		"input_audio_transcription": t.session.InputAudioTranscription,
+		"turn_detection":            t.session.TurnDetection,
+		"tools":                     t.session.Tools,
+		"tool_choice":               common.GetStringIfEmpty(t.session.ToolChoice, "auto"),
+		"temperature":               t.session.Temperature,
+	}
+}
+
+func (t *liveTranslator) Start() (*channel.RealtimeTranslation, error) {
+	out := &channel.RealtimeTranslation{}
+	err := out.SendClient(map[string]any{
+		"event_id": liveEventId(),
+		"type":     dto.RealtimeEventTypeSessionCreated,
+		"session":  t.sessionObject(),
+	})
+	return out, err
+}
+
+func (t *liveTranslator) audioOutput() bool {
+	for _, modality := range t.session.Modalities {
+		if modality == "audio" {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *liveTranslator) buildSetup() *dto.GeminiLiveSetup {
+	config := &dto.GeminiChatGenerationConfig{ResponseModalities: []string{"TEXT"}}
+	if t.audioOutput() {
+		config.ResponseModalities = []string{"AUDIO"}
+		for _, voice := range liveVoices {
+			if strings.EqualFold(voice, t.session.Voice) {
+				config.SpeechConfig, _ = common.Marshal(map[string]any{
+					"voiceConfig": map[string]any{"prebuiltVoiceConfig": map[string]any{"voiceName": voice}},
+				})
+				break
+			}
+		}
+	}
+	if t.session.Temperature > 0 {
+		temperature := t.session.Temperature
+		config.Temperature = &temperature
+	}
+	setup := &dto.GeminiLiveSetup{
+		Model:            "models/" + t.info.UpstreamModelName,
+		GenerationConfig: config,
+	}
+	if t.session.Instructions != "" {
+		setup.SystemInstruction = &dto.GeminiChatContent{Parts: []dto.GeminiPart{{Text: t.session.Instructions}}}
+	}
+	if len(t.session.Tools) > 0 {
+		declarations := make([]map[string]any, 0, len(t.session.Tools))
+		for _, tool := range t.session.Tools {
+			declaration := map[string]any{"name": tool.Name, "description": tool.Description}
+			if tool.Parameters != nil {
+				declaration["parameters"] = cleanFunctionParameters(tool.Parameters)
+			}
+			declarations = append(declarations, declaration)
+		}
+		setup.Tools = []dto.GeminiChatTool{{FunctionDeclarations: declarations}}
+	}
+	if t.manualTurn {
+		setup.RealtimeInputConfig = &dto.GeminiLiveRealtimeConfig{
+			AutomaticActivityDetection: &dto.GeminiLiveActivityDetection{Disabled: true},
+		}
+	}
+	if t.session.InputAudioTranscription.Model != "" {
+		setup.InputAudioTranscription = &struct{}{}
+	}
+	if t.audioOutput() {
+		setup.OutputAudioTranscription = &struct{}{}
+	}
+	return setup
+}
+
+// sendUpstream 在 setupComplete 之前缓存消息，setup 本身直接发送
+func (t *liveTranslator) sendUpstream(out *channel.RealtimeTranslation, message *dto.GeminiLiveClientMessage) error {
+	if !t.setupSent {
+		t.setupSent = true
+		if err := out.SendUpstream(&dto.GeminiLiveClientMessage{Setup: t.buildSetup()}); err != nil {
+			return err
+		}
+	}
+	if message == nil {
+		return nil
+	}
+	if !t.ready {
+		t.pending = append(t.pending, message)
+		return nil
+	}
+	return out.SendUpstream(message)
+}
+
+func (t *liveTranslator) mergeSession(event *dto.RealtimeEvent, message []byte) {
+	session := event.Session
+	raw := gjson.GetBytes(message, "session")
+	if raw.Get("modalities").Exists() {
+		t.session.Modalities = session.Modalities
+	}
+	if raw.Get("instructions").Exists() {
+		t.session.Instructions = session.Instructions
+	}
+	if raw.Get("voice").Exists() {
+		t.session.Voice = session.Voice
+	}
+	if raw.Get("input_audio_format").Exists() {
+		t.session.InputAudioFormat = session.InputAudioFormat
+	}
+	if raw.Get("output_audio_format").Exists() {
+		t.session.OutputAudioFormat = session.OutputAudioFormat
+	}
+	if raw.Get("input_audio_transcription").Exists() {
+		t.session.InputAudioTranscription = session.InputAudioTranscription
+	}
+	if turnDetection := raw.Get("turn_detection"); turnDetection.Exists() {
+		t.session.TurnDetection = session.TurnDetection
+		t.manualTurn = turnDetection.Type == gjson.Null
+	}
+	if raw.Get("tools").Exists() {
+		t.session.Tools = session.Tools
+	}
+	if raw.Get("tool_choice").Exists() {
+		t.session.ToolChoice = session.ToolChoice
+	}
+	if raw.Get("temperature").Exists() {
+		t.session.Temperature = session.Temperature
+	}
+}
+
+func (t *liveTranslator) TranslateClientEvent(event *dto.RealtimeEvent, message []byte) (*channel.RealtimeTranslation, error) {
+	out := &channel.RealtimeTranslation{}
+	switch event.Type {
+	case dto.RealtimeEventTypeSessionUpdate:
+		if event.Session != nil {
+			if t.setupSent {
+				logger.LogWarn(t.c, "gemini live session is already set up, only audio formats of session.update take effect")
+			}
+			t.mergeSession(event, message)
+		}
+		return out, out.SendClient(map[string]any{
+			"event_id": liveEventId(),
+			"type":     dto.RealtimeEventTypeSessionUpdated,
+			"session":  t.sessionObject(),
+		})
+	case dto.RealtimeEventInputAudioBufferAppend:
+		audio, err := base64.StdEncoding.DecodeString(event.Audio)
+		if err != nil {
+			return nil, fmt.Errorf("invalid audio: %w", err)
+		}
+		pcm, sampleRate, err := service.DecodeRealtimeAudio(audio, t.session.InputAudioFormat)
+		if err != nil {
+			return nil, err
+		}
+		if t.manualTurn && !t.activityOpen {
+			t.activityOpen = true
+			if err := t.sendUpstream(out, &dto.GeminiLiveClientMessage{RealtimeInput: &dto.GeminiLiveRealtimeInput{ActivityStart: &struct{}{}}}); err != nil {
+				return nil, err
+			}
+		}
+		if t.inputItemId == "" {
+			t.inputItemId = "item_" + common.GetRandomString(20)
+		}
+		return out, t.sendUpstream(out, &dto.GeminiLiveClientMessage{RealtimeInput: &dto.GeminiLiveRealtimeInput{
+			Audio: &dto.GeminiInlineData{
+				MimeType: "audio/pcm;rate=" + strconv.Itoa(sampleRate),
+				Data:     base64.StdEncoding.EncodeToString(pcm),
+			},
+		}})
+	case "input_audio_buffer.commit":
+		if t.activityOpen {
+			t.activityOpen = false
+			if err := t.sendUpstream(out, &dto.GeminiLiveClientMessage{RealtimeInput: &dto.GeminiLiveRealtimeInput{ActivityEnd: &struct{}{}}}); err != nil {
+				return nil, err
+			}
+		}
+		itemId := common.GetStringIfEmpty(t.inputItemId, "item_"+common.GetRandomString(20))
+		return out, out.SendClient(map[string]any{
+			"event_id":         liveEventId(),
+			"type":             "input_audio_buffer.committed",
+			"previous_item_id": nil,
+			"item_id":          itemId,
+		})
+	case "input_audio_buffer.clear":
+		// 已发送的音频无法从上游撤回，只重置本地状态
+		return out, out.SendClient(map[string]any{
+			"event_id": liveEventId(),
+			"type":     "input_audio_buffer.cleared",
+		})
+	case dto.RealtimeEventTypeConversationCreate:
+		if event.Item == nil {
+			return out, nil
+		}
+		item := *event.Item
+		if item.Id == "" {
+			item.Id = "item_" + common.GetRandomString(20)
+		}
+		switch item.Type {
+		case "function_call_output":
+			response := map[string]any{"output": item.Output}
+			var parsed map[string]any
+			if err := common.UnmarshalJsonStr(item.Output, &parsed); err == nil {
+				response = parsed
+			}
+			if err := t.sendUpstream(out, &dto.GeminiLiveClientMessage{ToolResponse: &dto.GeminiLiveToolResponse{
+				FunctionResponses: []dto.GeminiLiveFunctionResponse{{
+					Id:       item.CallId,
+					Name:     t.callNames[item.CallId],
+					Response: response,
+				}},
+			}}); err != nil {
+				return nil, err
+			}
+		case "message":
+			parts := make([]dto.GeminiPart, 0, len(item.Content))
+			for _, content := range item.Content {
+				if content.Text != "" {
+					parts = append(parts, dto.GeminiPart{Text: content.Text})
+				} else if content.Transcript != "" {
+					parts = append(parts, dto.GeminiPart{Text: content.Transcript})
+				}
+			}
+			if len(parts) > 0 {
+				role := "user"
+				if item.Role == "assistant" {
+					role = "model"
+				}
+				t.pendingTurns = append(t.pendingTurns, dto.GeminiChatContent{Role: role, Parts: parts})
+			}
+		}
+		return out, out.SendClient(map[string]any{
+			"event_id":         liveEventId(),
+			"type":             dto.RealtimeEventConversationItemCreated,
+			"previous_item_id": nil,
+			"item":             item,
+		})
+	case dto.RealtimeEventTypeResponseCreate:
+		if len(t.pendingTurns) > 0 {
+			turns := t.pendingTurns
+			t.pendingTurns = nil
+			return out, t.sendUpstream(out, &dto.GeminiLiveClientMessage{ClientContent: &dto.GeminiLiveClientContent{Turns: turns, TurnComplete: true}})
+		}
+		// 手动模式下未 commit 的音频视为本轮输入
+		if t.activityOpen {
+			t.activityOpen = false
+			return out, t.sendUpstream(out, &dto.GeminiLiveClientMessage{RealtimeInput: &dto.GeminiLiveRealtimeInput{ActivityEnd: &struct{}{}}})
+		}
+		return out, nil
+	}
+	// response.cancel 等 Gemini Live 不支持的事件直接忽略
+	return out, nil
+}
+
+func (t *liveTranslator) TranslateUpstreamMessage(messageType int, message []byte) (*channel.RealtimeTranslation, error) {
+	out := &channel.RealtimeTranslation{}
+	var serverMessage dto.GeminiLiveServerMessage
+	if err := common.Unmarshal(message, &serverMessage); err != nil {
+		return nil, fmt.Errorf("invalid gemini live message: %w", err)
+	}
+
+	if serverMessage.SetupComplete != nil {
+		t.ready = true
+		for _, pending := range t.pending {
+			if err := out.SendUpstream(pending); err != nil {
+				return nil, err
+			}
+		}
+		t.pending = nil
+	}
+	if serverMessage.UsageMetadata != nil {
+		t.usage = liveUsage(serverMessage.UsageMetadata)
+	}
+	if content := serverMessage.ServerContent; content != nil {
+		if content.InputTranscription != nil && content.InputTranscription.Text != "" {
+			t.inputTranscript.WriteString(content.InputTranscription.Text)
+			if err := out.SendClient(map[string]any{
+				"event_id":      liveEventId(),
+				"type":          "conversation.item.input_audio_transcription.delta",
+				"item_id":       t.inputItemId,
+				"content_index": 0,
+				"delta":         content.InputTranscription.Text,
+			}); err != nil {
+				return nil, err
+			}
+		}
+		if content.ModelTurn != nil {
+			for _, part := range content.ModelTurn.Parts {
+				if err := t.handleModelPart(out, part); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if content.OutputTranscription != nil && content.OutputTranscription.Text != "" {
+			if err := t.ensureMessageItem(out); err != nil {
+				return nil, err
+			}
+			t.transcript.WriteString(content.OutputTranscription.Text)
+			if err := t.sendDelta(out, dto.RealtimeEventResponseAudioTranscriptionDelta, content.OutputTranscription.Text); err != nil {
+				return nil, err
+			}
+		}
+		if content.Interrupted {
+			// 用户打断时 OpenAI 客户端依赖 speech_started 停止播放
+			if err := out.SendClient(map[string]any{
+				"event_id":       liveEventId(),
+				"type":           "input_audio_buffer.speech_started",
+				"audio_start_ms": 0,
+				"item_id":        common.GetStringIfEmpty(t.inputItemId, "item_"+common.GetRandomString(20)),
+			}); err != nil {
+				return nil, err
+			}
+			if err := t.finishResponse(out, "cancelled"); err != nil {
+				return nil, err
+			}
+		}
+		if content.TurnComplete {
+			if err := t.finishInputTranscript(out); err != nil {
+				return nil, err
+			}
+			if err := t.finishResponse(out, "completed"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if serverMessage.ToolCall != nil && len(serverMessage.ToolCall.FunctionCalls) > 0 {
+		if err := t.handleToolCall(out, serverMessage.ToolCall); err != nil {
+			return nil, err
+		}
+	}
+	if serverMessage.GoAway != nil {
+		logger.LogWarn(t.c, "gemini live connection will be closed soon, time left: "+serverMessage.GoAway.TimeLeft)
+	}
+	return out, nil
+}
+
+func (t *liveTranslator) ensureResponse(out *channel.RealtimeTranslation) error {
+	if t.responseId != "" {
+		return nil
+	}
+	t.responseId = "resp_" + common.GetRandomString(20)
+	t.output = nil
+	return out.SendClient(map[string]any{
+		"event_id": liveEventId(),
+		"type":     "response.created",
+		"response": map[string]any{
+			"id":     t.responseId,
+			"object": "realtime.response",
+			"status": "in_progress",
+			"output": []any{},
+		},
+	})
+}
+
+func (t *liveTranslator) contentType() string {
+	if t.audioOutput() {
+		return "audio"
+	}
+	return "text"
+}
+
+func (t *liveTranslator) ensureMessageItem(out *channel.RealtimeTranslation) error {
+	if err := t.ensureResponse(out); err != nil {
+		return err
+	}
+	if t.messageItem != nil {
+		return nil
+	}
+	t.messageItem = map[string]any{
+		"id":      "item_" + common.GetRandomString(20),
+		"object":  "realtime.item",
+		"type":    "message",
+		"status":  "in_progress",
+		"role":    "assistant",
+		"content": []any{},
+	}
+	t.output = append(t.output, t.messageItem)
+	if err := out.SendClient(map[string]any{
+		"event_id":     liveEventId(),
+		"type":         "response.output_item.added",
+		"response_id":  t.responseId,
+		"output_index": len(t.output) - 1,
+		"item":         t.messageItem,
+	}); err != nil {
+		return err
+	}
+	return out.SendClient(map[string]any{
+		"event_id":      liveEventId(),
+		"type":          "response.content_part.added",
+		"response_id":   t.responseId,
+		"item_id":       t.messageItem["id"],
+		"output_index":  len(t.output) - 1,
+		"content_index": 0,
+		"part":          map[string]any{"type": t.contentType()},
+	})
+}
+
+func (t *liveTranslator) sendDelta(out *channel.RealtimeTranslation, eventType string, delta string) error {
+	return out.SendClient(map[string]any{
+		"event_id":      liveEventId(),
+		"type":          eventType,
+		"response_id":   t.responseId,
+		"item_id":       t.messageItem["id"],
+		"output_index":  0,
+		"content_index": 0,
+		"delta":         delta,
+	})
+}
+
+func (t *liveTranslator) handleModelPart(out *channel.RealtimeTranslation, part dto.GeminiPart) error {
+	if part.Thought {
+		return nil
+	}
+	if part.InlineData != nil && strings.HasPrefix(part.InlineData.MimeType, "audio/") {
+		if err := t.ensureMessageItem(out); err != nil {
+			return err
+		}
+		pcm, err := base64.StdEncoding.DecodeString(part.InlineData.Data)
+		if err != nil {
+			return fmt.Errorf("invalid audio data: %w", err)
+		}
+		audio, err := service.EncodeRealtimeAudio(pcm, liveSampleRate(part.InlineData.MimeType), t.session.OutputAudioFormat)
+		if err != nil {
+			return err
+		}
+		return t.sendDelta(out, dto.RealtimeEventResponseAudioDelta, base64.StdEncoding.EncodeToString(audio))
+	}
+	if part.Text != "" {
+		if err := t.ensureMessageItem(out); err != nil {
+			return err
+		}
+		t.text.WriteString(part.Text)
+		return t.sendDelta(out, "response.text.delta", part.Text)
+	}
+	return nil
+}
+
+// liveSampleRate 从 audio/pcm;rate=24000 中解析采样率，Gemini Live 输出默认为 24kHz
+func liveSampleRate(mimeType string) int {
+	if idx := strings.Index(mimeType, "rate="); idx >= 0 {
+		if rate, err := strconv.Atoi(mimeType[idx+len("rate="):]); err == nil && rate > 0 {
+			return rate
+		}
+	}
+	return 24000
+}
+
+func (t *liveTranslator) handleToolCall(out *channel.RealtimeTranslation, toolCall *dto.GeminiLiveToolCall) error {
+	if err := t.ensureResponse(out); err != nil {
+		return err
+	}
+	for _, call := range toolCall.FunctionCalls {
+		callId := common.GetStringIfEmpty(call.Id, "call_"+common.GetRandomString(20))
+		t.callNames[callId] = call.Name
+		arguments := "{}"
+		if call.Args != nil {
+			data, err := common.Marshal(call.Args)
+			if err != nil {
+				return err
+			}
+			arguments = string(data)
+		}
+		item := map[string]any{
+			"id":        "item_" + common.GetRandomString(20),
+			"object":    "realtime.item",
+			"type":      "function_call",
+			"status":    "completed",
+			"call_id":   callId,
+			"name":      call.Name,
+			"arguments": arguments,
+		}
+		t.output = append(t.output, item)
+		outputIndex := len(t.output) - 1
+		events := []map[string]any{
+			{"type": "response.output_item.added", "output_index": outputIndex, "item": item},
+			{"type": dto.RealtimeEventResponseFunctionCallArgumentsDelta, "output_index": outputIndex, "item_id": item["id"], "call_id": callId, "delta": arguments},
+			{"type": dto.RealtimeEventResponseFunctionCallArgumentsDone, "output_index": outputIndex, "item_id": item["id"], "call_id": callId, "name": call.Name, "arguments": arguments},
+			{"type": "response.output_item.done", "output_index": outputIndex, "item": item},
+		}
+		for _, event := range events {
+			event["event_id"] = liveEventId()
+			event["response_id"] = t.responseId
+			if err := out.SendClient(event); err != nil {
+				return err
+			}
+		}
+	}
+	// 函数调用后 Gemini 等待 toolResponse，本轮响应到此结束
+	return t.finishResponse(out, "completed")
+}
+
+func (t *liveTranslator) finishInputTranscript(out *channel.RealtimeTranslation) error {
+	if t.inputTranscript.Len() == 0 {
+		t.inputItemId = ""
+		return nil
+	}
+	transcript := t.inputTranscript.String()
+	t.inputTranscript.Reset()
+	itemId := t.inputItemId
+	t.inputItemId = ""
+	return out.SendClient(map[string]any{
+		"event_id":      liveEventId(),
+		"type":          "conversation.item.input_audio_transcription.completed",
+		"item_id":       itemId,
+		"content_index": 0,
+		"transcript":    transcript,
+	})
+}
+
+func (t *liveTranslator) finishResponse(out *channel.RealtimeTranslation, status string) error {
+	if t.responseId == "" {
+		return nil
+	}
+	if t.messageItem != nil {
+		itemId := t.messageItem["id"]
+		var part map[string]any
+		var doneEvents []map[string]any
+		if t.audioOutput() {
+			part = map[string]any{"type": "audio", "transcript": t.transcript.String()}
+			doneEvents = append(doneEvents,
+				map[string]any{"type": "response.audio.done"},
+				map[string]any{"type": "response.audio_transcript.done", "transcript": t.transcript.String()},
+			)
+		} else {
+			part = map[string]any{"type": "text", "text": t.text.String()}
+			doneEvents = append(doneEvents, map[string]any{"type": "response.text.done", "text": t.text.String()})
+		}
+		doneEvents = append(doneEvents, map[string]any{"type": "response.content_part.done", "part": part})
+		for _, event := range doneEvents {
+			event["event_id"] = liveEventId()
+			event["response_id"] = t.responseId
+			event["item_id"] = itemId
+			event["output_index"] = 0
+			event["content_index"] = 0
+			if err := out.SendClient(event); err != nil {
+				return err
+			}
+		}
+		t.messageItem["status"] = status
+		if status == "cancelled" {
+			t.messageItem["status"] = "incomplete"
+		}
+		t.messageItem["content"] = []any{part}
+		if err := out.SendClient(map[string]any{
+			"event_id":     liveEventId(),
+			"type":         "response.output_item.done",
+			"response_id":  t.responseId,
+			"output_index": 0,
+			"item":         t.messageItem,
+		}); err != nil {
+			return err
+		}
+	}
+
+	response := map[string]any{
+		"id":             t.responseId,
+		"object":         "realtime.response",
+		"status":         status,
+		"status_details": nil,
+		"output":         t.output,
+		"usage":          t.usage,
+	}
+	out.Usage = t.usage
+	t.responseId = ""
+	t.messageItem = nil
+	t.output = nil
+	t.transcript.Reset()
+	t.text.Reset()
+	t.usage = nil
+	return out.SendClient(map[string]any{
+		"event_id": liveEventId(),
+		"type":     dto.RealtimeEventTypeResponseDone,
+		"response": response,
+	})
+}
+
+// liveUsage 将 Gemini Live 的用量转换为 OpenAI Realtime 用量，未细分模态时按文本计
+func liveUsage(metadata *dto.GeminiLiveUsageMetadata) *dto.RealtimeUsage {
+	usage := &dto.RealtimeUsage{
+		TotalTokens:  metadata.TotalTokenCount,
+		InputTokens:  metadata.PromptTokenCount,
+		OutputTokens: metadata.ResponseTokenCount,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	}
+	audioInput := 0
+	for _, detail := range metadata.PromptTokensDetails {
+		if detail.Modality == "AUDIO" {
+			audioInput += detail.TokenCount
+		}
+	}
+	audioOutput := 0
+	for _, detail := range metadata.ResponseTokensDetails {
+		if detail.Modality == "AUDIO" {
+			audioOutput += detail.TokenCount
+		}
+	}
+	usage.InputTokenDetails.AudioTokens = audioInput
+	usage.InputTokenDetails.TextTokens = usage.InputTokens - audioInput
+	usage.OutputTokenDetails.AudioTokens = audioOutput
+	usage.OutputTokenDetails.TextTokens = usage.OutputTokens - audioOutput
+	return usage
+}
+
+// GeminiLiveHandler 通过 OpenAI Realtime 协议使用 Gemini Live 模型
+func GeminiLiveHandler(c *gin.Context, info *relaycommon.RelayInfo) (*dto.RealtimeUsage, *types.NewAPIError) {
+	newAPIError, usage := channel.RealtimeBridgeHandler(c, info, newLiveTranslator(c, info))
+	return usage, newAPIError
+}
@@ -76,6 +76,19 @@ func ollamaStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 	var responseId = common.GetUUID()
 	var created = time.Now().Unix()
 	var toolCallIndex int
+	// 模拟函数调用时从正文中解析工具调用
+	toolCallParser := service.NewToolCallStreamParser(info)
+	sendChunk := func(chunk *dto.ChatCompletionsStreamResponse) {
+		chunks := []*dto.ChatCompletionsStreamResponse{chunk}
+		if toolCallParser != nil {
+			chunks = toolCallParser.Process(chunk)
+		}
+		for _, item := range chunks {
+			if data, err := common.Marshal(item); err == nil {
+				_ = helper.StringData(c, string(data))
+			}
+		}
+	}
 	start := helper.GenerateStartEmptyResponse(responseId, created, model, nil)
 	if data, err := common.Marshal(start); err == nil {
 		_ = helper.StringData(c, string(data))
@@ -144,9 +157,7 @@ func ollamaStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 					delta.Choices[0].Delta.ToolCalls = append(delta.Choices[0].Delta.ToolCalls, tr)
 				}
 			}
-			if data, err := common.Marshal(delta); err == nil {
-				_ = helper.StringData(c, string(data))
-			}
+			sendChunk(&delta)
 			continue
 		}
 		// done frame
@@ -160,9 +171,7 @@ func ollamaStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 		}
 		// emit stop delta
 		if stop := helper.GenerateStopResponse(responseId, created, model, finishReason); stop != nil {
-			if data, err := common.Marshal(stop); err == nil {
-				_ = helper.StringData(c, string(data))
-			}
+			sendChunk(stop)
 		}
 		// emit usage frame
 		if final := helper.GenerateFinalUsageResponse(responseId, created, model, *usage); final != nil {
@@ -287,6 +296,7 @@ func ollamaChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 		}},
 		Usage: *usage,
 	}
+	service.ParseEmulatedToolCalls(info, &full)
 	out, _ := common.Marshal(full)
 	service.IOCopyBytesGracefully(c, resp, out)
 	return usage, nil
@@ -127,7 +127,7 @@ func OaiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Re
 	// 检查是否为音频模型
 	isAudioModel := strings.Contains(strings.ToLower(model), "audio")
 
-	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
+	handleData := func(data string) {
 		if lastStreamData != "" {
 			err := HandleStreamFormat(c, info, lastStreamData, info.ChannelSetting.ForceFormat, info.ChannelSetting.ThinkingToContent)
 			if err != nil {
@@ -143,8 +143,34 @@ func OaiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Re
 			lastStreamData = data
 			streamItems = append(streamItems, data)
 		}
+	}
+
+	// 模拟函数调用时，从正文中解析工具调用后再按原流程处理
+	toolCallParser := service.NewToolCallStreamParser(info)
+	var lastParsedResponse *dto.ChatCompletionsStreamResponse
+	handleParsedData := func(responses []*dto.ChatCompletionsStreamResponse) {
+		for _, response := range responses {
+			lastParsedResponse = response
+			if parsed, err := common.Marshal(response); err == nil {
+				handleData(string(parsed))
+			}
+		}
+	}
+
+	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
+		if toolCallParser != nil {
+			var streamResponse dto.ChatCompletionsStreamResponse
+			if err := common.UnmarshalJsonStr(data, &streamResponse); err == nil {
+				handleParsedData(toolCallParser.Process(&streamResponse))
+				return true
+			}
+		}
+		handleData(data)
 		return true
 	})
+	if toolCallParser != nil && lastParsedResponse != nil {
+		handleParsedData(toolCallParser.Flush(lastParsedResponse.Id, lastParsedResponse.Created, lastParsedResponse.Model))
+	}
 
 	// 对音频模型，从倒数第二个stream data中提取usage信息
 	if isAudioModel && secondLastStreamData != "" {
@@ -235,6 +261,11 @@ func OpenaiHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Respo
 		forceFormat = true
 	}
 
+	if len(info.EmulatedToolNames) > 0 {
+		service.ParseEmulatedToolCalls(info, &simpleResponse)
+		forceFormat = true
+	}
+
 	usageModified := false
 	if simpleResponse.Usage.PromptTokens == 0 {
 		completionTokens := simpleResponse.Usage.CompletionTokens
@@ -0,0 +1,284 @@
+package channel
+
+import (
+	"fmt"
+	"sync"
+
+	common2 "github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// RealtimeTranslator 在 OpenAI Realtime 协议与上游实时协议之间转换事件。
+// 非 OpenAI 协议的实时后端实现此接口，在 DoResponse 中交给 RealtimeBridgeHandler 即可接入 /v1/realtime。
+// 同一连接上的调用由 RealtimeBridgeHandler 串行执行，实现无需加锁。
+type RealtimeTranslator interface {
+	// Start 在上游连接建立后调用一次，通常用于向客户端发送 session.created
+	Start() (*RealtimeTranslation, error)
+	// TranslateClientEvent 转换客户端发送的 OpenAI Realtime 事件
+	TranslateClientEvent(event *dto.RealtimeEvent, message []byte) (*RealtimeTranslation, error)
+	// TranslateUpstreamMessage 转换上游发送的消息
+	TranslateUpstreamMessage(messageType int, message []byte) (*RealtimeTranslation, error)
+}
+
+// RealtimeMessage 发往上游的一条 WebSocket 消息
+type RealtimeMessage struct {
+	MessageType int
+	Data        []byte
+}
+
+// RealtimeTranslation 一次转换的结果
+type RealtimeTranslation struct {
+	ToUpstream []RealtimeMessage
+	ToClient   [][]byte // OpenAI Realtime 服务端事件
+	// Usage 上游返回的本轮用量，随 response.done 一起返回；为空时按本地估算计费
+	Usage *dto.RealtimeUsage
+}
+
+// SendUpstream 以文本消息发送 JSON 到上游
+func (t *RealtimeTranslation) SendUpstream(v any) error {
+	data, err := common2.Marshal(v)
+	if err != nil {
+		return err
+	}
+	t.ToUpstream = append(t.ToUpstream, RealtimeMessage{MessageType: websocket.TextMessage, Data: data})
+	return nil
+}
+
+// SendClient 向客户端发送 OpenAI Realtime 事件
+func (t *RealtimeTranslation) SendClient(v any) error {
+	data, err := common2.Marshal(v)
+	if err != nil {
+		return err
+	}
+	t.ToClient = append(t.ToClient, data)
+	return nil
+}
+
+type realtimeBridge struct {
+	c          *gin.Context
+	info       *common.RelayInfo
+	translator RealtimeTranslator
+	mu         sync.Mutex
+	localUsage *dto.RealtimeUsage // 本地估算的用量，上游返回用量后丢弃
+	sumUsage   *dto.RealtimeUsage
+}
+
+// RealtimeBridgeHandler 通过 translator 将客户端的 OpenAI Realtime 连接桥接到非 OpenAI 协议的上游，
+// 计费方式与 OpenAI 实时接口一致：每轮结束时通过 PreWssConsumeQuota 扣费，返回的总用量用于记录日志
+func RealtimeBridgeHandler(c *gin.Context, info *common.RelayInfo, translator RealtimeTranslator) (*types.NewAPIError, *dto.RealtimeUsage) {
+	if info == nil || info.ClientWs == nil || info.TargetWs == nil {
+		return types.NewError(fmt.Errorf("invalid websocket connection"), types.ErrorCodeBadResponse), nil
+	}
+	info.IsStream = true
+
+	b := &realtimeBridge{
+		c:          c,
+		info:       info,
+		translator: translator,
+		localUsage: &dto.RealtimeUsage{},
+		sumUsage:   &dto.RealtimeUsage{},
+	}
+
+	start, err := translator.Start()
+	if err == nil {
+		err = b.deliver(start)
+	}
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeBadResponse), nil
+	}
+
+	clientClosed := make(chan struct{})
+	targetClosed := make(chan struct{})
+	errChan := make(chan error, 2)
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in client reader: %v", r)
+			}
+		}()
+		for {
+			_, message, err := info.ClientWs.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					errChan <- fmt.Errorf("error reading from client: %v", err)
+				}
+				close(clientClosed)
+				return
+			}
+			if err := b.handleClientMessage(message); err != nil {
+				errChan <- err
+				return
+			}
+		}
+	})
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in target reader: %v", r)
+			}
+		}()
+		for {
+			messageType, message, err := info.TargetWs.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					errChan <- fmt.Errorf("error reading from target: %v", err)
+				} else if closeErr, ok := err.(*websocket.CloseError); ok && closeErr.Text != "" {
+					// 上游通常在关闭帧中说明出错原因，转告客户端
+					b.mu.Lock()
+					helper.WssError(c, info.ClientWs, types.OpenAIError{Message: closeErr.Text, Type: "upstream_error"})
+					b.mu.Unlock()
+				}
+				close(targetClosed)
+				return
+			}
+			info.SetFirstResponseTime()
+			if err := b.handleUpstreamMessage(messageType, message); err != nil {
+				errChan <- err
+				return
+			}
+		}
+	})
+
+	select {
+	case <-clientClosed:
+	case <-targetClosed:
+	case err := <-errChan:
+		logger.LogError(c, "realtime bridge error: "+err.Error())
+		b.mu.Lock()
+		helper.WssError(c, info.ClientWs, types.OpenAIError{Message: err.Error(), Type: "server_error"})
+		b.mu.Unlock()
+	case <-c.Done():
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.localUsage.TotalTokens != 0 {
+		_ = b.consume(b.localUsage)
+	}
+	return nil, b.sumUsage
+}
+
+func (b *realtimeBridge) handleClientMessage(message []byte) error {
+	event := &dto.RealtimeEvent{}
+	if err := common2.Unmarshal(message, event); err != nil {
+		return fmt.Errorf("error unmarshalling message: %v", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if event.Type == dto.RealtimeEventTypeSessionUpdate && event.Session != nil && event.Session.Tools != nil {
+		b.info.RealtimeTools = event.Session.Tools
+	}
+	textToken, audioToken, err := service.CountTokenRealtime(b.info, *event, b.info.UpstreamModelName)
+	if err != nil {
+		return fmt.Errorf("error counting text token: %v", err)
+	}
+	b.localUsage.TotalTokens += textToken + audioToken
+	b.localUsage.InputTokens += textToken + audioToken
+	b.localUsage.InputTokenDetails.TextTokens += textToken
+	b.localUsage.InputTokenDetails.AudioTokens += audioToken
+
+	translation, err := b.translator.TranslateClientEvent(event, message)
+	if err != nil {
+		return fmt.Errorf("error translating client event %s: %v", event.Type, err)
+	}
+	return b.deliver(translation)
+}
+
+func (b *realtimeBridge) handleUpstreamMessage(messageType int, message []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	translation, err := b.translator.TranslateUpstreamMessage(messageType, message)
+	if err != nil {
+		return fmt.Errorf("error translating upstream message: %v", err)
+	}
+	return b.deliver(translation)
+}
+
+// deliver 发送转换结果，并按发往客户端的事件估算输出用量、在每轮结束时扣费，调用方需持有锁
+func (b *realtimeBridge) deliver(translation *RealtimeTranslation) error {
+	if translation == nil {
+		return nil
+	}
+	for _, message := range translation.ToUpstream {
+		if err := b.info.TargetWs.WriteMessage(message.MessageType, message.Data); err != nil {
+			return fmt.Errorf("error writing to target: %v", err)
+		}
+	}
+
+	responseDone := false
+	for _, message := range translation.ToClient {
+		event := &dto.RealtimeEvent{}
+		if err := common2.Unmarshal(message, event); err == nil {
+			switch event.Type {
+			case dto.RealtimeEventTypeSessionCreated, dto.RealtimeEventTypeSessionUpdated:
+				if event.Session != nil {
+					b.info.InputAudioFormat = common2.GetStringIfEmpty(event.Session.InputAudioFormat, b.info.InputAudioFormat)
+					b.info.OutputAudioFormat = common2.GetStringIfEmpty(event.Session.OutputAudioFormat, b.info.OutputAudioFormat)
+				}
+			case dto.RealtimeEventTypeResponseDone:
+				responseDone = true
+				if translation.Usage == nil {
+					textToken, _, err := service.CountTokenRealtime(b.info, *event, b.info.UpstreamModelName)
+					if err == nil {
+						b.localUsage.TotalTokens += textToken
+						b.localUsage.InputTokens += textToken
+						b.localUsage.InputTokenDetails.TextTokens += textToken
+					}
+				}
+			default:
+				textToken, audioToken, err := service.CountTokenRealtime(b.info, *event, b.info.UpstreamModelName)
+				if err != nil {
+					return fmt.Errorf("error counting text token: %v", err)
+				}
+				b.localUsage.TotalTokens += textToken + audioToken
+				b.localUsage.OutputTokens += textToken + audioToken
+				b.localUsage.OutputTokenDetails.TextTokens += textToken
+				b.localUsage.OutputTokenDetails.AudioTokens += audioToken
+			}
+		}
+		if err := helper.WssString(b.c, b.info.ClientWs, string(message)); err != nil {
+			return fmt.Errorf("error writing to client: %v", err)
+		}
+	}
+
+	// 上游返回了用量时以上游为准，丢弃本轮本地估算
+	if translation.Usage != nil {
+		b.localUsage = &dto.RealtimeUsage{}
+		if err := b.consume(translation.Usage); err != nil {
+			return fmt.Errorf("error consume usage: %v", err)
+		}
+	} else if responseDone && b.localUsage.TotalTokens != 0 {
+		if err := b.consume(b.localUsage); err != nil {
+			return fmt.Errorf("error consume usage: %v", err)
+		}
+		b.localUsage = &dto.RealtimeUsage{}
+	}
+	if responseDone {
+		b.info.IsFirstRequest = false
+	}
+	return nil
+}
+
+func (b *realtimeBridge) consume(usage *dto.RealtimeUsage) error {
+	b.sumUsage.TotalTokens += usage.TotalTokens
+	b.sumUsage.InputTokens += usage.InputTokens
+	b.sumUsage.OutputTokens += usage.OutputTokens
+	b.sumUsage.InputTokenDetails.CachedTokens += usage.InputTokenDetails.CachedTokens
+	b.sumUsage.InputTokenDetails.TextTokens += usage.InputTokenDetails.TextTokens
+	b.sumUsage.InputTokenDetails.AudioTokens += usage.InputTokenDetails.AudioTokens
+	b.sumUsage.OutputTokenDetails.TextTokens += usage.OutputTokenDetails.TextTokens
+	b.sumUsage.OutputTokenDetails.AudioTokens += usage.OutputTokenDetails.AudioTokens
+	return service.PreWssConsumeQuota(b.c, b.info, usage)
+}
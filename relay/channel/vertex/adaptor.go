@@ -384,3 +384,46 @@ func (a *Adaptor) GetModelList() []string {
 func (a *Adaptor) GetChannelName() string {
 	return ChannelName
 }
+
+func (a *Adaptor) CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	switch r := request.(type) {
+	case *dto.ClaudeRequest:
+		// Claude 计数接口只能通过服务账号访问
+		if a.RequestMode != RequestModeClaude || info.ChannelOtherSettings.VertexKeyType == dto.VertexKeyTypeAPIKey {
+			return 0, channel.ErrTokenCountNotSupported
+		}
+		fullRequestURL, err := a.getRequestUrl(info, "count-tokens", "rawPredict")
+		if err != nil {
+			return 0, err
+		}
+		body := r.ToCountTokensRequest()
+		body.Model = info.UpstreamModelName
+		if v, ok := claudeModelMap[info.UpstreamModelName]; ok {
+			body.Model = v
+		}
+		var resp dto.ClaudeCountTokensResponse
+		if err := channel.DoTokenCountRequest(a, c, info, fullRequestURL, body, &resp); err != nil {
+			return 0, err
+		}
+		return resp.InputTokens, nil
+	case *dto.GeminiChatRequest:
+		if a.RequestMode != RequestModeGemini {
+			return 0, channel.ErrTokenCountNotSupported
+		}
+		info.IsStream = false
+		generateURL, err := a.GetRequestURL(info)
+		if err != nil {
+			return 0, err
+		}
+		fullRequestURL := gemini.CountTokensURL(generateURL)
+		if fullRequestURL == "" {
+			return 0, channel.ErrTokenCountNotSupported
+		}
+		var resp dto.GeminiCountTokensResponse
+		if err := channel.DoTokenCountRequest(a, c, info, fullRequestURL, gemini.CountTokensBody(r), &resp); err != nil {
+			return 0, err
+		}
+		return resp.TotalTokens, nil
+	}
+	return 0, channel.ErrTokenCountNotSupported
+}
@@ -33,6 +33,7 @@ const (
 type ClaudeConvertInfo struct {
 	LastMessagesType string
 	Index            int
+	ToolIndexBase    int // 工具调用块的起始 index，OpenAI 的工具 index 从 0 开始
 	Usage            *dto.Usage
 	FinishReason     string
 	Done             bool
@@ -71,6 +72,8 @@ type ChannelMeta struct {
 	UpstreamModelName    string
 	IsModelMapped        bool
 	SupportStreamOptions bool // 是否支持流式选项
+	// EmulatedToolNames 通过提示词模拟函数调用时声明的工具名，非空时需要从模型输出中解析工具调用
+	EmulatedToolNames []string
 }
 
 type TokenCountMeta struct {
@@ -81,6 +84,7 @@ type TokenCountMeta struct {
 type RelayInfo struct {
 	TokenId           int
 	TokenKey          string
+	EphemeralKeyId    int // 使用临时密钥时的密钥 ID，消费计入签发令牌
 	UserId            int
 	UsingGroup        string // 使用的分组
 	UserGroup         string // 用户所在分组
@@ -109,6 +113,7 @@ type RelayInfo struct {
 	UserSetting            dto.UserSetting
 	UserEmail              string
 	UserQuota              int
+	ResellerMarkup         float64 // 分销商子用户的加价倍率，非子用户为 0
 	RelayFormat            types.RelayFormat
 	SendResponseCount      int
 	FinalPreConsumedQuota  int  // 最终预消耗的配额
@@ -400,6 +405,7 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenId:        common.GetContextKeyInt(c, constant.ContextKeyTokenId),
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
+		EphemeralKeyId: common.GetContextKeyInt(c, constant.ContextKeyEphemeralKeyId),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
@@ -432,10 +438,21 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 	if ok {
 		info.UserSetting = userSetting
 	}
+	if markup, ok := common.GetContextKeyType[float64](c, constant.ContextKeyResellerMarkup); ok {
+		info.ResellerMarkup = markup
+	}
 
 	return info
 }
 
+// GetResellerMarkup 返回分销商子用户的加价倍率，非子用户为 1
+func (info *RelayInfo) GetResellerMarkup() float64 {
+	if info.ResellerMarkup < 1 {
+		return 1
+	}
+	return info.ResellerMarkup
+}
+
 func GenRelayInfo(c *gin.Context, relayFormat types.RelayFormat, request dto.Request, ws *websocket.Conn) (*RelayInfo, error) {
 	switch relayFormat {
 	case types.RelayFormatOpenAI:
@@ -497,6 +514,7 @@ func (info *RelayInfo) HasSendResponse() bool {
 type TaskRelayInfo struct {
 	Action       string
 	OriginTaskID string
+	CallbackUrl  string // 任务结束后的回调地址
 
 	ConsumeQuota bool
 }
@@ -0,0 +1,62 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CountTokensHelper 计算请求的输入 token 数，渠道支持时调用上游计数接口，否则使用本地估算，不计费
+func CountTokensHelper(c *gin.Context, info *relaycommon.RelayInfo) (int, *types.NewAPIError) {
+	info.InitChannelMeta(c)
+
+	var request dto.Request
+	switch r := info.Request.(type) {
+	case *dto.ClaudeRequest:
+		copied, err := common.DeepCopy(r)
+		if err != nil {
+			return 0, types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+		}
+		request = copied
+	case *dto.GeminiChatRequest:
+		copied, err := common.DeepCopy(r)
+		if err != nil {
+			return 0, types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+		}
+		request = copied
+	default:
+		return 0, types.NewErrorWithStatusCode(fmt.Errorf("invalid request type %T", info.Request), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	if err := helper.ModelMappedHelper(c, info, request); err != nil {
+		return 0, types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+	}
+
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor != nil {
+		adaptor.Init(info)
+		if counter, ok := adaptor.(channel.TokenCounter); ok {
+			tokens, err := counter.CountTokens(c, info, request)
+			if err == nil {
+				return tokens, nil
+			}
+			if !errors.Is(err, channel.ErrTokenCountNotSupported) {
+				logger.LogWarn(c, fmt.Sprintf("upstream token counting failed, fall back to local estimation: %s", err.Error()))
+			}
+		}
+	}
+
+	meta := request.GetTokenCountMeta()
+	return service.CountTokenInput(meta.CombineText, info.UpstreamModelName), nil
+}
@@ -42,6 +42,14 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 		groupRatioInfo.GroupRatio = ratio_setting.GetGroupRatio(relayInfo.UsingGroup)
 	}
 
+	// 分销商子用户在分组倍率基础上叠加分销商加价
+	if markup := relayInfo.GetResellerMarkup(); markup != 1 {
+		groupRatioInfo.GroupRatio *= markup
+		if groupRatioInfo.HasSpecialRatio {
+			groupRatioInfo.GroupSpecialRatio *= markup
+		}
+	}
+
 	return groupRatioInfo
 }
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
@@ -15,6 +16,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -105,7 +107,15 @@ func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 		}
 	}
 
+	var mirrorWriter *imageMirrorWriter
+	if !info.IsStream && operation_setting.GetArtifactSetting().Enabled && operation_setting.GetArtifactSetting().MirrorImages {
+		mirrorWriter = &imageMirrorWriter{ResponseWriter: c.Writer}
+		c.Writer = mirrorWriter
+	}
 	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	if mirrorWriter != nil {
+		mirrorWriter.finish(c, info.UserId, newAPIError == nil)
+	}
 	if newAPIError != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
@@ -133,3 +143,56 @@ func ImageHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 	postConsumeQuota(c, info, usage.(*dto.Usage), logContent)
 	return nil
 }
+
+// imageMirrorWriter 缓存图片接口的响应，写回客户端后异步转存其中的图片
+type imageMirrorWriter struct {
+	gin.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func (w *imageMirrorWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *imageMirrorWriter) WriteHeaderNow() {}
+
+func (w *imageMirrorWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *imageMirrorWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *imageMirrorWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *imageMirrorWriter) Written() bool {
+	return w.status != 0 || w.body.Len() > 0
+}
+
+func (w *imageMirrorWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *imageMirrorWriter) Flush() {}
+
+// finish 恢复原始 writer 并写出缓存的响应，mirror 为 true 时再异步转存图片
+func (w *imageMirrorWriter) finish(c *gin.Context, userId int, mirror bool) {
+	c.Writer = w.ResponseWriter
+	if !w.Written() {
+		return
+	}
+	body := w.body.Bytes()
+	c.Writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	c.Writer.WriteHeader(w.Status())
+	_, _ = c.Writer.Write(body)
+	if mirror && w.Status() == http.StatusOK {
+		service.MirrorImageResponse(userId, body)
+	}
+}
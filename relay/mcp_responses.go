@@ -0,0 +1,465 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mcpResponsesLoop 由网关执行 Responses 请求中的 mcp 工具，输出项与 OpenAI 一致：
+// mcp_list_tools、mcp_call、mcp_approval_request
+type mcpResponsesLoop struct {
+	toolSet *service.MCPToolSet
+	// 客户端传入的原始工具，响应中原样返回
+	tools        []map[string]any
+	maxToolCalls int
+	stream       bool
+	output       []any
+	calls        int
+	rounds       int
+}
+
+// mcpResponsesApiTypes 实现了 ConvertOpenAIResponsesRequest 的 API 类型，
+// 其他渠道无法发送 Responses 请求，网关也就无法在其上执行 mcp 工具
+var mcpResponsesApiTypes = map[int]bool{
+	constant.APITypeOpenAI:     true,
+	constant.APITypeOpenRouter: true,
+	constant.APITypeXinference: true,
+	constant.APITypeCloudflare: true,
+}
+
+// newMCPResponsesLoop 请求带有 mcp 工具且由网关执行时返回处理器，否则返回 nil
+func newMCPResponsesLoop(info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) (*mcpResponsesLoop, error) {
+	if len(request.Tools) == 0 || !mcpToolLoopEnabled(info) {
+		return nil, nil
+	}
+	tools := request.GetToolsMap()
+	var mcpTools []dto.MCPTool
+	for _, tool := range tools {
+		if common.Interface2String(tool["type"]) != dto.ToolTypeMCP {
+			continue
+		}
+		mcpTool, err := common.Any2Type[dto.MCPTool](tool)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mcp tool: %w", err)
+		}
+		mcpTools = append(mcpTools, mcpTool)
+	}
+	if len(mcpTools) == 0 {
+		return nil, nil
+	}
+	if !mcpResponsesApiTypes[info.ApiType] {
+		return nil, fmt.Errorf("channel type does not support the Responses API, use /v1/chat/completions for mcp tools")
+	}
+	toolSet, err := service.NewMCPToolSet(mcpTools)
+	if err != nil {
+		return nil, err
+	}
+	return &mcpResponsesLoop{
+		toolSet:      toolSet,
+		tools:        tools,
+		maxToolCalls: int(request.MaxToolCalls),
+	}, nil
+}
+
+// prepare 将 mcp 工具替换为函数工具，流式请求改为非流式，结束后再以事件流的形式返回给客户端
+func (l *mcpResponsesLoop) prepare(info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) error {
+	l.stream = request.Stream
+	request.Stream = false
+	info.IsStream = false
+
+	tools := make([]map[string]any, 0, len(l.tools))
+	for _, tool := range l.tools {
+		if common.Interface2String(tool["type"]) != dto.ToolTypeMCP {
+			tools = append(tools, tool)
+		}
+	}
+	tools = append(tools, l.toolSet.ResponsesFunctionTools()...)
+	if info.ResponsesUsageInfo != nil && info.ResponsesUsageInfo.BuiltInTools != nil {
+		if _, ok := info.ResponsesUsageInfo.BuiltInTools["function"]; !ok {
+			info.ResponsesUsageInfo.BuiltInTools["function"] = &relaycommon.BuildInToolInfo{ToolName: "function"}
+		}
+	}
+	toolsJson, err := common.Marshal(tools)
+	if err != nil {
+		return err
+	}
+	request.Tools = toolsJson
+
+	// {"type": "mcp", "server_label": "...", "name": "..."} 转换为对应的函数
+	if common.GetJsonType(request.ToolChoice) == "object" {
+		var choice struct {
+			Type        string `json:"type"`
+			ServerLabel string `json:"server_label"`
+			Name        string `json:"name"`
+		}
+		if common.Unmarshal(request.ToolChoice, &choice) == nil && choice.Type == dto.ToolTypeMCP {
+			toolChoice := any("required")
+			if choice.Name != "" {
+				toolChoice = map[string]any{"type": "function", "name": service.MCPFunctionName(choice.ServerLabel, choice.Name)}
+			}
+			if request.ToolChoice, err = common.Marshal(toolChoice); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func mcpFunctionCallItems(callId string, name string, arguments string, output string) []map[string]any {
+	return []map[string]any{
+		{"type": "function_call", "call_id": callId, "name": name, "arguments": arguments},
+		{"type": "function_call_output", "call_id": callId, "output": output},
+	}
+}
+
+// mcpListedServers 历史中已经列出过工具的服务，本次不再返回 mcp_list_tools
+func mcpListedServers(input []map[string]any) map[string]bool {
+	listed := make(map[string]bool)
+	for _, item := range input {
+		if common.Interface2String(item["type"]) == dto.MCPItemTypeListTools {
+			listed[common.Interface2String(item["server_label"])] = true
+		}
+	}
+	return listed
+}
+
+// convertInput 将输入中的 mcp 输出项转换为上游可识别的函数调用，并执行客户端已批准的调用
+func (l *mcpResponsesLoop) convertInput(ctx context.Context, input []map[string]any) ([]map[string]any, error) {
+	requests := make(map[string]map[string]any)
+	answered := make(map[string]bool)
+	for _, item := range input {
+		switch common.Interface2String(item["type"]) {
+		case dto.MCPItemTypeApprovalRequest:
+			requests[common.Interface2String(item["id"])] = item
+		case dto.MCPItemTypeCall:
+			if id := common.Interface2String(item["approval_request_id"]); id != "" {
+				answered[id] = true
+			}
+		}
+	}
+
+	items := make([]map[string]any, 0, len(input))
+	for _, item := range input {
+		switch common.Interface2String(item["type"]) {
+		case dto.MCPItemTypeListTools, dto.MCPItemTypeApprovalRequest:
+			continue
+		case dto.MCPItemTypeCall:
+			callId := common.GetStringIfEmpty(common.Interface2String(item["id"]), "call_"+common.GetUUID())
+			output := common.Interface2String(item["output"])
+			if errorText := common.Interface2String(item["error"]); errorText != "" {
+				output = "Error: " + errorText
+			}
+			name := service.MCPFunctionName(common.Interface2String(item["server_label"]), common.Interface2String(item["name"]))
+			items = append(items, mcpFunctionCallItems(callId, name, common.Interface2String(item["arguments"]), output)...)
+		case dto.MCPItemTypeApprovalResponse:
+			approval, err := common.Any2Type[dto.MCPApprovalResponse](item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid mcp_approval_response: %w", err)
+			}
+			if answered[approval.ApprovalRequestID] {
+				continue
+			}
+			request, ok := requests[approval.ApprovalRequestID]
+			if !ok {
+				return nil, fmt.Errorf("mcp approval request %s not found, include it in input or use previous_response_id", approval.ApprovalRequestID)
+			}
+			answered[approval.ApprovalRequestID] = true
+			arguments := common.Interface2String(request["arguments"])
+			name := service.MCPFunctionName(common.Interface2String(request["server_label"]), common.Interface2String(request["name"]))
+			output := mcpDeniedOutput
+			if approval.Approve && l.toolSet.Has(name) {
+				call := l.toolSet.Call(ctx, name, arguments)
+				call.ApprovalRequestID = approval.ApprovalRequestID
+				l.calls++
+				l.output = append(l.output, call)
+				output = service.MCPCallResultText(call)
+			} else if approval.Approve {
+				output = "Error: the tool is not available"
+			} else if approval.Reason != "" {
+				output += " Reason: " + approval.Reason
+			}
+			items = append(items, mcpFunctionCallItems(approval.ApprovalRequestID, name, arguments, output)...)
+		default:
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// handleOutput 执行本轮输出中的 mcp 调用并生成对应的输出项，需要继续请求时将本轮输出与结果追加到输入并返回 true
+func (l *mcpResponsesLoop) handleOutput(ctx context.Context, output []any, input *[]map[string]any, last bool) bool {
+	hasMCPCall, hasClientCall := false, false
+	for _, raw := range output {
+		item, _ := raw.(map[string]any)
+		if common.Interface2String(item["type"]) != "function_call" {
+			continue
+		}
+		if l.toolSet.Has(common.Interface2String(item["name"])) {
+			hasMCPCall = true
+		} else {
+			hasClientCall = true
+		}
+	}
+	if !hasMCPCall {
+		l.output = append(l.output, output...)
+		return false
+	}
+
+	pending := false
+	next := make([]map[string]any, 0, len(output)+2)
+	for _, raw := range output {
+		item, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		name := common.Interface2String(item["name"])
+		if common.Interface2String(item["type"]) != "function_call" || !l.toolSet.Has(name) {
+			l.output = append(l.output, item)
+			if replay := service.ReplayResponsesItem(item); replay != nil {
+				next = append(next, replay)
+			}
+			continue
+		}
+		arguments := common.Interface2String(item["arguments"])
+		switch {
+		case last || (l.maxToolCalls > 0 && l.calls >= l.maxToolCalls):
+			l.output = append(l.output, l.toolSet.CallError(name, arguments, mcpMaxIterationsExceeded))
+			last = true
+		case l.toolSet.RequiresApproval(name):
+			// 客户端返回 mcp_approval_response 后在下次请求中执行
+			l.output = append(l.output, l.toolSet.ApprovalRequest("mcpr_"+common.GetUUID(), name, arguments))
+			pending = true
+		default:
+			call := l.toolSet.Call(ctx, name, arguments)
+			l.calls++
+			l.output = append(l.output, call)
+			next = append(next, mcpFunctionCallItems(common.Interface2String(item["call_id"]), name, arguments, service.MCPCallResultText(call))...)
+		}
+	}
+	if last || pending || hasClientCall {
+		return false
+	}
+	*input = append(*input, next...)
+	return true
+}
+
+// relay 循环请求上游并执行工具，返回累计用量和需要写入日志的说明
+func (l *mcpResponsesLoop) relay(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.OpenAIResponsesRequest) (*dto.Usage, string, *types.NewAPIError) {
+	defer l.toolSet.Close()
+	input, err := service.NormalizeResponsesInput(request.Input)
+	if err != nil {
+		return nil, "", types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	ctx := c.Request.Context()
+	if apiErr := connectMCPToolSet(ctx, l.toolSet); apiErr != nil {
+		return nil, "", apiErr
+	}
+	for _, item := range l.toolSet.ListToolsItems(mcpListedServers(input)) {
+		l.output = append(l.output, item)
+	}
+	input, err = l.convertInput(ctx, input)
+	if err != nil {
+		return nil, "", types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if err = l.prepare(info, request); err != nil {
+		return nil, "", types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	defer func() {
+		info.IsStream = l.stream
+	}()
+
+	maxIterations := mcpMaxIterations()
+	totalUsage := &dto.Usage{}
+	var response map[string]any
+	for {
+		last := l.rounds == maxIterations-1 || (l.maxToolCalls > 0 && l.calls >= l.maxToolCalls)
+		if last {
+			request.ToolChoice = []byte(`"none"`)
+		}
+		if request.Input, err = common.Marshal(input); err != nil {
+			return nil, "", types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+		}
+		attemptRequest, err := common.DeepCopy(request)
+		if err != nil {
+			return nil, "", types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+		}
+
+		writer := &bufferedResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		usage, newAPIError := doResponsesRequest(c, info, adaptor, attemptRequest)
+		c.Writer = writer.ResponseWriter
+		l.rounds++
+		if newAPIError != nil {
+			return nil, "", newAPIError
+		}
+		if usage != nil {
+			addUsage(totalUsage, usage)
+		}
+
+		response = nil
+		if writer.Status() != http.StatusOK || common.Unmarshal(writer.body.Bytes(), &response) != nil || response == nil {
+			// 无法识别的响应原样返回
+			writer.flushTo(c)
+			return totalUsage, mcpExtraContent(l.calls, l.rounds), nil
+		}
+		output, _ := response["output"].([]any)
+		if !l.handleOutput(ctx, output, &input, last) {
+			break
+		}
+		// 强制调用只对第一轮生效，避免模型无法结束
+		if len(request.ToolChoice) > 0 {
+			request.ToolChoice = []byte(`"auto"`)
+		}
+	}
+
+	response["output"] = l.output
+	response["tools"] = l.tools
+	responseUsage, _ := response["usage"].(map[string]any)
+	if responseUsage == nil {
+		responseUsage = make(map[string]any)
+	}
+	responseUsage["input_tokens"] = totalUsage.PromptTokens
+	responseUsage["output_tokens"] = totalUsage.CompletionTokens
+	responseUsage["total_tokens"] = totalUsage.TotalTokens
+	responseUsage["input_tokens_details"] = map[string]any{"cached_tokens": totalUsage.PromptTokensDetails.CachedTokens}
+	response["usage"] = responseUsage
+
+	body, err := common.Marshal(response)
+	if err != nil {
+		return nil, "", types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+	}
+	// 供网关保存响应，用于 previous_response_id
+	common.SetContextKey(c, constant.ContextKeyResponsesResult, body)
+	if l.stream {
+		writeResponsesStream(c, body)
+	} else {
+		c.Writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		c.Data(http.StatusOK, "application/json", body)
+	}
+	return totalUsage, mcpExtraContent(l.calls, l.rounds), nil
+}
+
+// writeResponsesStream 将完整的响应对象按 Responses API 的事件顺序返回
+func writeResponsesStream(c *gin.Context, body []byte) {
+	var response map[string]any
+	if err := common.Unmarshal(body, &response); err != nil {
+		return
+	}
+	c.Writer.Header().Del("Content-Length")
+	helper.SetEventStreamHeaders(c)
+
+	sequence := 0
+	send := func(eventType string, event map[string]any) {
+		event["type"] = eventType
+		event["sequence_number"] = sequence
+		sequence++
+		data, err := common.Marshal(event)
+		if err != nil {
+			return
+		}
+		helper.ResponseChunkData(c, dto.ResponsesStreamResponse{Type: eventType}, string(data))
+	}
+
+	inProgress := make(map[string]any, len(response))
+	for k, v := range response {
+		inProgress[k] = v
+	}
+	inProgress["status"] = "in_progress"
+	inProgress["output"] = []any{}
+	delete(inProgress, "usage")
+	send("response.created", map[string]any{"response": inProgress})
+	send("response.in_progress", map[string]any{"response": inProgress})
+
+	output, _ := response["output"].([]any)
+	for i, raw := range output {
+		item, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		itemType := common.Interface2String(item["type"])
+		itemId := item["id"]
+		added := make(map[string]any, len(item))
+		for k, v := range item {
+			added[k] = v
+		}
+		added["status"] = "in_progress"
+		switch itemType {
+		case "message":
+			added["content"] = []any{}
+		case "function_call", dto.MCPItemTypeCall:
+			added["arguments"] = ""
+			delete(added, "output")
+			delete(added, "error")
+		}
+		send("response.output_item.added", map[string]any{"output_index": i, "item": added})
+
+		switch itemType {
+		case "message":
+			contents, _ := item["content"].([]any)
+			for j, rawPart := range contents {
+				part, ok := rawPart.(map[string]any)
+				if !ok {
+					continue
+				}
+				event := func() map[string]any {
+					return map[string]any{"item_id": itemId, "output_index": i, "content_index": j}
+				}
+				emptyPart := make(map[string]any, len(part))
+				for k, v := range part {
+					emptyPart[k] = v
+				}
+				if _, ok := part["text"]; ok {
+					emptyPart["text"] = ""
+				}
+				partAdded := event()
+				partAdded["part"] = emptyPart
+				send("response.content_part.added", partAdded)
+				if common.Interface2String(part["type"]) == "output_text" {
+					text := common.Interface2String(part["text"])
+					delta := event()
+					delta["delta"] = text
+					send("response.output_text.delta", delta)
+					done := event()
+					done["text"] = text
+					send("response.output_text.done", done)
+				}
+				partDone := event()
+				partDone["part"] = part
+				send("response.content_part.done", partDone)
+			}
+		case "function_call", dto.MCPItemTypeCall:
+			eventPrefix := "response.function_call_arguments"
+			if itemType == dto.MCPItemTypeCall {
+				eventPrefix = "response.mcp_call_arguments"
+			}
+			arguments := common.Interface2String(item["arguments"])
+			send(eventPrefix+".delta", map[string]any{"item_id": itemId, "output_index": i, "delta": arguments})
+			send(eventPrefix+".done", map[string]any{"item_id": itemId, "output_index": i, "arguments": arguments})
+			if itemType == dto.MCPItemTypeCall {
+				status := "response.mcp_call.completed"
+				if common.Interface2String(item["status"]) == "failed" {
+					status = "response.mcp_call.failed"
+				}
+				send(status, map[string]any{"item_id": itemId, "output_index": i})
+			}
+		case dto.MCPItemTypeListTools:
+			send("response.mcp_list_tools.in_progress", map[string]any{"item_id": itemId, "output_index": i})
+			send("response.mcp_list_tools.completed", map[string]any{"item_id": itemId, "output_index": i})
+		}
+		send("response.output_item.done", map[string]any{"output_index": i, "item": item})
+	}
+	send("response.completed", map[string]any{"response": response})
+}
@@ -0,0 +1,317 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	mcpDeniedOutput          = "The user denied this tool call."
+	mcpMaxIterationsExceeded = "exceeded the maximum number of tool iterations"
+)
+
+// mcpToolLoopEnabled 渠道透传 mcp 工具或透传请求体时不由网关执行
+func mcpToolLoopEnabled(info *relaycommon.RelayInfo) bool {
+	if !service.IsMCPEnabled() || info.ChannelSetting.MCPPassThrough {
+		return false
+	}
+	return !model_setting.GetGlobalSettings().PassThroughRequestEnabled && !info.ChannelSetting.PassThroughBodyEnabled
+}
+
+func mcpMaxIterations() int {
+	return max(operation_setting.GetMCPSetting().MaxIterations, 1)
+}
+
+func connectMCPToolSet(ctx context.Context, toolSet *service.MCPToolSet) *types.NewAPIError {
+	if err := toolSet.Connect(ctx); err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeBadResponse, http.StatusFailedDependency, types.ErrOptionWithSkipRetry())
+	}
+	return nil
+}
+
+// mcpExtraContent 写入使用日志的说明，多轮请求合并为一次计费
+func mcpExtraContent(calls int, rounds int) string {
+	if calls == 0 && rounds <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("MCP 工具调用 %d 次，模型请求 %d 次", calls, rounds)
+}
+
+// mcpChatLoop 由网关执行 Chat Completions 请求中的 mcp 工具：工具以函数的形式提供给模型，
+// 模型调用后由网关执行并继续请求，直到模型给出回答、需要客户端处理或达到轮数上限
+type mcpChatLoop struct {
+	toolSet   *service.MCPToolSet
+	approvals map[string]dto.MCPApprovalResponse
+	stream    bool
+	output    []any
+	calls     int
+	rounds    int
+}
+
+// newMCPChatLoop 请求带有 mcp 工具且由网关执行时返回处理器，否则返回 nil
+func newMCPChatLoop(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (*mcpChatLoop, error) {
+	approvals := request.MCPApprovals
+	request.MCPApprovals = nil
+	if info.RelayMode != relayconstant.RelayModeChatCompletions || !mcpToolLoopEnabled(info) {
+		return nil, nil
+	}
+	var mcpTools []dto.MCPTool
+	for _, tool := range request.Tools {
+		if tool.Type != dto.ToolTypeMCP {
+			continue
+		}
+		mcpTool := dto.MCPTool{Type: tool.Type}
+		if tool.MCPToolOptions != nil {
+			mcpTool.MCPToolOptions = *tool.MCPToolOptions
+		}
+		mcpTools = append(mcpTools, mcpTool)
+	}
+	if len(mcpTools) == 0 {
+		return nil, nil
+	}
+	// 工具调用只按第一个选项继续请求，无法同时处理多个选项
+	if request.N > 1 {
+		return nil, fmt.Errorf("n > 1 is not supported when mcp tools are executed by the gateway")
+	}
+	toolSet, err := service.NewMCPToolSet(mcpTools)
+	if err != nil {
+		return nil, err
+	}
+	loop := &mcpChatLoop{
+		toolSet:   toolSet,
+		approvals: make(map[string]dto.MCPApprovalResponse, len(approvals)),
+	}
+	for _, approval := range approvals {
+		loop.approvals[approval.ApprovalRequestID] = approval
+	}
+	return loop, nil
+}
+
+// prepare 将 mcp 工具替换为函数工具，流式请求改为非流式，结束后再以流的形式返回给客户端
+func (l *mcpChatLoop) prepare(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) {
+	l.stream = request.Stream
+	request.Stream = false
+	request.StreamOptions = nil
+	info.IsStream = false
+
+	tools := make([]dto.ToolCallRequest, 0, len(request.Tools))
+	for _, tool := range request.Tools {
+		if tool.Type != dto.ToolTypeMCP {
+			tools = append(tools, tool)
+		}
+	}
+	request.Tools = append(tools, l.toolSet.FunctionTools()...)
+
+	// {"type": "mcp", "server_label": "...", "name": "..."} 转换为对应的函数
+	if choice, ok := request.ToolChoice.(map[string]any); ok && choice["type"] == dto.ToolTypeMCP {
+		name := common.Interface2String(choice["name"])
+		if name == "" {
+			request.ToolChoice = "required"
+		} else {
+			request.ToolChoice = map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": service.MCPFunctionName(common.Interface2String(choice["server_label"]), name)},
+			}
+		}
+	}
+}
+
+// resolvePending 处理历史中最后一条 assistant 消息里尚未返回结果的 mcp 调用：
+// 已批准或无需批准的由网关执行，其余按拒绝处理
+func (l *mcpChatLoop) resolvePending(ctx context.Context, request *dto.GeneralOpenAIRequest) {
+	assistantIndex := -1
+	for i := len(request.Messages) - 1; i >= 0; i-- {
+		if request.Messages[i].Role == "assistant" {
+			assistantIndex = i
+			break
+		}
+	}
+	if assistantIndex < 0 {
+		return
+	}
+	answered := make(map[string]bool)
+	end := assistantIndex + 1
+	for ; end < len(request.Messages) && request.Messages[end].Role == "tool"; end++ {
+		answered[request.Messages[end].ToolCallId] = true
+	}
+
+	var results []dto.Message
+	for _, call := range request.Messages[assistantIndex].ParseToolCalls() {
+		name := call.Function.Name
+		if answered[call.ID] || !l.toolSet.Has(name) {
+			continue
+		}
+		output := mcpDeniedOutput
+		approval, ok := l.approvals[call.ID]
+		if (ok && approval.Approve) || (!ok && !l.toolSet.RequiresApproval(name)) {
+			item := l.toolSet.Call(ctx, name, call.Function.Arguments)
+			item.ApprovalRequestID = approval.ApprovalRequestID
+			l.calls++
+			l.output = append(l.output, item)
+			output = service.MCPCallResultText(item)
+		} else if approval.Reason != "" {
+			output += " Reason: " + approval.Reason
+		}
+		results = append(results, dto.Message{Role: "tool", ToolCallId: call.ID, Content: output})
+	}
+	if len(results) == 0 {
+		return
+	}
+	messages := make([]dto.Message, 0, len(request.Messages)+len(results))
+	messages = append(messages, request.Messages[:end]...)
+	messages = append(messages, results...)
+	request.Messages = append(messages, request.Messages[end:]...)
+}
+
+// handleChoice 执行模型调用的 mcp 工具，需要继续请求时将调用与结果追加到消息中并返回 true
+func (l *mcpChatLoop) handleChoice(ctx context.Context, request *dto.GeneralOpenAIRequest, choice *dto.OpenAITextResponseChoice, last bool) bool {
+	var mcpCalls, clientCalls []dto.ToolCallRequest
+	for _, call := range choice.Message.ParseToolCalls() {
+		if l.toolSet.Has(call.Function.Name) {
+			mcpCalls = append(mcpCalls, call)
+		} else {
+			clientCalls = append(clientCalls, call)
+		}
+	}
+	if len(mcpCalls) == 0 {
+		return false
+	}
+
+	// 同一轮中有待批准或客户端自己的调用时，本轮的 mcp 调用全部推迟：
+	// 与客户端调用一起返回，客户端回放后由 resolvePending 统一执行，避免已执行的调用与结果不在历史中而被重复执行
+	deferred := len(clientCalls) > 0
+	for _, call := range mcpCalls {
+		if l.toolSet.RequiresApproval(call.Function.Name) {
+			deferred = true
+		}
+	}
+
+	results := make([]dto.Message, 0, len(mcpCalls))
+	for _, call := range mcpCalls {
+		name := call.Function.Name
+		switch {
+		case last:
+			l.output = append(l.output, l.toolSet.CallError(name, call.Function.Arguments, mcpMaxIterationsExceeded))
+		case deferred:
+			// 需要批准的调用由客户端通过 mcp_approvals 批准后在下次请求中执行
+			if l.toolSet.RequiresApproval(name) {
+				l.output = append(l.output, l.toolSet.ApprovalRequest(call.ID, name, call.Function.Arguments))
+			}
+		default:
+			item := l.toolSet.Call(ctx, name, call.Function.Arguments)
+			l.calls++
+			l.output = append(l.output, item)
+			results = append(results, dto.Message{Role: "tool", ToolCallId: call.ID, Content: service.MCPCallResultText(item)})
+		}
+	}
+
+	if last || deferred {
+		// 交给客户端：最后一轮只返回客户端自己的工具调用，否则连同推迟的 mcp 调用一起返回
+		calls := clientCalls
+		if !last {
+			calls = choice.Message.ParseToolCalls()
+		}
+		choice.Message.ToolCalls = nil
+		if len(calls) > 0 {
+			choice.Message.SetToolCalls(calls)
+			choice.FinishReason = "tool_calls"
+		} else if choice.FinishReason == "tool_calls" {
+			choice.FinishReason = "stop"
+		}
+		return false
+	}
+
+	assistant := dto.Message{Role: "assistant"}
+	if content := choice.Message.StringContent(); content != "" {
+		assistant.SetStringContent(content)
+	}
+	assistant.SetToolCalls(mcpCalls)
+	request.Messages = append(request.Messages, assistant)
+	request.Messages = append(request.Messages, results...)
+	return true
+}
+
+// relay 循环请求上游并执行工具，返回累计用量和需要写入日志的说明
+func (l *mcpChatLoop) relay(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.GeneralOpenAIRequest) (*dto.Usage, string, *types.NewAPIError) {
+	defer l.toolSet.Close()
+	ctx := c.Request.Context()
+	if apiErr := connectMCPToolSet(ctx, l.toolSet); apiErr != nil {
+		return nil, "", apiErr
+	}
+	for _, item := range l.toolSet.ListToolsItems(nil) {
+		l.output = append(l.output, item)
+	}
+	l.prepare(info, request)
+	defer func() {
+		info.IsStream = l.stream
+	}()
+	l.resolvePending(ctx, request)
+
+	maxIterations := mcpMaxIterations()
+	totalUsage := &dto.Usage{}
+	var response *dto.OpenAITextResponse
+	for {
+		last := l.rounds == maxIterations-1
+		if last {
+			request.ToolChoice = "none"
+		}
+		attemptRequest, err := common.DeepCopy(request)
+		if err != nil {
+			return nil, "", types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+		}
+
+		writer := &bufferedResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		usage, newAPIError := doTextRequest(c, info, adaptor, attemptRequest)
+		c.Writer = writer.ResponseWriter
+		l.rounds++
+		if newAPIError != nil {
+			return nil, "", newAPIError
+		}
+		if usage != nil {
+			addUsage(totalUsage, usage)
+		}
+
+		response = &dto.OpenAITextResponse{}
+		if writer.Status() != http.StatusOK || common.Unmarshal(writer.body.Bytes(), response) != nil || len(response.Choices) == 0 {
+			// 无法识别的响应原样返回
+			writer.flushTo(c)
+			return totalUsage, mcpExtraContent(l.calls, l.rounds), nil
+		}
+		if !l.handleChoice(ctx, request, &response.Choices[0], last) {
+			break
+		}
+		// 强制调用只对第一轮生效，避免模型无法结束
+		if request.ToolChoice != nil {
+			request.ToolChoice = "auto"
+		}
+	}
+
+	response.Usage = *totalUsage
+	response.MCPOutput = l.output
+	if l.stream {
+		writeChatCompletionStream(c, info, response)
+	} else {
+		body, err := common.Marshal(response)
+		if err != nil {
+			return nil, "", types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+		}
+		c.Writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		c.Data(http.StatusOK, "application/json", body)
+	}
+	return totalUsage, mcpExtraContent(l.calls, l.rounds), nil
+}
@@ -34,6 +34,17 @@ func RelayMidjourneyImage(c *gin.Context) {
 		})
 		return
 	}
+	// 已转存的图片直接从网关存储读取
+	if artifact := model.GetTaskArtifact(model.ArtifactSourceMidjourney, midjourneyTask.MjId); artifact != nil {
+		if reader, err := service.OpenArtifact(c.Request.Context(), artifact); err == nil {
+			defer reader.Close()
+			c.Writer.Header().Set("Content-Type", artifact.ContentType)
+			if _, err = io.Copy(c.Writer, reader); err != nil {
+				log.Println("Failed to stream image:", err)
+			}
+			return
+		}
+	}
 	var httpClient *http.Client
 	if channel, err := model.CacheGetChannel(midjourneyTask.ChannelId); err == nil {
 		proxy := channel.GetSetting().Proxy
@@ -188,7 +199,7 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 
 	priceData := helper.ModelPriceHelperPerCall(c, info)
 
-	userQuota, err := model.GetUserQuota(info.UserId, false)
+	spendableQuota, _, err := model.GetUserSpendableQuota(info.UserId)
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -196,7 +207,7 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 		}
 	}
 
-	if userQuota-priceData.Quota < 0 {
+	if spendableQuota-priceData.Quota < 0 {
 		return &dto.MidjourneyResponse{
 			Code:        4,
 			Description: "quota_not_enough",
@@ -489,7 +500,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 
 	priceData := helper.ModelPriceHelperPerCall(c, relayInfo)
 
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	spendableQuota, _, err := model.GetUserSpendableQuota(relayInfo.UserId)
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -497,7 +508,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 		}
 	}
 
-	if consumeQuota && userQuota-priceData.Quota < 0 {
+	if consumeQuota && spendableQuota-priceData.Quota < 0 {
 		return &dto.MidjourneyResponse{
 			Code:        4,
 			Description: "quota_not_enough",
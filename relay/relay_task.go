@@ -21,6 +21,8 @@ import (
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
 )
 
 /*
@@ -43,6 +45,11 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		return service.TaskErrorWrapperLocal(fmt.Errorf("invalid api platform: %s", platform), "invalid_api_platform", http.StatusBadRequest)
 	}
 	adaptor.Init(info)
+	// callback_url 仅供网关使用，需在适配器解析请求前从请求体中移除
+	taskErr = resolveTaskCallbackUrl(c, info)
+	if taskErr != nil {
+		return
+	}
 	// get & validate taskRequest 获取并验证文本请求
 	taskErr = adaptor.ValidateRequestAndSetAction(c, info)
 	if taskErr != nil {
@@ -72,6 +79,7 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	} else {
 		ratio = modelPrice * groupRatio
 	}
+	ratio *= info.GetResellerMarkup()
 	// FIXME: 临时修补，支持任务仅按次计费
 	if !common.StringsContains(constant.TaskPricePatches, modelName) {
 		if len(info.PriceData.OtherRatios) > 0 {
@@ -83,13 +91,13 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		}
 	}
 	println(fmt.Sprintf("model: %s, model_price: %.4f, group: %s, group_ratio: %.4f, final_ratio: %.4f", modelName, modelPrice, info.UsingGroup, groupRatio, ratio))
-	userQuota, err := model.GetUserQuota(info.UserId, false)
+	spendableQuota, _, err := model.GetUserSpendableQuota(info.UserId)
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 		return
 	}
 	quota := int(ratio * common.QuotaPerUnit)
-	if userQuota-quota < 0 {
+	if spendableQuota-quota < 0 {
 		taskErr = service.TaskErrorWrapperLocal(errors.New("user quota is not enough"), "quota_not_enough", http.StatusForbidden)
 		return
 	}
@@ -113,12 +121,22 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 			if channel.Status != common.ChannelStatusEnabled {
 				return service.TaskErrorWrapperLocal(errors.New("该任务所属渠道已被禁用"), "task_channel_disable", http.StatusBadRequest)
 			}
+			originKey := originTask.GetChannelKey(channel)
 			c.Set("base_url", channel.GetBaseURL())
 			c.Set("channel_id", originTask.ChannelId)
-			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", originKey))
 
 			info.ChannelBaseUrl = channel.GetBaseURL()
 			info.ChannelId = originTask.ChannelId
+			info.ApiKey = originKey
+			info.ChannelIsMultiKey = channel.ChannelInfo.IsMultiKey
+			info.ChannelMultiKeyIndex = originTask.PrivateData.KeyIndex
+		} else if info.ChannelIsMultiKey {
+			// 多 Key 渠道需要使用原任务提交时的 Key
+			if channel, err := model.CacheGetChannel(info.ChannelId); err == nil {
+				info.ApiKey = originTask.GetChannelKey(channel)
+				info.ChannelMultiKeyIndex = originTask.PrivateData.KeyIndex
+			}
 		}
 	}
 
@@ -216,6 +234,72 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	return nil
 }
 
+// resolveTaskCallbackUrl 读取请求中的 callback_url，未指定时使用令牌的默认回调地址
+func resolveTaskCallbackUrl(c *gin.Context, info *relaycommon.RelayInfo) *dto.TaskError {
+	callbackUrl, err := takeTaskCallbackUrl(c)
+	if err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_request", http.StatusBadRequest)
+	}
+	callbackUrl = strings.TrimSpace(callbackUrl)
+	if callbackUrl != "" && common.GetContextKeyInt(c, constant.ContextKeyEphemeralKeyId) != 0 {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("ephemeral keys cannot set callback_url"), "invalid_callback_url", http.StatusForbidden)
+	}
+	if callbackUrl == "" {
+		callbackUrl = common.GetContextKeyString(c, constant.ContextKeyTokenCallbackUrl)
+	}
+	if callbackUrl == "" {
+		return nil
+	}
+	if err := service.ValidateTaskCallbackUrl(callbackUrl); err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_callback_url", http.StatusBadRequest)
+	}
+	info.CallbackUrl = callbackUrl
+	return nil
+}
+
+// takeTaskCallbackUrl 取出 JSON 或 multipart 请求体中的 callback_url，并将其从请求体中删除，避免转发给上游。
+// 取出的值缓存在上下文中，渠道重试时请求体已不含该字段
+func takeTaskCallbackUrl(c *gin.Context) (string, error) {
+	if v, ok := common.GetContextKey(c, constant.ContextKeyTaskCallbackUrl); ok {
+		return v.(string), nil
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return "", err
+	}
+	contentType := c.Request.Header.Get("Content-Type")
+	var callbackUrl string
+	var stripped []byte
+	switch {
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		var found bool
+		callbackUrl, stripped, found, err = common.RemoveMultipartField(body, contentType, "callback_url")
+		if err != nil || !found {
+			return "", err
+		}
+	case strings.HasPrefix(contentType, "application/json"):
+		result := gjson.GetBytes(body, "callback_url")
+		if !result.Exists() {
+			return "", nil
+		}
+		callbackUrl = result.String()
+		stripped, err = sjson.DeleteBytes(body, "callback_url")
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", nil
+	}
+	common.SetContextKey(c, constant.ContextKeyTaskCallbackUrl, callbackUrl)
+	c.Set(common.KeyRequestBody, stripped)
+	c.Request.Body = io.NopCloser(bytes.NewReader(stripped))
+	c.Request.ContentLength = int64(len(stripped))
+	c.Request.Form = nil
+	c.Request.PostForm = nil
+	c.Request.MultipartForm = nil
+	return callbackUrl, nil
+}
+
 var fetchRespBuilders = map[int]func(c *gin.Context) (respBody []byte, taskResp *dto.TaskError){
 	relayconstant.RelayModeSunoFetchByID:  sunoFetchByIDRespBodyBuilder,
 	relayconstant.RelayModeSunoFetch:      sunoFetchRespBodyBuilder,
@@ -331,7 +415,7 @@ func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *d
 		if adaptor == nil {
 			return
 		}
-		resp, err2 := adaptor.FetchTask(baseURL, channelModel.Key, map[string]any{
+		resp, err2 := adaptor.FetchTask(baseURL, originTask.GetChannelKey(channelModel), map[string]any{
 			"task_id": originTask.TaskID,
 			"action":  originTask.Action,
 		}, proxy)
@@ -0,0 +1,334 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const structuredOutputMaxRetriesLimit = 5
+
+var invalidToolNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// structuredOutput 为不支持 json_schema 的渠道模拟结构化输出：改写请求、校验结果，失败时修复或重新请求
+type structuredOutput struct {
+	mode       string
+	schema     *service.StructuredOutputSchema
+	maxRetries int
+	stream     bool
+	// toolName tool 模式下强制调用的工具名
+	toolName string
+}
+
+// newStructuredOutput 渠道开启结构化输出且请求带有 json_schema/json_object 格式时返回处理器，否则返回 nil
+func newStructuredOutput(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (*structuredOutput, error) {
+	mode := info.ChannelSetting.StructuredOutputMode
+	switch mode {
+	case service.StructuredOutputModeNative, service.StructuredOutputModePrompt, service.StructuredOutputModeTool:
+	default:
+		return nil, nil
+	}
+	if info.RelayMode != relayconstant.RelayModeChatCompletions || len(request.Messages) == 0 {
+		return nil, nil
+	}
+	// 透传请求体时无法改写请求
+	if model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled {
+		return nil, nil
+	}
+	schema, err := service.ParseStructuredOutputSchema(request.ResponseFormat)
+	if err != nil || schema == nil {
+		return nil, err
+	}
+	maxRetries := info.ChannelSetting.StructuredOutputMaxRetries
+	if maxRetries < 0 {
+		maxRetries = 0
+	} else if maxRetries > structuredOutputMaxRetriesLimit {
+		maxRetries = structuredOutputMaxRetriesLimit
+	}
+	return &structuredOutput{
+		mode:       mode,
+		schema:     schema,
+		maxRetries: maxRetries,
+	}, nil
+}
+
+// prepare 改写发往上游的请求，流式请求改为非流式，结束后再以流的形式返回给客户端
+func (s *structuredOutput) prepare(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) {
+	s.stream = request.Stream
+	request.Stream = false
+	request.StreamOptions = nil
+	info.IsStream = false
+
+	mode := s.mode
+	// 客户端自带工具时不能强制调用，退回提示词模式
+	if mode == service.StructuredOutputModeTool && len(request.Tools) > 0 {
+		mode = service.StructuredOutputModePrompt
+	}
+	switch mode {
+	case service.StructuredOutputModeTool:
+		s.toolName = invalidToolNameRegex.ReplaceAllString(s.schema.Name, "_")
+		if len(s.toolName) > 64 {
+			s.toolName = s.toolName[:64]
+		}
+		request.ResponseFormat = nil
+		request.Tools = []dto.ToolCallRequest{{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        s.toolName,
+				Description: common.GetStringIfEmpty(s.schema.Description, "Respond with the final answer."),
+				Parameters:  s.schema.ToolParameters(),
+			},
+		}}
+		request.ToolChoice = map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": s.toolName},
+		}
+	case service.StructuredOutputModePrompt:
+		request.ResponseFormat = nil
+		instruction := s.schema.Instruction()
+		systemRole := request.GetSystemRoleName()
+		for i, message := range request.Messages {
+			if message.Role == systemRole && message.IsStringContent() {
+				request.Messages[i].SetStringContent(message.StringContent() + "\n\n" + instruction)
+				return
+			}
+		}
+		request.Messages = append([]dto.Message{{Role: systemRole, Content: instruction}}, request.Messages...)
+	}
+}
+
+// relay 发送请求并校验结果，返回累计用量和需要写入日志的说明
+func (s *structuredOutput) relay(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.GeneralOpenAIRequest) (*dto.Usage, string, *types.NewAPIError) {
+	s.prepare(info, request)
+	defer func() {
+		info.IsStream = s.stream
+	}()
+
+	totalUsage := &dto.Usage{}
+	var followUp []dto.Message
+	var lastResponse *dto.OpenAITextResponse
+	var lastErr error
+	attempts := 0
+	for ; attempts <= s.maxRetries; attempts++ {
+		attemptRequest, err := common.DeepCopy(request)
+		if err != nil {
+			return nil, "", types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+		}
+		attemptRequest.Messages = append(attemptRequest.Messages, followUp...)
+
+		writer := &bufferedResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		usage, newAPIError := doTextRequest(c, info, adaptor, attemptRequest)
+		c.Writer = writer.ResponseWriter
+		if newAPIError != nil {
+			if lastResponse == nil {
+				return nil, "", newAPIError
+			}
+			// 重新请求失败时返回上一次的结果
+			logger.LogWarn(c, "structured output retry failed: "+newAPIError.Error())
+			break
+		}
+		if usage != nil {
+			addUsage(totalUsage, usage)
+		}
+
+		response := &dto.OpenAITextResponse{}
+		if writer.Status() != http.StatusOK || common.Unmarshal(writer.body.Bytes(), response) != nil || len(response.Choices) == 0 {
+			// 无法识别的响应原样返回
+			writer.flushTo(c)
+			return totalUsage, "", nil
+		}
+		lastResponse = response
+		output, err := s.check(response)
+		lastErr = err
+		if err == nil {
+			break
+		}
+		logger.LogWarn(c, fmt.Sprintf("structured output validation failed (attempt %d): %s", attempts+1, err.Error()))
+		followUp = append(followUp,
+			dto.Message{Role: "assistant", Content: output},
+			dto.Message{Role: "user", Content: fmt.Sprintf("Your previous reply is invalid: %s\nReply again with only the corrected JSON.", truncateString(err.Error(), 1000))},
+		)
+	}
+
+	lastResponse.Usage = *totalUsage
+	if s.stream {
+		writeChatCompletionStream(c, info, lastResponse)
+	} else {
+		body, err := common.Marshal(lastResponse)
+		if err != nil {
+			return nil, "", types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+		}
+		c.Writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		c.Data(http.StatusOK, "application/json", body)
+	}
+
+	var extraContent string
+	if lastErr != nil {
+		extraContent = fmt.Sprintf("结构化输出校验失败（请求 %d 次）：%s", attempts, truncateString(lastErr.Error(), 500))
+	} else if attempts > 0 {
+		extraContent = fmt.Sprintf("结构化输出重试 %d 次后通过校验", attempts)
+	}
+	return totalUsage, extraContent, nil
+}
+
+// check 校验并修复每个选项的输出，返回第一个不合格的输出及原因
+func (s *structuredOutput) check(response *dto.OpenAITextResponse) (string, error) {
+	for i := range response.Choices {
+		choice := &response.Choices[i]
+		output, ok := s.extractOutput(choice)
+		if !ok {
+			continue
+		}
+		fixed, err := s.schema.Validate(output)
+		if err != nil {
+			return output, err
+		}
+		choice.Message.SetStringContent(fixed)
+	}
+	return "", nil
+}
+
+// extractOutput 取出选项中的模型输出，tool 模式下将强制调用的工具参数转换为正文；
+// 模型调用了客户端自带的工具时不做校验
+func (s *structuredOutput) extractOutput(choice *dto.OpenAITextResponseChoice) (string, bool) {
+	toolCalls := choice.Message.ParseToolCalls()
+	if s.toolName != "" {
+		for _, call := range toolCalls {
+			if call.Function.Name == s.toolName {
+				choice.Message.ToolCalls = nil
+				choice.Message.SetStringContent(call.Function.Arguments)
+				if choice.FinishReason == "tool_calls" {
+					choice.FinishReason = "stop"
+				}
+				return call.Function.Arguments, true
+			}
+		}
+	} else if len(toolCalls) > 0 {
+		return "", false
+	}
+	return choice.Message.StringContent(), true
+}
+
+// writeChatCompletionStream 将缓存的完整响应以 chat.completion.chunk 的形式返回
+func writeChatCompletionStream(c *gin.Context, info *relaycommon.RelayInfo, response *dto.OpenAITextResponse) {
+	c.Writer.Header().Del("Content-Length")
+	helper.SetEventStreamHeaders(c)
+	created := info.StartTime.Unix()
+	for i, choice := range response.Choices {
+		chunk := helper.GenerateStartEmptyResponse(response.Id, created, response.Model, nil)
+		chunk.Choices[0].Index = choice.Index
+		if i == 0 {
+			chunk.MCPOutput = response.MCPOutput
+		}
+		chunk.Choices[0].Delta.SetContentString(choice.Message.StringContent())
+		if choice.Message.ReasoningContent != "" {
+			chunk.Choices[0].Delta.ReasoningContent = common.GetPointer(choice.Message.ReasoningContent)
+		}
+		for i, call := range choice.Message.ParseToolCalls() {
+			toolCall := dto.ToolCallResponse{
+				ID:   call.ID,
+				Type: call.Type,
+				Function: dto.FunctionResponse{
+					Name:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+				},
+			}
+			toolCall.SetIndex(i)
+			chunk.Choices[0].Delta.ToolCalls = append(chunk.Choices[0].Delta.ToolCalls, toolCall)
+		}
+		_ = helper.ObjectData(c, chunk)
+
+		stop := helper.GenerateStopResponse(response.Id, created, response.Model, common.GetStringIfEmpty(choice.FinishReason, "stop"))
+		stop.Choices[0].Index = choice.Index
+		_ = helper.ObjectData(c, stop)
+	}
+	if info.ShouldIncludeUsage {
+		_ = helper.ObjectData(c, helper.GenerateFinalUsageResponse(response.Id, created, response.Model, response.Usage))
+	}
+	helper.Done(c)
+}
+
+func addUsage(total *dto.Usage, usage *dto.Usage) {
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
+	total.PromptTokensDetails.CachedTokens += usage.PromptTokensDetails.CachedTokens
+	total.PromptTokensDetails.CachedCreationTokens += usage.PromptTokensDetails.CachedCreationTokens
+	total.PromptTokensDetails.TextTokens += usage.PromptTokensDetails.TextTokens
+	total.PromptTokensDetails.AudioTokens += usage.PromptTokensDetails.AudioTokens
+	total.PromptTokensDetails.ImageTokens += usage.PromptTokensDetails.ImageTokens
+	total.CompletionTokenDetails.TextTokens += usage.CompletionTokenDetails.TextTokens
+	total.CompletionTokenDetails.AudioTokens += usage.CompletionTokenDetails.AudioTokens
+	total.CompletionTokenDetails.ReasoningTokens += usage.CompletionTokenDetails.ReasoningTokens
+}
+
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// bufferedResponseWriter 缓存 adaptor 写回的响应，校验通过后再返回客户端
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedResponseWriter) WriteHeaderNow() {}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *bufferedResponseWriter) Written() bool {
+	return w.status != 0 || w.body.Len() > 0
+}
+
+func (w *bufferedResponseWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedResponseWriter) Flush() {}
+
+// flushTo 将缓存的响应原样写给客户端
+func (w *bufferedResponseWriter) flushTo(c *gin.Context) {
+	if !w.Written() {
+		return
+	}
+	c.Writer.Header().Set("Content-Length", strconv.Itoa(w.body.Len()))
+	c.Writer.WriteHeader(w.Status())
+	_, _ = c.Writer.Write(w.body.Bytes())
+}
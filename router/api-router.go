@@ -1,6 +1,7 @@
 package router
 
 import (
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/controller"
 	"github.com/QuantumNous/new-api/middleware"
 
@@ -17,8 +18,8 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.POST("/setup", controller.PostSetup)
 		apiRouter.GET("/status", controller.GetStatus)
 		apiRouter.GET("/uptime/status", controller.GetUptimeKumaStatus)
-		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
-		apiRouter.GET("/status/test", middleware.AdminAuth(), controller.TestStatus)
+		apiRouter.GET("/models", middleware.PermissionAuth(common.PermissionSelfManage), controller.DashboardListModels)
+		apiRouter.GET("/status/test", middleware.PermissionAuth(common.PermissionChannelRead), controller.TestStatus)
 		apiRouter.GET("/notice", controller.GetNotice)
 		apiRouter.GET("/user-agreement", controller.GetUserAgreement)
 		apiRouter.GET("/privacy-policy", controller.GetPrivacyPolicy)
@@ -45,14 +46,15 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.POST("/creem/webhook", controller.CreemWebhook)
 
 		// Universal secure verification routes
-		apiRouter.POST("/verify", middleware.UserAuth(), middleware.CriticalRateLimit(), controller.UniversalVerify)
-		apiRouter.GET("/verify/status", middleware.UserAuth(), controller.GetVerificationStatus)
+		apiRouter.POST("/verify", middleware.PermissionAuth(common.PermissionSelfManage), middleware.CriticalRateLimit(), controller.UniversalVerify)
+		apiRouter.GET("/verify/status", middleware.PermissionAuth(common.PermissionSelfManage), controller.GetVerificationStatus)
 
 		userRoute := apiRouter.Group("/user")
 		{
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Login)
 			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), controller.Verify2FALogin)
+			userRoute.POST("/ldap/login", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.LdapLogin)
 			userRoute.POST("/passkey/login/begin", middleware.CriticalRateLimit(), controller.PasskeyLoginBegin)
 			userRoute.POST("/passkey/login/finish", middleware.CriticalRateLimit(), controller.PasskeyLoginFinish)
 			//userRoute.POST("/tokenlog", middleware.CriticalRateLimit(), controller.TokenLog)
@@ -61,14 +63,22 @@ func SetApiRouter(router *gin.Engine) {
 			userRoute.GET("/groups", controller.GetUserGroups)
 
 			selfRoute := userRoute.Group("/")
-			selfRoute.Use(middleware.UserAuth())
+			selfRoute.Use(middleware.PermissionAuth(common.PermissionSelfManage))
 			{
 				selfRoute.GET("/self/groups", controller.GetUserGroups)
 				selfRoute.GET("/self", controller.GetSelf)
+				selfRoute.GET("/self/permissions", controller.GetSelfPermissions)
 				selfRoute.GET("/models", controller.GetUserModels)
 				selfRoute.PUT("/self", controller.UpdateSelf)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
 				selfRoute.GET("/token", controller.GenerateAccessToken)
+				selfRoute.GET("/sessions", controller.GetSelfSessions)
+				selfRoute.DELETE("/sessions", controller.RevokeSelfOtherSessions)
+				selfRoute.DELETE("/sessions/:id", controller.RevokeSelfSession)
+				selfRoute.GET("/access_keys", controller.GetAccessKeys)
+				selfRoute.POST("/access_keys", controller.AddAccessKey)
+				selfRoute.PUT("/access_keys", controller.UpdateAccessKey)
+				selfRoute.DELETE("/access_keys/:id", controller.DeleteAccessKey)
 				selfRoute.GET("/passkey", controller.PasskeyStatus)
 				selfRoute.POST("/passkey/register/begin", controller.PasskeyRegisterBegin)
 				selfRoute.POST("/passkey/register/finish", controller.PasskeyRegisterFinish)
@@ -76,6 +86,8 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/passkey/verify/finish", controller.PasskeyVerifyFinish)
 				selfRoute.DELETE("/passkey", controller.PasskeyDelete)
 				selfRoute.GET("/aff", controller.GetAffCode)
+				selfRoute.GET("/aff/report", controller.GetAffiliateReport)
+				selfRoute.GET("/aff/commissions", controller.GetAffiliateCommissions)
 				selfRoute.GET("/topup/info", controller.GetTopUpInfo)
 				selfRoute.GET("/topup/self", controller.GetUserTopUps)
 				selfRoute.POST("/topup", middleware.CriticalRateLimit(), controller.TopUp)
@@ -96,69 +108,72 @@ func SetApiRouter(router *gin.Engine) {
 			}
 
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
 			{
-				adminRoute.GET("/", controller.GetAllUsers)
-				adminRoute.GET("/topup", controller.GetAllTopUps)
-				adminRoute.POST("/topup/complete", controller.AdminCompleteTopUp)
-				adminRoute.GET("/search", controller.SearchUsers)
-				adminRoute.GET("/:id", controller.GetUser)
-				adminRoute.POST("/", controller.CreateUser)
-				adminRoute.POST("/manage", controller.ManageUser)
-				adminRoute.PUT("/", controller.UpdateUser)
-				adminRoute.DELETE("/:id", controller.DeleteUser)
-				adminRoute.DELETE("/:id/reset_passkey", controller.AdminResetPasskey)
+				adminRoute.GET("/", middleware.PermissionAuth(common.PermissionUserRead), controller.GetAllUsers)
+				adminRoute.GET("/topup", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetAllTopUps)
+				adminRoute.POST("/topup/complete", middleware.PermissionAuth(common.PermissionBillingManage), controller.AdminCompleteTopUp)
+				adminRoute.POST("/topup/refund", middleware.PermissionAuth(common.PermissionBillingManage), controller.AdminRefundTopUp)
+				adminRoute.GET("/search", middleware.PermissionAuth(common.PermissionUserRead), controller.SearchUsers)
+				adminRoute.GET("/:id", middleware.PermissionAuth(common.PermissionUserRead), controller.GetUser)
+				adminRoute.POST("/", middleware.PermissionAuth(common.PermissionUserManage), controller.CreateUser)
+				adminRoute.POST("/manage", middleware.PermissionAuth(common.PermissionUserManage), controller.ManageUser)
+				adminRoute.PUT("/", middleware.PermissionAuth(common.PermissionUserManage), controller.UpdateUser)
+				adminRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionUserManage), controller.DeleteUser)
+				adminRoute.DELETE("/:id/reset_passkey", middleware.PermissionAuth(common.PermissionUserManage), controller.AdminResetPasskey)
+				adminRoute.GET("/:id/sessions", middleware.PermissionAuth(common.PermissionUserRead), controller.GetUserSessions)
+				adminRoute.DELETE("/:id/sessions", middleware.PermissionAuth(common.PermissionUserManage), controller.RevokeUserSessions)
+				adminRoute.DELETE("/:id/sessions/:session_id", middleware.PermissionAuth(common.PermissionUserManage), controller.RevokeUserSession)
+				adminRoute.GET("/:id/roles", middleware.PermissionAuth(common.PermissionRoleManage), controller.GetUserPermissionRoles)
+				adminRoute.PUT("/:id/roles", middleware.PermissionAuth(common.PermissionRoleManage), controller.UpdateUserPermissionRoles)
 
 				// Admin 2FA routes
-				adminRoute.GET("/2fa/stats", controller.Admin2FAStats)
-				adminRoute.DELETE("/:id/2fa", controller.AdminDisable2FA)
+				adminRoute.GET("/2fa/stats", middleware.PermissionAuth(common.PermissionUserRead), controller.Admin2FAStats)
+				adminRoute.DELETE("/:id/2fa", middleware.PermissionAuth(common.PermissionUserManage), controller.AdminDisable2FA)
 			}
 		}
 		optionRoute := apiRouter.Group("/option")
-		optionRoute.Use(middleware.RootAuth())
 		{
-			optionRoute.GET("/", controller.GetOptions)
-			optionRoute.PUT("/", controller.UpdateOption)
-			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
-			optionRoute.POST("/migrate_console_setting", controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
+			optionRoute.GET("/", middleware.PermissionAuth(common.PermissionOptionRead), controller.GetOptions)
+			optionRoute.PUT("/", middleware.PermissionAuth(common.PermissionOptionWrite), controller.UpdateOption)
+			optionRoute.POST("/rest_model_ratio", middleware.PermissionAuth(common.PermissionOptionWrite), controller.ResetModelRatio)
+			optionRoute.POST("/migrate_console_setting", middleware.PermissionAuth(common.PermissionOptionWrite), controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
 		}
 		ratioSyncRoute := apiRouter.Group("/ratio_sync")
-		ratioSyncRoute.Use(middleware.RootAuth())
+		ratioSyncRoute.Use(middleware.PermissionAuth(common.PermissionOptionWrite))
 		{
 			ratioSyncRoute.GET("/channels", controller.GetSyncableChannels)
 			ratioSyncRoute.POST("/fetch", controller.FetchUpstreamRatios)
 		}
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
 		{
-			channelRoute.GET("/", controller.GetAllChannels)
-			channelRoute.GET("/search", controller.SearchChannels)
-			channelRoute.GET("/models", controller.ChannelListModels)
-			channelRoute.GET("/models_enabled", controller.EnabledListModels)
-			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.POST("/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
-			channelRoute.GET("/test", controller.TestAllChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.POST("/tag/disabled", controller.DisableTagChannels)
-			channelRoute.POST("/tag/enabled", controller.EnableTagChannels)
-			channelRoute.PUT("/tag", controller.EditTagChannels)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
-			channelRoute.POST("/batch", controller.DeleteChannelBatch)
-			channelRoute.POST("/fix", controller.FixChannelsAbilities)
-			channelRoute.GET("/fetch_models/:id", controller.FetchUpstreamModels)
-			channelRoute.POST("/fetch_models", controller.FetchModels)
-			channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
-			channelRoute.GET("/tag/models", controller.GetTagModels)
-			channelRoute.POST("/copy/:id", controller.CopyChannel)
-			channelRoute.POST("/multi_key/manage", controller.ManageMultiKeys)
+			channelRoute.GET("/", middleware.PermissionAuth(common.PermissionChannelRead), controller.GetAllChannels)
+			channelRoute.GET("/search", middleware.PermissionAuth(common.PermissionChannelRead), controller.SearchChannels)
+			channelRoute.GET("/models", middleware.PermissionAuth(common.PermissionChannelRead), controller.ChannelListModels)
+			channelRoute.GET("/models_enabled", middleware.PermissionAuth(common.PermissionChannelRead), controller.EnabledListModels)
+			channelRoute.GET("/:id", middleware.PermissionAuth(common.PermissionChannelRead), controller.GetChannel)
+			channelRoute.POST("/:id/key", middleware.PermissionAuth(common.PermissionChannelKeyReveal), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
+			channelRoute.GET("/test", middleware.PermissionAuth(common.PermissionChannelRead), controller.TestAllChannels)
+			channelRoute.GET("/test/:id", middleware.PermissionAuth(common.PermissionChannelRead), controller.TestChannel)
+			channelRoute.GET("/update_balance", middleware.PermissionAuth(common.PermissionChannelRead), controller.UpdateAllChannelsBalance)
+			channelRoute.GET("/update_balance/:id", middleware.PermissionAuth(common.PermissionChannelRead), controller.UpdateChannelBalance)
+			channelRoute.POST("/", middleware.PermissionAuth(common.PermissionChannelWrite), controller.AddChannel)
+			channelRoute.PUT("/", middleware.PermissionAuth(common.PermissionChannelWrite), controller.UpdateChannel)
+			channelRoute.DELETE("/disabled", middleware.PermissionAuth(common.PermissionChannelWrite), controller.DeleteDisabledChannel)
+			channelRoute.POST("/tag/disabled", middleware.PermissionAuth(common.PermissionChannelWrite), controller.DisableTagChannels)
+			channelRoute.POST("/tag/enabled", middleware.PermissionAuth(common.PermissionChannelWrite), controller.EnableTagChannels)
+			channelRoute.PUT("/tag", middleware.PermissionAuth(common.PermissionChannelWrite), controller.EditTagChannels)
+			channelRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionChannelWrite), controller.DeleteChannel)
+			channelRoute.POST("/batch", middleware.PermissionAuth(common.PermissionChannelWrite), controller.DeleteChannelBatch)
+			channelRoute.POST("/fix", middleware.PermissionAuth(common.PermissionChannelWrite), controller.FixChannelsAbilities)
+			channelRoute.GET("/fetch_models/:id", middleware.PermissionAuth(common.PermissionChannelRead), controller.FetchUpstreamModels)
+			channelRoute.POST("/fetch_models", middleware.PermissionAuth(common.PermissionChannelWrite), controller.FetchModels)
+			channelRoute.POST("/batch/tag", middleware.PermissionAuth(common.PermissionChannelWrite), controller.BatchSetChannelTag)
+			channelRoute.GET("/tag/models", middleware.PermissionAuth(common.PermissionChannelRead), controller.GetTagModels)
+			channelRoute.POST("/copy/:id", middleware.PermissionAuth(common.PermissionChannelWrite), controller.CopyChannel)
+			channelRoute.POST("/multi_key/manage", middleware.PermissionAuth(common.PermissionChannelWrite), controller.ManageMultiKeys)
 		}
 		tokenRoute := apiRouter.Group("/token")
-		tokenRoute.Use(middleware.UserAuth())
+		tokenRoute.Use(middleware.PermissionAuth(common.PermissionTokenManage))
 		{
 			tokenRoute.GET("/", controller.GetAllTokens)
 			tokenRoute.GET("/search", controller.SearchTokens)
@@ -180,7 +195,7 @@ func SetApiRouter(router *gin.Engine) {
 		}
 
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
+		redemptionRoute.Use(middleware.PermissionAuth(common.PermissionBillingManage))
 		{
 			redemptionRoute.GET("/", controller.GetAllRedemptions)
 			redemptionRoute.GET("/search", controller.SearchRedemptions)
@@ -191,49 +206,92 @@ func SetApiRouter(router *gin.Engine) {
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
 		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
-		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
-		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
-		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		logRoute.GET("/", middleware.PermissionAuth(common.PermissionLogReadAll), controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.PermissionAuth(common.PermissionLogDelete), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", middleware.PermissionAuth(common.PermissionLogReadAll), controller.GetLogsStat)
+		logRoute.GET("/self/stat", middleware.PermissionAuth(common.PermissionLogReadSelf), controller.GetLogsSelfStat)
+		logRoute.GET("/search", middleware.PermissionAuth(common.PermissionLogReadAll), controller.SearchAllLogs)
+		logRoute.GET("/self", middleware.PermissionAuth(common.PermissionLogReadSelf), controller.GetUserLogs)
+		logRoute.GET("/self/search", middleware.PermissionAuth(common.PermissionLogReadSelf), controller.SearchUserLogs)
 
 		dataRoute := apiRouter.Group("/data")
-		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
-		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
+		dataRoute.GET("/", middleware.PermissionAuth(common.PermissionLogReadAll), controller.GetAllQuotaDates)
+		dataRoute.GET("/self", middleware.PermissionAuth(common.PermissionLogReadSelf), controller.GetUserQuotaDates)
 
 		logRoute.Use(middleware.CORS())
 		{
 			logRoute.GET("/token", controller.GetLogByKey)
 		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		groupRoute.Use(middleware.PermissionAuth(common.PermissionChannelRead))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
 
 		prefillGroupRoute := apiRouter.Group("/prefill_group")
-		prefillGroupRoute.Use(middleware.AdminAuth())
 		{
-			prefillGroupRoute.GET("/", controller.GetPrefillGroups)
-			prefillGroupRoute.POST("/", controller.CreatePrefillGroup)
-			prefillGroupRoute.PUT("/", controller.UpdatePrefillGroup)
-			prefillGroupRoute.DELETE("/:id", controller.DeletePrefillGroup)
+			prefillGroupRoute.GET("/", middleware.PermissionAuth(common.PermissionChannelRead), controller.GetPrefillGroups)
+			prefillGroupRoute.POST("/", middleware.PermissionAuth(common.PermissionModelManage), controller.CreatePrefillGroup)
+			prefillGroupRoute.PUT("/", middleware.PermissionAuth(common.PermissionModelManage), controller.UpdatePrefillGroup)
+			prefillGroupRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionModelManage), controller.DeletePrefillGroup)
+		}
+
+		invoiceRoute := apiRouter.Group("/invoice")
+		{
+			invoiceRoute.GET("/self", middleware.PermissionAuth(common.PermissionSelfManage), controller.GetUserInvoices)
+			invoiceRoute.GET("/self/:id/export", middleware.PermissionAuth(common.PermissionSelfManage), controller.ExportUserInvoice)
+			invoiceRoute.GET("/", middleware.PermissionAuth(common.PermissionBillingManage), controller.GetAllInvoices)
+			invoiceRoute.POST("/generate", middleware.PermissionAuth(common.PermissionBillingManage), controller.GenerateInvoice)
+			invoiceRoute.PUT("/status", middleware.PermissionAuth(common.PermissionBillingManage), controller.UpdateInvoiceStatus)
+			invoiceRoute.GET("/:id/export", middleware.PermissionAuth(common.PermissionBillingManage), controller.ExportInvoice)
+		}
+
+		webhookRoute := apiRouter.Group("/webhook")
+		webhookRoute.Use(middleware.PermissionAuth(common.PermissionSelfManage))
+		{
+			webhookRoute.GET("/event_types", controller.GetWebhookEventTypes)
+			webhookRoute.GET("/subscription", controller.GetWebhookSubscriptions)
+			webhookRoute.POST("/subscription", controller.AddWebhookSubscription)
+			webhookRoute.PUT("/subscription", controller.UpdateWebhookSubscription)
+			webhookRoute.DELETE("/subscription/:id", controller.DeleteWebhookSubscription)
+			webhookRoute.GET("/delivery", controller.GetWebhookDeliveries)
+			webhookRoute.POST("/delivery/:id/redeliver", controller.RedeliverWebhook)
+		}
+
+		artifactRoute := apiRouter.Group("/artifact")
+		artifactRoute.Use(middleware.PermissionAuth(common.PermissionSelfManage))
+		{
+			artifactRoute.GET("/", controller.GetUserArtifacts)
+			artifactRoute.GET("/usage", controller.GetUserArtifactUsage)
+		}
+
+		resellerRoute := apiRouter.Group("/reseller")
+		resellerRoute.Use(middleware.PermissionAuth(common.PermissionResellerManage))
+		{
+			resellerRoute.GET("/stat", controller.GetResellerStat)
+			resellerRoute.PUT("/markup", controller.UpdateResellerMarkup)
+			resellerRoute.GET("/user", controller.GetResellerSubUsers)
+			resellerRoute.GET("/user/:id", controller.GetResellerSubUser)
+			resellerRoute.POST("/user", controller.CreateResellerSubUser)
+			resellerRoute.PUT("/user", controller.UpdateResellerSubUser)
+			resellerRoute.GET("/log", controller.GetResellerLogs)
 		}
 
 		mjRoute := apiRouter.Group("/mj")
-		mjRoute.GET("/self", middleware.UserAuth(), controller.GetUserMidjourney)
-		mjRoute.GET("/", middleware.AdminAuth(), controller.GetAllMidjourney)
+		mjRoute.GET("/self", middleware.PermissionAuth(common.PermissionLogReadSelf), controller.GetUserMidjourney)
+		mjRoute.GET("/", middleware.PermissionAuth(common.PermissionLogReadAll), controller.GetAllMidjourney)
+		mjRoute.POST("/:id/fail", middleware.PermissionAuth(common.PermissionTaskManage), controller.ForceFailMidjourney)
 
 		taskRoute := apiRouter.Group("/task")
 		{
-			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
-			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+			taskRoute.GET("/self", middleware.PermissionAuth(common.PermissionLogReadSelf), controller.GetUserTask)
+			taskRoute.GET("/", middleware.PermissionAuth(common.PermissionLogReadAll), controller.GetAllTask)
+			taskRoute.POST("/:id/fail", middleware.PermissionAuth(common.PermissionTaskManage), controller.ForceFailTask)
+			taskRoute.POST("/:id/refund", middleware.PermissionAuth(common.PermissionTaskManage), controller.ForceRefundTask)
 		}
 
 		vendorRoute := apiRouter.Group("/vendors")
-		vendorRoute.Use(middleware.AdminAuth())
+		vendorRoute.Use(middleware.PermissionAuth(common.PermissionModelManage))
 		{
 			vendorRoute.GET("/", controller.GetAllVendors)
 			vendorRoute.GET("/search", controller.SearchVendors)
@@ -244,7 +302,7 @@ func SetApiRouter(router *gin.Engine) {
 		}
 
 		modelsRoute := apiRouter.Group("/models")
-		modelsRoute.Use(middleware.AdminAuth())
+		modelsRoute.Use(middleware.PermissionAuth(common.PermissionModelManage))
 		{
 			modelsRoute.GET("/sync_upstream/preview", controller.SyncUpstreamPreview)
 			modelsRoute.POST("/sync_upstream", controller.SyncUpstreamModels)
@@ -256,5 +314,19 @@ func SetApiRouter(router *gin.Engine) {
 			modelsRoute.PUT("/", controller.UpdateModelMeta)
 			modelsRoute.DELETE("/:id", controller.DeleteModelMeta)
 		}
+
+		permissionRoute := apiRouter.Group("/permission")
+		permissionRoute.Use(middleware.PermissionAuth(common.PermissionRoleManage))
+		{
+			permissionRoute.GET("/", controller.GetPermissions)
+		}
+		roleRoute := apiRouter.Group("/role")
+		roleRoute.Use(middleware.PermissionAuth(common.PermissionRoleManage))
+		{
+			roleRoute.GET("/", controller.GetPermissionRoles)
+			roleRoute.POST("/", controller.CreatePermissionRole)
+			roleRoute.PUT("/", controller.UpdatePermissionRole)
+			roleRoute.DELETE("/:id", controller.DeletePermissionRole)
+		}
 	}
 }
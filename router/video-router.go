@@ -22,6 +22,19 @@ func SetVideoRouter(router *gin.Engine) {
 		videoV1Router.GET("/videos/:task_id", controller.RelayTask)
 	}
 
+	// 取消任务只查询本地任务记录，无需分发渠道
+	taskCancelRouter := router.Group("")
+	taskCancelRouter.Use(middleware.TokenAuth())
+	{
+		taskCancelRouter.DELETE("/v1/videos/:task_id", controller.CancelTask)
+		taskCancelRouter.DELETE("/v1/video/generations/:task_id", controller.CancelTask)
+		taskCancelRouter.DELETE("/kling/v1/videos/text2video/:task_id", controller.CancelTask)
+		taskCancelRouter.DELETE("/kling/v1/videos/image2video/:task_id", controller.CancelTask)
+	}
+
+	// 转存的生成结果通过签名地址访问，无需令牌
+	router.GET("/v1/artifacts/:key", controller.GetArtifactContent)
+
 	klingV1Router := router.Group("/kling/v1")
 	klingV1Router.Use(middleware.KlingRequestConvert(), middleware.TokenAuth(), middleware.Distribute())
 	{
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const artifactDownloadTimeout = 5 * time.Minute
+
+// MirrorArtifactRequest 转存请求
+type MirrorArtifactRequest struct {
+	UserId  int
+	Source  string
+	TaskId  string
+	Url     string
+	Headers map[string]string
+	Client  *http.Client // 为空时使用默认客户端
+	Trusted bool         // 地址由渠道配置生成（如带鉴权的上游内容接口），跳过 SSRF 检查
+}
+
+// IsArtifactStorageEnabled 是否开启转存
+func IsArtifactStorageEnabled() bool {
+	return operation_setting.GetArtifactSetting().Enabled
+}
+
+// MirrorArtifact 下载上游生成结果并写入存储，按配置计费
+func MirrorArtifact(req MirrorArtifactRequest) (*model.Artifact, error) {
+	setting := operation_setting.GetArtifactSetting()
+	if !setting.Enabled {
+		return nil, errors.New("artifact storage is disabled")
+	}
+	if req.Url == "" {
+		return nil, errors.New("artifact url is empty")
+	}
+	if setting.UserQuotaMB > 0 {
+		usage, err := model.GetUserArtifactUsage(req.UserId)
+		if err != nil {
+			return nil, err
+		}
+		if usage.Size >= int64(setting.UserQuotaMB)<<20 {
+			return nil, errors.New("user artifact storage quota exceeded")
+		}
+	}
+	if !req.Trusted {
+		fetchSetting := system_setting.GetFetchSetting()
+		if err := common.ValidateURLWithFetchSetting(req.Url, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+			return nil, fmt.Errorf("request reject: %v", err)
+		}
+	}
+	store, err := GetArtifactStore()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), artifactDownloadTimeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, req.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	client := req.Client
+	if client == nil {
+		client = GetHttpClient()
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download artifact failed with status %d", resp.StatusCode)
+	}
+	maxSize := int64(setting.MaxFileSizeMB) << 20
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return nil, errors.New("artifact is too large")
+	}
+
+	// 先落到临时文件，得到准确大小后再写入存储
+	tmp, err := os.CreateTemp("", "artifact-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	var reader io.Reader = resp.Body
+	if maxSize > 0 {
+		reader = io.LimitReader(resp.Body, maxSize+1)
+	}
+	size, err := io.Copy(tmp, reader)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && size > maxSize {
+		return nil, errors.New("artifact is too large")
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(tmp, head)
+		contentType = http.DetectContentType(head[:n])
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	key := common.GetUUID()
+	storageKey := fmt.Sprintf("%d/%s/%s%s", req.UserId, now.Format("20060102"), key, artifactExtension(contentType))
+	if store.Name() == operation_setting.ArtifactBackendS3 && setting.S3Prefix != "" {
+		storageKey = path.Join(setting.S3Prefix, storageKey)
+	}
+	if err = store.Put(ctx, storageKey, contentType, tmp, size); err != nil {
+		return nil, err
+	}
+
+	artifact := &model.Artifact{
+		Key:         key,
+		UserId:      req.UserId,
+		Source:      req.Source,
+		TaskId:      req.TaskId,
+		Backend:     store.Name(),
+		StorageKey:  storageKey,
+		ContentType: contentType,
+		Size:        size,
+		OriginUrl:   req.Url,
+		CreatedTime: now.Unix(),
+	}
+	if setting.RetentionDays > 0 {
+		artifact.ExpiresTime = now.AddDate(0, 0, setting.RetentionDays).Unix()
+	}
+	if setting.BillingEnabled && setting.PricePerGB > 0 {
+		artifact.Quota = int(float64(size) / (1 << 30) * setting.PricePerGB * common.QuotaPerUnit)
+	}
+	if err = artifact.Insert(); err != nil {
+		_ = store.Delete(context.Background(), storageKey)
+		return nil, err
+	}
+	if artifact.Quota > 0 {
+		if err := model.DecreaseUserQuota(artifact.UserId, artifact.Quota); err != nil {
+			common.SysError(fmt.Sprintf("failed to charge artifact storage of user %d: %s", artifact.UserId, err.Error()))
+		} else {
+			model.RecordLog(artifact.UserId, model.LogTypeSystem, fmt.Sprintf("生成结果转存 %.2f MB，扣除存储费用 %s", float64(size)/(1<<20), logger.LogQuota(artifact.Quota)))
+		}
+	}
+	return artifact, nil
+}
+
+func artifactExtension(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch mediaType {
+	case "video/mp4":
+		return ".mp4"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	case "audio/mpeg":
+		return ".mp3"
+	}
+	exts, _ := mime.ExtensionsByType(mediaType)
+	if len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+func artifactSignature(key string, expires int64) string {
+	return common.GenerateHMAC(key + ":" + strconv.FormatInt(expires, 10))
+}
+
+// SignArtifactUrl 生成带有效期的网关访问地址
+func SignArtifactUrl(artifact *model.Artifact) string {
+	expireSeconds := operation_setting.GetArtifactSetting().UrlExpireSeconds
+	if expireSeconds <= 0 {
+		expireSeconds = 3600
+	}
+	expires := time.Now().Unix() + int64(expireSeconds)
+	return fmt.Sprintf("%s/v1/artifacts/%s?expires=%d&signature=%s",
+		system_setting.ServerAddress, artifact.Key, expires, artifactSignature(artifact.Key, expires))
+}
+
+// VerifyArtifactSignature 校验签名及有效期
+func VerifyArtifactSignature(key string, expiresStr string, signature string) bool {
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil || expires < time.Now().Unix() {
+		return false
+	}
+	return hmac.Equal([]byte(artifactSignature(key, expires)), []byte(signature))
+}
+
+// OpenArtifact 从对应的存储后端读取内容
+func OpenArtifact(ctx context.Context, artifact *model.Artifact) (io.ReadCloser, error) {
+	store, err := getArtifactStoreByName(artifact.Backend)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(ctx, artifact.StorageKey)
+}
+
+// MirrorImageResponse 异步转存图片接口返回的 url，不阻塞本次请求：响应中保留上游地址，
+// 转存完成后可在生成结果列表中获取网关签名地址
+func MirrorImageResponse(userId int, body []byte) {
+	var resp struct {
+		Data []struct {
+			Url string `json:"url"`
+		} `json:"data"`
+	}
+	if err := common.Unmarshal(body, &resp); err != nil {
+		return
+	}
+	for _, item := range resp.Data {
+		if item.Url == "" {
+			continue
+		}
+		imageUrl := item.Url
+		gopool.Go(func() {
+			_, err := MirrorArtifact(MirrorArtifactRequest{
+				UserId: userId,
+				Source: model.ArtifactSourceImage,
+				Url:    imageUrl,
+			})
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to mirror image for user %d: %s", userId, err.Error()))
+			}
+		})
+	}
+}
+
+// CleanupExpiredArtifacts 删除超过保留期的转存文件
+func CleanupExpiredArtifacts() {
+	for {
+		artifacts, err := model.GetExpiredArtifacts(time.Now().Unix(), 100)
+		if err != nil {
+			common.SysError("failed to get expired artifacts: " + err.Error())
+			return
+		}
+		if len(artifacts) == 0 {
+			return
+		}
+		for _, artifact := range artifacts {
+			store, err := getArtifactStoreByName(artifact.Backend)
+			if err == nil {
+				err = store.Delete(context.Background(), artifact.StorageKey)
+			}
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to delete artifact %s: %s", artifact.Key, err.Error()))
+			}
+			// 存储删除失败也移除记录，避免反复重试同一批数据
+			if err := model.DeleteArtifactById(artifact.Id); err != nil {
+				common.SysError(fmt.Sprintf("failed to delete artifact record %d: %s", artifact.Id, err.Error()))
+				return
+			}
+		}
+		common.SysLog(fmt.Sprintf("cleaned up %d expired artifacts", len(artifacts)))
+	}
+}
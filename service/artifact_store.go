@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// ArtifactStore 生成结果的持久化存储
+type ArtifactStore interface {
+	Name() string
+	Put(ctx context.Context, key string, contentType string, body io.ReadSeeker, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// GetArtifactStore 按当前配置返回存储后端
+func GetArtifactStore() (ArtifactStore, error) {
+	return getArtifactStoreByName(operation_setting.GetArtifactSetting().Backend)
+}
+
+func getArtifactStoreByName(name string) (ArtifactStore, error) {
+	setting := operation_setting.GetArtifactSetting()
+	switch name {
+	case operation_setting.ArtifactBackendS3:
+		if setting.S3Endpoint == "" || setting.S3Bucket == "" {
+			return nil, errors.New("s3 artifact store is not configured")
+		}
+		return &s3ArtifactStore{
+			endpoint:        strings.TrimRight(setting.S3Endpoint, "/"),
+			region:          setting.S3Region,
+			bucket:          setting.S3Bucket,
+			accessKeyId:     setting.S3AccessKeyId,
+			secretAccessKey: setting.S3SecretAccessKey,
+			pathStyle:       setting.S3PathStyle,
+		}, nil
+	case operation_setting.ArtifactBackendLocal, "":
+		root := setting.LocalPath
+		if root == "" {
+			root = "data/artifacts"
+		}
+		return &localArtifactStore{root: root}, nil
+	}
+	return nil, fmt.Errorf("unknown artifact backend: %s", name)
+}
+
+type localArtifactStore struct {
+	root string
+}
+
+func (s *localArtifactStore) Name() string {
+	return operation_setting.ArtifactBackendLocal
+}
+
+// path 将对象键映射到存储目录下，拒绝越出目录的键
+func (s *localArtifactStore) path(key string) (string, error) {
+	p := filepath.Join(s.root, filepath.FromSlash(key))
+	rel, err := filepath.Rel(s.root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("invalid artifact key")
+	}
+	return p, nil
+}
+
+func (s *localArtifactStore) Put(ctx context.Context, key string, contentType string, body io.ReadSeeker, size int64) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, body); err != nil {
+		f.Close()
+		_ = os.Remove(p)
+		return err
+	}
+	return f.Close()
+}
+
+func (s *localArtifactStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (s *localArtifactStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// s3ArtifactStore 基于 SigV4 签名的 S3 兼容存储，支持 AWS S3、MinIO、R2 等
+type s3ArtifactStore struct {
+	endpoint        string
+	region          string
+	bucket          string
+	accessKeyId     string
+	secretAccessKey string
+	pathStyle       bool
+}
+
+func (s *s3ArtifactStore) Name() string {
+	return operation_setting.ArtifactBackendS3
+}
+
+func (s *s3ArtifactStore) objectUrl(key string) (string, error) {
+	u, err := url.Parse(s.endpoint)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid s3 endpoint: %s", s.endpoint)
+	}
+	escapedKey := (&url.URL{Path: key}).EscapedPath()
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + escapedKey
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + escapedKey
+	}
+	u.RawPath = u.Path
+	return u.String(), nil
+}
+
+func (s *s3ArtifactStore) do(ctx context.Context, method string, key string, contentType string, body io.ReadSeeker, size int64) (*http.Response, error) {
+	objectUrl, err := s.objectUrl(key)
+	if err != nil {
+		return nil, err
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = body
+	}
+	req, err := http.NewRequestWithContext(ctx, method, objectUrl, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", contentType)
+	}
+	payloadHash := "UNSIGNED-PAYLOAD"
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	region := s.region
+	if region == "" {
+		region = "us-east-1"
+	}
+	credentials := aws.Credentials{AccessKeyID: s.accessKeyId, SecretAccessKey: s.secretAccessKey}
+	if err = v4.NewSigner().SignHTTP(ctx, credentials, req, payloadHash, "s3", region, time.Now()); err != nil {
+		return nil, err
+	}
+	return GetHttpClient().Do(req)
+}
+
+func (s *s3ArtifactStore) Put(ctx context.Context, key string, contentType string, body io.ReadSeeker, size int64) error {
+	resp, err := s.do(ctx, http.MethodPut, key, contentType, body, size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3 put object failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+func (s *s3ArtifactStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, "", nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 get object failed with status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func (s *s3ArtifactStore) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, "", nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("s3 delete object failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
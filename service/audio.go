@@ -2,6 +2,7 @@ package service
 
 import (
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
 	"strings"
 )
@@ -46,3 +47,143 @@ func DecodeBase64AudioData(audioBase64 string) (string, error) {
 
 	return audioBase64, nil
 }
+
+// RealtimePCM16SampleRate OpenAI Realtime pcm16 格式的采样率
+const RealtimePCM16SampleRate = 24000
+
+// DecodeRealtimeAudio 将 OpenAI Realtime 音频（pcm16、g711_ulaw、g711_alaw）解码为 16 位小端 PCM，返回采样率
+func DecodeRealtimeAudio(audio []byte, format string) ([]byte, int, error) {
+	switch format {
+	case "", "pcm16":
+		return audio, RealtimePCM16SampleRate, nil
+	case "g711_ulaw":
+		return decodeG711(audio, ulawToLinear), 8000, nil
+	case "g711_alaw":
+		return decodeG711(audio, alawToLinear), 8000, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported audio format: %s", format)
+}
+
+// EncodeRealtimeAudio 将 16 位小端 PCM 编码为 OpenAI Realtime 音频格式，必要时重采样
+func EncodeRealtimeAudio(pcm []byte, sampleRate int, format string) ([]byte, error) {
+	switch format {
+	case "", "pcm16":
+		return ResamplePCM16(pcm, sampleRate, RealtimePCM16SampleRate), nil
+	case "g711_ulaw":
+		return encodeG711(ResamplePCM16(pcm, sampleRate, 8000), linearToUlaw), nil
+	case "g711_alaw":
+		return encodeG711(ResamplePCM16(pcm, sampleRate, 8000), linearToAlaw), nil
+	}
+	return nil, fmt.Errorf("unsupported audio format: %s", format)
+}
+
+// ResamplePCM16 对单声道 16 位小端 PCM 做线性插值重采样
+func ResamplePCM16(pcm []byte, from int, to int) []byte {
+	if from == to || from <= 0 || to <= 0 || len(pcm) < 2 {
+		return pcm
+	}
+	srcCount := len(pcm) / 2
+	dstCount := int(int64(srcCount) * int64(to) / int64(from))
+	out := make([]byte, dstCount*2)
+	for i := 0; i < dstCount; i++ {
+		pos := float64(i) * float64(from) / float64(to)
+		idx := int(pos)
+		frac := pos - float64(idx)
+		s0 := float64(int16(binary.LittleEndian.Uint16(pcm[idx*2:])))
+		s1 := s0
+		if idx+1 < srcCount {
+			s1 = float64(int16(binary.LittleEndian.Uint16(pcm[(idx+1)*2:])))
+		}
+		binary.LittleEndian.PutUint16(out[i*2:], uint16(int16(s0+(s1-s0)*frac)))
+	}
+	return out
+}
+
+func decodeG711(data []byte, decode func(byte) int16) []byte {
+	out := make([]byte, len(data)*2)
+	for i, b := range data {
+		binary.LittleEndian.PutUint16(out[i*2:], uint16(decode(b)))
+	}
+	return out
+}
+
+func encodeG711(pcm []byte, encode func(int16) byte) []byte {
+	out := make([]byte, len(pcm)/2)
+	for i := range out {
+		out[i] = encode(int16(binary.LittleEndian.Uint16(pcm[i*2:])))
+	}
+	return out
+}
+
+// G.711 μ-law / A-law 编解码，参考 ITU-T G.711
+func ulawToLinear(u byte) int16 {
+	u = ^u
+	t := (int(u&0x0f) << 3) + 0x84
+	t <<= (u & 0x70) >> 4
+	if u&0x80 != 0 {
+		return int16(0x84 - t)
+	}
+	return int16(t - 0x84)
+}
+
+func linearToUlaw(sample int16) byte {
+	const bias, clip = 0x84, 32635
+	s := int(sample)
+	sign := 0
+	if s < 0 {
+		s = -s
+		sign = 0x80
+	}
+	if s > clip {
+		s = clip
+	}
+	s += bias
+	exponent := 7
+	for mask := 0x4000; s&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (s >> (exponent + 3)) & 0x0f
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+func alawToLinear(a byte) int16 {
+	a ^= 0x55
+	t := int(a&0x0f) << 4
+	seg := int(a&0x70) >> 4
+	switch seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
+
+func linearToAlaw(sample int16) byte {
+	s := int(sample)
+	mask := 0xd5
+	if s < 0 {
+		mask = 0x55
+		s = -s - 1
+	}
+	if s > 32767 {
+		s = 32767
+	}
+	var out int
+	if s < 256 {
+		out = s >> 4
+	} else {
+		exponent := 7
+		for m := 0x4000; s&m == 0 && exponent > 1; m >>= 1 {
+			exponent--
+		}
+		out = exponent<<4 | (s>>(exponent+3))&0x0f
+	}
+	return byte(out ^ mask)
+}
@@ -32,6 +32,11 @@ func DisableChannel(channelError types.ChannelError, reason string) {
 		subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channelError.ChannelName, channelError.ChannelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被禁用，原因：%s", channelError.ChannelName, channelError.ChannelId, reason)
 		NotifyRootUser(formatNotifyType(channelError.ChannelId, common.ChannelStatusAutoDisabled), subject, content)
+		PublishEvent(dto.EventTypeChannelDisabled, 0, map[string]any{
+			"channel_id":   channelError.ChannelId,
+			"channel_name": channelError.ChannelName,
+			"reason":       reason,
+		})
 	}
 }
 
@@ -41,6 +46,10 @@ func EnableChannel(channelId int, usingKey string, channelName string) {
 		subject := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 		NotifyRootUser(formatNotifyType(channelId, common.ChannelStatusEnabled), subject, content)
+		PublishEvent(dto.EventTypeChannelEnabled, 0, map[string]any{
+			"channel_id":   channelId,
+			"channel_name": channelName,
+		})
 	}
 }
 
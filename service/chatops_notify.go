@@ -0,0 +1,217 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+var (
+	notifyLinkRegex  = regexp.MustCompile(`(?i)<a\s+[^>]*href=['"]([^'"]+)['"][^>]*>(.*?)</a>`)
+	notifyBreakRegex = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>`)
+	notifyTagRegex   = regexp.MustCompile(`<[^>]+>`)
+)
+
+// IsChatOpsNotifyType 是否为聊天机器人类通知方式，此类通知使用纯文本内容
+func IsChatOpsNotifyType(notifyType string) bool {
+	switch notifyType {
+	case dto.NotifyTypeSlack, dto.NotifyTypeDiscord, dto.NotifyTypeFeishu, dto.NotifyTypeDingTalk, dto.NotifyTypeTelegram:
+		return true
+	}
+	return false
+}
+
+// renderNotifyText 替换占位符并将 HTML 内容转换为纯文本
+func renderNotifyText(data dto.Notify) string {
+	content := data.Content
+	for _, value := range data.Values {
+		content = strings.Replace(content, dto.ContentValueParam, fmt.Sprintf("%v", value), 1)
+	}
+	content = notifyLinkRegex.ReplaceAllStringFunc(content, func(s string) string {
+		matches := notifyLinkRegex.FindStringSubmatch(s)
+		if matches[1] == matches[2] {
+			return matches[1]
+		}
+		return fmt.Sprintf("%s (%s)", matches[2], matches[1])
+	})
+	content = notifyBreakRegex.ReplaceAllString(content, "\n")
+	content = notifyTagRegex.ReplaceAllString(content, "")
+	return strings.TrimSpace(content)
+}
+
+// postChatOpsNotify 发送 JSON 请求到聊天机器人，返回响应内容供调用方校验业务错误码
+func postChatOpsNotify(name string, targetURL string, payload any) ([]byte, error) {
+	payloadBytes, err := common.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s payload: %v", name, err)
+	}
+
+	var resp *http.Response
+	if system_setting.EnableWorker() {
+		workerReq := &WorkerRequest{
+			URL:    targetURL,
+			Key:    system_setting.WorkerValidKey,
+			Method: http.MethodPost,
+			Headers: map[string]string{
+				"Content-Type": "application/json; charset=utf-8",
+			},
+			Body: payloadBytes,
+		}
+		resp, err = DoWorkerRequest(workerReq)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send %s request through worker: %v", name, err)
+		}
+	} else {
+		// SSRF防护（非Worker模式）
+		fetchSetting := system_setting.GetFetchSetting()
+		if err := common.ValidateURLWithFetchSetting(targetURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+			return nil, fmt.Errorf("request reject: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, targetURL, bytes.NewBuffer(payloadBytes))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s request: %v", name, err)
+		}
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		resp, err = GetHttpClient().Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send %s request: %v", name, err)
+		}
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, fmt.Errorf("%s request failed with status code: %d", name, resp.StatusCode)
+	}
+	return body, nil
+}
+
+func sendSlackNotify(webhookURL string, data dto.Notify) error {
+	payload := map[string]any{
+		"text": fmt.Sprintf("*%s*\n%s", data.Title, renderNotifyText(data)),
+	}
+	_, err := postChatOpsNotify("slack", webhookURL, payload)
+	return err
+}
+
+func sendDiscordNotify(webhookURL string, data dto.Notify) error {
+	payload := map[string]any{
+		"embeds": []map[string]any{
+			{
+				"title":       data.Title,
+				"description": renderNotifyText(data),
+				"timestamp":   time.Now().UTC().Format(time.RFC3339),
+			},
+		},
+	}
+	_, err := postChatOpsNotify("discord", webhookURL, payload)
+	return err
+}
+
+// feishuSign 飞书签名：以 timestamp + "\n" + secret 为密钥对空串做 HmacSHA256 后 Base64
+func feishuSign(timestamp int64, secret string) string {
+	stringToSign := fmt.Sprintf("%d\n%s", timestamp, secret)
+	h := hmac.New(sha256.New, []byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func sendFeishuNotify(webhookURL string, secret string, data dto.Notify) error {
+	payload := map[string]any{
+		"msg_type": "post",
+		"content": map[string]any{
+			"post": map[string]any{
+				"zh_cn": map[string]any{
+					"title": data.Title,
+					"content": [][]map[string]any{
+						{{"tag": "text", "text": renderNotifyText(data)}},
+					},
+				},
+			},
+		},
+	}
+	if secret != "" {
+		timestamp := time.Now().Unix()
+		payload["timestamp"] = strconv.FormatInt(timestamp, 10)
+		payload["sign"] = feishuSign(timestamp, secret)
+	}
+	body, err := postChatOpsNotify("feishu", webhookURL, payload)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := common.Unmarshal(body, &result); err == nil && result.Code != 0 {
+		return fmt.Errorf("feishu request failed: %d %s", result.Code, result.Msg)
+	}
+	return nil
+}
+
+// dingTalkSign 钉钉加签：以 secret 为密钥对 timestamp + "\n" + secret 做 HmacSHA256 后 Base64
+func dingTalkSign(timestampMs int64, secret string) string {
+	stringToSign := fmt.Sprintf("%d\n%s", timestampMs, secret)
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func sendDingTalkNotify(webhookURL string, secret string, data dto.Notify) error {
+	targetURL := webhookURL
+	if secret != "" {
+		timestampMs := time.Now().UnixMilli()
+		separator := "&"
+		if !strings.Contains(targetURL, "?") {
+			separator = "?"
+		}
+		targetURL = fmt.Sprintf("%s%stimestamp=%d&sign=%s", targetURL, separator, timestampMs, url.QueryEscape(dingTalkSign(timestampMs, secret)))
+	}
+	payload := map[string]any{
+		"msgtype": "markdown",
+		"markdown": map[string]any{
+			"title": data.Title,
+			"text":  fmt.Sprintf("### %s\n\n%s", data.Title, strings.ReplaceAll(renderNotifyText(data), "\n", "\n\n")),
+		},
+	}
+	body, err := postChatOpsNotify("dingtalk", targetURL, payload)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := common.Unmarshal(body, &result); err == nil && result.ErrCode != 0 {
+		return fmt.Errorf("dingtalk request failed: %d %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+func sendTelegramNotify(botToken string, chatId string, data dto.Notify) error {
+	targetURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", botToken)
+	payload := map[string]any{
+		"chat_id":                  chatId,
+		"text":                     fmt.Sprintf("%s\n\n%s", data.Title, renderNotifyText(data)),
+		"disable_web_page_preview": true,
+	}
+	_, err := postChatOpsNotify("telegram", targetURL, payload)
+	if err != nil {
+		// 避免机器人令牌随请求地址出现在日志中
+		return errors.New(strings.ReplaceAll(err.Error(), botToken, "***"))
+	}
+	return nil
+}
@@ -377,13 +377,14 @@ func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamRespon
 			if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeTools {
 				claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
 				info.ClaudeConvertInfo.Index++
+				info.ClaudeConvertInfo.ToolIndexBase = info.ClaudeConvertInfo.Index
 			}
 			info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeTools
 
 			for i, toolCall := range toolCalls {
 				blockIndex := info.ClaudeConvertInfo.Index
 				if toolCall.Index != nil {
-					blockIndex = *toolCall.Index
+					blockIndex = info.ClaudeConvertInfo.ToolIndexBase + *toolCall.Index
 				} else if len(toolCalls) > 1 {
 					blockIndex = info.ClaudeConvertInfo.Index + i
 				}
@@ -505,6 +506,12 @@ func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse, info *relayco
 	for _, choice := range openAIResponse.Choices {
 		stopReason = stopReasonOpenAI2Claude(choice.FinishReason)
 		if choice.FinishReason == "tool_calls" {
+			if text := choice.Message.StringContent(); text != "" {
+				claudeContent := dto.ClaudeMediaMessage{}
+				claudeContent.Type = "text"
+				claudeContent.SetText(text)
+				contents = append(contents, claudeContent)
+			}
 			for _, toolUse := range choice.Message.ParseToolCalls() {
 				claudeContent := dto.ClaudeMediaMessage{}
 				claudeContent.Type = "tool_use"
@@ -671,8 +678,8 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 		for _, tool := range geminiRequest.GetTools() {
 			if tool.FunctionDeclarations != nil {
 				// 将 Gemini 的 FunctionDeclarations 转换为 OpenAI 的 ToolCallRequest
-				functionDeclarations, ok := tool.FunctionDeclarations.([]dto.FunctionRequest)
-				if ok {
+				functionDeclarations, err := common.Any2Type[[]dto.FunctionRequest](tool.FunctionDeclarations)
+				if err == nil {
 					for _, function := range functionDeclarations {
 						openAITool := dto.ToolCallRequest{
 							Type: "function",
@@ -767,6 +774,13 @@ func ResponseOpenAI2Gemini(openAIResponse *dto.OpenAITextResponse, info *relayco
 			Parts: make([]dto.GeminiPart, 0),
 		}
 
+		// 处理文本内容
+		if textContent := choice.Message.StringContent(); textContent != "" {
+			content.Parts = append(content.Parts, dto.GeminiPart{
+				Text: textContent,
+			})
+		}
+
 		// 处理工具调用
 		toolCalls := choice.Message.ParseToolCalls()
 		if len(toolCalls) > 0 {
@@ -789,15 +803,6 @@ func ResponseOpenAI2Gemini(openAIResponse *dto.OpenAITextResponse, info *relayco
 				}
 				content.Parts = append(content.Parts, part)
 			}
-		} else {
-			// 处理文本内容
-			textContent := choice.Message.StringContent()
-			if textContent != "" {
-				part := dto.GeminiPart{
-					Text: textContent,
-				}
-				content.Parts = append(content.Parts, part)
-			}
 		}
 
 		candidate.Content = content
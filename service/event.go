@@ -0,0 +1,228 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	webhookDeliveryLeaseSeconds = 60
+	webhookRetryBaseSeconds     = 30
+	webhookRetryMaxSeconds      = 6 * 60 * 60
+	webhookDeliveryBatchSize    = 100
+)
+
+// PublishEvent 发布事件：为匹配的订阅写入投递记录并立即尝试投递，失败的投递由后台任务重试
+func PublishEvent(eventType string, userId int, data map[string]any) {
+	if !operation_setting.GetEventSetting().Enabled {
+		return
+	}
+	gopool.Go(func() {
+		if err := publishEvent(eventType, userId, data); err != nil {
+			common.SysError(fmt.Sprintf("failed to publish event %s: %s", eventType, err.Error()))
+		}
+	})
+}
+
+func publishEvent(eventType string, userId int, data map[string]any) error {
+	subscriptions, err := model.GetEventSubscriptions(eventType, userId)
+	if err != nil {
+		return err
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+	now := common.GetTimestamp()
+	event := dto.Event{
+		Id:        "evt_" + common.GetUUID(),
+		Type:      eventType,
+		UserId:    userId,
+		CreatedAt: now,
+		Data:      data,
+	}
+	payload, err := common.Marshal(event)
+	if err != nil {
+		return err
+	}
+	deliveries := make([]*model.WebhookDelivery, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		// 系统级事件只投递给全局订阅
+		if dto.AdminEventTypes[eventType] && !subscription.Global {
+			continue
+		}
+		deliveries = append(deliveries, &model.WebhookDelivery{
+			SubscriptionId: subscription.Id,
+			UserId:         subscription.UserId,
+			EventId:        event.Id,
+			EventType:      eventType,
+			Payload:        string(payload),
+			Status:         common.WebhookDeliveryStatusPending,
+			NextAttemptAt:  now,
+			CreatedTime:    now,
+		})
+	}
+	if err = model.CreateWebhookDeliveries(deliveries); err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		DeliverWebhook(delivery)
+	}
+	return nil
+}
+
+// DeliverWebhook 抢占并投递一条记录，抢占失败说明已被其他节点处理
+func DeliverWebhook(delivery *model.WebhookDelivery) {
+	now := common.GetTimestamp()
+	if !model.ClaimWebhookDelivery(delivery.Id, now, webhookDeliveryLeaseSeconds) {
+		return
+	}
+	maxAttempts := operation_setting.GetEventSetting().MaxAttempts
+	delivery.Attempts++
+
+	subscription, err := model.GetWebhookSubscriptionById(delivery.SubscriptionId, delivery.UserId)
+	if err != nil || subscription.Status != common.WebhookSubscriptionStatusEnabled {
+		// 订阅已删除或禁用，不再重试
+		delivery.Status = common.WebhookDeliveryStatusFailed
+		delivery.LastError = "subscription not found or disabled"
+		saveWebhookDeliveryResult(delivery)
+		return
+	}
+
+	headers := map[string]string{
+		"X-Webhook-Event":     delivery.EventType,
+		"X-Webhook-Delivery":  strconv.Itoa(delivery.Id),
+		"X-Webhook-Event-Id":  delivery.EventId,
+		"X-Webhook-Timestamp": strconv.FormatInt(now, 10),
+	}
+	statusCode, err := PostSignedWebhook(subscription.Url, subscription.Secret, []byte(delivery.Payload), headers)
+	delivery.ResponseCode = statusCode
+	if err == nil {
+		delivery.Status = common.WebhookDeliveryStatusSuccess
+		delivery.LastError = ""
+		delivery.DeliveredTime = common.GetTimestamp()
+	} else {
+		delivery.LastError = err.Error()
+		if maxAttempts > 0 && delivery.Attempts >= maxAttempts {
+			delivery.Status = common.WebhookDeliveryStatusFailed
+		} else {
+			delivery.Status = common.WebhookDeliveryStatusPending
+			delivery.NextAttemptAt = common.GetTimestamp() + webhookRetryDelay(delivery.Attempts)
+		}
+	}
+	saveWebhookDeliveryResult(delivery)
+}
+
+func saveWebhookDeliveryResult(delivery *model.WebhookDelivery) {
+	if err := delivery.SaveResult(); err != nil {
+		common.SysError(fmt.Sprintf("failed to save webhook delivery %d: %s", delivery.Id, err.Error()))
+	}
+}
+
+// webhookRetryDelay 指数退避：30s, 60s, 120s ... 最长 6 小时
+func webhookRetryDelay(attempts int) int64 {
+	delay := int64(webhookRetryBaseSeconds)
+	for i := 1; i < attempts && delay < webhookRetryMaxSeconds; i++ {
+		delay *= 2
+	}
+	if delay > webhookRetryMaxSeconds {
+		delay = webhookRetryMaxSeconds
+	}
+	return delay
+}
+
+// RetryDueWebhookDeliveries 投递所有到期的待重试记录
+func RetryDueWebhookDeliveries() int {
+	deliveries, err := model.GetDueWebhookDeliveries(common.GetTimestamp(), webhookDeliveryBatchSize)
+	if err != nil {
+		common.SysError("failed to get due webhook deliveries: " + err.Error())
+		return 0
+	}
+	for _, delivery := range deliveries {
+		DeliverWebhook(delivery)
+	}
+	return len(deliveries)
+}
+
+// CleanupWebhookDeliveries 清理超过保留天数的投递记录
+func CleanupWebhookDeliveries() {
+	retentionDays := operation_setting.GetEventSetting().RetentionDays
+	if retentionDays <= 0 {
+		return
+	}
+	target := time.Now().AddDate(0, 0, -retentionDays).Unix()
+	count, err := model.DeleteOldWebhookDeliveries(target)
+	if err != nil {
+		common.SysError("failed to cleanup webhook deliveries: " + err.Error())
+		return
+	}
+	if count > 0 {
+		common.SysLog(fmt.Sprintf("cleaned up %d webhook deliveries", count))
+	}
+}
+
+// PublishTopupCompletedEvent 发布充值完成事件
+func PublishTopupCompletedEvent(tradeNo string) {
+	topUp := model.GetTopUpByTradeNo(tradeNo)
+	if topUp == nil || topUp.Status != common.TopUpStatusSuccess {
+		return
+	}
+	PublishEvent(dto.EventTypeTopupCompleted, topUp.UserId, map[string]any{
+		"trade_no":       topUp.TradeNo,
+		"amount":         topUp.Amount,
+		"money":          topUp.Money,
+		"payment_method": topUp.PaymentMethod,
+		"complete_time":  topUp.CompleteTime,
+	})
+}
+
+// PublishTaskFinishedEvent 异步任务进入成功或失败状态时发布事件
+func PublishTaskFinishedEvent(task *model.Task) {
+	if !task.IsFinished() {
+		return
+	}
+	PublishEvent(dto.EventTypeTaskFinished, task.UserId, map[string]any{
+		"task_id":     task.TaskID,
+		"platform":    task.Platform,
+		"action":      task.Action,
+		"status":      task.Status,
+		"fail_reason": task.FailReason,
+		"quota":       task.Quota,
+		"submit_time": task.SubmitTime,
+		"finish_time": task.FinishTime,
+	})
+}
+
+// PublishMidjourneyFinishedEvent Midjourney 任务进入终态（进度 100%）时发布事件，字段与异步任务一致
+func PublishMidjourneyFinishedEvent(task *model.Midjourney) {
+	PublishEvent(dto.EventTypeTaskFinished, task.UserId, map[string]any{
+		"task_id":     task.MjId,
+		"platform":    constant.TaskPlatformMidjourney,
+		"action":      task.Action,
+		"status":      task.Status,
+		"fail_reason": task.FailReason,
+		"quota":       task.Quota,
+		"submit_time": task.SubmitTime,
+		"finish_time": task.FinishTime,
+	})
+}
+
+// PublishUserRegisteredEvent 新用户注册时发布事件，source 为注册来源
+func PublishUserRegisteredEvent(user *model.User, source string) {
+	PublishEvent(dto.EventTypeUserRegistered, user.Id, map[string]any{
+		"user_id":      user.Id,
+		"username":     user.Username,
+		"display_name": user.DisplayName,
+		"email":        user.Email,
+		"inviter_id":   user.InviterId,
+		"source":       source,
+	})
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+const (
+	InvoiceFormatJSON = "json"
+	InvoiceFormatCSV  = "csv"
+	InvoiceFormatHTML = "html"
+)
+
+func formatInvoiceAmount(quota int) string {
+	return fmt.Sprintf("%.6f", float64(quota)/common.QuotaPerUnit)
+}
+
+// RenderInvoiceCSV 导出账单明细为 CSV
+func RenderInvoiceCSV(invoice *model.Invoice) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	rows := [][]string{
+		{"invoice_no", invoice.InvoiceNo},
+		{"username", invoice.Username},
+		{"period_start", time.Unix(invoice.PeriodStart, 0).Format(time.DateOnly)},
+		{"period_end", time.Unix(invoice.PeriodEnd-1, 0).Format(time.DateOnly)},
+		{"status", invoice.Status},
+		{},
+		{"day", "token_name", "model_name", "request_count", "prompt_tokens", "completion_tokens", "refund_quota", "quota", "amount"},
+	}
+	for _, item := range invoice.GetItems() {
+		rows = append(rows, []string{
+			item.Day,
+			item.TokenName,
+			item.ModelName,
+			strconv.Itoa(item.RequestCount),
+			strconv.Itoa(item.PromptTokens),
+			strconv.Itoa(item.CompletionTokens),
+			strconv.Itoa(item.RefundQuota),
+			strconv.Itoa(item.Quota),
+			formatInvoiceAmount(item.Quota),
+		})
+	}
+	rows = append(rows, []string{"total", "", "", strconv.Itoa(invoice.RequestCount), "", "", "", strconv.Itoa(invoice.Quota), formatInvoiceAmount(invoice.Quota)})
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var invoiceHTMLTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Invoice.InvoiceNo}}</title>
+<style>
+body { font-family: sans-serif; margin: 32px; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-top: 16px; }
+th, td { border: 1px solid #ccc; padding: 6px 8px; font-size: 13px; text-align: left; }
+th { background: #f5f5f5; }
+td.num { text-align: right; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h2>{{.SystemName}} Invoice</h2>
+<p>Invoice No: {{.Invoice.InvoiceNo}}<br>
+Customer: {{.Invoice.Username}} (#{{.Invoice.UserId}})<br>
+Period: {{.PeriodStart}} ~ {{.PeriodEnd}}<br>
+Status: {{.Invoice.Status}}</p>
+<table>
+<tr><th>Day</th><th>Token</th><th>Model</th><th>Requests</th><th>Prompt Tokens</th><th>Completion Tokens</th><th>Refunded</th><th>Amount</th></tr>
+{{range .Items}}<tr><td>{{.Day}}</td><td>{{.TokenName}}</td><td>{{.ModelName}}</td><td class="num">{{.RequestCount}}</td><td class="num">{{.PromptTokens}}</td><td class="num">{{.CompletionTokens}}</td><td class="num">{{.Refunded}}</td><td class="num">{{.Amount}}</td></tr>
+{{end}}<tr><th colspan="3">Total</th><th class="num">{{.Invoice.RequestCount}}</th><th></th><th></th><th></th><th class="num">{{.Total}}</th></tr>
+</table>
+</body>
+</html>
+`))
+
+// RenderInvoiceHTML 导出可打印的 HTML 账单，可通过浏览器打印为 PDF
+func RenderInvoiceHTML(invoice *model.Invoice) ([]byte, error) {
+	type htmlItem struct {
+		model.InvoiceItem
+		Refunded string
+		Amount   string
+	}
+	items := make([]htmlItem, 0)
+	for _, item := range invoice.GetItems() {
+		items = append(items, htmlItem{InvoiceItem: item, Refunded: formatInvoiceAmount(item.RefundQuota), Amount: formatInvoiceAmount(item.Quota)})
+	}
+	buf := &bytes.Buffer{}
+	err := invoiceHTMLTemplate.Execute(buf, map[string]interface{}{
+		"SystemName":  common.SystemName,
+		"Invoice":     invoice,
+		"Items":       items,
+		"PeriodStart": time.Unix(invoice.PeriodStart, 0).Format(time.DateOnly),
+		"PeriodEnd":   time.Unix(invoice.PeriodEnd-1, 0).Format(time.DateOnly),
+		"Total":       formatInvoiceAmount(invoice.Quota),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GenerateMonthlyInvoices 为所有后付费用户生成上一个自然月的账单，已存在的账单跳过
+func GenerateMonthlyInvoices(now time.Time, issue bool) (int, error) {
+	// 从当月 1 日回退，避免 31 日等日期回退一个月后被规范化到当月
+	lastMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0)
+	periodStart, periodEnd := model.GetMonthPeriod(lastMonth.Year(), lastMonth.Month())
+	userIds, err := model.GetPostpaidUserIds()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, userId := range userIds {
+		if model.InvoiceExists(userId, periodStart) {
+			continue
+		}
+		if _, err := model.GenerateInvoice(userId, periodStart, periodEnd, issue); err != nil {
+			common.SysError(fmt.Sprintf("failed to generate invoice for user %d: %s", userId, err.Error()))
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
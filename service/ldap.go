@@ -0,0 +1,209 @@
+package service
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var ErrLDAPInvalidCredentials = errors.New("用户名或密码错误")
+
+// LDAPUser LDAP 认证通过的用户信息
+type LDAPUser struct {
+	Id          string
+	DN          string
+	Username    string
+	Email       string
+	DisplayName string
+	Groups      []string // 分组 DN
+}
+
+func dialLDAP(settings *system_setting.LDAPSettings) (*ldap.Conn, error) {
+	u, err := url.Parse(settings.Url)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("LDAP 地址无效: %s", settings.Url)
+	}
+	timeout := time.Duration(settings.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+	conn, err := ldap.DialURL(settings.Url,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+	if settings.StartTLS && strings.EqualFold(u.Scheme, "ldap") {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// bindLDAPService 使用服务账号绑定，未配置服务账号时匿名搜索
+func bindLDAPService(conn *ldap.Conn, settings *system_setting.LDAPSettings) error {
+	if settings.BindDN == "" {
+		return conn.UnauthenticatedBind("")
+	}
+	return conn.Bind(settings.BindDN, settings.BindPassword)
+}
+
+func ldapEntryId(entry *ldap.Entry, attr string) string {
+	if attr == "" {
+		return strings.ToLower(entry.DN)
+	}
+	raw := entry.GetRawAttributeValue(attr)
+	if len(raw) == 0 {
+		return strings.ToLower(entry.DN)
+	}
+	// objectGUID 等二进制属性以十六进制保存
+	if strings.EqualFold(attr, "objectGUID") || strings.EqualFold(attr, "objectSid") {
+		return hex.EncodeToString(raw)
+	}
+	return string(raw)
+}
+
+// LDAPAuthenticate 使用服务账号搜索用户，再以用户 DN 与密码绑定校验密码
+func LDAPAuthenticate(username string, password string) (*LDAPUser, error) {
+	settings := system_setting.GetLDAPSettings()
+	// 空密码会被服务器当作匿名绑定并返回成功，必须拒绝
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+	conn, err := dialLDAP(settings)
+	if err != nil {
+		common.SysError("failed to connect to LDAP server: " + err.Error())
+		return nil, errors.New("无法连接至 LDAP 服务器，请稍后重试")
+	}
+	defer conn.Close()
+	if err := bindLDAPService(conn, settings); err != nil {
+		common.SysError("LDAP service bind failed: " + err.Error())
+		return nil, errors.New("LDAP 服务账号绑定失败，请检查设置")
+	}
+
+	attrs := make([]string, 0, 5)
+	for _, attr := range []string{settings.UsernameAttribute, settings.EmailAttribute, settings.DisplayNameAttribute, settings.IdAttribute, settings.GroupAttribute} {
+		if attr != "" {
+			attrs = append(attrs, attr)
+		}
+	}
+	filter := strings.ReplaceAll(settings.UserFilter, "{username}", ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		settings.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		filter, attrs, nil,
+	))
+	if err != nil {
+		common.SysError("LDAP user search failed: " + err.Error())
+		return nil, errors.New("LDAP 用户搜索失败，请检查设置")
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrLDAPInvalidCredentials
+	}
+	entry := result.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		common.SysError("LDAP user bind failed: " + err.Error())
+		return nil, errors.New("LDAP 认证失败，请稍后重试")
+	}
+
+	user := &LDAPUser{
+		Id:          ldapEntryId(entry, settings.IdAttribute),
+		DN:          entry.DN,
+		Username:    entry.GetAttributeValue(settings.UsernameAttribute),
+		Email:       entry.GetAttributeValue(settings.EmailAttribute),
+		DisplayName: entry.GetAttributeValue(settings.DisplayNameAttribute),
+	}
+	if user.Username == "" {
+		user.Username = username
+	}
+	if settings.GroupAttribute != "" {
+		user.Groups = append(user.Groups, entry.GetAttributeValues(settings.GroupAttribute)...)
+	}
+	if settings.GroupBaseDN != "" && settings.GroupFilter != "" {
+		// 用户绑定后可能无权读取分组，重新以服务账号绑定再搜索
+		if err := bindLDAPService(conn, settings); err != nil {
+			common.SysError("LDAP service bind failed: " + err.Error())
+			return nil, errors.New("LDAP 服务账号绑定失败，请检查设置")
+		}
+		groupFilter := strings.NewReplacer(
+			"{dn}", ldap.EscapeFilter(entry.DN),
+			"{username}", ldap.EscapeFilter(user.Username),
+		).Replace(settings.GroupFilter)
+		groups, err := conn.Search(ldap.NewSearchRequest(
+			settings.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+			groupFilter, []string{"1.1"}, nil,
+		))
+		if err != nil {
+			common.SysError("LDAP group search failed: " + err.Error())
+			return nil, errors.New("LDAP 分组搜索失败，请检查设置")
+		}
+		for _, group := range groups.Entries {
+			user.Groups = append(user.Groups, group.DN)
+		}
+	}
+	return user, nil
+}
+
+// ldapGroupMatches 按 DN 或 CN 匹配分组，不区分大小写
+func ldapGroupMatches(groupDN string, name string) bool {
+	if strings.EqualFold(groupDN, name) {
+		return true
+	}
+	dn, err := ldap.ParseDN(groupDN)
+	if err != nil || len(dn.RDNs) == 0 {
+		return false
+	}
+	for _, attr := range dn.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") && strings.EqualFold(attr.Value, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// InLDAPGroup 用户是否属于指定分组（DN 或 CN）
+func (user *LDAPUser) InLDAPGroup(name string) bool {
+	for _, group := range user.Groups {
+		if ldapGroupMatches(group, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveLDAPGroupMapping 按分组映射计算用户分组与角色，未匹配时为默认分组与普通用户
+func ResolveLDAPGroupMapping(user *LDAPUser, mappings []system_setting.LDAPGroupMapping) (string, int) {
+	group, role := "default", common.RoleCommonUser
+	for _, mapping := range mappings {
+		if !user.InLDAPGroup(mapping.Group) {
+			continue
+		}
+		if mapping.UserGroup != "" {
+			group = mapping.UserGroup
+		}
+		if mapping.Role > common.RoleGuestUser && mapping.Role < common.RoleRootUser {
+			role = mapping.Role
+		}
+	}
+	return group, role
+}
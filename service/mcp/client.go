@@ -0,0 +1,231 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 实现网关执行工具所需的 MCP 客户端子集：initialize、tools/list、tools/call，
+// 支持 Streamable HTTP 与旧版 HTTP+SSE 两种传输方式
+
+const (
+	TransportStreamableHTTP = "streamable_http"
+	TransportSSE            = "sse"
+
+	protocolVersion = "2025-06-18"
+	// 单条消息的大小上限
+	maxMessageSize = 16 << 20
+	// tools/list 最多翻页次数
+	maxListPages = 20
+)
+
+type Options struct {
+	URL        string
+	Transport  string
+	Headers    map[string]string
+	HTTPClient *http.Client
+}
+
+type Tool struct {
+	Name        string          `json:"name"`
+	Title       string          `json:"title,omitempty"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+	Annotations map[string]any  `json:"annotations,omitempty"`
+}
+
+// ReadOnly 服务端是否声明该工具不修改外部状态
+func (t *Tool) ReadOnly() bool {
+	readOnly, _ := t.Annotations["readOnlyHint"].(bool)
+	return readOnly
+}
+
+type CallToolResult struct {
+	Content           []json.RawMessage `json:"content"`
+	StructuredContent json.RawMessage   `json:"structuredContent,omitempty"`
+	IsError           bool              `json:"isError,omitempty"`
+}
+
+// Text 将结果转换为文本：拼接文本内容，其他类型的内容保留原始 JSON
+func (r *CallToolResult) Text() string {
+	parts := make([]string, 0, len(r.Content))
+	for _, raw := range r.Content {
+		var content struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if err := common.Unmarshal(raw, &content); err == nil && content.Type == "text" {
+			parts = append(parts, content.Text)
+			continue
+		}
+		parts = append(parts, string(raw))
+	}
+	if len(parts) == 0 && len(r.StructuredContent) > 0 {
+		return string(r.StructuredContent)
+	}
+	return strings.Join(parts, "\n")
+}
+
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+type request struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int64  `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// idKey 将响应中的 id 统一为字符串，兼容服务端以字符串回传数字 id
+func idKey(id json.RawMessage) string {
+	return strings.Trim(strings.TrimSpace(string(id)), `"`)
+}
+
+type transport interface {
+	// call 发送请求并等待对应 id 的响应
+	call(ctx context.Context, req *request) (*response, error)
+	// notify 发送通知，不等待响应
+	notify(ctx context.Context, req *request) error
+	close()
+}
+
+type Client struct {
+	transport transport
+	nextID    atomic.Int64
+}
+
+// Connect 连接 MCP 服务并完成初始化握手
+func Connect(ctx context.Context, opts Options) (*Client, error) {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	var t transport
+	switch opts.Transport {
+	case "", TransportStreamableHTTP:
+		t = newStreamableHTTPTransport(opts)
+	case TransportSSE:
+		sse, err := dialSSE(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		t = sse
+	default:
+		return nil, fmt.Errorf("unsupported mcp transport: %s", opts.Transport)
+	}
+	client := &Client{transport: t}
+	if err := client.initialize(ctx); err != nil {
+		t.close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	var result struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo": map[string]any{
+			"name":    "new-api",
+			"version": common.Version,
+		},
+	}, &result)
+	if err != nil {
+		return fmt.Errorf("mcp initialize failed: %w", err)
+	}
+	if st, ok := c.transport.(*streamableHTTPTransport); ok {
+		st.setProtocolVersion(result.ProtocolVersion)
+	}
+	return c.transport.notify(ctx, &request{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	resp, err := c.transport.call(ctx, &request{
+		JSONRPC: "2.0",
+		ID:      c.nextID.Add(1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if len(resp.Result) == 0 {
+		return errors.New("mcp response has no result")
+	}
+	return common.Unmarshal(resp.Result, result)
+}
+
+// ListTools 列出服务提供的全部工具
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for page := 0; page < maxListPages; page++ {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var result struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "tools/list", params, &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			break
+		}
+		cursor = result.NextCursor
+	}
+	return tools, nil
+}
+
+// CallTool 调用工具，arguments 为 JSON 对象
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*CallToolResult, error) {
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	var result CallToolResult
+	if err := c.call(ctx, "tools/call", map[string]any{
+		"name":      name,
+		"arguments": arguments,
+	}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close 结束会话并释放连接
+func (c *Client) Close() {
+	c.transport.close()
+}
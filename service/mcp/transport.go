@@ -0,0 +1,409 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+type sseEvent struct {
+	event string
+	data  string
+}
+
+type sseReader struct {
+	scanner *bufio.Scanner
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxMessageSize)
+	return &sseReader{scanner: scanner}
+}
+
+// next 读取下一个事件，流结束时返回 io.EOF
+func (r *sseReader) next() (*sseEvent, error) {
+	event := &sseEvent{}
+	var data []string
+	for r.scanner.Scan() {
+		line := strings.TrimSuffix(r.scanner.Text(), "\r")
+		if line == "" {
+			if len(data) == 0 && event.event == "" {
+				continue
+			}
+			event.data = strings.Join(data, "\n")
+			return event, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		event.data = strings.Join(data, "\n")
+		return event, nil
+	}
+	return nil, io.EOF
+}
+
+// findResponse 从单条消息或批量消息中找出指定 id 的响应
+func findResponse(data []byte, id int64) (*response, bool) {
+	data = bytes.TrimSpace(data)
+	var messages []response
+	if len(data) > 0 && data[0] == '[' {
+		if err := common.Unmarshal(data, &messages); err != nil {
+			return nil, false
+		}
+	} else {
+		var message response
+		if err := common.Unmarshal(data, &message); err != nil {
+			return nil, false
+		}
+		messages = []response{message}
+	}
+	key := strconv.FormatInt(id, 10)
+	for i := range messages {
+		if len(messages[i].ID) > 0 && messages[i].Method == "" && idKey(messages[i].ID) == key {
+			return &messages[i], true
+		}
+	}
+	return nil, false
+}
+
+func applyHeaders(req *http.Request, headers map[string]string) {
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+}
+
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("mcp server returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// streamableHTTPTransport 每条消息单独 POST，响应为 JSON 或 SSE 流
+type streamableHTTPTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu              sync.Mutex
+	sessionID       string
+	protocolVersion string
+}
+
+func newStreamableHTTPTransport(opts Options) *streamableHTTPTransport {
+	return &streamableHTTPTransport{
+		url:     opts.URL,
+		headers: opts.Headers,
+		client:  opts.HTTPClient,
+	}
+}
+
+func (t *streamableHTTPTransport) setProtocolVersion(version string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.protocolVersion = version
+}
+
+func (t *streamableHTTPTransport) newRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, method, t.url, body)
+	if err != nil {
+		return nil, err
+	}
+	applyHeaders(httpReq, t.headers)
+	t.mu.Lock()
+	if t.sessionID != "" {
+		httpReq.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		httpReq.Header.Set("MCP-Protocol-Version", t.protocolVersion)
+	}
+	t.mu.Unlock()
+	return httpReq, nil
+}
+
+func (t *streamableHTTPTransport) post(ctx context.Context, req *request) (*http.Response, error) {
+	body, err := common.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := t.newRequest(ctx, http.MethodPost, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json, text/event-stream")
+	resp, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if sessionID := resp.Header.Get("Mcp-Session-Id"); sessionID != "" {
+		t.mu.Lock()
+		t.sessionID = sessionID
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, statusError(resp)
+	}
+	return resp, nil
+}
+
+func (t *streamableHTTPTransport) call(ctx context.Context, req *request) (*response, error) {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		reader := newSSEReader(resp.Body)
+		for {
+			event, err := reader.next()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil, errors.New("mcp stream ended before the response arrived")
+				}
+				return nil, err
+			}
+			if event.event != "" && event.event != "message" {
+				continue
+			}
+			if message, ok := findResponse([]byte(event.data), req.ID); ok {
+				return message, nil
+			}
+		}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+	if err != nil {
+		return nil, err
+	}
+	message, ok := findResponse(body, req.ID)
+	if !ok {
+		return nil, fmt.Errorf("invalid mcp response: %s", common.MaskSensitiveInfo(string(body[:min(len(body), 200)])))
+	}
+	return message, nil
+}
+
+func (t *streamableHTTPTransport) notify(ctx context.Context, req *request) error {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxMessageSize))
+	return resp.Body.Close()
+}
+
+// close 通知服务端结束会话，失败不影响调用方
+func (t *streamableHTTPTransport) close() {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	httpReq, err := t.newRequest(ctx, http.MethodDelete, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := t.client.Do(httpReq); err == nil {
+		_ = resp.Body.Close()
+	}
+}
+
+// sseTransport 旧版 HTTP+SSE：GET 建立事件流，服务端通过 endpoint 事件告知 POST 地址，响应从事件流返回
+type sseTransport struct {
+	client   *http.Client
+	headers  map[string]string
+	endpoint string
+	body     io.ReadCloser
+	cancel   context.CancelFunc
+
+	mu      sync.Mutex
+	pending map[string]chan *response
+	done    chan struct{}
+	err     error
+}
+
+func dialSSE(ctx context.Context, opts Options) (*sseTransport, error) {
+	baseURL, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	// 事件流在整个会话期间保持，不受建立连接时的 ctx 限制
+	streamCtx, cancel := context.WithCancel(context.Background())
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	httpReq, err := http.NewRequestWithContext(streamCtx, http.MethodGet, opts.URL, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	applyHeaders(httpReq, opts.Headers)
+	httpReq.Header.Set("Accept", "text/event-stream")
+	resp, err := opts.HTTPClient.Do(httpReq)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		cancel()
+		return nil, statusError(resp)
+	}
+
+	reader := newSSEReader(resp.Body)
+	var endpoint *url.URL
+	for endpoint == nil {
+		event, err := reader.next()
+		if err != nil {
+			_ = resp.Body.Close()
+			cancel()
+			return nil, fmt.Errorf("mcp sse endpoint event not received: %w", err)
+		}
+		if event.event != "endpoint" {
+			continue
+		}
+		endpoint, err = baseURL.Parse(strings.TrimSpace(event.data))
+		if err != nil {
+			_ = resp.Body.Close()
+			cancel()
+			return nil, fmt.Errorf("invalid mcp sse endpoint: %w", err)
+		}
+	}
+	// 只允许向同一服务发送消息
+	if endpoint.Scheme != baseURL.Scheme || endpoint.Host != baseURL.Host {
+		_ = resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("mcp sse endpoint %s is not on the same origin", endpoint.Redacted())
+	}
+
+	t := &sseTransport{
+		client:   opts.HTTPClient,
+		headers:  opts.Headers,
+		endpoint: endpoint.String(),
+		body:     resp.Body,
+		cancel:   cancel,
+		pending:  make(map[string]chan *response),
+		done:     make(chan struct{}),
+	}
+	go t.readLoop(reader)
+	return t, nil
+}
+
+func (t *sseTransport) readLoop(reader *sseReader) {
+	var err error
+	for {
+		var event *sseEvent
+		event, err = reader.next()
+		if err != nil {
+			break
+		}
+		if event.event != "" && event.event != "message" {
+			continue
+		}
+		var message response
+		if common.Unmarshal([]byte(event.data), &message) != nil || len(message.ID) == 0 || message.Method != "" {
+			// 忽略通知和服务端发起的请求
+			continue
+		}
+		t.mu.Lock()
+		ch, ok := t.pending[idKey(message.ID)]
+		delete(t.pending, idKey(message.ID))
+		t.mu.Unlock()
+		if ok {
+			ch <- &message
+		}
+	}
+	t.mu.Lock()
+	if errors.Is(err, io.EOF) {
+		err = errors.New("mcp sse stream closed")
+	}
+	t.err = err
+	t.mu.Unlock()
+	close(t.done)
+}
+
+func (t *sseTransport) post(ctx context.Context, req *request) error {
+	body, err := common.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	applyHeaders(httpReq, t.headers)
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return statusError(resp)
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxMessageSize))
+	return nil
+}
+
+func (t *sseTransport) call(ctx context.Context, req *request) (*response, error) {
+	key := strconv.FormatInt(req.ID, 10)
+	ch := make(chan *response, 1)
+	t.mu.Lock()
+	t.pending[key] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, key)
+		t.mu.Unlock()
+	}()
+
+	if err := t.post(ctx, req); err != nil {
+		return nil, err
+	}
+	select {
+	case message := <-ch:
+		return message, nil
+	case <-t.done:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return nil, t.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *sseTransport) notify(ctx context.Context, req *request) error {
+	return t.post(ctx, req)
+}
+
+func (t *sseTransport) close() {
+	t.cancel()
+	_ = t.body.Close()
+}
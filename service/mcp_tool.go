@@ -0,0 +1,446 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/service/mcp"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+var mcpInvalidNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// MCPToolSet 一次请求中由网关执行的 MCP 工具：连接服务、列出工具、以函数的形式暴露给模型并执行调用
+type MCPToolSet struct {
+	servers []*mcpServer
+	// 暴露给模型的函数名 -> 工具
+	tools   map[string]*mcpServerTool
+	timeout time.Duration
+}
+
+type mcpServer struct {
+	label       string
+	description string
+	options     mcp.Options
+	// 允许使用的工具，为 nil 时不限制
+	allowedTools map[string]bool
+	readOnly     bool
+	approval     mcpApprovalPolicy
+	client       *mcp.Client
+	tools        []mcp.Tool
+}
+
+type mcpServerTool struct {
+	server *mcpServer
+	tool   mcp.Tool
+}
+
+// mcpApprovalPolicy 调用前是否需要客户端批准，未单独列出的工具默认需要批准
+type mcpApprovalPolicy struct {
+	never       bool
+	alwaysNames map[string]bool
+	neverNames  map[string]bool
+}
+
+func (p *mcpApprovalPolicy) required(name string) bool {
+	if p.neverNames[name] {
+		return false
+	}
+	if p.alwaysNames[name] {
+		return true
+	}
+	return !p.never
+}
+
+// IsMCPEnabled 是否由网关执行 mcp 工具
+func IsMCPEnabled() bool {
+	return operation_setting.GetMCPSetting().Enabled
+}
+
+// MCPFunctionName 暴露给模型的函数名，同一服务的同名工具在多轮请求中保持一致
+func MCPFunctionName(serverLabel string, toolName string) string {
+	name := mcpInvalidNameRegex.ReplaceAllString(serverLabel+"__"+toolName, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// NewMCPToolSet 校验请求中的 mcp 工具：server_label 对应预置服务时使用预置配置，
+// 否则 server_url 必须在允许的前缀内并通过 SSRF 检查
+func NewMCPToolSet(tools []dto.MCPTool) (*MCPToolSet, error) {
+	setting := operation_setting.GetMCPSetting()
+	timeoutSeconds := setting.ToolTimeoutSeconds
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = 60
+	}
+	toolSet := &MCPToolSet{
+		tools:   make(map[string]*mcpServerTool),
+		timeout: time.Duration(timeoutSeconds) * time.Second,
+	}
+	seen := make(map[string]bool)
+	for _, tool := range tools {
+		label := tool.ServerLabel
+		if label == "" {
+			return nil, errors.New("mcp tool requires server_label")
+		}
+		if seen[label] {
+			return nil, fmt.Errorf("duplicate mcp server_label: %s", label)
+		}
+		seen[label] = true
+
+		server := &mcpServer{
+			label:       label,
+			description: tool.ServerDescription,
+		}
+		headers := make(map[string]string, len(tool.Headers)+1)
+		for k, v := range tool.Headers {
+			headers[k] = v
+		}
+		if tool.Authorization != "" {
+			headers["Authorization"] = "Bearer " + tool.Authorization
+		}
+		preset := setting.FindServer(label)
+		switch {
+		case preset != nil && (tool.ServerUrl == "" || tool.ServerUrl == preset.URL):
+			server.options.URL = preset.URL
+			server.options.Transport = preset.Transport
+			// 预置的请求头优先，避免被客户端覆盖
+			for k, v := range preset.Headers {
+				headers[k] = v
+			}
+			if server.description == "" {
+				server.description = preset.Description
+			}
+		case tool.ServerUrl != "":
+			if !setting.IsServerURLAllowed(tool.ServerUrl) {
+				return nil, fmt.Errorf("mcp server_url is not allowed: %s", tool.ServerUrl)
+			}
+			fetchSetting := system_setting.GetFetchSetting()
+			if err := common.ValidateURLWithFetchSetting(tool.ServerUrl, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+				return nil, fmt.Errorf("mcp server_url rejected: %v", err)
+			}
+			server.options.URL = tool.ServerUrl
+			if strings.HasSuffix(strings.SplitN(tool.ServerUrl, "?", 2)[0], "/sse") {
+				server.options.Transport = mcp.TransportSSE
+			}
+		default:
+			return nil, fmt.Errorf("mcp server %s is not configured, server_url is required", label)
+		}
+		server.options.Headers = headers
+		server.options.HTTPClient = GetHttpClient()
+
+		if err := server.parseAllowedTools(tool.AllowedTools); err != nil {
+			return nil, fmt.Errorf("invalid allowed_tools for mcp server %s: %w", label, err)
+		}
+		if err := server.parseRequireApproval(tool.RequireApproval); err != nil {
+			return nil, fmt.Errorf("invalid require_approval for mcp server %s: %w", label, err)
+		}
+		toolSet.servers = append(toolSet.servers, server)
+	}
+	return toolSet, nil
+}
+
+func (s *mcpServer) parseAllowedTools(raw json.RawMessage) error {
+	switch common.GetJsonType(raw) {
+	case "unknown", "null":
+		return nil
+	case "array":
+		var names []string
+		if err := common.Unmarshal(raw, &names); err != nil {
+			return err
+		}
+		s.allowedTools = toNameSet(names)
+	case "object":
+		var filter struct {
+			ToolNames []string `json:"tool_names"`
+			ReadOnly  bool     `json:"read_only"`
+		}
+		if err := common.Unmarshal(raw, &filter); err != nil {
+			return err
+		}
+		if filter.ToolNames != nil {
+			s.allowedTools = toNameSet(filter.ToolNames)
+		}
+		s.readOnly = filter.ReadOnly
+	default:
+		return errors.New("must be an array or an object")
+	}
+	return nil
+}
+
+func (s *mcpServer) parseRequireApproval(raw json.RawMessage) error {
+	switch common.GetJsonType(raw) {
+	case "unknown", "null":
+		return nil
+	case "string":
+		var mode string
+		if err := common.Unmarshal(raw, &mode); err != nil {
+			return err
+		}
+		switch mode {
+		case "always":
+		case "never":
+			s.approval.never = true
+		default:
+			return fmt.Errorf("unknown mode %q", mode)
+		}
+	case "object":
+		type toolNames struct {
+			ToolNames []string `json:"tool_names"`
+		}
+		var policy struct {
+			Always *toolNames `json:"always"`
+			Never  *toolNames `json:"never"`
+		}
+		if err := common.Unmarshal(raw, &policy); err != nil {
+			return err
+		}
+		if policy.Always != nil {
+			s.approval.alwaysNames = toNameSet(policy.Always.ToolNames)
+		}
+		if policy.Never != nil {
+			s.approval.neverNames = toNameSet(policy.Never.ToolNames)
+		}
+	default:
+		return errors.New("must be a string or an object")
+	}
+	return nil
+}
+
+func toNameSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+func (s *mcpServer) connect(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	client, err := mcp.Connect(ctx, s.options)
+	if err != nil {
+		return err
+	}
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		client.Close()
+		return err
+	}
+	s.client = client
+	for _, tool := range tools {
+		if s.allowedTools != nil && !s.allowedTools[tool.Name] {
+			continue
+		}
+		if s.readOnly && !tool.ReadOnly() {
+			continue
+		}
+		s.tools = append(s.tools, tool)
+	}
+	return nil
+}
+
+// Connect 并发连接所有服务并列出工具，任一服务失败时返回错误
+func (s *MCPToolSet) Connect(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(s.servers))
+	for i, server := range s.servers {
+		wg.Add(1)
+		go func(i int, server *mcpServer) {
+			defer wg.Done()
+			errs[i] = server.connect(ctx, s.timeout)
+		}(i, server)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("failed to list tools from mcp server %s: %w", s.servers[i].label, err)
+		}
+	}
+	for _, server := range s.servers {
+		for _, tool := range server.tools {
+			s.tools[MCPFunctionName(server.label, tool.Name)] = &mcpServerTool{server: server, tool: tool}
+		}
+	}
+	return nil
+}
+
+// Close 结束所有会话
+func (s *MCPToolSet) Close() {
+	for _, server := range s.servers {
+		if server.client != nil {
+			server.client.Close()
+		}
+	}
+}
+
+// Has 函数名是否对应网关执行的 mcp 工具
+func (s *MCPToolSet) Has(name string) bool {
+	_, ok := s.tools[name]
+	return ok
+}
+
+// RequiresApproval 调用该工具前是否需要客户端批准
+func (s *MCPToolSet) RequiresApproval(name string) bool {
+	tool, ok := s.tools[name]
+	return ok && tool.server.approval.required(tool.tool.Name)
+}
+
+func (s *MCPToolSet) describe(tool *mcpServerTool) (string, any) {
+	description := common.GetStringIfEmpty(tool.tool.Description, tool.tool.Title)
+	if tool.server.description != "" {
+		description = fmt.Sprintf("[%s: %s] %s", tool.server.label, tool.server.description, description)
+	}
+	var parameters any = tool.tool.InputSchema
+	if len(tool.tool.InputSchema) == 0 {
+		parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	return description, parameters
+}
+
+// FunctionTools 以 Chat Completions 的函数工具形式返回所有 mcp 工具
+func (s *MCPToolSet) FunctionTools() []dto.ToolCallRequest {
+	tools := make([]dto.ToolCallRequest, 0, len(s.tools))
+	for _, server := range s.servers {
+		for _, tool := range server.tools {
+			name := MCPFunctionName(server.label, tool.Name)
+			description, parameters := s.describe(s.tools[name])
+			tools = append(tools, dto.ToolCallRequest{
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:        name,
+					Description: description,
+					Parameters:  parameters,
+				},
+			})
+		}
+	}
+	return tools
+}
+
+// ResponsesFunctionTools 以 Responses API 的函数工具形式返回所有 mcp 工具
+func (s *MCPToolSet) ResponsesFunctionTools() []map[string]any {
+	tools := make([]map[string]any, 0, len(s.tools))
+	for _, function := range s.FunctionTools() {
+		tools = append(tools, map[string]any{
+			"type":        "function",
+			"name":        function.Function.Name,
+			"description": function.Function.Description,
+			"parameters":  function.Function.Parameters,
+			"strict":      false,
+		})
+	}
+	return tools
+}
+
+// ListToolsItems 返回各服务的 mcp_list_tools 输出项，skip 中的服务已在历史中列出过
+func (s *MCPToolSet) ListToolsItems(skip map[string]bool) []dto.MCPListToolsItem {
+	items := make([]dto.MCPListToolsItem, 0, len(s.servers))
+	for _, server := range s.servers {
+		if skip[server.label] {
+			continue
+		}
+		tools := make([]dto.MCPListedTool, 0, len(server.tools))
+		for _, tool := range server.tools {
+			tools = append(tools, dto.MCPListedTool{
+				Name:        tool.Name,
+				Description: tool.Description,
+				InputSchema: tool.InputSchema,
+				Annotations: tool.Annotations,
+			})
+		}
+		items = append(items, dto.MCPListToolsItem{
+			Type:        dto.MCPItemTypeListTools,
+			ID:          "mcpl_" + common.GetUUID(),
+			ServerLabel: server.label,
+			Tools:       tools,
+		})
+	}
+	return items
+}
+
+// ApprovalRequest 生成 mcp_approval_request 输出项
+func (s *MCPToolSet) ApprovalRequest(id string, name string, arguments string) *dto.MCPApprovalRequestItem {
+	tool := s.tools[name]
+	return &dto.MCPApprovalRequestItem{
+		Type:        dto.MCPItemTypeApprovalRequest,
+		ID:          id,
+		ServerLabel: tool.server.label,
+		Name:        tool.tool.Name,
+		Arguments:   arguments,
+	}
+}
+
+func (s *MCPToolSet) newCallItem(name string, arguments string) *dto.MCPCallItem {
+	tool := s.tools[name]
+	return &dto.MCPCallItem{
+		Type:        dto.MCPItemTypeCall,
+		ID:          "mcp_" + common.GetUUID(),
+		ServerLabel: tool.server.label,
+		Name:        tool.tool.Name,
+		Arguments:   arguments,
+		Status:      "completed",
+	}
+}
+
+// CallError 返回未执行的 mcp_call 输出项，如超过调用次数限制
+func (s *MCPToolSet) CallError(name string, arguments string, message string) *dto.MCPCallItem {
+	item := s.newCallItem(name, arguments)
+	item.Error = &message
+	item.Status = "failed"
+	return item
+}
+
+// Call 执行工具调用并返回 mcp_call 输出项，调用失败或工具返回错误时记录在 error 中
+func (s *MCPToolSet) Call(ctx context.Context, name string, arguments string) *dto.MCPCallItem {
+	args := strings.TrimSpace(arguments)
+	if args == "" {
+		args = "{}"
+	}
+	if !json.Valid([]byte(args)) {
+		return s.CallError(name, arguments, "invalid tool arguments: not a JSON object")
+	}
+	tool := s.tools[name]
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	result, err := tool.server.client.CallTool(ctx, tool.tool.Name, json.RawMessage(args))
+	if err != nil {
+		return s.CallError(name, arguments, err.Error())
+	}
+	output := truncateMCPOutput(result.Text())
+	if result.IsError {
+		return s.CallError(name, arguments, output)
+	}
+	item := s.newCallItem(name, arguments)
+	item.Output = &output
+	return item
+}
+
+func truncateMCPOutput(output string) string {
+	limit := operation_setting.GetMCPSetting().MaxOutputKB << 10
+	if limit <= 0 || len(output) <= limit {
+		return output
+	}
+	return strings.ToValidUTF8(output[:limit], "") + "\n...(truncated)"
+}
+
+// MCPCallResultText 返回提供给模型的工具结果
+func MCPCallResultText(item *dto.MCPCallItem) string {
+	if item.Error != nil {
+		return "Error: " + *item.Error
+	}
+	if item.Output != nil {
+		return *item.Output
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// OIDCProvisionResult 按声明计算出的准入结果与用户属性
+type OIDCProvisionResult struct {
+	Allowed bool
+	Reason  string
+	Group   string
+	Role    int
+	Quota   int // 0 表示使用默认的新用户额度
+}
+
+// oidcClaimValues 取声明的值，数组展开为多个值；email_domain 由 email 声明计算
+func oidcClaimValues(claims map[string]any, claim string) []string {
+	if claim == "email_domain" {
+		if _, ok := claims["email_domain"]; !ok {
+			email, _ := claims["email"].(string)
+			if idx := strings.LastIndex(email, "@"); idx >= 0 {
+				return []string{email[idx+1:]}
+			}
+			return nil
+		}
+	}
+	var current any = claims
+	for _, part := range strings.Split(claim, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+	values := make([]string, 0)
+	switch v := current.(type) {
+	case nil:
+	case []any:
+		for _, item := range v {
+			if item != nil {
+				values = append(values, fmt.Sprint(item))
+			}
+		}
+	case string:
+		values = append(values, v)
+	default:
+		values = append(values, fmt.Sprint(v))
+	}
+	return values
+}
+
+// MatchOIDCClaim 判断声明是否满足规则，字符串比较不区分大小写
+func MatchOIDCClaim(claims map[string]any, claim string, value string) bool {
+	for _, v := range oidcClaimValues(claims, claim) {
+		if value == "*" && v != "" {
+			return true
+		}
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveOIDCProvisioning 计算声明对应的准入结果与分组、角色，未匹配映射时为默认分组与普通用户
+func ResolveOIDCProvisioning(provisioning *system_setting.OIDCProvisioning, claims map[string]any) *OIDCProvisionResult {
+	result := &OIDCProvisionResult{
+		Allowed: true,
+		Group:   "default",
+		Role:    common.RoleCommonUser,
+	}
+	for _, rule := range provisioning.DenyRules {
+		if MatchOIDCClaim(claims, rule.Claim, rule.Value) {
+			result.Allowed = false
+			result.Reason = fmt.Sprintf("%s=%s 的用户不允许登录", rule.Claim, rule.Value)
+			return result
+		}
+	}
+	if len(provisioning.AllowRules) > 0 {
+		allowed := false
+		for _, rule := range provisioning.AllowRules {
+			if MatchOIDCClaim(claims, rule.Claim, rule.Value) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			result.Allowed = false
+			result.Reason = "不满足 OIDC 准入规则"
+			return result
+		}
+	}
+	for _, mapping := range provisioning.Mappings {
+		if !MatchOIDCClaim(claims, mapping.Claim, mapping.Value) {
+			continue
+		}
+		if mapping.Group != "" {
+			result.Group = mapping.Group
+		}
+		if mapping.Role != 0 {
+			result.Role = mapping.Role
+		}
+		if mapping.Quota != 0 {
+			result.Quota = mapping.Quota
+		}
+	}
+	return result
+}
+
+// IsOIDCEmailVerified 声明中的 email_verified 是否为 true，部分提供方以字符串返回
+func IsOIDCEmailVerified(claims map[string]any) bool {
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
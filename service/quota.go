@@ -90,7 +90,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	if relayInfo.UsePrice {
 		return nil
 	}
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	spendableQuota, userQuota, err := model.GetUserSpendableQuota(relayInfo.UserId)
 	if err != nil {
 		return err
 	}
@@ -120,6 +120,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	if ok {
 		actualGroupRatio = userGroupRatio
 	}
+	actualGroupRatio *= relayInfo.GetResellerMarkup()
 
 	quotaInfo := QuotaInfo{
 		InputDetails: TokenDetails{
@@ -138,7 +139,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 
 	quota := calculateAudioQuota(quotaInfo)
 
-	if userQuota < quota {
+	if spendableQuota < quota {
 		return fmt.Errorf("user quota is not enough, user quota: %s, need quota: %s", logger.FormatQuota(userQuota), logger.FormatQuota(quota))
 	}
 
@@ -146,8 +147,17 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", logger.FormatQuota(token.RemainQuota), logger.FormatQuota(quota))
 	}
 
-	err = PostConsumeQuota(relayInfo, quota, 0, false)
+	// realtime 会话按轮次扣费，临时密钥的消费上限在扣费前原子校验
+	if relayInfo.EphemeralKeyId != 0 {
+		if err := model.ConsumeEphemeralKeyQuota(relayInfo.EphemeralKeyId, quota); err != nil {
+			return err
+		}
+	}
+	err = postConsumeQuota(relayInfo, quota, 0, false, false)
 	if err != nil {
+		if relayInfo.EphemeralKeyId != 0 {
+			_ = model.IncreaseEphemeralKeyUsedQuota(relayInfo.EphemeralKeyId, -quota)
+		}
 		return err
 	}
 	logger.LogInfo(ctx, "realtime streaming consume quota success, quota: "+fmt.Sprintf("%d", quota))
@@ -494,14 +504,32 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	if !relayInfo.TokenUnlimited && token.RemainQuota < quota {
 		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", logger.FormatQuota(token.RemainQuota), logger.FormatQuota(quota))
 	}
+	// 临时密钥的消费上限在累加时原子校验，避免并发请求超额
+	if relayInfo.EphemeralKeyId != 0 {
+		if err := model.ConsumeEphemeralKeyQuota(relayInfo.EphemeralKeyId, quota); err != nil {
+			return err
+		}
+	}
 	err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
 	if err != nil {
+		if relayInfo.EphemeralKeyId != 0 {
+			_ = model.IncreaseEphemeralKeyUsedQuota(relayInfo.EphemeralKeyId, -quota)
+		}
 		return err
 	}
+	// 预扣费可能恰好用完令牌额度，之后的补扣差额为 0 时不会再检查
+	if quota > 0 && !relayInfo.TokenUnlimited {
+		checkAndPublishTokenExhausted(relayInfo, quota)
+	}
 	return nil
 }
 
 func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool) (err error) {
+	return postConsumeQuota(relayInfo, quota, preConsumedQuota, sendEmail, true)
+}
+
+// postConsumeQuota countEphemeral 为 false 时调用方已自行累加临时密钥的消费额度
+func postConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool, countEphemeral bool) (err error) {
 
 	if quota > 0 {
 		err = model.DecreaseUserQuota(relayInfo.UserId, quota)
@@ -521,6 +549,14 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		if err != nil {
 			return err
 		}
+		if quota > 0 && !relayInfo.TokenUnlimited {
+			checkAndPublishTokenExhausted(relayInfo, quota)
+		}
+		if relayInfo.EphemeralKeyId != 0 && countEphemeral {
+			if err := model.IncreaseEphemeralKeyUsedQuota(relayInfo.EphemeralKeyId, quota); err != nil {
+				common.SysLog("failed to update ephemeral key used quota: " + err.Error())
+			}
+		}
 	}
 
 	if sendEmail {
@@ -532,6 +568,26 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 	return nil
 }
 
+// checkAndPublishTokenExhausted 令牌额度在本次扣费（预扣费或补扣差额）后耗尽时发布事件
+func checkAndPublishTokenExhausted(relayInfo *relaycommon.RelayInfo, quota int) {
+	gopool.Go(func() {
+		token, err := model.GetTokenByKey(relayInfo.TokenKey, true)
+		if err != nil || token.UnlimitedQuota {
+			return
+		}
+		// 仅在本次扣费使余额从正数变为非正数时发布，避免重复
+		if token.RemainQuota > 0 || token.RemainQuota+quota <= 0 {
+			return
+		}
+		PublishEvent(dto.EventTypeTokenExhausted, relayInfo.UserId, map[string]any{
+			"token_id":     token.Id,
+			"token_name":   token.Name,
+			"used_quota":   token.UsedQuota,
+			"remain_quota": token.RemainQuota,
+		})
+	})
+}
+
 func checkAndSendQuotaNotify(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int) {
 	gopool.Go(func() {
 		userSetting := relayInfo.UserSetting
@@ -547,6 +603,12 @@ func checkAndSendQuotaNotify(relayInfo *relaycommon.RelayInfo, quota int, preCon
 			quotaTooLow = true
 		}
 		if quotaTooLow {
+			if canPublish, _ := CheckNotificationLimit(relayInfo.UserId, dto.EventTypeQuotaLow); canPublish {
+				PublishEvent(dto.EventTypeQuotaLow, relayInfo.UserId, map[string]any{
+					"quota":     relayInfo.UserQuota - consumeQuota,
+					"threshold": threshold,
+				})
+			}
 			prompt := "您的额度即将用尽"
 			topUpLink := fmt.Sprintf("%s/console/topup", system_setting.ServerAddress)
 
@@ -563,7 +625,7 @@ func checkAndSendQuotaNotify(relayInfo *relaycommon.RelayInfo, quota int, preCon
 				// Bark推送使用简短文本，不支持HTML
 				content = "{{value}}，剩余额度：{{value}}，请及时充值"
 				values = []interface{}{prompt, logger.FormatQuota(relayInfo.UserQuota)}
-			} else if notifyType == dto.NotifyTypeGotify {
+			} else if notifyType == dto.NotifyTypeGotify || IsChatOpsNotifyType(notifyType) {
 				content = "{{value}}，当前剩余额度为 {{value}}，请及时充值。"
 				values = []interface{}{prompt, logger.FormatQuota(relayInfo.UserQuota)}
 			} else {
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"gorm.io/gorm"
+)
+
+// ErrPreviousResponseNotFound previous_response_id 在网关中不存在或已过期
+var ErrPreviousResponseNotFound = errors.New("previous response not found")
+
+// IsResponseStoreEnabled 是否由网关保存 Responses API 的响应
+func IsResponseStoreEnabled() bool {
+	return operation_setting.GetResponseStoreSetting().Enabled
+}
+
+// NormalizeResponsesInput 将 input 统一为输入项数组，字符串视为一条用户消息
+func NormalizeResponsesInput(input []byte) ([]map[string]any, error) {
+	switch common.GetJsonType(input) {
+	case "string":
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, err
+		}
+		return []map[string]any{{"type": "message", "role": "user", "content": text}}, nil
+	case "array":
+		var items []map[string]any
+		if err := common.Unmarshal(input, &items); err != nil {
+			return nil, fmt.Errorf("invalid input items: %w", err)
+		}
+		return items, nil
+	case "unknown", "null":
+		return nil, nil
+	}
+	return nil, errors.New("input must be a string or an array")
+}
+
+// ReplayResponsesItem 生成发往上游的历史输入项：去掉网关或原上游生成的 id，
+// 没有 encrypted_content 的 reasoning 项只能在原上游展开，直接丢弃；
+// mcp 输出项保留 id，供 mcp_approval_response 引用
+func ReplayResponsesItem(item map[string]any) map[string]any {
+	itemType, _ := item["type"].(string)
+	if itemType == "reasoning" {
+		if encrypted, _ := item["encrypted_content"].(string); encrypted == "" {
+			return nil
+		}
+	}
+	replay := make(map[string]any, len(item))
+	for k, v := range item {
+		if k == "id" && itemType != "item_reference" && !strings.HasPrefix(itemType, "mcp_") {
+			continue
+		}
+		replay[k] = v
+	}
+	return replay
+}
+
+// storedResponseItems 返回保存的响应对应的完整对话：之前的输入加上本次输出
+func storedResponseItems(stored *model.StoredResponse) ([]map[string]any, error) {
+	var items []map[string]any
+	if len(stored.InputItems) > 0 {
+		if err := common.Unmarshal(stored.InputItems, &items); err != nil {
+			return nil, err
+		}
+	}
+	var response struct {
+		Output []map[string]any `json:"output"`
+	}
+	if err := common.Unmarshal(stored.Response, &response); err != nil {
+		return nil, err
+	}
+	return append(items, response.Output...), nil
+}
+
+// PrepareResponsesRequest 在选择渠道前展开 previous_response_id，使重试切换到任意渠道时都携带完整上下文；
+// 网关中找不到对应响应时返回 ErrPreviousResponseNotFound。全局透传请求时上游收到的是原始请求体，不做处理
+func PrepareResponsesRequest(c *gin.Context, request *dto.OpenAIResponsesRequest) error {
+	if !IsResponseStoreEnabled() || model_setting.GetGlobalSettings().PassThroughRequestEnabled {
+		return nil
+	}
+	current, err := NormalizeResponsesInput(request.Input)
+	if err != nil {
+		return err
+	}
+
+	var history []map[string]any
+	if request.PreviousResponseID != "" {
+		stored, err := model.GetStoredResponse(c.GetInt("id"), request.PreviousResponseID, common.GetTimestamp())
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: %s", ErrPreviousResponseNotFound, request.PreviousResponseID)
+			}
+			return fmt.Errorf("failed to load previous response: %w", err)
+		}
+		history, err = storedResponseItems(stored)
+		if err != nil {
+			return fmt.Errorf("failed to load previous response: %w", err)
+		}
+		upstreamItems := make([]map[string]any, 0, len(history)+len(current))
+		for _, item := range history {
+			if replay := ReplayResponsesItem(item); replay != nil {
+				upstreamItems = append(upstreamItems, replay)
+			}
+		}
+		upstreamItems = append(upstreamItems, current...)
+		input, err := common.Marshal(upstreamItems)
+		if err != nil {
+			return err
+		}
+		request.Input = input
+		common.SetContextKey(c, constant.ContextKeyResponsesPreviousId, request.PreviousResponseID)
+		request.PreviousResponseID = ""
+	}
+
+	// store 默认为 true，与 OpenAI 一致
+	if string(request.Store) == "false" {
+		return nil
+	}
+	items := make([]map[string]any, 0, len(history)+len(current))
+	items = append(items, history...)
+	for _, item := range current {
+		if id, _ := item["id"].(string); id == "" {
+			stored := make(map[string]any, len(item)+1)
+			for k, v := range item {
+				stored[k] = v
+			}
+			stored["id"] = "msg_" + common.GetUUID()
+			item = stored
+		}
+		items = append(items, item)
+	}
+	common.SetContextKey(c, constant.ContextKeyResponsesInputItems, items)
+	return nil
+}
+
+// SaveResponsesResult 保存上游返回的响应对象，失败只记录日志，不影响本次请求
+func SaveResponsesResult(c *gin.Context) {
+	setting := operation_setting.GetResponseStoreSetting()
+	if !setting.Enabled {
+		return
+	}
+	items, ok := common.GetContextKeyType[[]map[string]any](c, constant.ContextKeyResponsesInputItems)
+	if !ok {
+		return
+	}
+	result, ok := common.GetContextKeyType[[]byte](c, constant.ContextKeyResponsesResult)
+	if !ok || len(result) == 0 {
+		return
+	}
+	responseId := gjson.GetBytes(result, "id").String()
+	if responseId == "" {
+		return
+	}
+	// 上游收到的是展开后的输入，保存时还原客户端传入的 previous_response_id
+	if previousId := common.GetContextKeyString(c, constant.ContextKeyResponsesPreviousId); previousId != "" {
+		if patched, err := sjson.SetBytes(result, "previous_response_id", previousId); err == nil {
+			result = patched
+		}
+	}
+	inputItems, err := common.Marshal(items)
+	if err != nil {
+		logger.LogError(c, "failed to marshal responses input items: "+err.Error())
+		return
+	}
+	size := int64(len(inputItems) + len(result))
+	if setting.MaxResponseKB > 0 && size > int64(setting.MaxResponseKB)<<10 {
+		logger.LogWarn(c, fmt.Sprintf("response %s is too large to store: %d bytes", responseId, size))
+		return
+	}
+
+	userId := c.GetInt("id")
+	now := common.GetTimestamp()
+	record := &model.StoredResponse{
+		ResponseId:  responseId,
+		UserId:      userId,
+		Model:       gjson.GetBytes(result, "model").String(),
+		InputItems:  inputItems,
+		Response:    result,
+		Size:        size,
+		CreatedTime: now,
+	}
+	if setting.TTLHours > 0 {
+		record.ExpiresTime = now + int64(setting.TTLHours)*3600
+	}
+	if err := record.Insert(); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to store response %s: %s", responseId, err.Error()))
+		return
+	}
+	if setting.UserStorageMB > 0 {
+		if _, err := model.TrimUserStoredResponses(userId, int64(setting.UserStorageMB)<<20); err != nil {
+			logger.LogError(c, "failed to trim stored responses: "+err.Error())
+		}
+	}
+}
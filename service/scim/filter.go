@@ -0,0 +1,514 @@
+package scim
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 实现 RFC 7644 3.4.2.2 中 IdP 常用的过滤语法：
+//   userName eq "alice"、externalId eq "x"、emails[type eq "work"].value eq "a@b.c"、
+//   members[value eq "12"]、meta.lastModified gt "..."，以及 and / or / not / 括号组合。
+// 资源以 map[string]any 表示，属性名大小写不敏感，字符串比较大小写不敏感。
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+type Filter interface {
+	Match(resource map[string]any) bool
+}
+
+type logicalFilter struct {
+	op          string // and / or
+	left, right Filter
+}
+
+func (f *logicalFilter) Match(resource map[string]any) bool {
+	if f.op == "and" {
+		return f.left.Match(resource) && f.right.Match(resource)
+	}
+	return f.left.Match(resource) || f.right.Match(resource)
+}
+
+type notFilter struct {
+	child Filter
+}
+
+func (f *notFilter) Match(resource map[string]any) bool {
+	return !f.child.Match(resource)
+}
+
+type attrFilter struct {
+	path  []string
+	op    string
+	value any
+}
+
+func (f *attrFilter) Match(resource map[string]any) bool {
+	return compareValues(resolvePath(resource, f.path), f.op, f.value)
+}
+
+// valuePathFilter 形如 emails[type eq "work"] 或 emails[type eq "work"].value eq "x"
+type valuePathFilter struct {
+	attr   string
+	filter Filter
+	sub    []string
+	op     string
+	value  any
+}
+
+func (f *valuePathFilter) Match(resource map[string]any) bool {
+	for _, elem := range f.Elements(resource) {
+		if len(f.sub) == 0 {
+			return true
+		}
+		if compareValues(resolvePath(elem, f.sub), f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Elements 返回多值属性中满足方括号内条件的元素
+func (f *valuePathFilter) Elements(resource map[string]any) []map[string]any {
+	elems := make([]map[string]any, 0)
+	for _, v := range asList(getAttr(resource, f.attr)) {
+		elem, ok := v.(map[string]any)
+		if ok && f.filter.Match(elem) {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+// ParseFilter 解析过滤表达式
+func ParseFilter(input string) (Filter, error) {
+	p, err := newParser(input)
+	if err != nil {
+		return nil, err
+	}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, p.peek().text)
+	}
+	return f, nil
+}
+
+// Path PATCH 操作的目标路径：attr[filter].sub
+type Path struct {
+	Attr   string
+	Filter *valuePathFilter // 可为空
+	Sub    string           // 可为空
+}
+
+// ParsePath 解析 PATCH 操作的 path，如 active、name.givenName、emails[type eq "work"].value、members[value eq "1"]
+func ParsePath(input string) (*Path, error) {
+	p, err := newParser(input)
+	if err != nil {
+		return nil, err
+	}
+	tok := p.next()
+	if tok.kind != tokenIdent {
+		return nil, fmt.Errorf("%w: invalid path %q", ErrInvalidFilter, input)
+	}
+	parts := splitAttrPath(tok.text)
+	path := &Path{Attr: parts[0]}
+	if len(parts) > 1 {
+		path.Sub = parts[1]
+	}
+	if p.peek().kind == tokenLBracket {
+		if len(parts) > 1 {
+			return nil, fmt.Errorf("%w: invalid path %q", ErrInvalidFilter, input)
+		}
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokenRBracket {
+			return nil, fmt.Errorf("%w: missing ]", ErrInvalidFilter)
+		}
+		path.Filter = &valuePathFilter{attr: path.Attr, filter: inner}
+		if p.peek().kind == tokenIdent && strings.HasPrefix(p.peek().text, ".") {
+			path.Sub = strings.TrimPrefix(p.next().text, ".")
+		}
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("%w: invalid path %q", ErrInvalidFilter, input)
+	}
+	return path, nil
+}
+
+// MatchElements 返回路径方括号条件匹配的元素，无条件时返回全部元素
+func (path *Path) MatchElements(resource map[string]any) []map[string]any {
+	if path.Filter != nil {
+		return path.Filter.Elements(resource)
+	}
+	elems := make([]map[string]any, 0)
+	for _, v := range asList(getAttr(resource, path.Attr)) {
+		if elem, ok := v.(map[string]any); ok {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+const (
+	tokenIdent = iota
+	tokenString
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenEOF
+)
+
+type token struct {
+	kind int
+	text string
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func newParser(input string) (*parser, error) {
+	tokens := make([]token, 0)
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")"})
+			i++
+		case r == '[':
+			tokens = append(tokens, token{kind: tokenLBracket, text: "["})
+			i++
+		case r == ']':
+			tokens = append(tokens, token{kind: tokenRBracket, text: "]"})
+			i++
+		case r == '"':
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sb.String()})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("()[]\"", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i])})
+		}
+	}
+	return &parser{tokens: tokens}, nil
+}
+
+func (p *parser) peek() token {
+	if p.pos >= len(p.tokens) {
+		return token{kind: tokenEOF}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.kind == tokenIdent && strings.EqualFold(tok.text, keyword)
+}
+
+func (p *parser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalFilter{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalFilter{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Filter, error) {
+	if p.isKeyword("not") {
+		p.next()
+		if p.peek().kind != tokenLParen {
+			return nil, fmt.Errorf("%w: expected ( after not", ErrInvalidFilter)
+		}
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notFilter{child: child}, nil
+	}
+	if p.peek().kind == tokenLParen {
+		p.next()
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokenRParen {
+			return nil, fmt.Errorf("%w: missing )", ErrInvalidFilter)
+		}
+		return f, nil
+	}
+	return p.parseAttrExpr()
+}
+
+func (p *parser) parseAttrExpr() (Filter, error) {
+	tok := p.next()
+	if tok.kind != tokenIdent {
+		return nil, fmt.Errorf("%w: expected attribute, got %q", ErrInvalidFilter, tok.text)
+	}
+	path := splitAttrPath(tok.text)
+	if p.peek().kind == tokenLBracket {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokenRBracket {
+			return nil, fmt.Errorf("%w: missing ]", ErrInvalidFilter)
+		}
+		vp := &valuePathFilter{attr: path[0], filter: inner}
+		if p.peek().kind == tokenIdent && strings.HasPrefix(p.peek().text, ".") {
+			vp.sub = splitAttrPath(strings.TrimPrefix(p.next().text, "."))
+			op, value, err := p.parseComparison()
+			if err != nil {
+				return nil, err
+			}
+			vp.op, vp.value = op, value
+		}
+		return vp, nil
+	}
+	op, value, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	return &attrFilter{path: path, op: op, value: value}, nil
+}
+
+func (p *parser) parseComparison() (string, any, error) {
+	opTok := p.next()
+	op := strings.ToLower(opTok.text)
+	switch op {
+	case "pr":
+		return op, nil, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return "", nil, fmt.Errorf("%w: unsupported operator %q", ErrInvalidFilter, opTok.text)
+	}
+	valTok := p.next()
+	switch valTok.kind {
+	case tokenString:
+		return op, valTok.text, nil
+	case tokenIdent:
+		switch strings.ToLower(valTok.text) {
+		case "true":
+			return op, true, nil
+		case "false":
+			return op, false, nil
+		case "null":
+			return op, nil, nil
+		}
+		if n, err := strconv.ParseFloat(valTok.text, 64); err == nil {
+			return op, n, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%w: invalid value %q", ErrInvalidFilter, valTok.text)
+}
+
+// splitAttrPath 去掉 schema URN 前缀后按 . 拆分属性路径
+func splitAttrPath(path string) []string {
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		if idx := strings.LastIndex(path, ":"); idx >= 0 {
+			path = path[idx+1:]
+		}
+	}
+	return strings.Split(path, ".")
+}
+
+func getAttr(resource map[string]any, name string) any {
+	if v, ok := resource[name]; ok {
+		return v
+	}
+	for k, v := range resource {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+func asList(v any) []any {
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		return value
+	case []map[string]any:
+		list := make([]any, 0, len(value))
+		for _, m := range value {
+			list = append(list, m)
+		}
+		return list
+	default:
+		return []any{value}
+	}
+}
+
+// resolvePath 按路径取值，途经多值属性时展开为全部元素的值
+func resolvePath(resource map[string]any, path []string) []any {
+	current := []any{resource}
+	for _, name := range path {
+		nextValues := make([]any, 0)
+		for _, v := range current {
+			m, ok := v.(map[string]any)
+			if !ok {
+				continue
+			}
+			nextValues = append(nextValues, asList(getAttr(m, name))...)
+		}
+		current = nextValues
+	}
+	return current
+}
+
+func compareValues(values []any, op string, expected any) bool {
+	if op == "pr" {
+		for _, v := range values {
+			if v != nil && v != "" {
+				return true
+			}
+		}
+		return false
+	}
+	if op == "ne" {
+		return !compareValues(values, "eq", expected)
+	}
+	for _, v := range values {
+		if compareValue(v, op, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+func compareValue(actual any, op string, expected any) bool {
+	switch exp := expected.(type) {
+	case nil:
+		return op == "eq" && actual == nil
+	case bool:
+		act, ok := actual.(bool)
+		return ok && op == "eq" && act == exp
+	case float64:
+		act, ok := toFloat(actual)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return act == exp
+		case "gt":
+			return act > exp
+		case "ge":
+			return act >= exp
+		case "lt":
+			return act < exp
+		case "le":
+			return act <= exp
+		}
+		return false
+	case string:
+		act := strings.ToLower(fmt.Sprintf("%v", actual))
+		e := strings.ToLower(exp)
+		switch op {
+		case "eq":
+			return act == e
+		case "co":
+			return strings.Contains(act, e)
+		case "sw":
+			return strings.HasPrefix(act, e)
+		case "ew":
+			return strings.HasSuffix(act, e)
+		case "gt":
+			return act > e
+		case "ge":
+			return act >= e
+		case "lt":
+			return act < e
+		case "le":
+			return act <= e
+		}
+	}
+	return false
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
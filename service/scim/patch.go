@@ -0,0 +1,206 @@
+package scim
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidPath  = errors.New("invalid path")
+	ErrInvalidValue = errors.New("invalid value")
+)
+
+// PatchOperation RFC 7644 3.5.2 的单个 PATCH 操作
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// ApplyPatch 将 PATCH 操作依次应用到资源上。
+// 兼容 Okta（无 path、value 为属性集合）与 Azure AD（op 大写、带 path、布尔值为字符串）的写法
+func ApplyPatch(resource map[string]any, ops []PatchOperation) error {
+	for _, op := range ops {
+		name := strings.ToLower(op.Op)
+		if name != "add" && name != "replace" && name != "remove" {
+			return fmt.Errorf("%w: unsupported op %q", ErrInvalidValue, op.Op)
+		}
+		if err := applyPatchOperation(resource, name, strings.TrimSpace(op.Path), op.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyPatchOperation(resource map[string]any, op string, pathStr string, value any) error {
+	if pathStr == "" {
+		if op == "remove" {
+			return fmt.Errorf("%w: remove requires path", ErrInvalidPath)
+		}
+		values, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%w: value must be an object when path is empty", ErrInvalidValue)
+		}
+		for k, v := range values {
+			// Azure AD 会在无 path 时使用 name.givenName 这类带点的键
+			if err := applyPatchOperation(resource, op, k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path, err := ParsePath(pathStr)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPath, err.Error())
+	}
+	if path.Filter == nil {
+		if path.Sub == "" {
+			return patchAttr(resource, op, path.Attr, value)
+		}
+		parent, _ := getAttr(resource, path.Attr).(map[string]any)
+		if parent == nil {
+			if op == "remove" {
+				return nil
+			}
+			parent = make(map[string]any)
+			setAttr(resource, path.Attr, parent)
+		}
+		return patchAttr(parent, op, path.Sub, value)
+	}
+
+	list := asList(getAttr(resource, path.Attr))
+	if op == "remove" {
+		kept := make([]any, 0, len(list))
+		for _, v := range list {
+			elem, ok := v.(map[string]any)
+			if !ok || !path.Filter.filter.Match(elem) {
+				kept = append(kept, v)
+				continue
+			}
+			if path.Sub != "" {
+				deleteAttr(elem, path.Sub)
+				kept = append(kept, elem)
+			}
+		}
+		setAttr(resource, path.Attr, kept)
+		return nil
+	}
+	elems := path.Filter.Elements(resource)
+	if len(elems) == 0 {
+		// 目标元素不存在时按方括号内的 eq 条件新建，例如 emails[type eq "work"].value
+		elem := make(map[string]any)
+		if f, ok := path.Filter.filter.(*attrFilter); ok && f.op == "eq" && len(f.path) == 1 {
+			elem[f.path[0]] = f.value
+		}
+		setAttr(resource, path.Attr, append(list, elem))
+		elems = []map[string]any{elem}
+	}
+	for _, elem := range elems {
+		if path.Sub != "" {
+			setAttr(elem, path.Sub, value)
+			continue
+		}
+		values, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%w: value must be an object", ErrInvalidValue)
+		}
+		for k, v := range values {
+			setAttr(elem, k, v)
+		}
+	}
+	return nil
+}
+
+// patchAttr 对单个属性执行操作，多值属性的 add 为追加，remove 可带 value 只移除指定元素
+func patchAttr(resource map[string]any, op string, name string, value any) error {
+	current := getAttr(resource, name)
+	switch op {
+	case "remove":
+		if value == nil {
+			deleteAttr(resource, name)
+			return nil
+		}
+		removing := make(map[string]bool)
+		for _, v := range asList(value) {
+			if m, ok := v.(map[string]any); ok {
+				removing[fmt.Sprint(getAttr(m, "value"))] = true
+			}
+		}
+		kept := make([]any, 0)
+		for _, v := range asList(current) {
+			if m, ok := v.(map[string]any); ok && removing[fmt.Sprint(getAttr(m, "value"))] {
+				continue
+			}
+			kept = append(kept, v)
+		}
+		setAttr(resource, name, kept)
+	case "add":
+		if _, isList := current.([]any); isList {
+			setAttr(resource, name, append(asList(current), asList(value)...))
+			return nil
+		}
+		if currentMap, ok := current.(map[string]any); ok {
+			if values, ok := value.(map[string]any); ok {
+				for k, v := range values {
+					setAttr(currentMap, k, v)
+				}
+				return nil
+			}
+		}
+		setAttr(resource, name, value)
+	default:
+		setAttr(resource, name, value)
+	}
+	return nil
+}
+
+// setAttr 设置属性，键名大小写不敏感，已有同名键时沿用原键名
+func setAttr(resource map[string]any, name string, value any) {
+	parts := splitAttrPath(name)
+	for _, part := range parts[:len(parts)-1] {
+		child, _ := getAttr(resource, part).(map[string]any)
+		if child == nil {
+			child = make(map[string]any)
+			setAttr(resource, part, child)
+		}
+		resource = child
+	}
+	name = parts[len(parts)-1]
+	for k := range resource {
+		if strings.EqualFold(k, name) {
+			resource[k] = value
+			return
+		}
+	}
+	resource[name] = value
+}
+
+func deleteAttr(resource map[string]any, name string) {
+	parts := splitAttrPath(name)
+	for _, part := range parts[:len(parts)-1] {
+		child, _ := getAttr(resource, part).(map[string]any)
+		if child == nil {
+			return
+		}
+		resource = child
+	}
+	for k := range resource {
+		if strings.EqualFold(k, parts[len(parts)-1]) {
+			delete(resource, k)
+		}
+	}
+}
+
+// GetAttr 按属性路径取值，键名大小写不敏感
+func GetAttr(resource map[string]any, name string) any {
+	values := resolvePath(resource, splitAttrPath(name))
+	if len(values) == 0 {
+		return nil
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
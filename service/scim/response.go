@@ -0,0 +1,55 @@
+package scim
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	ContentType = "application/scim+json"
+)
+
+// Render 以 application/scim+json 输出资源
+func Render(c *gin.Context, status int, body any) {
+	data, err := common.Marshal(body)
+	if err != nil {
+		RenderError(c, 500, "", err.Error())
+		return
+	}
+	c.Data(status, ContentType+"; charset=utf-8", data)
+}
+
+// RenderError 输出 RFC 7644 3.12 格式的错误
+func RenderError(c *gin.Context, status int, scimType string, detail string) {
+	body := gin.H{
+		"schemas": []string{SchemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	Render(c, status, body)
+}
+
+// ListResponse 列表响应，startIndex 从 1 开始
+func ListResponse(resources []map[string]any, total int, startIndex int) gin.H {
+	return gin.H{
+		"schemas":      []string{SchemaListResponse},
+		"totalResults": total,
+		"startIndex":   startIndex,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	}
+}
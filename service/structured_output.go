@@ -0,0 +1,195 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+const (
+	StructuredOutputModeNative = "native" // 上游原生支持 json_schema，只校验结果
+	StructuredOutputModePrompt = "prompt" // 在系统提示词中注入 schema
+	StructuredOutputModeTool   = "tool"   // 以 schema 作为参数强制调用工具
+)
+
+const structuredOutputSchemaURL = "mem://response_format/schema.json"
+
+var trailingCommaRegex = regexp.MustCompile(`,\s*([}\]])`)
+
+// StructuredOutputSchema 请求中 response_format 描述的输出格式
+type StructuredOutputSchema struct {
+	Name        string
+	Description string
+	// Schema 原始的 JSON Schema，json_object 时为 nil
+	Schema   any
+	compiled *jsonschema.Schema
+}
+
+// ParseStructuredOutputSchema 解析 response_format，非 json_schema/json_object 时返回 nil
+func ParseStructuredOutputSchema(format *dto.ResponseFormat) (*StructuredOutputSchema, error) {
+	if format == nil {
+		return nil, nil
+	}
+	switch format.Type {
+	case "json_object":
+		return &StructuredOutputSchema{Name: "json_response"}, nil
+	case "json_schema":
+	default:
+		return nil, nil
+	}
+
+	var formatSchema dto.FormatJsonSchema
+	if err := common.Unmarshal(format.JsonSchema, &formatSchema); err != nil {
+		return nil, fmt.Errorf("invalid response_format.json_schema: %w", err)
+	}
+	if formatSchema.Schema == nil {
+		return nil, errors.New("response_format.json_schema.schema is required")
+	}
+	schemaBytes, err := common.Marshal(formatSchema.Schema)
+	if err != nil {
+		return nil, err
+	}
+	// 使用 jsonschema 自带的解析，保证数字精度与校验一致
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schemaBytes))
+	if err != nil {
+		return nil, fmt.Errorf("invalid response_format schema: %w", err)
+	}
+	compiler := jsonschema.NewCompiler()
+	// 不允许加载外部 $ref
+	compiler.UseLoader(jsonschema.SchemeURLLoader{})
+	if err := compiler.AddResource(structuredOutputSchemaURL, doc); err != nil {
+		return nil, fmt.Errorf("invalid response_format schema: %w", err)
+	}
+	compiled, err := compiler.Compile(structuredOutputSchemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response_format schema: %w", err)
+	}
+
+	name := formatSchema.Name
+	if name == "" {
+		name = "json_response"
+	}
+	return &StructuredOutputSchema{
+		Name:        name,
+		Description: formatSchema.Description,
+		Schema:      formatSchema.Schema,
+		compiled:    compiled,
+	}, nil
+}
+
+// Instruction 生成注入系统提示词的格式要求
+func (s *StructuredOutputSchema) Instruction() string {
+	var sb strings.Builder
+	if s.Schema == nil {
+		sb.WriteString("You must respond with a single valid JSON object.")
+	} else {
+		schemaBytes, _ := common.Marshal(s.Schema)
+		sb.WriteString("You must respond with a single JSON value that conforms to the following JSON Schema")
+		if s.Description != "" {
+			sb.WriteString(" (")
+			sb.WriteString(s.Description)
+			sb.WriteString(")")
+		}
+		sb.WriteString(":\n")
+		sb.Write(schemaBytes)
+	}
+	sb.WriteString("\nOutput only the JSON itself, without markdown code fences, comments or any other text.")
+	return sb.String()
+}
+
+// ToolParameters 强制工具调用时使用的参数 schema
+func (s *StructuredOutputSchema) ToolParameters() any {
+	if s.Schema == nil {
+		return map[string]any{"type": "object"}
+	}
+	return s.Schema
+}
+
+// Validate 校验模型输出，必要时先做本地修复（去掉代码块、截取 JSON、删除多余逗号），
+// 返回可直接交给客户端的 JSON 文本
+func (s *StructuredOutputSchema) Validate(output string) (string, error) {
+	var firstErr error
+	for _, candidate := range repairJSONCandidates(output) {
+		err := s.validate(candidate)
+		if err == nil {
+			return candidate, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return output, firstErr
+}
+
+func (s *StructuredOutputSchema) validate(text string) error {
+	instance, err := jsonschema.UnmarshalJSON(strings.NewReader(text))
+	if err != nil {
+		return fmt.Errorf("output is not valid JSON: %v", err)
+	}
+	if s.compiled == nil {
+		if _, ok := instance.(map[string]any); !ok {
+			return errors.New("output is not a JSON object")
+		}
+		return nil
+	}
+	if err := s.compiled.Validate(instance); err != nil {
+		// 去掉首行的 schema 地址，只保留具体的错误位置
+		lines := strings.Split(strings.TrimSpace(err.Error()), "\n")
+		if len(lines) > 1 {
+			lines = lines[1:]
+		}
+		for i, line := range lines {
+			lines[i] = strings.TrimPrefix(strings.TrimSpace(line), "- ")
+		}
+		return fmt.Errorf("output does not match the schema: %s", strings.Join(lines, "; "))
+	}
+	return nil
+}
+
+// repairJSONCandidates 按修复程度由轻到重列出候选文本
+func repairJSONCandidates(output string) []string {
+	candidates := []string{output}
+	add := func(s string) {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return
+		}
+		for _, c := range candidates {
+			if c == s {
+				return
+			}
+		}
+		candidates = append(candidates, s)
+	}
+
+	text := strings.TrimSpace(output)
+	add(text)
+	// 去掉 markdown 代码块
+	if start := strings.Index(text, "```"); start >= 0 {
+		rest := text[start+3:]
+		if newline := strings.IndexByte(rest, '\n'); newline >= 0 {
+			rest = rest[newline+1:]
+		}
+		if end := strings.LastIndex(rest, "```"); end >= 0 {
+			rest = rest[:end]
+		}
+		text = strings.TrimSpace(rest)
+		add(text)
+	}
+	// 截取第一个 { 或 [ 到最后一个 } 或 ] 之间的内容
+	if start := strings.IndexAny(text, "{["); start >= 0 {
+		if end := strings.LastIndexAny(text, "}]"); end > start {
+			text = text[start : end+1]
+			add(text)
+		}
+	}
+	add(trailingCommaRegex.ReplaceAllString(text, "$1"))
+	return candidates
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const taskCallbackEvent = "task.finished"
+
+// ValidateTaskCallbackUrl 校验任务回调地址，必须为 http(s) 且通过 SSRF 防护检查
+func ValidateTaskCallbackUrl(callbackUrl string) error {
+	if len(callbackUrl) > 1024 {
+		return fmt.Errorf("callback_url is too long")
+	}
+	parsed, err := url.Parse(callbackUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid callback_url")
+	}
+	fetchSetting := system_setting.GetFetchSetting()
+	if err := common.ValidateURLWithFetchSetting(callbackUrl, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return fmt.Errorf("callback_url rejected: %v", err)
+	}
+	return nil
+}
+
+// TriggerTaskCallback 任务进入终态且已登记回调时，异步投递回调
+func TriggerTaskCallback(task *model.Task) {
+	if task.CallbackStatus != common.TaskCallbackStatusPending {
+		return
+	}
+	gopool.Go(func() {
+		DeliverTaskCallback(task)
+	})
+}
+
+// getTaskCallbackSecret 回调签名密钥：使用提交任务的令牌的专用回调密钥，未生成时不签名
+func getTaskCallbackSecret(task *model.Task) string {
+	if task.PrivateData.TokenId == 0 {
+		return ""
+	}
+	token, err := model.GetTokenById(task.PrivateData.TokenId)
+	if err != nil {
+		return ""
+	}
+	return token.CallbackSecret
+}
+
+// DeliverTaskCallback 抢占并投递任务回调，失败时按退避时间重新排期
+func DeliverTaskCallback(task *model.Task) {
+	now := common.GetTimestamp()
+	if !model.ClaimTaskCallback(task.ID, now, webhookDeliveryLeaseSeconds) {
+		return
+	}
+	maxAttempts := operation_setting.GetEventSetting().MaxAttempts
+	task.CallbackAttempts++
+
+	video := task.ToOpenAIVideo()
+	if artifact := model.GetTaskArtifact(model.ArtifactSourceTask, task.TaskID); artifact != nil {
+		video.SetMetadata("artifact_url", SignArtifactUrl(artifact))
+	}
+	payload, err := common.Marshal(video)
+	if err != nil {
+		task.CallbackStatus = common.TaskCallbackStatusFailed
+		task.CallbackError = err.Error()
+		saveTaskCallbackResult(task)
+		return
+	}
+	headers := map[string]string{
+		"X-Webhook-Event":     taskCallbackEvent,
+		"X-Webhook-Delivery":  task.TaskID + "-" + strconv.Itoa(task.CallbackAttempts),
+		"X-Webhook-Timestamp": strconv.FormatInt(now, 10),
+		"X-Task-Id":           task.TaskID,
+	}
+	statusCode, err := PostSignedWebhook(task.CallbackUrl, getTaskCallbackSecret(task), payload, headers)
+	task.CallbackCode = statusCode
+	if err == nil {
+		task.CallbackStatus = common.TaskCallbackStatusSuccess
+		task.CallbackError = ""
+		task.CallbackTime = common.GetTimestamp()
+	} else {
+		task.CallbackError = err.Error()
+		if maxAttempts > 0 && task.CallbackAttempts >= maxAttempts {
+			task.CallbackStatus = common.TaskCallbackStatusFailed
+		} else {
+			task.CallbackNextAt = common.GetTimestamp() + webhookRetryDelay(task.CallbackAttempts)
+		}
+	}
+	saveTaskCallbackResult(task)
+}
+
+func saveTaskCallbackResult(task *model.Task) {
+	if err := task.SaveCallbackResult(); err != nil {
+		common.SysError(fmt.Sprintf("failed to save callback result of task %s: %s", task.TaskID, err.Error()))
+	}
+}
+
+// RetryDueTaskCallbacks 投递所有到期的待重试任务回调
+func RetryDueTaskCallbacks() int {
+	tasks, err := model.GetDueTaskCallbacks(common.GetTimestamp(), webhookDeliveryBatchSize)
+	if err != nil {
+		common.SysError("failed to get due task callbacks: " + err.Error())
+		return 0
+	}
+	for _, task := range tasks {
+		DeliverTaskCallback(task)
+	}
+	return len(tasks)
+}
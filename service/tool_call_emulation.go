@@ -0,0 +1,453 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+)
+
+const (
+	emulatedToolCallOpenTag  = "<tool_call>"
+	emulatedToolCallCloseTag = "</tool_call>"
+)
+
+// toolCallEmulationApiTypes 聊天响应经由 OpenAI 格式处理（openai.OaiStreamHandler / OpenaiHandler）或 Ollama 处理的 API 类型，
+// 只有这些类型会从模型输出中解析模拟的工具调用
+var toolCallEmulationApiTypes = map[int]bool{
+	constant.APITypeOpenAI:      true,
+	constant.APITypeOpenRouter:  true,
+	constant.APITypeXinference:  true,
+	constant.APITypeOllama:      true,
+	constant.APITypeSiliconFlow: true,
+	constant.APITypeBaiduV2:     true,
+	constant.APITypeMoonshot:    true,
+	constant.APITypeVolcEngine:  true,
+	constant.APITypePerplexity:  true,
+	constant.APITypeDeepSeek:    true,
+	constant.APITypeMistral:     true,
+	constant.APITypeSubmodel:    true,
+	constant.APITypeMiniMax:     true,
+}
+
+// SupportsToolCallEmulation 该 API 类型是否支持通过提示词模拟函数调用
+func SupportsToolCallEmulation(apiType int) bool {
+	return toolCallEmulationApiTypes[apiType]
+}
+
+// IsToolCallEmulationEnabled 渠道或模型是否配置为通过提示词模拟函数调用，不支持的 API 类型始终返回 false
+func IsToolCallEmulationEnabled(info *relaycommon.RelayInfo) bool {
+	if info == nil || info.ChannelMeta == nil || !SupportsToolCallEmulation(info.ApiType) {
+		return false
+	}
+	return info.ChannelSetting.ToolCallEmulation ||
+		model_setting.ShouldEmulateToolCalls(info.OriginModelName) ||
+		model_setting.ShouldEmulateToolCalls(info.UpstreamModelName)
+}
+
+// ApplyToolCallEmulation 将请求中的 tools 改写为系统提示词，历史中的工具调用与工具结果改写为文本，
+// 声明的工具名记录在 info.EmulatedToolNames 中，用于解析模型输出；每次请求上游前调用
+func ApplyToolCallEmulation(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) {
+	info.EmulatedToolNames = nil
+	if !IsToolCallEmulationEnabled(info) {
+		return
+	}
+
+	hasToolMessage := false
+	for _, message := range request.Messages {
+		if message.Role == "tool" || len(message.ParseToolCalls()) > 0 {
+			hasToolMessage = true
+			break
+		}
+	}
+	if len(request.Tools) == 0 && !hasToolMessage {
+		return
+	}
+
+	request.Messages = toolMessagesToText(request.Messages)
+
+	var functions []dto.FunctionRequest
+	for _, tool := range request.Tools {
+		if tool.Type == "function" && tool.Function.Name != "" {
+			functions = append(functions, tool.Function)
+		}
+	}
+	instruction := ""
+	if len(functions) > 0 && request.ToolChoice != "none" {
+		instruction = toolCallInstruction(functions, request.ToolChoice, request.ParallelTooCalls)
+		for _, function := range functions {
+			info.EmulatedToolNames = append(info.EmulatedToolNames, function.Name)
+		}
+	}
+	request.Tools = nil
+	request.ToolChoice = nil
+	request.ParallelTooCalls = nil
+	if instruction == "" {
+		return
+	}
+
+	systemRole := request.GetSystemRoleName()
+	for i, message := range request.Messages {
+		if message.Role == systemRole && message.IsStringContent() {
+			request.Messages[i].SetStringContent(message.StringContent() + "\n\n" + instruction)
+			return
+		}
+	}
+	request.Messages = append([]dto.Message{{Role: systemRole, Content: instruction}}, request.Messages...)
+}
+
+func toolCallInstruction(functions []dto.FunctionRequest, toolChoice any, parallelToolCalls *bool) string {
+	var sb strings.Builder
+	sb.WriteString("# Tools\n\nYou may call one or more of the following tools to help with the user's request. Tool definitions:\n<tools>\n")
+	for _, function := range functions {
+		definition, _ := common.Marshal(map[string]any{
+			"name":        function.Name,
+			"description": function.Description,
+			"parameters":  function.Parameters,
+		})
+		sb.Write(definition)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("</tools>\n\n")
+	sb.WriteString("To call a tool, output a block in exactly the following format, one block per call:\n")
+	sb.WriteString(emulatedToolCallOpenTag + "\n{\"name\": \"<tool name>\", \"arguments\": <arguments as a JSON object>}\n" + emulatedToolCallCloseTag + "\n")
+	sb.WriteString("After the tool call blocks, stop and wait: the results will be provided in <tool_response> blocks in the next message. Never make up tool results. If no tool is needed, answer the user directly without any " + emulatedToolCallOpenTag + " block.")
+
+	switch choice := toolChoice.(type) {
+	case string:
+		if choice == "required" {
+			sb.WriteString("\nYou must call at least one tool in this reply.")
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			if name, _ := function["name"].(string); name != "" {
+				sb.WriteString(fmt.Sprintf("\nYou must call the tool \"%s\" in this reply.", name))
+			}
+		}
+	}
+	if parallelToolCalls != nil && !*parallelToolCalls {
+		sb.WriteString("\nCall at most one tool per reply.")
+	}
+	return sb.String()
+}
+
+// toolMessagesToText 将 assistant 的 tool_calls 改写为 <tool_call> 文本，连续的 tool 消息合并为一条 user 消息
+func toolMessagesToText(messages []dto.Message) []dto.Message {
+	toolNames := make(map[string]string)
+	result := make([]dto.Message, 0, len(messages))
+	var toolResults strings.Builder
+	flushToolResults := func() {
+		if toolResults.Len() == 0 {
+			return
+		}
+		result = append(result, dto.Message{Role: "user", Content: strings.TrimSpace(toolResults.String())})
+		toolResults.Reset()
+	}
+
+	for _, message := range messages {
+		if message.Role == "tool" {
+			name := toolNames[message.ToolCallId]
+			if name == "" && message.Name != nil {
+				name = *message.Name
+			}
+			toolResults.WriteString(fmt.Sprintf("<tool_response name=\"%s\" id=\"%s\">\n%s\n</tool_response>\n", name, message.ToolCallId, message.StringContent()))
+			continue
+		}
+		flushToolResults()
+
+		toolCalls := message.ParseToolCalls()
+		if message.Role != "assistant" || len(toolCalls) == 0 {
+			result = append(result, message)
+			continue
+		}
+		var sb strings.Builder
+		sb.WriteString(message.StringContent())
+		for _, call := range toolCalls {
+			toolNames[call.ID] = call.Function.Name
+			arguments := strings.TrimSpace(call.Function.Arguments)
+			if arguments == "" {
+				arguments = "{}"
+			}
+			if sb.Len() > 0 {
+				sb.WriteString("\n")
+			}
+			sb.WriteString(fmt.Sprintf("%s\n{\"name\": %q, \"arguments\": %s}\n%s", emulatedToolCallOpenTag, call.Function.Name, arguments, emulatedToolCallCloseTag))
+		}
+		converted := message
+		converted.ToolCalls = nil
+		converted.SetStringContent(sb.String())
+		result = append(result, converted)
+	}
+	flushToolResults()
+	return result
+}
+
+// ParseEmulatedToolCalls 从非流式响应的正文中解析模拟的工具调用
+func ParseEmulatedToolCalls(info *relaycommon.RelayInfo, response *dto.OpenAITextResponse) {
+	if len(info.EmulatedToolNames) == 0 {
+		return
+	}
+	for i := range response.Choices {
+		choice := &response.Choices[i]
+		parser := &toolCallTextParser{toolNames: info.EmulatedToolNames}
+		text, calls := parser.feed(choice.Message.StringContent())
+		flushText, flushCalls := parser.flush()
+		text += flushText
+		calls = append(calls, flushCalls...)
+		if len(calls) == 0 {
+			continue
+		}
+		toolCalls := make([]dto.ToolCallRequest, 0, len(calls))
+		for _, call := range calls {
+			toolCalls = append(toolCalls, dto.ToolCallRequest{
+				ID:   call.ID,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+				},
+			})
+		}
+		choice.Message.SetToolCalls(toolCalls)
+		if text = strings.TrimSpace(text); text != "" {
+			choice.Message.SetStringContent(text)
+		} else {
+			choice.Message.SetNullContent()
+		}
+		if choice.FinishReason == "" || choice.FinishReason == "stop" {
+			choice.FinishReason = "tool_calls"
+		}
+	}
+}
+
+// ToolCallStreamParser 从流式响应的增量正文中解析模拟的工具调用
+type ToolCallStreamParser struct {
+	toolNames []string
+	choices   map[int]*toolCallTextParser
+}
+
+// NewToolCallStreamParser 未启用模拟时返回 nil
+func NewToolCallStreamParser(info *relaycommon.RelayInfo) *ToolCallStreamParser {
+	if len(info.EmulatedToolNames) == 0 {
+		return nil
+	}
+	return &ToolCallStreamParser{
+		toolNames: info.EmulatedToolNames,
+		choices:   make(map[int]*toolCallTextParser),
+	}
+}
+
+func (p *ToolCallStreamParser) choice(index int) *toolCallTextParser {
+	parser, ok := p.choices[index]
+	if !ok {
+		parser = &toolCallTextParser{toolNames: p.toolNames}
+		p.choices[index] = parser
+	}
+	return parser
+}
+
+// Process 处理一个流式响应块，返回改写后应发送的响应块：
+// 可能是工具调用标签的文本会暂缓发送，完整的工具调用块转换为 tool_calls 增量
+func (p *ToolCallStreamParser) Process(response *dto.ChatCompletionsStreamResponse) []*dto.ChatCompletionsStreamResponse {
+	if len(response.Choices) == 0 {
+		return []*dto.ChatCompletionsStreamResponse{response}
+	}
+	var result []*dto.ChatCompletionsStreamResponse
+	choices := make([]dto.ChatCompletionsStreamResponseChoice, 0, len(response.Choices))
+	for _, choice := range response.Choices {
+		parser := p.choice(choice.Index)
+		text, calls := parser.feed(choice.Delta.GetContentString())
+		if choice.FinishReason != nil {
+			flushText, flushCalls := parser.flush()
+			text += flushText
+			calls = append(calls, flushCalls...)
+			// 结束前发送暂缓的内容，结束原因单独发送
+			if text != "" || len(calls) > 0 {
+				chunk := *response
+				chunk.Choices = []dto.ChatCompletionsStreamResponseChoice{{Index: choice.Index, Delta: choice.Delta}}
+				chunk.Usage = nil
+				setToolCallDelta(&chunk.Choices[0].Delta, text, calls)
+				result = append(result, &chunk)
+				choice.Delta = dto.ChatCompletionsStreamResponseChoiceDelta{}
+				text, calls = "", nil
+			}
+			if parser.callCount > 0 && (*choice.FinishReason == "" || *choice.FinishReason == "stop") {
+				choice.FinishReason = common.GetPointer("tool_calls")
+			}
+		}
+		setToolCallDelta(&choice.Delta, text, calls)
+		// 内容被暂缓后为空的增量不再发送
+		if choice.FinishReason == nil && isEmptyDelta(&choice.Delta) {
+			continue
+		}
+		choices = append(choices, choice)
+	}
+	if len(choices) == 0 && response.Usage == nil {
+		return result
+	}
+	response.Choices = choices
+	return append(result, response)
+}
+
+func isEmptyDelta(delta *dto.ChatCompletionsStreamResponseChoiceDelta) bool {
+	return delta.Role == "" && delta.GetContentString() == "" && delta.GetReasoningContent() == "" && len(delta.ToolCalls) == 0
+}
+
+// Flush 上游未返回结束原因时，发送剩余的暂缓内容
+func (p *ToolCallStreamParser) Flush(id string, createAt int64, model string) []*dto.ChatCompletionsStreamResponse {
+	var result []*dto.ChatCompletionsStreamResponse
+	for index, parser := range p.choices {
+		text, calls := parser.flush()
+		if text == "" && len(calls) == 0 {
+			continue
+		}
+		chunk := &dto.ChatCompletionsStreamResponse{
+			Id:      id,
+			Object:  "chat.completion.chunk",
+			Created: createAt,
+			Model:   model,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{{Index: index}},
+		}
+		setToolCallDelta(&chunk.Choices[0].Delta, text, calls)
+		result = append(result, chunk)
+	}
+	return result
+}
+
+func setToolCallDelta(delta *dto.ChatCompletionsStreamResponseChoiceDelta, text string, calls []dto.ToolCallResponse) {
+	if text != "" {
+		delta.SetContentString(text)
+	} else {
+		delta.Content = nil
+	}
+	if len(calls) > 0 {
+		delta.ToolCalls = calls
+	}
+}
+
+// toolCallTextParser 解析单个选项的正文，支持增量输入
+type toolCallTextParser struct {
+	toolNames []string
+	pending   string
+	inCall    bool
+	callCount int
+}
+
+// feed 输入一段正文，返回可以确定的普通文本和完整的工具调用
+func (p *toolCallTextParser) feed(s string) (string, []dto.ToolCallResponse) {
+	p.pending += s
+	var text strings.Builder
+	var calls []dto.ToolCallResponse
+	for {
+		if !p.inCall {
+			if idx := strings.Index(p.pending, emulatedToolCallOpenTag); idx >= 0 {
+				text.WriteString(p.pending[:idx])
+				p.pending = p.pending[idx+len(emulatedToolCallOpenTag):]
+				p.inCall = true
+				continue
+			}
+			// 结尾可能是标签的前半部分，暂不输出
+			keep := partialSuffixLen(p.pending, emulatedToolCallOpenTag)
+			text.WriteString(p.pending[:len(p.pending)-keep])
+			p.pending = p.pending[len(p.pending)-keep:]
+			break
+		}
+		idx := strings.Index(p.pending, emulatedToolCallCloseTag)
+		if idx < 0 {
+			break
+		}
+		body := p.pending[:idx]
+		p.pending = p.pending[idx+len(emulatedToolCallCloseTag):]
+		p.inCall = false
+		if call, ok := p.parseCall(body); ok {
+			calls = append(calls, call)
+		} else {
+			text.WriteString(emulatedToolCallOpenTag + body + emulatedToolCallCloseTag)
+		}
+	}
+	return p.trimText(text.String()), calls
+}
+
+// flush 输出剩余内容，缺少结束标签的工具调用也尝试解析
+func (p *toolCallTextParser) flush() (string, []dto.ToolCallResponse) {
+	pending := p.pending
+	p.pending = ""
+	if !p.inCall {
+		return p.trimText(pending), nil
+	}
+	p.inCall = false
+	if call, ok := p.parseCall(pending); ok {
+		return "", []dto.ToolCallResponse{call}
+	}
+	return p.trimText(emulatedToolCallOpenTag + pending), nil
+}
+
+// trimText 工具调用之后的空白没有意义，直接丢弃
+func (p *toolCallTextParser) trimText(text string) string {
+	if p.callCount > 0 && strings.TrimSpace(text) == "" {
+		return ""
+	}
+	return text
+}
+
+func (p *toolCallTextParser) parseCall(body string) (dto.ToolCallResponse, bool) {
+	body = strings.TrimSpace(body)
+	body = strings.TrimPrefix(body, "```json")
+	body = strings.TrimPrefix(body, "```")
+	body = strings.TrimSuffix(body, "```")
+	var call struct {
+		Name      string `json:"name"`
+		Arguments any    `json:"arguments"`
+	}
+	if err := common.UnmarshalJsonStr(strings.TrimSpace(body), &call); err != nil || call.Name == "" {
+		return dto.ToolCallResponse{}, false
+	}
+	known := false
+	for _, name := range p.toolNames {
+		if name == call.Name {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return dto.ToolCallResponse{}, false
+	}
+	var arguments string
+	switch args := call.Arguments.(type) {
+	case nil:
+		arguments = "{}"
+	case string:
+		arguments = args
+	default:
+		data, err := common.Marshal(args)
+		if err != nil {
+			return dto.ToolCallResponse{}, false
+		}
+		arguments = string(data)
+	}
+	toolCall := dto.ToolCallResponse{
+		ID:   "call_" + common.GetUUID(),
+		Type: "function",
+		Function: dto.FunctionResponse{
+			Name:      call.Name,
+			Arguments: arguments,
+		},
+	}
+	toolCall.SetIndex(p.callCount)
+	p.callCount++
+	return toolCall, true
+}
+
+// partialSuffixLen 返回 s 的结尾与 tag 开头重合的最大长度
+func partialSuffixLen(s, tag string) int {
+	for n := len(tag) - 1; n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
@@ -75,6 +75,36 @@ func NotifyUser(userId int, userEmail string, userSetting dto.UserSetting, data
 			return nil
 		}
 		return sendGotifyNotify(gotifyUrl, gotifyToken, userSetting.GotifyPriority, data)
+	case dto.NotifyTypeSlack:
+		if userSetting.SlackWebhookUrl == "" {
+			common.SysLog(fmt.Sprintf("user %d has no slack webhook url, skip sending slack", userId))
+			return nil
+		}
+		return sendSlackNotify(userSetting.SlackWebhookUrl, data)
+	case dto.NotifyTypeDiscord:
+		if userSetting.DiscordWebhookUrl == "" {
+			common.SysLog(fmt.Sprintf("user %d has no discord webhook url, skip sending discord", userId))
+			return nil
+		}
+		return sendDiscordNotify(userSetting.DiscordWebhookUrl, data)
+	case dto.NotifyTypeFeishu:
+		if userSetting.FeishuWebhookUrl == "" {
+			common.SysLog(fmt.Sprintf("user %d has no feishu webhook url, skip sending feishu", userId))
+			return nil
+		}
+		return sendFeishuNotify(userSetting.FeishuWebhookUrl, userSetting.FeishuSecret, data)
+	case dto.NotifyTypeDingTalk:
+		if userSetting.DingTalkWebhookUrl == "" {
+			common.SysLog(fmt.Sprintf("user %d has no dingtalk webhook url, skip sending dingtalk", userId))
+			return nil
+		}
+		return sendDingTalkNotify(userSetting.DingTalkWebhookUrl, userSetting.DingTalkSecret, data)
+	case dto.NotifyTypeTelegram:
+		if userSetting.TelegramBotToken == "" || userSetting.TelegramChatId == "" {
+			common.SysLog(fmt.Sprintf("user %d has no telegram bot token or chat id, skip sending telegram", userId))
+			return nil
+		}
+		return sendTelegramNotify(userSetting.TelegramBotToken, userSetting.TelegramChatId, data)
 	}
 	return nil
 }
@@ -9,6 +9,8 @@ import (
 type GlobalSettings struct {
 	PassThroughRequestEnabled bool     `json:"pass_through_request_enabled"`
 	ThinkingModelBlacklist    []string `json:"thinking_model_blacklist"`
+	// 通过系统提示词模拟函数调用的模型，以 * 结尾时按前缀匹配
+	ToolCallEmulationModels []string `json:"tool_call_emulation_models"`
 }
 
 // 默认配置
@@ -18,6 +20,7 @@ var defaultOpenaiSettings = GlobalSettings{
 		"moonshotai/kimi-k2-thinking",
 		"kimi-k2-thinking",
 	},
+	ToolCallEmulationModels: []string{},
 }
 
 // 全局实例
@@ -46,3 +49,23 @@ func ShouldPreserveThinkingSuffix(modelName string) bool {
 	}
 	return false
 }
+
+// ShouldEmulateToolCalls 判断模型是否配置为通过提示词模拟函数调用
+func ShouldEmulateToolCalls(modelName string) bool {
+	target := strings.TrimSpace(modelName)
+	if target == "" {
+		return false
+	}
+
+	for _, entry := range globalSettings.ToolCallEmulationModels {
+		entry = strings.TrimSpace(entry)
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if prefix != "" && strings.HasPrefix(target, prefix) {
+				return true
+			}
+		} else if entry == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// AffiliateRate 各级邀请人的佣金比例，单位为百分比
+type AffiliateRate struct {
+	Level1 float64 `json:"level1"`
+	Level2 float64 `json:"level2"`
+}
+
+type AffiliateSetting struct {
+	CommissionEnabled bool                     `json:"commission_enabled"` // 是否对被邀请用户的充值发放佣金
+	Level1Rate        float64                  `json:"level1_rate"`        // 一级邀请人佣金比例（%）
+	Level2Rate        float64                  `json:"level2_rate"`        // 二级邀请人佣金比例（%）
+	GroupRates        map[string]AffiliateRate `json:"group_rates"`        // 按邀请人分组覆盖佣金比例
+	SettlementDays    int                      `json:"settlement_days"`    // 佣金结算期（天），结算后才可划转
+}
+
+// 默认配置
+var affiliateSetting = AffiliateSetting{
+	CommissionEnabled: false,
+	Level1Rate:        10,
+	Level2Rate:        3,
+	GroupRates:        map[string]AffiliateRate{},
+	SettlementDays:    7,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("affiliate_setting", &affiliateSetting)
+}
+
+func GetAffiliateSetting() *AffiliateSetting {
+	return &affiliateSetting
+}
+
+// GetAffiliateRate 获取指定分组邀请人在某一级别的佣金比例（%）
+func GetAffiliateRate(group string, level int) float64 {
+	rate, ok := affiliateSetting.GroupRates[group]
+	switch level {
+	case 1:
+		if ok {
+			return rate.Level1
+		}
+		return affiliateSetting.Level1Rate
+	case 2:
+		if ok {
+			return rate.Level2
+		}
+		return affiliateSetting.Level2Rate
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	ArtifactBackendLocal = "local"
+	ArtifactBackendS3    = "s3"
+)
+
+type ArtifactSetting struct {
+	Enabled           bool    `json:"enabled"`              // 是否将生成的图片、视频、音频转存到网关
+	MirrorImages      bool    `json:"mirror_images"`        // 是否异步转存图片生成接口返回的 url，响应中保留上游地址
+	Backend           string  `json:"backend"`              // local 或 s3
+	LocalPath         string  `json:"local_path"`           // 本地存储目录
+	S3Endpoint        string  `json:"s3_endpoint"`          // S3 兼容服务地址，如 https://s3.us-east-1.amazonaws.com
+	S3Region          string  `json:"s3_region"`            // 区域
+	S3Bucket          string  `json:"s3_bucket"`            // 存储桶
+	S3AccessKeyId     string  `json:"s3_access_key_id"`     // 访问密钥 ID
+	S3SecretAccessKey string  `json:"s3_secret_access_key"` // 访问密钥
+	S3PathStyle       bool    `json:"s3_path_style"`        // 使用路径风格访问存储桶（MinIO 等需要开启）
+	S3Prefix          string  `json:"s3_prefix"`            // 对象键前缀
+	MaxFileSizeMB     int     `json:"max_file_size_mb"`     // 单个文件大小上限
+	UserQuotaMB       int     `json:"user_quota_mb"`        // 每个用户的存储空间上限，0 为不限制
+	RetentionDays     int     `json:"retention_days"`       // 保留天数，0 为永久保留
+	UrlExpireSeconds  int     `json:"url_expire_seconds"`   // 签名链接有效期
+	BillingEnabled    bool    `json:"billing_enabled"`      // 是否按存储量计费
+	PricePerGB        float64 `json:"price_per_gb"`         // 每 GB 存储费用（美元），在转存时一次性扣除
+}
+
+// 默认配置
+var artifactSetting = ArtifactSetting{
+	Enabled:          false,
+	MirrorImages:     false,
+	Backend:          ArtifactBackendLocal,
+	LocalPath:        "data/artifacts",
+	MaxFileSizeMB:    512,
+	UserQuotaMB:      0,
+	RetentionDays:    30,
+	UrlExpireSeconds: 3600,
+	BillingEnabled:   false,
+	PricePerGB:       0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("artifact_setting", &artifactSetting)
+}
+
+func GetArtifactSetting() *ArtifactSetting {
+	return &artifactSetting
+}
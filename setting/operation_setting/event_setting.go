@@ -0,0 +1,25 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type EventSetting struct {
+	Enabled       bool `json:"enabled"`        // 是否启用事件订阅投递
+	MaxAttempts   int  `json:"max_attempts"`   // 单条投递最大尝试次数，超过后标记为失败
+	RetentionDays int  `json:"retention_days"` // 投递记录保留天数，0 表示不清理
+}
+
+// 默认配置
+var eventSetting = EventSetting{
+	Enabled:       true,
+	MaxAttempts:   8,
+	RetentionDays: 30,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("event_setting", &eventSetting)
+}
+
+func GetEventSetting() *EventSetting {
+	return &eventSetting
+}
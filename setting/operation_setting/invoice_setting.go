@@ -0,0 +1,23 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type InvoiceSetting struct {
+	AutoGenerateEnabled bool `json:"auto_generate_enabled"` // 每月初自动为后付费用户生成上月账单
+	AutoIssueEnabled    bool `json:"auto_issue_enabled"`    // 自动生成的账单直接出账，否则保存为草稿
+}
+
+// 默认配置
+var invoiceSetting = InvoiceSetting{
+	AutoGenerateEnabled: true,
+	AutoIssueEnabled:    false,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("invoice_setting", &invoiceSetting)
+}
+
+func GetInvoiceSetting() *InvoiceSetting {
+	return &invoiceSetting
+}
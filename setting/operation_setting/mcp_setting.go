@@ -0,0 +1,67 @@
+package operation_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+type MCPServer struct {
+	Label       string            `json:"label"`       // 客户端通过 server_label 引用
+	URL         string            `json:"url"`         // 服务地址
+	Transport   string            `json:"transport"`   // streamable_http（默认）或 sse
+	Headers     map[string]string `json:"headers"`     // 固定请求头，如鉴权信息
+	Description string            `json:"description"` // 服务说明，会提供给模型
+}
+
+type MCPSetting struct {
+	Enabled            bool        `json:"enabled"`              // 是否由网关执行请求中 type 为 mcp 的工具
+	Servers            []MCPServer `json:"servers"`              // 预置服务，客户端只需填写 server_label
+	AllowedServerURLs  []string    `json:"allowed_server_urls"`  // 允许客户端通过 server_url 指定的地址前缀，为空时只能使用预置服务
+	MaxIterations      int         `json:"max_iterations"`       // 单次请求最多调用模型的轮数
+	ToolTimeoutSeconds int         `json:"tool_timeout_seconds"` // 连接服务、列出工具、调用工具的超时时间
+	MaxOutputKB        int         `json:"max_output_kb"`        // 单次工具结果的长度上限，超过部分截断
+}
+
+// 默认配置
+var mcpSetting = MCPSetting{
+	Enabled:            false,
+	Servers:            []MCPServer{},
+	AllowedServerURLs:  []string{},
+	MaxIterations:      8,
+	ToolTimeoutSeconds: 60,
+	MaxOutputKB:        64,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("mcp_setting", &mcpSetting)
+}
+
+func GetMCPSetting() *MCPSetting {
+	return &mcpSetting
+}
+
+// FindServer 按 label 查找预置服务
+func (s *MCPSetting) FindServer(label string) *MCPServer {
+	for i := range s.Servers {
+		if s.Servers[i].Label == label {
+			return &s.Servers[i]
+		}
+	}
+	return nil
+}
+
+// IsServerURLAllowed 客户端指定的服务地址是否在允许的前缀内，
+// 前缀不以 / 结尾时需在路径边界处匹配，避免 https://a.com 匹配到 https://a.com.evil.com
+func (s *MCPSetting) IsServerURLAllowed(url string) bool {
+	for _, prefix := range s.AllowedServerURLs {
+		if prefix == "" || !strings.HasPrefix(url, prefix) {
+			continue
+		}
+		if len(url) == len(prefix) || strings.HasSuffix(prefix, "/") || strings.ContainsRune("/?#", rune(url[len(prefix)])) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type ResponseStoreSetting struct {
+	Enabled       bool `json:"enabled"`         // 是否由网关保存 Responses API 的响应，并展开 previous_response_id
+	TTLHours      int  `json:"ttl_hours"`       // 保存时长，0 表示永久保留
+	MaxResponseKB int  `json:"max_response_kb"` // 单条记录（输入与响应合计）大小上限，超过不保存
+	UserStorageMB int  `json:"user_storage_mb"` // 每个用户的保存空间上限，超过时淘汰最早的记录，0 表示不限制
+}
+
+// 默认配置
+var responseStoreSetting = ResponseStoreSetting{
+	Enabled:       false,
+	TTLHours:      720,
+	MaxResponseKB: 4096,
+	UserStorageMB: 100,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("response_store_setting", &responseStoreSetting)
+}
+
+func GetResponseStoreSetting() *ResponseStoreSetting {
+	return &responseStoreSetting
+}
@@ -0,0 +1,25 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type TaskCancelSetting struct {
+	Enabled               bool    `json:"enabled"`                  // 是否允许用户取消未完成的任务
+	QueuedRefundRatio     float64 `json:"queued_refund_ratio"`      // 排队中（尚未开始生成）的任务取消后退还的额度比例
+	InProgressRefundRatio float64 `json:"in_progress_refund_ratio"` // 生成中的任务取消后退还的额度比例
+}
+
+// 默认配置
+var taskCancelSetting = TaskCancelSetting{
+	Enabled:               true,
+	QueuedRefundRatio:     1,
+	InProgressRefundRatio: 0.5,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_cancel_setting", &taskCancelSetting)
+}
+
+func GetTaskCancelSetting() *TaskCancelSetting {
+	return &taskCancelSetting
+}
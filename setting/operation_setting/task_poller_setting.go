@@ -0,0 +1,79 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type TaskPollerSetting struct {
+	DefaultInterval    int            `json:"default_interval"`     // 默认轮询间隔（秒）
+	PlatformIntervals  map[string]int `json:"platform_intervals"`   // 各平台轮询间隔（秒），key 为任务平台，如 suno、mj 或视频渠道类型
+	BackoffAfter       int            `json:"backoff_after"`        // 任务运行超过该时长（秒）后，每多运行一个周期轮询间隔翻倍，0 表示不退避
+	MaxInterval        int            `json:"max_interval"`         // 退避后的最大轮询间隔（秒）
+	ChannelConcurrency int            `json:"channel_concurrency"`  // 单个渠道同时进行的查询请求数
+	MaxChannels        int            `json:"max_channels"`         // 单个节点同时轮询的渠道数
+	BatchSize          int            `json:"batch_size"`           // 支持批量查询的平台单次查询的任务数
+	LeaseSeconds       int            `json:"lease_seconds"`        // 节点心跳及渠道租约有效期（秒）
+	DefaultTaskTimeout int            `json:"default_task_timeout"` // 任务最长存活时间（秒），超时未完成的任务标记为失败并退还额度，0 表示不限制
+	PlatformTimeouts   map[string]int `json:"platform_timeouts"`    // 各平台任务最长存活时间（秒），key 同 platform_intervals
+}
+
+// 默认配置
+var taskPollerSetting = TaskPollerSetting{
+	DefaultInterval: 15,
+	PlatformIntervals: map[string]int{
+		"suno": 15,
+		"mj":   15,
+	},
+	BackoffAfter:       600,
+	MaxInterval:        120,
+	ChannelConcurrency: 4,
+	MaxChannels:        16,
+	BatchSize:          100,
+	LeaseSeconds:       60,
+	DefaultTaskTimeout: 7200,
+	PlatformTimeouts: map[string]int{
+		"mj": 3600,
+	},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_poller_setting", &taskPollerSetting)
+}
+
+func GetTaskPollerSetting() *TaskPollerSetting {
+	return &taskPollerSetting
+}
+
+// GetTaskPollInterval 根据平台及任务已运行时长计算下一次轮询的间隔（秒）
+func GetTaskPollInterval(platform string, elapsed int64) int64 {
+	interval := int64(taskPollerSetting.DefaultInterval)
+	if v, ok := taskPollerSetting.PlatformIntervals[platform]; ok && v > 0 {
+		interval = int64(v)
+	}
+	if interval <= 0 {
+		interval = 15
+	}
+	backoffAfter := int64(taskPollerSetting.BackoffAfter)
+	if backoffAfter <= 0 || elapsed < backoffAfter {
+		return interval
+	}
+	maxInterval := int64(taskPollerSetting.MaxInterval)
+	if maxInterval < interval {
+		return interval
+	}
+	steps := elapsed / backoffAfter
+	for i := int64(0); i < steps && interval < maxInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval
+}
+
+// GetTaskTimeout 获取平台任务最长存活时间（秒），0 表示不限制
+func GetTaskTimeout(platform string) int64 {
+	if v, ok := taskPollerSetting.PlatformTimeouts[platform]; ok {
+		return int64(v)
+	}
+	return int64(taskPollerSetting.DefaultTaskTimeout)
+}
@@ -0,0 +1,67 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// LDAPGroupMapping LDAP 分组到用户分组与角色的映射，Group 可填分组 DN 或 CN，按顺序匹配，后匹配的非空项覆盖先匹配的
+type LDAPGroupMapping struct {
+	Group     string `json:"group"`
+	UserGroup string `json:"user_group"`
+	Role      int    `json:"role"`
+}
+
+type LDAPSettings struct {
+	Enabled bool `json:"enabled"`
+	// Url 形如 ldap://host:389 或 ldaps://host:636
+	Url                string `json:"url"`
+	StartTLS           bool   `json:"start_tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	// BindDN / BindPassword 用于搜索用户的服务账号，留空时匿名搜索
+	BindDN       string `json:"bind_dn"`
+	BindPassword string `json:"bind_password"`
+	BaseDN       string `json:"base_dn"`
+	// UserFilter 搜索用户的过滤器，{username} 替换为转义后的登录名，
+	// OpenLDAP 常用 (uid={username})，Active Directory 常用 (sAMAccountName={username})
+	UserFilter           string `json:"user_filter"`
+	UsernameAttribute    string `json:"username_attribute"`
+	EmailAttribute       string `json:"email_attribute"`
+	DisplayNameAttribute string `json:"display_name_attribute"`
+	// IdAttribute 用户的稳定标识属性，如 entryUUID、objectGUID，留空时使用 DN
+	IdAttribute string `json:"id_attribute"`
+	// GroupAttribute 用户条目上的分组属性，如 memberOf
+	GroupAttribute string `json:"group_attribute"`
+	// GroupBaseDN / GroupFilter 额外搜索分组，适用于未启用 memberOf 的 OpenLDAP；{dn} 与 {username} 会被替换
+	GroupBaseDN string `json:"group_base_dn"`
+	GroupFilter string `json:"group_filter"`
+	// RequiredGroups 非空时只有属于其中任一分组的用户可以登录
+	RequiredGroups []string           `json:"required_groups"`
+	GroupMappings  []LDAPGroupMapping `json:"group_mappings"`
+	// AutoProvision 首次登录时自动创建用户
+	AutoProvision bool `json:"auto_provision"`
+	// SyncOnLogin 每次登录时按分组映射同步用户分组与角色
+	SyncOnLogin bool `json:"sync_on_login"`
+	Timeout     int  `json:"timeout"` // 秒
+}
+
+// 默认配置
+var defaultLDAPSettings = LDAPSettings{
+	UserFilter:           "(uid={username})",
+	UsernameAttribute:    "uid",
+	EmailAttribute:       "mail",
+	DisplayNameAttribute: "cn",
+	GroupAttribute:       "memberOf",
+	GroupFilter:          "(|(member={dn})(uniqueMember={dn})(memberUid={username}))",
+	RequiredGroups:       []string{},
+	GroupMappings:        []LDAPGroupMapping{},
+	AutoProvision:        true,
+	SyncOnLogin:          true,
+	Timeout:              10,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("ldap", &defaultLDAPSettings)
+}
+
+func GetLDAPSettings() *LDAPSettings {
+	return &defaultLDAPSettings
+}
@@ -0,0 +1,20 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// LegacyAccessTokenSettings 旧版 access token 拥有用户全部权限且不会过期，已由管理密钥取代，默认停用
+type LegacyAccessTokenSettings struct {
+	Enabled bool `json:"enabled"`
+}
+
+// 默认配置
+var defaultLegacyAccessTokenSettings = LegacyAccessTokenSettings{}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("legacy_access_token", &defaultLegacyAccessTokenSettings)
+}
+
+func GetLegacyAccessTokenSettings() *LegacyAccessTokenSettings {
+	return &defaultLegacyAccessTokenSettings
+}
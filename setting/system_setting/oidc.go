@@ -1,6 +1,59 @@
 package system_setting
 
-import "github.com/QuantumNous/new-api/setting/config"
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// OIDCClaimRule 按 ID Token / UserInfo 声明匹配用户。
+// Claim 支持 a.b 形式的嵌套字段，另有 email_domain 表示邮箱域名；
+// 声明为数组时任一元素匹配即可，Value 为 "*" 时匹配任意非空值
+type OIDCClaimRule struct {
+	Claim string `json:"claim"`
+	Value string `json:"value"`
+}
+
+// OIDCClaimMapping 声明匹配时设置的分组、角色与注册时的初始额度。
+// 按顺序匹配，后匹配的非空项覆盖先匹配的
+type OIDCClaimMapping struct {
+	Claim string `json:"claim"`
+	Value string `json:"value"`
+	Group string `json:"group"`
+	Role  int    `json:"role"`
+	Quota int    `json:"quota"`
+}
+
+// OIDCProvisioning OIDC 用户的注册准入与分组、角色映射规则
+type OIDCProvisioning struct {
+	// AllowRules 非空时只有匹配任一规则的用户可以注册
+	AllowRules []OIDCClaimRule `json:"allow_rules"`
+	// DenyRules 匹配任一规则的用户不能注册
+	DenyRules []OIDCClaimRule    `json:"deny_rules"`
+	Mappings  []OIDCClaimMapping `json:"mappings"`
+	// SyncOnLogin 每次登录时重新校验准入规则并按映射同步分组与角色，无映射匹配时恢复为默认分组与普通用户
+	SyncOnLogin bool `json:"sync_on_login"`
+	// LinkScimUsers 首次登录时按已验证的邮箱绑定 SCIM 预先同步的用户，只应对与 SCIM 同源、可信的提供方开启
+	LinkScimUsers bool `json:"link_scim_users"`
+}
+
+// OIDCProvider 额外的 OIDC 提供方，与默认提供方并列
+type OIDCProvider struct {
+	Slug                  string           `json:"slug"`
+	Name                  string           `json:"name"`
+	Enabled               bool             `json:"enabled"`
+	ClientId              string           `json:"client_id"`
+	ClientSecret          string           `json:"client_secret"`
+	WellKnown             string           `json:"well_known"`
+	AuthorizationEndpoint string           `json:"authorization_endpoint"`
+	TokenEndpoint         string           `json:"token_endpoint"`
+	UserInfoEndpoint      string           `json:"user_info_endpoint"`
+	Scopes                string           `json:"scopes"`
+	Provisioning          OIDCProvisioning `json:"provisioning"`
+}
 
 type OIDCSettings struct {
 	Enabled               bool   `json:"enabled"`
@@ -10,10 +63,18 @@ type OIDCSettings struct {
 	AuthorizationEndpoint string `json:"authorization_endpoint"`
 	TokenEndpoint         string `json:"token_endpoint"`
 	UserInfoEndpoint      string `json:"user_info_endpoint"`
+	// Provisioning 默认提供方的注册与映射规则
+	Provisioning OIDCProvisioning `json:"provisioning"`
+	// Providers 额外的提供方，用户的 OIDC ID 记为 slug:sub 以免不同提供方的 sub 冲突
+	Providers []OIDCProvider `json:"providers"`
 }
 
 // 默认配置
-var defaultOIDCSettings = OIDCSettings{}
+var defaultOIDCSettings = OIDCSettings{
+	Providers: []OIDCProvider{},
+}
+
+var oidcProviderSlugRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
 
 func init() {
 	// 注册到全局配置管理器
@@ -23,3 +84,92 @@ func init() {
 func GetOIDCSettings() *OIDCSettings {
 	return &defaultOIDCSettings
 }
+
+// GetOIDCProvider 按 slug 获取提供方，slug 为空时返回由全局 OIDC 设置构成的默认提供方
+func GetOIDCProvider(slug string) *OIDCProvider {
+	settings := GetOIDCSettings()
+	if slug == "" {
+		return &OIDCProvider{
+			Name:                  "OIDC",
+			Enabled:               settings.Enabled,
+			ClientId:              settings.ClientId,
+			ClientSecret:          settings.ClientSecret,
+			WellKnown:             settings.WellKnown,
+			AuthorizationEndpoint: settings.AuthorizationEndpoint,
+			TokenEndpoint:         settings.TokenEndpoint,
+			UserInfoEndpoint:      settings.UserInfoEndpoint,
+			Provisioning:          settings.Provisioning,
+		}
+	}
+	for i := range settings.Providers {
+		if settings.Providers[i].Slug == slug {
+			provider := settings.Providers[i]
+			return &provider
+		}
+	}
+	return nil
+}
+
+// OidcId 用户在该提供方下的 OIDC ID，默认提供方保持原始 sub 以兼容已绑定的用户
+func (provider *OIDCProvider) OidcId(sub string) string {
+	if provider.Slug == "" {
+		return sub
+	}
+	return provider.Slug + ":" + sub
+}
+
+func validateOIDCProvisioning(provisioning *OIDCProvisioning) error {
+	rules := append(append([]OIDCClaimRule{}, provisioning.AllowRules...), provisioning.DenyRules...)
+	for _, rule := range rules {
+		if rule.Claim == "" || rule.Value == "" {
+			return fmt.Errorf("准入规则的声明与值不能为空")
+		}
+	}
+	for _, mapping := range provisioning.Mappings {
+		if mapping.Claim == "" || mapping.Value == "" {
+			return fmt.Errorf("映射规则的声明与值不能为空")
+		}
+		if mapping.Role != 0 && mapping.Role != common.RoleCommonUser && mapping.Role != common.RoleResellerUser && mapping.Role != common.RoleAdminUser {
+			return fmt.Errorf("映射规则的角色无效: %d", mapping.Role)
+		}
+		if mapping.Quota < 0 {
+			return fmt.Errorf("映射规则的初始额度不能为负数")
+		}
+	}
+	return nil
+}
+
+// ValidateOIDCProvisioning 校验 oidc.provisioning 配置
+func ValidateOIDCProvisioning(value string) error {
+	var provisioning OIDCProvisioning
+	if err := json.Unmarshal([]byte(value), &provisioning); err != nil {
+		return fmt.Errorf("OIDC 映射规则格式错误: %w", err)
+	}
+	return validateOIDCProvisioning(&provisioning)
+}
+
+// ValidateOIDCProviders 校验 oidc.providers 配置
+func ValidateOIDCProviders(value string) error {
+	var providers []OIDCProvider
+	if err := json.Unmarshal([]byte(value), &providers); err != nil {
+		return fmt.Errorf("OIDC 提供方格式错误: %w", err)
+	}
+	slugs := make(map[string]bool)
+	for i := range providers {
+		provider := &providers[i]
+		if !oidcProviderSlugRegex.MatchString(provider.Slug) {
+			return fmt.Errorf("OIDC 提供方标识无效: %q，只能包含小写字母、数字、- 和 _", provider.Slug)
+		}
+		if slugs[provider.Slug] {
+			return fmt.Errorf("OIDC 提供方标识重复: %s", provider.Slug)
+		}
+		slugs[provider.Slug] = true
+		if provider.Enabled && (provider.ClientId == "" || provider.TokenEndpoint == "" || provider.UserInfoEndpoint == "" || provider.AuthorizationEndpoint == "") {
+			return fmt.Errorf("OIDC 提供方 %s 缺少 Client Id 或端点配置", provider.Slug)
+		}
+		if err := validateOIDCProvisioning(&provider.Provisioning); err != nil {
+			return fmt.Errorf("OIDC 提供方 %s: %w", provider.Slug, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ScimSettings SCIM 2.0 用户与分组同步，IdP 使用独立的 Bearer 密钥访问 /scim/v2
+type ScimSettings struct {
+	Enabled bool   `json:"enabled"`
+	Token   string `json:"token"`
+	// RoleGroups SCIM 分组名到用户角色的映射，例如 {"new-api-admins": 10}；
+	// 未在此配置的分组按同名的用户分组处理
+	RoleGroups map[string]int `json:"role_groups"`
+}
+
+// 默认配置
+var defaultScimSettings = ScimSettings{
+	RoleGroups: map[string]int{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("scim", &defaultScimSettings)
+}
+
+func GetScimSettings() *ScimSettings {
+	return &defaultScimSettings
+}